@@ -0,0 +1,139 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+
+	"gommutetime/internal/apperr"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3";
+// otherwise the module version from the build info is used
+var version = ""
+
+// configExample is the annotated example config
+//
+//go:embed config.example.yaml
+var configExample []byte
+
+// webAssets is the Streamlit dashboard, extracted by the dashboard command
+//
+//go:embed web/dashboard.py web/requirements.txt
+var webAssets embed.FS
+
+func runVersion(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	fs.Parse(args)
+
+	fmt.Printf("gommutetime %s\n", currentVersion())
+
+	// Source control details are recorded when built from a checkout
+	info, ok := debug.ReadBuildInfo()
+	settings := map[string]string{}
+	if ok {
+		for _, s := range info.Settings {
+			settings[s.Key] = s.Value
+		}
+	}
+	if revision := settings["vcs.revision"]; revision != "" {
+		if settings["vcs.modified"] == "true" {
+			revision += " (modified)"
+		}
+		fmt.Printf("  commit  %s\n", revision)
+	}
+	if built := settings["vcs.time"]; built != "" {
+		fmt.Printf("  date    %s\n", built)
+	}
+	fmt.Printf("  go      %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// currentVersion returns the version set at build time, or else the module
+// version, or "dev"
+func currentVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+func runDashboard(args []string) {
+	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	port := fs.Int("port", 8050, "Port to serve the dashboard on")
+	dir := fs.String("dir", "", "Extract the dashboard to this directory without starting it")
+	fs.Parse(args)
+
+	if *dir != "" {
+		if err := extractDashboard(*dir); err != nil {
+			fatal("Failed to extract dashboard", err)
+		}
+		fmt.Printf("Extracted dashboard to %s\n", *dir)
+		return
+	}
+
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		cache = os.TempDir()
+	}
+	target := filepath.Join(cache, "gommutetime", "dashboard")
+	// Refreshed on every start so an upgraded binary serves its own version
+	if err := extractDashboard(target); err != nil {
+		fatal("Failed to extract dashboard", err)
+	}
+
+	streamlit, err := exec.LookPath("streamlit")
+	if err != nil {
+		fatal("Streamlit not found", apperr.Wrap(apperr.KindConfig,
+			fmt.Errorf("install it with: pip install -r %s", filepath.Join(target, "requirements.txt"))))
+	}
+	configAbs, err := filepath.Abs(*configPath)
+	if err != nil {
+		fatal("Invalid config path", apperr.Wrap(apperr.KindConfig, err))
+	}
+
+	// The dashboard reads the data directory relative to the config file
+	cmd := exec.Command(streamlit, "run", filepath.Join(target, "dashboard.py"),
+		fmt.Sprintf("--server.port=%d", *port), "--", configAbs)
+	cmd.Dir = filepath.Dir(configAbs)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.ExitCode())
+		}
+		fatal("Failed to start dashboard", err)
+	}
+}
+
+// extractDashboard writes the embedded dashboard files to dir
+func extractDashboard(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return apperr.Wrap(apperr.KindStorage, err)
+	}
+	return fs.WalkDir(webAssets, "web", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := webAssets.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(path)), data, 0644); err != nil {
+			return apperr.Wrap(apperr.KindStorage, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gommutetime/internal/config"
+)
+
+func runCompletion(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Error: usage: gommutetime completion bash|zsh|fish")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(os.Stdout)
+	case "zsh":
+		writeZshCompletion(os.Stdout)
+	case "fish":
+		writeFishCompletion(os.Stdout)
+	default:
+		fmt.Printf("Error: unsupported shell: %s (expected bash, zsh or fish)\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// listItineraries prints the itinerary IDs of a config for shell completion
+func listItineraries(args []string) {
+	cfg := completionConfig("__itineraries", args)
+	if cfg == nil {
+		return
+	}
+	for _, itin := range cfg.Itineraries {
+		fmt.Println(itin.ID)
+	}
+}
+
+// listProfiles prints the profile names of a config for shell completion
+func listProfiles(args []string) {
+	cfg := completionConfig("__profiles", args)
+	if cfg == nil {
+		return
+	}
+	for _, p := range cfg.Profiles {
+		fmt.Println(p.Name)
+	}
+}
+
+// completionConfig loads the config named by a -config argument, if any.
+// Errors are silent so a missing config simply completes nothing.
+func completionConfig(name string, args []string) *config.Config {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	if fs.Parse(args) != nil {
+		return nil
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return nil
+	}
+	return cfg
+}
+
+// writeBashCompletion writes a bash completion script
+func writeBashCompletion(w io.Writer) {
+	fmt.Fprintln(w, `# bash completion for gommutetime
+# Load with: source <(gommutetime completion bash)
+
+# Lists itineraries or profiles from the config given with -config
+_gommutetime_list() {
+    local config="" i
+    for ((i = 2; i < COMP_CWORD; i++)); do
+        if [[ ${COMP_WORDS[i]} == -config ]]; then
+            config=${COMP_WORDS[i+1]}
+        fi
+    done
+    gommutetime __$1 ${config:+-config "$config"} 2>/dev/null
+}
+
+_gommutetime() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    local prev=${COMP_WORDS[COMP_CWORD-1]}
+
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "`+strings.Join(commandNames(), " ")+`" -- "$cur"))
+        return
+    fi
+
+    case "${COMP_WORDS[1]}:$prev" in`)
+
+	// Option values
+	for _, c := range commandDocs {
+		for _, o := range c.options {
+			if o.complete == "" {
+				continue
+			}
+			fmt.Fprintf(w, "        %s:-%s)\n", c.name, o.name)
+			switch o.complete {
+			case "file":
+				fmt.Fprintln(w, `            COMPREPLY=($(compgen -f -- "$cur"))`)
+			case "itinerary":
+				fmt.Fprintln(w, `            COMPREPLY=($(compgen -W "$(_gommutetime_list itineraries)" -- "$cur"))`)
+			case "profile":
+				fmt.Fprintln(w, `            COMPREPLY=($(compgen -W "$(_gommutetime_list profiles)" -- "$cur"))`)
+			default:
+				fmt.Fprintf(w, "            COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", o.complete)
+			}
+			fmt.Fprintln(w, "            return ;;")
+		}
+	}
+	// Subcommands
+	for _, c := range commandDocs {
+		if c.sub != "" {
+			fmt.Fprintf(w, "        %s:%s)\n            COMPREPLY=($(compgen -W %q -- \"$cur\"))\n            return ;;\n", c.name, c.name, strings.Join(c.subs(), " "))
+		}
+	}
+	fmt.Fprintln(w, `        completion:completion)
+            COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+            return ;;
+    esac
+
+    [[ $cur == -* ]] || return
+
+    case ${COMP_WORDS[1]} in`)
+
+	// Option names
+	for _, c := range commandDocs {
+		if len(c.options) == 0 {
+			continue
+		}
+		names := make([]string, len(c.options))
+		for i, o := range c.options {
+			names[i] = "-" + o.name
+		}
+		fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", c.name, strings.Join(names, " "))
+	}
+
+	fmt.Fprintln(w, `    esac
+}
+
+complete -o default -F _gommutetime gommutetime`)
+}
+
+// writeZshCompletion writes a zsh completion script
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprintln(w, `#compdef gommutetime
+# Load with: gommutetime completion zsh > "${fpath[1]}/_gommutetime"
+
+# Lists itineraries or profiles from the config given with -config
+_gommutetime_list() {
+    local config i
+    for (( i = 1; i < CURRENT; i++ )); do
+        [[ $words[i] == -config ]] && config=$words[i+1]
+    done
+    local -a names
+    names=(${(f)"$(gommutetime __$1 ${config:+-config $config} 2>/dev/null)"})
+    compadd -a names
+}
+
+_gommutetime() {
+    if (( CURRENT == 2 )); then
+        local -a commands
+        commands=(`)
+
+	for _, c := range commandDocs {
+		fmt.Fprintf(w, "            %s\n", zshQuote(c.name+":"+c.summary))
+	}
+
+	fmt.Fprintln(w, `        )
+        _describe command commands
+        return
+    fi
+
+    local cmd=$words[2]
+    shift words
+    (( CURRENT-- ))
+
+    case $cmd in`)
+
+	for _, c := range commandDocs {
+		var specs []string
+		for _, o := range c.options {
+			spec := "-" + o.name + "[" + zshEscape(o.usage) + "]"
+			if o.arg != "" {
+				switch o.complete {
+				case "file":
+					spec += ":file:_files"
+				case "itinerary":
+					spec += ":itinerary:_gommutetime_list itineraries"
+				case "profile":
+					spec += ":profile:_gommutetime_list profiles"
+				case "":
+					spec += ":" + o.arg + ": "
+				default:
+					spec += ":" + o.arg + ":(" + o.complete + ")"
+				}
+			}
+			specs = append(specs, zshQuote(spec))
+		}
+		switch {
+		case c.sub != "":
+			specs = append([]string{zshQuote("1:subcommand:(" + strings.Join(c.subs(), " ") + ")")}, specs...)
+		case c.files:
+			specs = append(specs, zshQuote("*:file:_files"))
+		case c.name == "completion":
+			specs = append(specs, zshQuote("1:shell:(bash zsh fish)"))
+		}
+		if len(specs) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "        %s)\n            _arguments \\\n                %s ;;\n", c.name, strings.Join(specs, " \\\n                "))
+	}
+
+	fmt.Fprintln(w, `    esac
+}
+
+_gommutetime "$@"`)
+}
+
+// writeFishCompletion writes a fish completion script
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintln(w, `# fish completion for gommutetime
+# Load with: gommutetime completion fish > ~/.config/fish/completions/gommutetime.fish
+
+# Lists itineraries or profiles from the config given with -config
+function __gommutetime_list
+    set -l tokens (commandline -opc)
+    set -l config
+    if set -l i (contains -i -- -config $tokens)
+        set config -config $tokens[(math $i + 1)]
+    end
+    gommutetime __$argv[1] $config 2>/dev/null
+end
+
+complete -c gommutetime -f`)
+
+	for _, c := range commandDocs {
+		fmt.Fprintf(w, "complete -c gommutetime -n __fish_use_subcommand -a %s -d %s\n", c.name, fishQuote(c.summary))
+	}
+
+	for _, c := range commandDocs {
+		cond := "'__fish_seen_subcommand_from " + c.name + "'"
+		for _, o := range c.options {
+			line := fmt.Sprintf("complete -c gommutetime -n %s -o %s", cond, o.name)
+			if o.arg != "" {
+				switch o.complete {
+				case "file":
+					line += " -r -F"
+				case "itinerary":
+					line += " -x -a '(__gommutetime_list itineraries)'"
+				case "profile":
+					line += " -x -a '(__gommutetime_list profiles)'"
+				case "":
+					line += " -x"
+				default:
+					line += " -x -a " + fishQuote(o.complete)
+				}
+			}
+			fmt.Fprintf(w, "%s -d %s\n", line, fishQuote(o.usage))
+		}
+		switch {
+		case c.sub != "":
+			subs := strings.Join(c.subs(), " ")
+			fmt.Fprintf(w, "complete -c gommutetime -n %s -x -a %s\n", fishQuote("__fish_seen_subcommand_from "+c.name+"; and not __fish_seen_subcommand_from "+subs), fishQuote(subs))
+		case c.files:
+			fmt.Fprintf(w, "complete -c gommutetime -n %s -F\n", cond)
+		case c.name == "completion":
+			fmt.Fprintf(w, "complete -c gommutetime -n %s -x -a 'bash zsh fish'\n", cond)
+		}
+	}
+}
+
+// zshQuote single-quotes s for zsh
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// zshEscape escapes characters that are special in _arguments descriptions
+func zshEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(s)
+}
+
+// fishQuote single-quotes s for fish
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
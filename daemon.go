@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"gommutetime/internal/api"
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/audit"
+	"gommutetime/internal/backup"
+	"gommutetime/internal/clock"
+	"gommutetime/internal/config"
+	"gommutetime/internal/cost"
+	"gommutetime/internal/events"
+	"gommutetime/internal/feed"
+	"gommutetime/internal/fetcher"
+	"gommutetime/internal/gaps"
+	"gommutetime/internal/heartbeat"
+	"gommutetime/internal/jobhistory"
+	"gommutetime/internal/latest"
+	"gommutetime/internal/notify"
+	"gommutetime/internal/outbox"
+	"gommutetime/internal/plugin"
+	"gommutetime/internal/reporting"
+	"gommutetime/internal/rollup"
+	"gommutetime/internal/scheduler"
+	"gommutetime/internal/sequence"
+	"gommutetime/internal/series"
+	"gommutetime/internal/sheets"
+	"gommutetime/internal/statsd"
+	"gommutetime/internal/statuspage"
+	"gommutetime/internal/stream"
+	"gommutetime/internal/tenant"
+	"gommutetime/internal/watcher"
+)
+
+// scheduleOptions are the schedule command flags applied to every config
+type scheduleOptions struct {
+	skipProbe bool
+	readOnly  bool
+	simulate  bool
+	profile   string
+	tags      string
+	// strict refuses configs with warnings, at startup and on reloads
+	strict bool
+}
+
+// prepare applies the flags to a loaded config and validates it
+func (o scheduleOptions) prepare(cfg *config.Config) error {
+	if o.readOnly {
+		cfg.ReadOnly = true
+	}
+	if o.simulate {
+		cfg.Simulate = true
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := selectItineraries(cfg, o.profile, o.tags); err != nil {
+		return err
+	}
+	warnings := cfg.Warnings()
+	for _, warning := range warnings {
+		log.Printf("Warning: %s", warning)
+	}
+	if o.strict && len(warnings) > 0 {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("%d warnings in strict mode", len(warnings)))
+	}
+
+	return nil
+}
+
+// daemon schedules the itineraries of one config file and reloads them
+// when the file changes
+type daemon struct {
+	name  string // tenant name, empty when running a single config
+	sched *scheduler.Scheduler
+	fetch *fetcher.Fetcher
+	audit *audit.Log
+	// sequences numbers the samples published to the event bus
+	sequences *sequence.Counter
+}
+
+// startDaemon creates the fetcher, notifier and scheduler for a prepared
+// config and starts scheduling. dailyRequests caps the route lookups made
+// per day, zero for no limit. Reloaded configs must keep the data directory
+// of the tenant apart from the others in isolation.
+func startDaemon(ctx context.Context, name, configPath string, cfg *config.Config, opts scheduleOptions, dailyRequests int,
+	isolation *tenant.Isolation) (*daemon, error) {
+	// Create fetcher
+	dataDir := cfg.DataDir
+	if cfg.ReadOnly {
+		log.Println("Read-only mode: results will not be written to disk")
+		dataDir = ""
+	}
+
+	var fetch *fetcher.Fetcher
+	var err error
+	if cfg.Simulate {
+		log.Println("Simulation mode: recording synthetic commute times, no API calls are made")
+		fetch, err = fetcher.NewWithProvider(fetcher.NewSimulated(), dataDir)
+	} else {
+		fetch, err = fetcher.New(cfg.API, dataDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fetcher: %w", err)
+	}
+	fetch.SetDailyQuota(dailyRequests)
+	fetch.SetBatching(cfg.Storage.FlushInterval(), cfg.Storage.BatchSize)
+	fetch.SetSharing(cfg.API.Share())
+	if err := fetch.SetCache(cfg.CacheDir(), cfg.API.Cache()); err != nil {
+		return nil, err
+	}
+	if err := setProviders(fetch, cfg); err != nil {
+		return nil, err
+	}
+
+	// Verify the API key before scheduling anything
+	if !opts.skipProbe && !cfg.Simulate {
+		if err := probeAPIKey(fetch, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create notification manager
+	notifier, err := notify.New(cfg)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to create notifier: %w", err))
+	}
+
+	// Create the Google Sheets exporter
+	exporter, err := sheets.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create and start scheduler
+	sched, err := scheduler.New(cfg, fetch, notifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scheduler: %w", err)
+	}
+
+	// Send the metrics of each fetch to StatsD
+	statsdEmitter := statsd.New(cfg)
+	sched.OnJob(statsdEmitter.Job)
+
+	// Keep the latest job runs for debugging scheduling problems
+	jobRuns := jobhistory.New(cfg)
+	sched.OnJob(jobRuns.Job)
+
+	// Publish samples, job outcomes and alerts for the writers and
+	// integrations subscribed to them
+	bus := events.New()
+	sequences := sequence.New(cfg)
+	bus.NumberWith(sequences)
+	sched.PublishTo(bus)
+	notifier.PublishTo(bus)
+	bus.Subscribe(exporter.Record, events.SampleRecorded)
+
+	// Keep the aggregate series up to date
+	seriesWriter := series.New(cfg)
+	bus.Subscribe(seriesWriter.Record, events.SampleRecorded)
+
+	// Ping the dead man's switches
+	pinger := heartbeat.New(cfg)
+	bus.Subscribe(pinger.Success, events.JobSucceeded)
+
+	// Report itineraries that keep failing
+	bus.Subscribe(reporting.JobFailed, events.JobFailed)
+
+	// Send events to the external plugins
+	plugins := plugin.New(ctx, cfg)
+	bus.Subscribe(plugins.Handle)
+
+	// Publish samples and alerts to Kafka and NATS
+	streams := stream.New(ctx, cfg)
+	bus.Subscribe(streams.Handle, events.SampleRecorded, events.AlertFired)
+
+	// Retry the alerts and stream messages that failed to be delivered
+	outboxes := outbox.New(cfg)
+	notifier.RetryWith(outboxes)
+	streams.RetryWith(outboxes)
+	go outboxes.Run(ctx)
+
+	// Keep the latest sample of each itinerary in Redis
+	latestWriter := latest.New(ctx, cfg)
+	bus.Subscribe(latestWriter.Record, events.SampleRecorded)
+
+	// Keep alerts and daily summaries for the RSS and Atom feeds
+	feedRecorder := feed.New(cfg)
+	bus.Subscribe(feedRecorder.Record, events.AlertFired)
+	go feedRecorder.Run(ctx)
+	go exporter.Run(ctx)
+
+	// Make the scheduled backups
+	backups := backup.NewJob(configPath, cfg)
+	go backups.Run(ctx)
+
+	// Alert on missing samples
+	gapWatcher := gaps.NewWatcher(cfg, notifier, sched.Paused)
+	go gapWatcher.Run(ctx)
+
+	// Roll up old samples
+	rollups := rollup.NewJob(cfg)
+	go rollups.Run(ctx)
+
+	// Check the system clock
+	clockChecker := clock.New(cfg, notifier)
+	go clockChecker.Run(ctx)
+
+	// Render the status page
+	statusPages := statuspage.NewJob(cfg)
+	go statusPages.Run(ctx)
+	if err := sched.Start(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start scheduler: %w", err)
+	}
+
+	auditLog := audit.New(cfg.AuditPath())
+	auditLog.Record(audit.ActorDaemon, audit.ActionStart, configPath, fmt.Sprintf("%d itineraries", len(cfg.Itineraries)))
+	snapshot(configPath, cfg)
+
+	// Return to the previous config when a reloaded one keeps failing, but
+	// not back again if the restored config fails too
+	var current atomic.Pointer[config.Config]
+	var restored atomic.Pointer[[]byte]
+	current.Store(cfg)
+	sched.OnRepeatedFailures(autoRollbackFailures, func(failures int) {
+		if err := autoRollback(configPath, current.Load().DataDir, &restored); err != nil {
+			log.Printf("ERROR: %d jobs failed after the config reload, but it was not rolled back: %v", failures, err)
+			return
+		}
+		auditLog.Record(audit.ActorDaemon, audit.ActionRollback, configPath,
+			fmt.Sprintf("%d jobs failed after reload", failures))
+	})
+
+	// Start the HTTP API if enabled
+	var apiServer *api.Server
+	if cfg.Server.Listen != "" {
+		apiServer = api.New(cfg, configPath, sched, auditLog)
+		apiServer.PublishTo(bus)
+		apiServer.CompareWith(notifier)
+		apiServer.CheckConfigWith(func(newCfg *config.Config) error { return isolation.Check(name, newCfg) })
+		go func() {
+			if err := apiServer.Start(ctx); err != nil {
+				log.Printf("API server stopped: %v", err)
+			}
+		}()
+	}
+
+	// Setup config file watcher
+	watch, err := watcher.New(configPath, func(newCfg *config.Config) error {
+		if err := opts.prepare(newCfg); err != nil {
+			return err
+		}
+		if err := isolation.Claim(name, newCfg); err != nil {
+			return err
+		}
+		if err := setProviders(fetch, newCfg); err != nil {
+			return err
+		}
+		if err := exporter.Reload(newCfg); err != nil {
+			return err
+		}
+		seriesWriter.Reload(newCfg)
+		pinger.Reload(newCfg)
+		if err := sched.Reload(ctx, newCfg); err != nil {
+			return err
+		}
+		plugins.Reload(newCfg)
+		streams.Reload(newCfg)
+		outboxes.Reload(newCfg)
+		latestWriter.Reload(newCfg)
+		statsdEmitter.Reload(newCfg)
+		jobRuns.Reload(newCfg)
+		sequences.Reload(newCfg)
+		backups.Reload(newCfg)
+		rollups.Reload(newCfg)
+		statusPages.Reload(newCfg)
+		feedRecorder.Reload(newCfg)
+		gapWatcher.Reload(newCfg)
+		clockChecker.Reload(newCfg)
+		fetch.SetBatching(newCfg.Storage.FlushInterval(), newCfg.Storage.BatchSize)
+		fetch.SetSharing(newCfg.API.Share())
+		if err := fetch.SetCache(newCfg.CacheDir(), newCfg.API.Cache()); err != nil {
+			return err
+		}
+		if apiServer != nil {
+			apiServer.SetConfig(newCfg)
+		}
+		current.Store(newCfg)
+		snapshot(configPath, newCfg)
+		auditLog.Record(audit.ActorConfigFile, audit.ActionReload, configPath, fmt.Sprintf("%d itineraries", len(newCfg.Itineraries)))
+		bus.Publish(ctx, events.Event{Kind: events.ConfigReloaded, Config: newCfg})
+		return nil
+	}, func(err error) {
+		auditLog.Record(audit.ActorConfigFile, audit.ActionReloadFailed, configPath, err.Error())
+	})
+	if err != nil {
+		sched.Stop()
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	go func() {
+		if err := watch.Start(ctx); err != nil {
+			log.Printf("Watcher stopped: %v", err)
+		}
+	}()
+
+	return &daemon{name: name, sched: sched, fetch: fetch, audit: auditLog, sequences: sequences}, nil
+}
+
+// setProviders sets up the providers itineraries compare the default one
+// with, and the price of each
+func setProviders(fetch *fetcher.Fetcher, cfg *config.Config) error {
+	var others []fetcher.Provider
+	for _, name := range cost.Providers(cfg) {
+		fetch.SetPrice(name, cost.Price(cfg, name).PerThousand)
+		if name == cost.Provider(cfg) {
+			continue
+		}
+		provider, err := fetcher.NewProvider(cfg.API, name)
+		if err != nil {
+			return fmt.Errorf("failed to create provider %s: %w", name, err)
+		}
+		others = append(others, provider)
+	}
+	fetch.SetProviders(others...)
+	return nil
+}
+
+// autoRollbackFailures is how many jobs in a row may fail after a config
+// reload before the previous config is restored
+const autoRollbackFailures = 3
+
+// autoRollback restores the previous config version, unless the config file
+// is the version restored last time
+func autoRollback(configPath, dataDir string, restored *atomic.Pointer[[]byte]) error {
+	current, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if last := restored.Load(); last != nil && bytes.Equal(*last, current) {
+		return fmt.Errorf("it is the previous version, restored after earlier failures")
+	}
+
+	version, err := config.PreviousVersion(configPath, dataDir)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(version.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read config version: %w", err)
+	}
+	if err := config.Replace(configPath, data, nil); err != nil {
+		return err
+	}
+
+	log.Printf("Restored config version %s", filepath.Base(version.Path))
+	restored.Store(&data)
+	return nil
+}
+
+// snapshot saves a validated config for rollback, only warning on failure
+func snapshot(configPath string, cfg *config.Config) {
+	if err := config.Snapshot(configPath, cfg); err != nil {
+		log.Printf("Warning: failed to save config version: %v", err)
+	}
+}
+
+// probeAPIKey makes a minimal request to check that the key is valid and the
+// Distance Matrix API is enabled, failing if the provider rejects it. Network
+// failures only log a warning so the daemon can start while offline.
+func probeAPIKey(fetch *fetcher.Fetcher, cfg *config.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	err := fetch.Probe(ctx, cfg.Itineraries[0].FirstOrigin())
+	if err == nil {
+		log.Println("API key verified")
+		return nil
+	}
+
+	if fetcher.IsTransportError(err) {
+		log.Printf("Warning: could not verify API key: %v", err)
+		return nil
+	}
+
+	return fmt.Errorf("API key check failed (is the key valid and the Distance Matrix API enabled for it?): %w", err)
+}
+
+// jobs lists the scheduled jobs of all daemons, prefixing job names with
+// the tenant name in multi-tenant mode
+func jobs(daemons []*daemon) []scheduler.JobInfo {
+	var all []scheduler.JobInfo
+	for _, d := range daemons {
+		for _, job := range d.sched.Jobs() {
+			if d.name != "" {
+				job.Name = d.name + "/" + job.Name
+			}
+			all = append(all, job)
+		}
+	}
+	return all
+}
@@ -0,0 +1,149 @@
+// Package adaptive spreads a daily number of samples over the times of a
+// schedule, more of them where commute times varied most in the recorded
+// history and fewer where they hardly change
+package adaptive
+
+import (
+	"slices"
+	"time"
+
+	"gommutetime/internal/history"
+)
+
+// Lookback is how far back the history is used to plan a day
+const Lookback = 8 * 7 * 24 * time.Hour
+
+// minSamples is the fewest samples around a time for its variability to be
+// trusted
+const minSamples = 3
+
+// floor is the weight of the most stable times relative to the average
+// weight, so that they are still sampled now and then
+const floor = 0.25
+
+// Plan returns which of slots, in minutes after midnight every interval
+// minutes, to sample on a weekday: requests of them, or all of them when
+// there are fewer, in order. Each time is weighted by the standard
+// deviation of the samples taken around it, on the same weekday when there
+// are enough, and times are then picked evenly along the cumulative weight,
+// so that variable stretches of the window get more samples. Times without
+// enough history get the highest weight to be explored.
+func Plan(samples []history.Sample, slots []int, interval int, weekday time.Weekday, requests int) []int {
+	if requests >= len(slots) {
+		return slices.Clone(slots)
+	}
+	if requests <= 0 {
+		return nil
+	}
+
+	weights := make([]float64, len(slots))
+	known, sum, highest := 0, 0.0, 0.0
+	for i, slot := range slots {
+		w, ok := spread(samples, slot, interval, &weekday)
+		if !ok {
+			w, ok = spread(samples, slot, interval, nil)
+		}
+		if !ok {
+			weights[i] = -1
+			continue
+		}
+		weights[i] = w
+		known++
+		sum += w
+		highest = max(highest, w)
+	}
+	least := 1.0
+	if known > 0 && sum > 0 {
+		least = floor * sum / float64(known)
+	} else {
+		highest = 1
+	}
+	for i, w := range weights {
+		if w < 0 {
+			weights[i] = max(highest, least)
+		} else {
+			weights[i] = max(w, least)
+		}
+	}
+
+	// Pick the slot at the middle of each of requests equal stretches of
+	// the cumulative weight
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	picked := make(map[int]bool, requests)
+	i, cumulative := 0, weights[0]
+	for k := range requests {
+		target := (float64(k) + 0.5) * total / float64(requests)
+		for cumulative < target && i < len(weights)-1 {
+			i++
+			cumulative += weights[i]
+		}
+		picked[i] = true
+	}
+
+	// Heavy slots can be picked twice: fill in with the heaviest others
+	order := make([]int, len(slots))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return cmpDesc(weights[a], weights[b]) })
+	for _, i := range order {
+		if len(picked) >= requests {
+			break
+		}
+		picked[i] = true
+	}
+
+	var plan []int
+	for i, slot := range slots {
+		if picked[i] {
+			plan = append(plan, slot)
+		}
+	}
+	return plan
+}
+
+// spread returns the standard deviation of the durations of the samples
+// taken within half an interval of a time of day, on a weekday unless nil.
+// ok is false with too few samples.
+func spread(samples []history.Sample, slot, interval int, weekday *time.Weekday) (float64, bool) {
+	half := max(interval/2, 1)
+	var around []history.Sample
+	for _, s := range samples {
+		local := s.Timestamp.Local()
+		if weekday != nil && local.Weekday() != *weekday {
+			continue
+		}
+		diff := local.Hour()*60 + local.Minute() - slot
+		if diff < -half || diff >= half {
+			continue
+		}
+		around = append(around, s)
+	}
+	if len(around) < minSamples {
+		return 0, false
+	}
+	return history.Compute(around).StdDev, true
+}
+
+// cmpDesc orders floats from the largest
+func cmpDesc(a, b float64) int {
+	switch {
+	case a > b:
+		return -1
+	case a < b:
+		return 1
+	}
+	return 0
+}
+
+// Format formats the times of a plan as HH:MM
+func Format(plan []int) []string {
+	times := make([]string, len(plan))
+	for i, m := range plan {
+		times[i] = time.Date(0, 1, 1, m/60, m%60, 0, 0, time.UTC).Format("15:04")
+	}
+	return times
+}
@@ -0,0 +1,178 @@
+package analytics
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/history"
+)
+
+// Groupings of samples, by the local time they were recorded at
+const (
+	ByWeekday  = "weekday"
+	ByHour     = "hour"
+	ByDay      = "day"
+	BySchedule = "schedule"
+)
+
+// Groupings lists the supported groupings
+var Groupings = []string{ByWeekday, ByHour, ByDay, BySchedule}
+
+// weekdays are the weekday keys, Monday first
+var weekdays = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// Query selects the samples summarized by an engine
+type Query struct {
+	// Path is the itinerary's CSV output file
+	Path string
+	// From and To bound the sample times, To excluded; zero leaves an end open
+	From time.Time
+	To   time.Time
+	// By groups the samples; empty summarizes them together under "all"
+	By string
+}
+
+// Group holds the statistics of the samples sharing a key, e.g. a weekday
+type Group struct {
+	Key   string
+	Stats history.Stats
+}
+
+// Engine computes statistics over an itinerary's history
+type Engine interface {
+	Stats(ctx context.Context, q Query) ([]Group, error)
+}
+
+// New returns the engine selected in the config, including the aggregates
+// of rolled up samples
+func New(cfg config.AnalyticsConfig) Engine {
+	if cfg.Engine == config.EngineDuckDB {
+		command := cfg.Command
+		if command == "" {
+			command = "duckdb"
+		}
+		return withRollups{&duckDB{command: command}}
+	}
+	return withRollups{builtin{}}
+}
+
+// validate checks the grouping of a query
+func (q Query) validate() error {
+	if q.By != "" && !slices.Contains(Groupings, q.By) {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("unknown grouping %s (expected one of %s)", q.By, strings.Join(Groupings, ", ")))
+	}
+	return nil
+}
+
+// builtin streams the CSV file through the history index, keeping only
+// running totals per group
+type builtin struct{}
+
+// Stats implements Engine
+func (builtin) Stats(ctx context.Context, q Query) ([]Group, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]*accumulator)
+	err := history.Scan(q.Path, q.From, q.To, func(s history.Sample) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		key := groupKey(s, q.By)
+		if totals[key] == nil {
+			totals[key] = &accumulator{}
+		}
+		totals[key].add(s.Duration)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]Group, 0, len(totals))
+	for key, acc := range totals {
+		groups = append(groups, Group{Key: key, Stats: acc.stats()})
+	}
+	sortGroups(groups, q.By)
+	return groups, nil
+}
+
+// groupKey returns the key of the group a sample belongs to
+func groupKey(s history.Sample, by string) string {
+	switch by {
+	case ByWeekday:
+		return weekdays[(s.Timestamp.Weekday()+6)%7]
+	case ByHour:
+		return fmt.Sprintf("%02d", s.Timestamp.Hour())
+	case ByDay:
+		return s.Timestamp.Format(time.DateOnly)
+	case BySchedule:
+		return s.Schedule
+	}
+	return "all"
+}
+
+// sortGroups orders groups by key, weekdays starting on Monday
+func sortGroups(groups []Group, by string) {
+	slices.SortFunc(groups, func(a, b Group) int {
+		if by == ByWeekday {
+			return slices.Index(weekdays, a.Key) - slices.Index(weekdays, b.Key)
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+}
+
+// weekdayKey converts an ISO weekday number, 1 for Monday, to its key
+func weekdayKey(isodow string) string {
+	n, err := strconv.Atoi(isodow)
+	if err != nil || n < 1 || n > 7 {
+		return isodow
+	}
+	return weekdays[n-1]
+}
+
+// accumulator keeps running statistics using Welford's algorithm
+type accumulator struct {
+	count    int
+	mean     float64
+	m2       float64
+	min, max float64
+}
+
+// add includes a duration in the statistics
+func (a *accumulator) add(x float64) {
+	a.count++
+	if a.count == 1 {
+		a.min, a.max = x, x
+	}
+	a.min = min(a.min, x)
+	a.max = max(a.max, x)
+
+	delta := x - a.mean
+	a.mean += delta / float64(a.count)
+	a.m2 += delta * (x - a.mean)
+}
+
+// stats returns the statistics, with the population standard deviation
+// like history.Compute
+func (a *accumulator) stats() history.Stats {
+	if a.count == 0 {
+		return history.Stats{}
+	}
+	return history.Stats{
+		Count:  a.count,
+		Mean:   a.mean,
+		Min:    a.min,
+		Max:    a.max,
+		StdDev: math.Sqrt(a.m2 / float64(a.count)),
+	}
+}
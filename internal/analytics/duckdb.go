@@ -0,0 +1,165 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/history"
+)
+
+// csvColumns names the columns of output files, all read as text. Parquet
+// archives use the same names, with timestamp for ts.
+const csvColumns = `{'ts': 'VARCHAR', 'duration_minutes': 'VARCHAR', 'latency_ms': 'VARCHAR', 'http_status': 'VARCHAR', 'status': 'VARCHAR', 'provider': 'VARCHAR', 'origin': 'VARCHAR', 'destination': 'VARCHAR', 'schedule': 'VARCHAR', 'tags': 'VARCHAR', 'elements': 'VARCHAR', 'cost': 'VARCHAR', 'legs': 'VARCHAR', 'direct': 'VARCHAR'}`
+
+// duckDB runs queries with the DuckDB CLI, which reads the CSV file and any
+// Parquet archives of it in place without loading them into this process
+type duckDB struct {
+	command string
+}
+
+// duckDBRow is a result row of the statistics query
+type duckDBRow struct {
+	Key    string  `json:"key"`
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	StdDev float64 `json:"stddev"`
+}
+
+// Stats implements Engine
+func (d *duckDB) Stats(ctx context.Context, q Query) ([]Group, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	sources, err := sources(q.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return []Group{}, nil
+	}
+
+	cmd := exec.CommandContext(ctx, d.command, "-json", "-c", statsQuery(sources, q))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("duckdb engine needs the DuckDB CLI: %w", err))
+		}
+		return nil, fmt.Errorf("duckdb failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// Nothing is printed when no rows match
+	var rows []duckDBRow
+	if out := bytes.TrimSpace(stdout.Bytes()); len(out) > 0 {
+		if err := json.Unmarshal(out, &rows); err != nil {
+			return nil, fmt.Errorf("failed to parse duckdb output: %w", err)
+		}
+	}
+
+	groups := make([]Group, 0, len(rows))
+	for _, row := range rows {
+		key := row.Key
+		if q.By == ByWeekday {
+			key = weekdayKey(key)
+		}
+		groups = append(groups, Group{Key: key, Stats: history.Stats{
+			Count:  row.Count,
+			Mean:   row.Mean,
+			Min:    row.Min,
+			Max:    row.Max,
+			StdDev: row.StdDev,
+		}})
+	}
+	sortGroups(groups, q.By)
+	return groups, nil
+}
+
+// sources returns the CSV file, if it exists, followed by its Parquet
+// archives, e.g. work.parquet and work.2023.parquet for work.csv
+func sources(path string) ([]string, error) {
+	var files []string
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+
+	stem := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, pattern := range []string{stem + ".parquet", stem + ".*.parquet"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// statsQuery builds the SQL computing the statistics of a query. Times are
+// compared as instants, while groups use the local time as written, like
+// the builtin engine.
+func statsQuery(sources []string, q Query) string {
+	var selects []string
+	var parquet []string
+	for _, source := range sources {
+		if strings.HasSuffix(source, ".parquet") {
+			parquet = append(parquet, sqlString(source))
+			continue
+		}
+		selects = append(selects, fmt.Sprintf(`SELECT ts, duration_minutes, schedule FROM read_csv(%s, auto_detect = false, header = false, delim = ',', quote = '"', escape = '"', null_padding = true, ignore_errors = true, columns = %s)`,
+			sqlString(source), csvColumns))
+	}
+	if len(parquet) > 0 {
+		selects = append(selects, fmt.Sprintf(`SELECT CAST("timestamp" AS VARCHAR) AS ts, CAST(duration_minutes AS VARCHAR) AS duration_minutes, schedule FROM read_parquet([%s], union_by_name = true)`,
+			strings.Join(parquet, ", ")))
+	}
+
+	key := "'all'"
+	switch q.By {
+	case ByWeekday:
+		key = "CAST(isodow(CAST(substr(ts, 1, 10) AS DATE)) AS VARCHAR)"
+	case ByHour:
+		key = "substr(ts, 12, 2)"
+	case ByDay:
+		key = "substr(ts, 1, 10)"
+	case BySchedule:
+		key = "coalesce(schedule, '')"
+	}
+
+	where := []string{"recorded_at IS NOT NULL", "duration IS NOT NULL"}
+	if !q.From.IsZero() {
+		where = append(where, "recorded_at >= "+sqlTime(q.From))
+	}
+	if !q.To.IsZero() {
+		where = append(where, "recorded_at < "+sqlTime(q.To))
+	}
+
+	return fmt.Sprintf(`WITH raw AS (%s),
+samples AS (SELECT ts, TRY_CAST(ts AS TIMESTAMPTZ) AS recorded_at, TRY_CAST(duration_minutes AS DOUBLE) AS duration, schedule FROM raw)
+SELECT %s AS key, count(*) AS count, avg(duration) AS mean, min(duration) AS min, max(duration) AS max, stddev_pop(duration) AS stddev
+FROM samples WHERE %s GROUP BY key`,
+		strings.Join(selects, " UNION ALL BY NAME "), key, strings.Join(where, " AND "))
+}
+
+// sqlString quotes a SQL string literal
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sqlTime formats an instant as a SQL timestamp literal
+func sqlTime(t time.Time) string {
+	return "TIMESTAMPTZ '" + t.UTC().Format("2006-01-02 15:04:05.999999") + "+00'"
+}
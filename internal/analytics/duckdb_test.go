@@ -0,0 +1,27 @@
+package analytics
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+
+	"gommutetime/internal/history"
+)
+
+func TestCSVColumns(t *testing.T) {
+	var names []string
+	for _, m := range regexp.MustCompile(`'(\w+)': 'VARCHAR'`).FindAllStringSubmatch(csvColumns, -1) {
+		names = append(names, m[1])
+	}
+
+	// DuckDB names two columns differently from the output files
+	renamed := map[string]string{"ts": "timestamp", "duration_minutes": "duration"}
+	for i, name := range names {
+		if column, ok := renamed[name]; ok {
+			names[i] = column
+		}
+	}
+	if want := history.CurrentSchema().Columns; !slices.Equal(names, want) {
+		t.Errorf("csvColumns = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,49 @@
+package analytics
+
+import (
+	"context"
+
+	"gommutetime/internal/history"
+)
+
+// withRollups adds the aggregates of rolled up samples to the statistics of
+// an engine, which only reads the samples still in the output file
+type withRollups struct {
+	Engine
+}
+
+// Stats implements Engine
+func (e withRollups) Stats(ctx context.Context, q Query) ([]Group, error) {
+	groups, err := e.Engine.Stats(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregates, err := history.LoadAggregates(history.RollupFile(q.Path))
+	if err != nil || len(aggregates) == 0 {
+		return groups, err
+	}
+
+	totals := make(map[string]history.Stats, len(groups))
+	for _, g := range groups {
+		totals[g.Key] = g.Stats
+	}
+	for _, a := range aggregates {
+		if a.Period.Before(q.From) || (!q.To.IsZero() && !a.Period.Before(q.To)) {
+			continue
+		}
+		// Daily aggregates have no hour to group by
+		if q.By == ByHour && a.Resolution != history.ResolutionHour {
+			continue
+		}
+		key := groupKey(history.Sample{Timestamp: a.Period, Schedule: a.Schedule}, q.By)
+		totals[key] = history.Merge(totals[key], a.Stats)
+	}
+
+	groups = groups[:0]
+	for key, stats := range totals {
+		groups = append(groups, Group{Key: key, Stats: stats})
+	}
+	sortGroups(groups, q.By)
+	return groups, nil
+}
@@ -0,0 +1,223 @@
+// Package annotation records external events that explain unusual commute
+// times over a range of days, e.g. a bridge closure or school vacations.
+// Annotations are kept in a JSON file of the data directory, shown with the
+// recorded history and left out of the baselines it is compared with.
+package annotation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/history"
+)
+
+// File is the name of the annotations file in the data directory
+const File = "annotations.json"
+
+// dateLayout is the format of the days of an annotation
+const dateLayout = "2006-01-02"
+
+// ErrNotFound is returned when removing an annotation that does not exist
+var ErrNotFound = errors.New("annotation not found")
+
+// mu serializes changes to annotation files, made by the API and the CLI
+var mu sync.Mutex
+
+// Annotation is an event affecting the commutes of a range of days
+type Annotation struct {
+	ID int `json:"id"`
+	// From and To are the first and last days of the event, YYYY-MM-DD in
+	// local time. To is empty while the event is ongoing.
+	From  string `json:"from"`
+	To    string `json:"to,omitempty"`
+	Label string `json:"label"`
+	// Itineraries are the IDs of the itineraries the event affects, all of
+	// them when empty
+	Itineraries []string  `json:"itineraries,omitempty"`
+	Created     time.Time `json:"created"`
+}
+
+// Path returns the path of the annotations file of a data directory
+func Path(dataDir string) string {
+	return filepath.Join(dataDir, File)
+}
+
+// Validate checks the days and label of an annotation
+func (a Annotation) Validate() error {
+	if strings.TrimSpace(a.Label) == "" {
+		return apperr.Wrap(apperr.KindConfig, errors.New("annotation needs a label"))
+	}
+	from, err := time.Parse(dateLayout, a.From)
+	if err != nil {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("annotation from must be a date like 2026-03-04, got %q", a.From))
+	}
+	if a.To == "" {
+		return nil
+	}
+	to, err := time.Parse(dateLayout, a.To)
+	if err != nil {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("annotation to must be a date like 2026-03-04, got %q", a.To))
+	}
+	if to.Before(from) {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("annotation ends on %s before it starts on %s", a.To, a.From))
+	}
+	return nil
+}
+
+// Applies reports whether the annotation affects an itinerary
+func (a Annotation) Applies(itinID string) bool {
+	return len(a.Itineraries) == 0 || slices.Contains(a.Itineraries, itinID)
+}
+
+// Covers reports whether t falls on one of the days of the annotation, in
+// local time
+func (a Annotation) Covers(t time.Time) bool {
+	// Dates in this layout sort like the days they name
+	day := t.Local().Format(dateLayout)
+	return day >= a.From && (a.To == "" || day <= a.To)
+}
+
+// Overlaps reports whether the annotation covers any time in [from, to),
+// either bound being zero for none
+func (a Annotation) Overlaps(from, to time.Time) bool {
+	if !to.IsZero() && to.Local().Format(dateLayout) < a.From {
+		return false
+	}
+	return from.IsZero() || a.To == "" || from.Local().Format(dateLayout) <= a.To
+}
+
+// Days describes the days of the annotation, e.g. "2026-03-04 to 2026-03-20"
+func (a Annotation) Days() string {
+	switch a.To {
+	case "":
+		return a.From + " onwards"
+	case a.From:
+		return a.From
+	default:
+		return a.From + " to " + a.To
+	}
+}
+
+// Load reads the annotations in path, by ID. A missing file has none.
+func Load(path string) ([]Annotation, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to read annotations: %w", err))
+	}
+
+	var annotations []Annotation
+	if err := json.Unmarshal(data, &annotations); err != nil {
+		return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("invalid annotations file %s: %w", path, err))
+	}
+	slices.SortFunc(annotations, func(a, b Annotation) int { return a.ID - b.ID })
+	return annotations, nil
+}
+
+// For returns the annotations affecting an itinerary
+func For(annotations []Annotation, itinID string) []Annotation {
+	var matching []Annotation
+	for _, a := range annotations {
+		if a.Applies(itinID) {
+			matching = append(matching, a)
+		}
+	}
+	return matching
+}
+
+// Exclude returns the samples of an itinerary taken outside of the days of
+// the annotations affecting it, so that events do not skew what is usual
+func Exclude(annotations []Annotation, itinID string, samples []history.Sample) []history.Sample {
+	own := For(annotations, itinID)
+	if len(own) == 0 {
+		return samples
+	}
+	return slices.DeleteFunc(slices.Clone(samples), func(s history.Sample) bool {
+		return slices.ContainsFunc(own, func(a Annotation) bool { return a.Covers(s.Timestamp) })
+	})
+}
+
+// Add validates an annotation and appends it to the file in path with the
+// next ID, returning it as saved
+func Add(path string, a Annotation) (Annotation, error) {
+	if err := a.Validate(); err != nil {
+		return Annotation{}, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	annotations, err := Load(path)
+	if err != nil {
+		return Annotation{}, err
+	}
+	a.ID = 1
+	if len(annotations) > 0 {
+		a.ID = annotations[len(annotations)-1].ID + 1
+	}
+	a.Label = strings.TrimSpace(a.Label)
+	a.Created = time.Now().UTC().Truncate(time.Second)
+
+	if err := write(path, append(annotations, a)); err != nil {
+		return Annotation{}, err
+	}
+	return a, nil
+}
+
+// Remove deletes the annotation with an ID from the file in path, returning
+// it
+func Remove(path string, id int) (Annotation, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	annotations, err := Load(path)
+	if err != nil {
+		return Annotation{}, err
+	}
+	index := slices.IndexFunc(annotations, func(a Annotation) bool { return a.ID == id })
+	if index < 0 {
+		return Annotation{}, apperr.Wrap(apperr.KindConfig, fmt.Errorf("%w: %d", ErrNotFound, id))
+	}
+	removed := annotations[index]
+
+	if err := write(path, slices.Delete(annotations, index, index+1)); err != nil {
+		return Annotation{}, err
+	}
+	return removed, nil
+}
+
+// write replaces the annotations file atomically
+func write(path string, annotations []Annotation) error {
+	if annotations == nil {
+		annotations = []Annotation{}
+	}
+	data, _ := json.MarshalIndent(annotations, "", "  ")
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".annotations-*")
+	if err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write annotations: %w", err))
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write annotations: %w", err))
+	}
+	return nil
+}
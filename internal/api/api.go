@@ -0,0 +1,977 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gommutetime/internal/analytics"
+	"gommutetime/internal/annotation"
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/audit"
+	"gommutetime/internal/auth"
+	"gommutetime/internal/backup"
+	"gommutetime/internal/config"
+	"gommutetime/internal/cost"
+	"gommutetime/internal/events"
+	"gommutetime/internal/gaps"
+	"gommutetime/internal/history"
+	"gommutetime/internal/notify"
+	"gommutetime/internal/series"
+	"gommutetime/internal/trend"
+)
+
+// Server is an HTTP API over the configured itineraries and their recorded
+// samples. Requests authenticate with a dashboard user's password (HTTP
+// Basic) or with a bearer token from the OIDC provider, and the user's role
+// decides which operations are allowed.
+type Server struct {
+	server     *http.Server
+	state      atomic.Pointer[state]
+	configPath string
+	runner     Runner
+	audit      *audit.Log
+	bus        atomic.Pointer[events.Bus]
+	notifier   atomic.Pointer[notify.Manager]
+	// check accepts the configs uploaded to replace the config file, on top
+	// of their validation
+	check atomic.Pointer[func(*config.Config) error]
+}
+
+// Runner controls the scheduled fetches of itineraries
+type Runner interface {
+	RunNow(id string) error
+	Pause(id string) error
+	Resume(id string) error
+	Paused(id string) bool
+}
+
+// maxConfigSize bounds the size of configs uploaded through the API
+const maxConfigSize = 1 << 20
+
+// errForbidden is returned for valid credentials of an account that is not
+// a dashboard user
+var errForbidden = errors.New("no access")
+
+// state is the config the API serves and the matching token verifier
+type state struct {
+	cfg  *config.Config
+	oidc *auth.OIDC
+}
+
+// user is an authenticated caller. A nil user is an anonymous caller of an
+// API without authentication, which may do anything.
+type user struct {
+	Username string   `json:"username"`
+	Profiles []string `json:"profiles,omitempty"`
+	Role     string   `json:"role"`
+}
+
+// itinerary is an entry of the /api/v1/itineraries response
+type itinerary struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type,omitempty"`
+	From    string   `json:"from,omitempty"`
+	To      string   `json:"to,omitempty"`
+	Via     string   `json:"via,omitempty"`
+	Stops   []string `json:"stops,omitempty"`
+	Profile string   `json:"profile,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Paused  bool     `json:"paused,omitempty"`
+}
+
+// sample is an entry of the /api/v1/itineraries/{id}/samples response
+type sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Minutes   float64   `json:"duration_minutes"`
+	Provider  string    `json:"provider,omitempty"`
+	Schedule  string    `json:"schedule,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Elements  int       `json:"elements,omitempty"`
+	Cost      float64   `json:"cost,omitempty"`
+	Legs      []float64 `json:"legs_minutes,omitempty"`
+	Direct    float64   `json:"direct_minutes,omitempty"`
+}
+
+// statsGroup is an entry of the /api/v1/itineraries/{id}/stats response
+type statsGroup struct {
+	Key    string  `json:"key"`
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean_minutes"`
+	Min    float64 `json:"min_minutes"`
+	Max    float64 `json:"max_minutes"`
+	StdDev float64 `json:"stddev_minutes"`
+}
+
+// seriesPoint is an entry of the /api/v1/itineraries/{id}/series response
+type seriesPoint struct {
+	Period time.Time `json:"period"`
+	Count  int       `json:"count"`
+	Mean   float64   `json:"mean_minutes"`
+	Min    float64   `json:"min_minutes"`
+	Max    float64   `json:"max_minutes"`
+	StdDev float64   `json:"stddev_minutes"`
+}
+
+// change is an entry of the /api/v1/itineraries/{id}/changes response
+type change struct {
+	Date   string  `json:"date"`
+	Shift  float64 `json:"shift_minutes"`
+	Before float64 `json:"before_minutes"`
+	After  float64 `json:"after_minutes"`
+}
+
+// gapsReport is the /api/v1/itineraries/{id}/gaps response
+type gapsReport struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Expected int       `json:"expected"`
+	Recorded int       `json:"recorded"`
+	Gaps     []gap     `json:"gaps"`
+}
+
+// gap is a run of missing samples in a gapsReport
+type gap struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Missed int       `json:"missed"`
+}
+
+// usageReport is the /api/v1/usage response
+type usageReport struct {
+	Since       time.Time        `json:"since"`
+	Requests    int              `json:"requests"`
+	Elements    int              `json:"elements"`
+	Cost        float64          `json:"cost"`
+	Currency    string           `json:"currency,omitempty"`
+	Days        []usageDay       `json:"days"`
+	Itineraries []itineraryUsage `json:"itineraries"`
+	Budget      *budget          `json:"budget,omitempty"`
+}
+
+// usageDay is the usage of a day in a usageReport
+type usageDay struct {
+	Date     string  `json:"date"`
+	Requests int     `json:"requests"`
+	Elements int     `json:"elements"`
+	Cost     float64 `json:"cost"`
+}
+
+// itineraryUsage is the usage of an itinerary in a usageReport
+type itineraryUsage struct {
+	ID       string  `json:"id"`
+	Requests int     `json:"requests"`
+	Elements int     `json:"elements"`
+	Cost     float64 `json:"cost"`
+}
+
+// budget is the spending of the current month in a usageReport
+type budget struct {
+	Monthly   float64 `json:"monthly"`
+	Spent     float64 `json:"spent"`
+	Remaining float64 `json:"remaining"`
+}
+
+// New creates an API server for the config loaded from configPath,
+// listening on cfg.Server.Listen. Changes are recorded in auditLog.
+func New(cfg *config.Config, configPath string, runner Runner, auditLog *audit.Log) *Server {
+	s := &Server{configPath: configPath, runner: runner, audit: auditLog}
+	s.SetConfig(cfg)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/me", s.authorized(config.RoleViewer, s.handleMe))
+	mux.HandleFunc("GET /api/v1/itineraries", s.authorized(config.RoleViewer, s.handleItineraries))
+	mux.HandleFunc("GET /api/v1/itineraries/{id}/samples", s.authorized(config.RoleViewer, s.handleSamples))
+	mux.HandleFunc("GET /api/v1/itineraries/{id}/stats", s.authorized(config.RoleViewer, s.handleStats))
+	mux.HandleFunc("GET /api/v1/itineraries/{id}/series", s.authorized(config.RoleViewer, s.handleSeries))
+	mux.HandleFunc("GET /api/v1/itineraries/{id}/gaps", s.authorized(config.RoleViewer, s.handleGaps))
+	mux.HandleFunc("GET /api/v1/itineraries/{id}/changes", s.authorized(config.RoleViewer, s.handleChanges))
+	mux.HandleFunc("GET /api/v1/itineraries/{id}/calendar.ics", s.authorized(config.RoleViewer, s.handleCalendar))
+	mux.HandleFunc("GET /api/v1/feed.atom", s.authorized(config.RoleViewer, s.handleAtomFeed))
+	mux.HandleFunc("GET /api/v1/feed.rss", s.authorized(config.RoleViewer, s.handleRSSFeed))
+	mux.HandleFunc("GET /api/v1/summary", s.authorized(config.RoleViewer, s.handleSummary))
+	mux.HandleFunc("GET /api/v1/jobs/history", s.authorized(config.RoleViewer, s.handleJobHistory))
+	mux.HandleFunc("GET /api/v1/usage", s.authorized(config.RoleViewer, s.handleUsage))
+	mux.HandleFunc("GET /api/v1/annotations", s.authorized(config.RoleViewer, s.handleAnnotations))
+	mux.HandleFunc("POST /api/v1/annotations", s.authorized(config.RoleOperator, s.handleAddAnnotation))
+	mux.HandleFunc("DELETE /api/v1/annotations/{id}", s.authorized(config.RoleOperator, s.handleRemoveAnnotation))
+	mux.HandleFunc("POST /api/v1/itineraries/{id}/samples", s.authorized(config.RoleOperator, s.handleIngest))
+	mux.HandleFunc("POST /api/v1/itineraries/{id}/run", s.authorized(config.RoleOperator, s.handleRun))
+	mux.HandleFunc("POST /api/v1/itineraries/{id}/pause", s.authorized(config.RoleOperator, s.handlePause))
+	mux.HandleFunc("POST /api/v1/itineraries/{id}/resume", s.authorized(config.RoleOperator, s.handleResume))
+	mux.HandleFunc("GET /api/v1/config", s.authorized(config.RoleAdmin, s.handleGetConfig))
+	mux.HandleFunc("PUT /api/v1/config", s.authorized(config.RoleAdmin, s.handlePutConfig))
+	mux.HandleFunc("GET /api/v1/backup", s.authorized(config.RoleAdmin, s.handleBackup))
+	mux.HandleFunc("GET /api/v1/grafana", s.authorized(config.RoleViewer, s.handleGrafanaHealth))
+	mux.HandleFunc("GET /api/v1/grafana/{$}", s.authorized(config.RoleViewer, s.handleGrafanaHealth))
+	mux.HandleFunc("POST /api/v1/grafana/metrics", s.authorized(config.RoleViewer, s.handleGrafanaMetrics))
+	mux.HandleFunc("POST /api/v1/grafana/variable", s.authorized(config.RoleViewer, s.handleGrafanaVariable))
+	mux.HandleFunc("POST /api/v1/grafana/query", s.authorized(config.RoleViewer, s.handleGrafanaQuery))
+	mux.HandleFunc("GET /display", s.authorized(config.RoleViewer, s.handleDisplay))
+
+	s.server = &http.Server{
+		Addr:              cfg.Server.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// SetConfig switches to a reloaded config. The listen address is only read
+// at startup.
+func (s *Server) SetConfig(cfg *config.Config) {
+	st := &state{cfg: cfg}
+	if old := s.state.Load(); old != nil && old.cfg.OIDC == cfg.OIDC {
+		// Keep the cached provider keys
+		st.oidc = old.oidc
+	} else if cfg.OIDC.Enabled() {
+		st.oidc = auth.NewOIDC(cfg.OIDC.Issuer, cfg.OIDC.ClientID, &http.Client{Timeout: 10 * time.Second})
+	}
+	s.state.Store(st)
+}
+
+// Start serves until ctx is cancelled
+func (s *Server) Start(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("API listening on %s", s.server.Addr)
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handler serves an authenticated request
+type handler func(w http.ResponseWriter, r *http.Request, st *state, u *user)
+
+// authorized resolves the caller of a request before passing it on,
+// rejecting requests without valid credentials or from users whose role is
+// below required
+func (s *Server) authorized(required string, next handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		st := s.state.Load()
+
+		u, err := st.authenticate(r)
+		if errors.Is(err, errForbidden) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if err != nil {
+			if st.cfg.OIDC.Enabled() {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="gommutetime"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Basic realm="gommutetime"`)
+			}
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if u != nil && !config.Allows(u.Role, required) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("requires the %s role", required))
+			return
+		}
+
+		next(w, r, st, u)
+	}
+}
+
+// authenticate checks the credentials of a request. When neither dashboard
+// users nor OIDC are configured the API is open, which config validation
+// only allows on loopback addresses.
+func (st *state) authenticate(r *http.Request) (*user, error) {
+	users := st.cfg.Dashboard.Users
+	if len(users) == 0 && st.oidc == nil {
+		return nil, nil
+	}
+
+	// Password of a dashboard user
+	if username, password, ok := r.BasicAuth(); ok {
+		// Unknown users are checked against a dummy hash, so that response
+		// times do not tell which usernames exist
+		hash, match := auth.DummyHash, -1
+		for i, u := range users {
+			if u.Username == username && u.PasswordHash != "" {
+				hash, match = u.PasswordHash, i
+				break
+			}
+		}
+		if auth.VerifyPassword(hash, password) && match >= 0 {
+			return newUser(users[match]), nil
+		}
+		return nil, errors.New("invalid username or password")
+	}
+
+	// Token from the OIDC provider
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || st.oidc == nil {
+		return nil, errors.New("authentication required")
+	}
+	claims, err := st.oidc.Verify(r.Context(), token)
+	if err != nil {
+		if !errors.Is(err, auth.ErrInvalidToken) {
+			log.Printf("Warning: failed to verify API token: %v", err)
+		}
+		return nil, errors.New("invalid token")
+	}
+	username, _ := claims[st.cfg.OIDC.Claim()].(string)
+	if username == "" {
+		return nil, fmt.Errorf("token has no %s claim", st.cfg.OIDC.Claim())
+	}
+
+	// Without dashboard users every account of the provider can view
+	if len(users) == 0 {
+		return &user{Username: username, Role: config.RoleViewer}, nil
+	}
+	for _, u := range users {
+		if u.Username == username {
+			return newUser(u), nil
+		}
+	}
+	return nil, fmt.Errorf("user %s has %w", username, errForbidden)
+}
+
+// newUser returns the caller for a dashboard user
+func newUser(u config.DashboardUser) *user {
+	role := u.Role
+	if role == "" {
+		role = config.RoleViewer
+	}
+	return &user{Username: u.Username, Profiles: u.Profiles, Role: role}
+}
+
+// visible reports whether the caller may see an itinerary
+func (u *user) visible(itin config.Itinerary) bool {
+	return u == nil || len(u.Profiles) == 0 || slices.Contains(u.Profiles, itin.Profile)
+}
+
+// handleMe reports the authenticated caller
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	if u == nil {
+		u = &user{Role: config.RoleAdmin}
+	}
+	writeJSON(w, u)
+}
+
+// handleItineraries lists the itineraries the caller may see
+func (s *Server) handleItineraries(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	result := []itinerary{}
+	for _, itin := range st.cfg.Itineraries {
+		if !u.visible(itin) {
+			continue
+		}
+		result = append(result, itinerary{
+			ID:      itin.ID,
+			Name:    itin.Name,
+			Type:    itin.Type,
+			From:    itin.From,
+			To:      itin.To,
+			Via:     itin.Via,
+			Stops:   stopLabels(itin.Stops),
+			Profile: itin.Profile,
+			Tags:    itin.Tags,
+			Paused:  s.runner.Paused(itin.ID),
+		})
+	}
+	writeJSON(w, result)
+}
+
+// stopLabels returns the labels of the stops of a carpool itinerary
+func stopLabels(stops []config.Stop) []string {
+	var labels []string
+	for _, stop := range stops {
+		labels = append(labels, stop.Label)
+	}
+	return labels
+}
+
+// handleSamples returns the samples recorded for an itinerary, optionally
+// only those in a time range, e.g. ?since=2024-01-15T00:00:00Z and
+// ?until=2024-02-01T00:00:00Z (exclusive)
+func (s *Server) handleSamples(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	itin, ok := st.itinerary(w, r, u)
+	if !ok {
+		return
+	}
+
+	since, ok := queryTime(w, r, "since")
+	if !ok {
+		return
+	}
+	until, ok := queryTime(w, r, "until")
+	if !ok {
+		return
+	}
+
+	result := []sample{}
+	if st.cfg.DataDir != "" && itin.OutputFile != "" {
+		err := history.Scan(filepath.Join(st.cfg.DataDir, itin.OutputFile), since, until, func(smp history.Sample) error {
+			result = append(result, sample{
+				Timestamp: smp.Timestamp,
+				Minutes:   smp.Duration,
+				Provider:  smp.Provider,
+				Schedule:  smp.Schedule,
+				Tags:      smp.Tags,
+				Elements:  smp.Elements,
+				Cost:      smp.Cost,
+				Legs:      smp.Legs,
+				Direct:    smp.Direct,
+			})
+			return nil
+		})
+		if err != nil {
+			log.Printf("ERROR loading samples of %s: %v", itin.ID, err)
+			writeError(w, http.StatusInternalServerError, "failed to load samples")
+			return
+		}
+	}
+	writeJSON(w, result)
+}
+
+// handleStats returns statistics of the samples recorded for an itinerary,
+// optionally in a time range like samples and grouped with ?by=weekday,
+// hour, day or schedule. They are computed by the configured analytics
+// engine.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	itin, ok := st.itinerary(w, r, u)
+	if !ok {
+		return
+	}
+
+	query := analytics.Query{By: r.URL.Query().Get("by")}
+	if query.By != "" && !slices.Contains(analytics.Groupings, query.By) {
+		writeError(w, http.StatusBadRequest, "by must be one of "+strings.Join(analytics.Groupings, ", "))
+		return
+	}
+	if query.From, ok = queryTime(w, r, "since"); !ok {
+		return
+	}
+	if query.To, ok = queryTime(w, r, "until"); !ok {
+		return
+	}
+
+	result := []statsGroup{}
+	if st.cfg.DataDir != "" && itin.OutputFile != "" {
+		query.Path = filepath.Join(st.cfg.DataDir, itin.OutputFile)
+		groups, err := analytics.New(st.cfg.Analytics).Stats(r.Context(), query)
+		if err != nil {
+			log.Printf("ERROR computing stats of %s: %v", itin.ID, err)
+			writeError(w, http.StatusInternalServerError, "failed to compute stats")
+			return
+		}
+		for _, g := range groups {
+			result = append(result, statsGroup{
+				Key:    g.Key,
+				Count:  g.Stats.Count,
+				Mean:   g.Stats.Mean,
+				Min:    g.Stats.Min,
+				Max:    g.Stats.Max,
+				StdDev: g.Stats.StdDev,
+			})
+		}
+	}
+	writeJSON(w, result)
+}
+
+// handleSeries returns the hourly or daily aggregates of an itinerary's
+// samples (?resolution=hour or day), optionally in a time range like
+// samples. Series kept in the config are read as written, others are
+// computed from the samples.
+func (s *Server) handleSeries(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	itin, ok := st.itinerary(w, r, u)
+	if !ok {
+		return
+	}
+
+	resolution := r.URL.Query().Get("resolution")
+	if resolution == "" {
+		resolution = history.ResolutionHour
+	}
+	if resolution != history.ResolutionHour && resolution != history.ResolutionDay {
+		writeError(w, http.StatusBadRequest, "resolution must be hour or day")
+		return
+	}
+	since, ok := queryTime(w, r, "since")
+	if !ok {
+		return
+	}
+	until, ok := queryTime(w, r, "until")
+	if !ok {
+		return
+	}
+
+	result := []seriesPoint{}
+	if st.cfg.DataDir != "" && itin.OutputFile != "" {
+		points, err := series.Load(st.cfg, filepath.Join(st.cfg.DataDir, itin.OutputFile), resolution, since, until)
+		if err != nil {
+			log.Printf("ERROR loading series of %s: %v", itin.ID, err)
+			writeError(w, http.StatusInternalServerError, "failed to load series")
+			return
+		}
+		for _, p := range points {
+			result = append(result, seriesPoint{
+				Period: p.Period,
+				Count:  p.Stats.Count,
+				Mean:   p.Stats.Mean,
+				Min:    p.Stats.Min,
+				Max:    p.Stats.Max,
+				StdDev: p.Stats.StdDev,
+			})
+		}
+	}
+	writeJSON(w, result)
+}
+
+// handleGaps returns the scheduled samples of an itinerary that were not
+// recorded, in a time range like samples that defaults to the last 30 days
+func (s *Server) handleGaps(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	itin, ok := st.itinerary(w, r, u)
+	if !ok {
+		return
+	}
+
+	since, ok := queryTime(w, r, "since")
+	if !ok {
+		return
+	}
+	if since.IsZero() {
+		since = time.Now().AddDate(0, 0, -30)
+	}
+	until, ok := queryTime(w, r, "until")
+	if !ok {
+		return
+	}
+
+	report, err := gaps.Find(st.cfg, itin, since, until)
+	if err != nil {
+		log.Printf("ERROR finding gaps of %s: %v", itin.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to find gaps")
+		return
+	}
+	result := gapsReport{From: report.From, To: report.To, Expected: report.Expected, Recorded: report.Recorded, Gaps: []gap{}}
+	for _, g := range report.Gaps {
+		result.Gaps = append(result.Gaps, gap{From: g.From, To: g.To, Missed: g.Missed})
+	}
+	writeJSON(w, result)
+}
+
+// handleChanges returns the days when the commute times of an itinerary
+// shifted for good, oldest first, optionally in a time range like samples
+func (s *Server) handleChanges(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	itin, ok := st.itinerary(w, r, u)
+	if !ok {
+		return
+	}
+
+	since, ok := queryTime(w, r, "since")
+	if !ok {
+		return
+	}
+	until, ok := queryTime(w, r, "until")
+	if !ok {
+		return
+	}
+
+	result := []change{}
+	if st.cfg.DataDir != "" && itin.OutputFile != "" && !itin.IsMatrix() {
+		samples, err := history.LoadRange(filepath.Join(st.cfg.DataDir, itin.OutputFile), since, until)
+		if err != nil {
+			log.Printf("ERROR loading samples of %s: %v", itin.ID, err)
+			writeError(w, http.StatusInternalServerError, "failed to load samples")
+			return
+		}
+		// Itineraries comparing providers are analyzed with the primary one
+		samples = history.PrimaryOnly(samples, itin.PrimaryProvider())
+		// Annotated events are left out, as in the stats command
+		annotations, err := annotation.Load(annotation.Path(st.cfg.DataDir))
+		if err != nil {
+			log.Printf("ERROR loading annotations: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to load annotations")
+			return
+		}
+		for _, c := range trend.Detect(annotation.Exclude(annotations, itin.ID, samples)) {
+			result = append(result, change{Date: c.Date.Format("2006-01-02"), Shift: c.Shift, Before: c.Before, After: c.After})
+		}
+	}
+	writeJSON(w, result)
+}
+
+// handleUsage returns the provider requests, elements and estimated cost
+// recorded with the samples of the itineraries the caller may see, in total,
+// per day and per itinerary, in a time range like samples that defaults to
+// the last 30 days. Callers who see every itinerary also get the spending of
+// the current month against the budget.
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	since, ok := queryTime(w, r, "since")
+	if !ok {
+		return
+	}
+	if since.IsZero() {
+		since = time.Now().AddDate(0, 0, -30)
+	}
+	until, ok := queryTime(w, r, "until")
+	if !ok {
+		return
+	}
+
+	var total cost.Usage
+	result := usageReport{Since: since, Days: []usageDay{}, Itineraries: []itineraryUsage{}}
+	for _, itin := range st.cfg.Itineraries {
+		if !u.visible(itin) || st.cfg.DataDir == "" || itin.OutputFile == "" {
+			continue
+		}
+		usage, err := cost.Recorded(filepath.Join(st.cfg.DataDir, itin.OutputFile), since, until)
+		if err != nil {
+			log.Printf("ERROR computing usage of %s: %v", itin.ID, err)
+			writeError(w, http.StatusInternalServerError, "failed to compute usage")
+			return
+		}
+		total.Merge(usage)
+		result.Itineraries = append(result.Itineraries, itineraryUsage{
+			ID:       itin.ID,
+			Requests: usage.Requests,
+			Elements: usage.Elements,
+			Cost:     usage.Cost,
+		})
+	}
+	result.Requests, result.Elements, result.Cost = total.Requests, total.Elements, total.Cost
+	for _, d := range total.Days {
+		result.Days = append(result.Days, usageDay{Date: d.Date, Requests: d.Requests, Elements: d.Elements, Cost: d.Cost})
+	}
+
+	provider := total.Provider
+	if provider == "" {
+		provider = cost.Provider(st.cfg)
+	}
+	result.Currency = cost.Price(st.cfg, provider).Currency
+
+	if st.cfg.Budget > 0 && (u == nil || len(u.Profiles) == 0) {
+		spent, err := cost.MonthToDate(st.cfg, st.cfg.Itineraries, time.Now())
+		if err != nil {
+			log.Printf("ERROR computing the spending of the month: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to compute usage")
+			return
+		}
+		result.Budget = &budget{Monthly: spent.Limit, Spent: spent.Spent, Remaining: spent.Remaining}
+	}
+	writeJSON(w, result)
+}
+
+// handleAnnotations lists the annotations affecting the itineraries the
+// caller may see, optionally those of one itinerary or overlapping a time
+// range like samples
+func (s *Server) handleAnnotations(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	since, ok := queryTime(w, r, "since")
+	if !ok {
+		return
+	}
+	until, ok := queryTime(w, r, "until")
+	if !ok {
+		return
+	}
+	itinID := r.URL.Query().Get("itinerary")
+
+	result := []annotation.Annotation{}
+	if st.cfg.DataDir == "" {
+		writeJSON(w, result)
+		return
+	}
+	annotations, err := annotation.Load(annotation.Path(st.cfg.DataDir))
+	if err != nil {
+		log.Printf("ERROR loading annotations: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to load annotations")
+		return
+	}
+	for _, a := range annotations {
+		if !st.annotationVisible(a, u) || (itinID != "" && !a.Applies(itinID)) || !a.Overlaps(since, until) {
+			continue
+		}
+		result = append(result, a)
+	}
+	writeJSON(w, result)
+}
+
+// handleAddAnnotation records the annotation in the JSON request body.
+// Callers restricted to profiles must name the itineraries it affects.
+func (s *Server) handleAddAnnotation(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	var a annotation.Annotation
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigSize)).Decode(&a); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid annotation: "+err.Error())
+		return
+	}
+	if !st.annotationOwned(w, a, u) {
+		return
+	}
+	if st.cfg.ReadOnly || st.cfg.DataDir == "" {
+		writeError(w, http.StatusConflict, "annotations are not written in read-only mode")
+		return
+	}
+
+	added, err := annotation.Add(annotation.Path(st.cfg.DataDir), annotation.Annotation{
+		From: a.From, To: a.To, Label: a.Label, Itineraries: a.Itineraries,
+	})
+	if err != nil {
+		if apperr.KindOf(err) == apperr.KindConfig {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("ERROR writing annotation from API: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to write annotation")
+		return
+	}
+	s.audit.Record(u.name(), audit.ActionAnnotate, strconv.Itoa(added.ID), added.Label)
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/annotations/%d", added.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, added)
+}
+
+// handleRemoveAnnotation deletes an annotation the caller may change
+func (s *Server) handleRemoveAnnotation(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "unknown annotation: "+r.PathValue("id"))
+		return
+	}
+	if st.cfg.ReadOnly || st.cfg.DataDir == "" {
+		writeError(w, http.StatusConflict, "annotations are not written in read-only mode")
+		return
+	}
+
+	path := annotation.Path(st.cfg.DataDir)
+	annotations, err := annotation.Load(path)
+	if err != nil {
+		log.Printf("ERROR loading annotations: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to load annotations")
+		return
+	}
+	index := slices.IndexFunc(annotations, func(a annotation.Annotation) bool { return a.ID == id })
+	if index < 0 || !st.annotationVisible(annotations[index], u) {
+		writeError(w, http.StatusNotFound, "unknown annotation: "+r.PathValue("id"))
+		return
+	}
+	if !st.annotationOwned(w, annotations[index], u) {
+		return
+	}
+
+	removed, err := annotation.Remove(path, id)
+	if errors.Is(err, annotation.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "unknown annotation: "+r.PathValue("id"))
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR removing annotation from API: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to remove annotation")
+		return
+	}
+	s.audit.Record(u.name(), audit.ActionUnannotate, strconv.Itoa(removed.ID), removed.Label)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// annotationVisible reports whether the caller may see an annotation: those
+// affecting every itinerary, or one the caller may see
+func (st *state) annotationVisible(a annotation.Annotation, u *user) bool {
+	if len(a.Itineraries) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(st.cfg.Itineraries, func(itin config.Itinerary) bool {
+		return u.visible(itin) && slices.Contains(a.Itineraries, itin.ID)
+	})
+}
+
+// annotationOwned checks that the caller may change an annotation, writing
+// an error otherwise: every itinerary it affects must exist and be visible,
+// and only callers seeing every itinerary may change those affecting all
+func (st *state) annotationOwned(w http.ResponseWriter, a annotation.Annotation, u *user) bool {
+	if len(a.Itineraries) == 0 && u != nil && len(u.Profiles) > 0 {
+		writeError(w, http.StatusForbidden, "annotations of every itinerary need access to all of them")
+		return false
+	}
+	for _, id := range a.Itineraries {
+		if !slices.ContainsFunc(st.cfg.Itineraries, func(itin config.Itinerary) bool { return itin.ID == id && u.visible(itin) }) {
+			writeError(w, http.StatusBadRequest, "unknown itinerary: "+id)
+			return false
+		}
+	}
+	return true
+}
+
+// queryTime parses an optional RFC 3339 time parameter, writing an error
+// and returning false when it is invalid
+func queryTime(w http.ResponseWriter, r *http.Request, name string) (time.Time, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, name+" must be an RFC 3339 time")
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// handleRun fetches an itinerary right away
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	s.control(w, r, st, u, audit.ActionRun, s.runner.RunNow)
+}
+
+// handlePause stops the scheduled fetches of an itinerary
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	s.control(w, r, st, u, audit.ActionPause, s.runner.Pause)
+}
+
+// handleResume restarts the scheduled fetches of a paused itinerary
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	s.control(w, r, st, u, audit.ActionResume, s.runner.Resume)
+}
+
+// control applies a runner operation to the itinerary of a request
+func (s *Server) control(w http.ResponseWriter, r *http.Request, st *state, u *user, action string, op func(id string) error) {
+	itin, ok := st.itinerary(w, r, u)
+	if !ok {
+		return
+	}
+
+	if err := op(itin.ID); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	s.audit.Record(u.name(), action, itin.ID, "")
+	writeJSON(w, map[string]any{"id": itin.ID, "paused": s.runner.Paused(itin.ID)})
+}
+
+// handleGetConfig returns the config file as it is on disk
+func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	data, err := os.ReadFile(s.configPath)
+	if err != nil {
+		log.Printf("ERROR reading config for API: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read config")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(data)
+}
+
+// CheckConfigWith has uploaded configs checked with check before they
+// replace the config file, e.g. for the isolation of tenants
+func (s *Server) CheckConfigWith(check func(*config.Config) error) {
+	s.check.Store(&check)
+}
+
+// handlePutConfig replaces the config file with the YAML request body if it
+// is valid. The daemon picks up the change like any other edit.
+func (s *Server) handlePutConfig(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigSize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "config too large")
+		return
+	}
+
+	var check func(*config.Config) error
+	if fn := s.check.Load(); fn != nil {
+		check = *fn
+	}
+	if err := config.Replace(s.configPath, data, check); err != nil {
+		if apperr.KindOf(err) == apperr.KindConfig {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("ERROR writing config from API: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to write config")
+		return
+	}
+
+	s.audit.Record(u.name(), audit.ActionReplace, s.configPath, fmt.Sprintf("%d bytes", len(data)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleBackup streams a backup of the config file and data directory, as
+// made by the backup command, while the daemon keeps recording
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	name := "gommutetime-" + time.Now().Format("20060102-150405") + ".tar.zst"
+	w.Header().Set("Content-Type", "application/zstd")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	out := &sentWriter{w: w}
+	files, err := backup.Create(out, st.cfg, s.configPath)
+	if err != nil {
+		log.Printf("ERROR writing backup for API: %v", err)
+		if !out.sent {
+			w.Header().Del("Content-Disposition")
+			writeError(w, http.StatusInternalServerError, "failed to write backup")
+			return
+		}
+		// Abort the response to leave the client with a truncated download
+		// rather than a damaged backup
+		panic(http.ErrAbortHandler)
+	}
+	s.audit.Record(u.name(), audit.ActionBackup, name, fmt.Sprintf("%d files", files))
+}
+
+// sentWriter tells whether a response has started
+type sentWriter struct {
+	w    io.Writer
+	sent bool
+}
+
+func (s *sentWriter) Write(p []byte) (int, error) {
+	s.sent = true
+	return s.w.Write(p)
+}
+
+// itinerary finds the itinerary named in the request path among those the
+// caller may see, writing a not found error otherwise
+func (st *state) itinerary(w http.ResponseWriter, r *http.Request, u *user) (config.Itinerary, bool) {
+	id := r.PathValue("id")
+	index := slices.IndexFunc(st.cfg.Itineraries, func(itin config.Itinerary) bool {
+		return itin.ID == id && u.visible(itin)
+	})
+	if index < 0 {
+		writeError(w, http.StatusNotFound, "unknown itinerary: "+id)
+		return config.Itinerary{}, false
+	}
+	return st.cfg.Itineraries[index], true
+}
+
+// name identifies the caller in logs
+func (u *user) name() string {
+	if u == nil {
+		return "anonymous"
+	}
+	return u.Username
+}
+
+// writeJSON writes v as the response body
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("ERROR encoding API response: %v", err)
+	}
+}
+
+// writeError writes an error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gommutetime/internal/history"
+	"gommutetime/internal/ical"
+)
+
+const (
+	// defaultCalendarDays is how many days calendar feeds cover by default
+	defaultCalendarDays = 60
+	// maxCalendarDays bounds the days of calendar feeds
+	maxCalendarDays = 366
+	// calendarWeeks is how many previous weeks the typical commute of a
+	// day is averaged over
+	calendarWeeks = 8
+)
+
+// Default hours of the morning commute in calendar feeds, local time
+const (
+	defaultMorningStart = "05:00"
+	defaultMorningEnd   = "12:00"
+)
+
+// handleCalendar serves an iCalendar feed of an itinerary's morning
+// commutes: an all-day event for each day with samples, summarizing their
+// mean against the typical one of that weekday in the previous weeks.
+// ?days=60 is how many days back the feed covers, and ?start=05:00 and
+// ?end=12:00 bound the morning.
+func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	itin, ok := st.itinerary(w, r, u)
+	if !ok {
+		return
+	}
+	if itin.IsMatrix() {
+		writeError(w, http.StatusBadRequest, "matrix itineraries have no calendar")
+		return
+	}
+
+	query := r.URL.Query()
+	days := defaultCalendarDays
+	if value := query.Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxCalendarDays {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("days must be between 1 and %d", maxCalendarDays))
+			return
+		}
+		days = n
+	}
+	start, end := defaultMorningStart, defaultMorningEnd
+	if value := query.Get("start"); value != "" {
+		start = value
+	}
+	if value := query.Get("end"); value != "" {
+		end = value
+	}
+	from, err1 := time.Parse("15:04", start)
+	until, err2 := time.Parse("15:04", end)
+	if err1 != nil || err2 != nil || !from.Before(until) {
+		writeError(w, http.StatusBadRequest, "start and end must be times of day, e.g. 05:00 and 12:00, start first")
+		return
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	first := today.AddDate(0, 0, -days+1)
+	var samples []history.Sample
+	if st.cfg.DataDir != "" && itin.OutputFile != "" {
+		var err error
+		samples, err = history.LoadRange(filepath.Join(st.cfg.DataDir, itin.OutputFile), first.AddDate(0, 0, -7*calendarWeeks), time.Time{})
+		if err != nil {
+			log.Printf("ERROR API failed to read samples of %s: %v", itin.ID, err)
+			writeError(w, http.StatusInternalServerError, "failed to read samples")
+			return
+		}
+	}
+
+	// Mornings of the primary provider, by local day
+	mornings := make(map[time.Time][]history.Sample)
+	for _, smp := range history.PrimaryOnly(samples, itin.PrimaryProvider()) {
+		local := smp.Timestamp.Local()
+		minute := local.Hour()*60 + local.Minute()
+		if minute < from.Hour()*60+from.Minute() || minute >= until.Hour()*60+until.Minute() {
+			continue
+		}
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+		mornings[day] = append(mornings[day], smp)
+	}
+
+	var events []ical.Event
+	for day := first; !day.After(today); day = day.AddDate(0, 0, 1) {
+		actual := history.Compute(mornings[day])
+		if actual.Count == 0 {
+			continue
+		}
+		var previous []history.Sample
+		for week := 1; week <= calendarWeeks; week++ {
+			previous = append(previous, mornings[day.AddDate(0, 0, -7*week)]...)
+		}
+		typical := history.Compute(previous)
+		events = append(events, ical.Event{
+			UID:         fmt.Sprintf("%s-%s@gommutetime", itin.ID, day.Format("20060102")),
+			Summary:     calendarSummary(actual, typical),
+			Description: calendarDescription(itin.Name, start, end, day, actual, typical),
+			Start:       day,
+			End:         day.AddDate(0, 0, 1),
+			AllDay:      true,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if err := ical.Write(w, itin.Name, events); err != nil {
+		log.Printf("ERROR API failed to write calendar of %s: %v", itin.ID, err)
+	}
+}
+
+// calendarSummary titles the event of a morning, e.g. "Commute 42 min
+// (+4 vs 38)"
+func calendarSummary(actual, typical history.Stats) string {
+	if typical.Count == 0 {
+		return fmt.Sprintf("Commute %.0f min", actual.Mean)
+	}
+	return fmt.Sprintf("Commute %.0f min (%+.0f vs %.0f)", actual.Mean, actual.Mean-typical.Mean, typical.Mean)
+}
+
+// calendarDescription details the samples of a morning and what is typical
+func calendarDescription(name, start, end string, day time.Time, actual, typical history.Stats) string {
+	text := fmt.Sprintf("%s, %d samples between %s and %s: %.0f minutes on average, %.0f to %.0f.",
+		name, actual.Count, start, end, actual.Mean, actual.Min, actual.Max)
+	if typical.Count == 0 {
+		return text + fmt.Sprintf("\nNo samples on the %d %ss before.", calendarWeeks, day.Weekday())
+	}
+	return text + fmt.Sprintf("\nTypical %s: %.0f minutes, from %d samples over the %d weeks before.",
+		day.Weekday(), typical.Mean, typical.Count, calendarWeeks)
+}
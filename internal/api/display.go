@@ -0,0 +1,261 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/statuspage"
+)
+
+const (
+	// defaultDisplayWidth and defaultDisplayHeight fit the common 7.5"
+	// e-ink panels
+	defaultDisplayWidth  = 800
+	defaultDisplayHeight = 480
+	// maxDisplaySize bounds the width and height of rendered images
+	maxDisplaySize = 4096
+	// displayRefresh is how often the HTML display reloads, in seconds
+	displayRefresh = 60
+)
+
+// display is what a display shows of an itinerary
+type display struct {
+	Name string
+	// Minutes is the latest commute time, empty without a recent sample
+	Minutes string
+	Trend   string
+	// Guidance is when to leave, or when one would arrive leaving now
+	Guidance string
+	// SampledAt is when the latest sample was taken
+	SampledAt string
+	Width     int
+	Height    int
+	Refresh   int
+}
+
+var displayPage = template.Must(template.New("display").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>{{.Name}}</title>
+<style>
+body { margin: 0; width: {{.Width}}px; height: {{.Height}}px; font-family: sans-serif; color: #000; background: #fff; text-align: center; }
+h1 { font-size: 2.5em; margin: .4em 0 0; }
+p.minutes { font-size: 7em; font-weight: bold; margin: 0; }
+p.guidance { font-size: 3.5em; margin: 0; }
+p.at { font-size: 1.5em; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{- if .Minutes}}
+<p class="minutes">{{.Minutes}} min {{.Trend}}</p>
+<p class="guidance">{{.Guidance}}</p>
+<p class="at">sampled at {{.SampledAt}}</p>
+{{- else}}
+<p class="guidance">no recent sample</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// handleDisplay renders the latest commute time of an itinerary for e-ink
+// dashboards and kiosks, as a black and white PNG (the default) or a page
+// without scripts, e.g. /display?itinerary=work&width=800&height=480. With
+// ?arrive=09:00 it tells when to leave to arrive on time, otherwise when one
+// would arrive leaving now.
+func (s *Server) handleDisplay(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	query := r.URL.Query()
+	id := query.Get("itinerary")
+	index := slices.IndexFunc(st.cfg.Itineraries, func(itin config.Itinerary) bool {
+		return (itin.ID == id || id == "") && u.visible(itin) && !itin.IsMatrix()
+	})
+	if index < 0 {
+		writeError(w, http.StatusNotFound, "unknown itinerary: "+id)
+		return
+	}
+	itin := st.cfg.Itineraries[index]
+
+	width, ok := displaySize(w, query.Get("width"), "width", defaultDisplayWidth)
+	if !ok {
+		return
+	}
+	height, ok := displaySize(w, query.Get("height"), "height", defaultDisplayHeight)
+	if !ok {
+		return
+	}
+	var arrive time.Time
+	if value := query.Get("arrive"); value != "" {
+		t, err := time.Parse("15:04", value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "arrive must be a time of day, e.g. 09:00")
+			return
+		}
+		arrive = t
+	}
+	format := query.Get("format")
+	if format != "" && format != "png" && format != "html" {
+		writeError(w, http.StatusBadRequest, "format must be png or html")
+		return
+	}
+
+	now := time.Now()
+	current, err := statuspage.Current(st.cfg, itin, now)
+	if err != nil {
+		log.Printf("ERROR API failed to read samples of %s: %v", itin.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to read samples")
+		return
+	}
+	d := describeDisplay(current, arrive, now)
+	d.Width, d.Height, d.Refresh = width, height, displayRefresh
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if format == "html" {
+		var b bytes.Buffer
+		if err := displayPage.Execute(&b, d); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(b.Bytes())
+		return
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, d.image()); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(b.Bytes())
+}
+
+// displaySize parses the width or height of a display
+func displaySize(w http.ResponseWriter, value, name string, fallback int) (int, bool) {
+	if value == "" {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 64 || n > maxDisplaySize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%s must be between 64 and %d pixels", name, maxDisplaySize))
+		return 0, false
+	}
+	return n, true
+}
+
+// describeDisplay words the latest commute time of an itinerary. When the
+// arrival time of the day has passed, it is taken as tomorrow's.
+func describeDisplay(current statuspage.Itinerary, arrive, now time.Time) display {
+	d := display{Name: current.Name}
+	if d.Name == "" {
+		d.Name = current.ID
+	}
+	if current.Minutes == nil {
+		return d
+	}
+	minutes := time.Duration(*current.Minutes * float64(time.Minute))
+	d.Minutes = fmt.Sprintf("%.0f", *current.Minutes)
+	d.SampledAt = current.SampledAt.Local().Format("15:04")
+	switch current.Trend {
+	case statuspage.TrendUp:
+		d.Trend = "↑"
+	case statuspage.TrendDown:
+		d.Trend = "↓"
+	}
+
+	if arrive.IsZero() {
+		d.Guidance = "arrive " + now.Add(minutes).Format("15:04")
+		return d
+	}
+	local := now.Local()
+	by := time.Date(local.Year(), local.Month(), local.Day(), arrive.Hour(), arrive.Minute(), 0, 0, time.Local)
+	if by.Before(local) {
+		by = by.AddDate(0, 0, 1)
+	}
+	leave := by.Add(-minutes)
+	if leave.After(local) {
+		d.Guidance = "leave by " + leave.Format("15:04")
+	} else {
+		d.Guidance = "leave now"
+	}
+	return d
+}
+
+// image draws the display in black on white, a line of text per row scaled
+// to fill the image
+func (d display) image() image.Image {
+	img := image.NewPaletted(image.Rect(0, 0, d.Width, d.Height), color.Palette{color.White, color.Black})
+
+	lines := []string{d.Name, "NO RECENT SAMPLE"}
+	weights := []int{1, 2}
+	if d.Minutes != "" {
+		lines = []string{d.Name, strings.TrimSpace(d.Minutes + " MIN " + d.Trend), d.Guidance, "SAMPLED AT " + d.SampledAt}
+		weights = []int{1, 3, 2, 1}
+	}
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+
+	// Each scale unit is a pixel of a glyph cell, with a blank row between
+	// lines and a margin around them
+	margin := max(d.Width, d.Height) / 40
+	unit := (d.Height - 2*margin) / (total * (glyphHeight + 2))
+	var scales []int
+	used := 0
+	for i, line := range lines {
+		line = strings.ToUpper(line)
+		lines[i] = line
+		scale := weights[i] * unit
+		if fit := (d.Width - 2*margin) / max(1, len([]rune(line))*(glyphWidth+1)); fit < scale {
+			scale = fit
+		}
+		scale = max(1, scale)
+		scales = append(scales, scale)
+		used += scale * (glyphHeight + 2)
+	}
+
+	y := (d.Height - used) / 2
+	for i, line := range lines {
+		scale := scales[i]
+		x := (d.Width - len([]rune(line))*(glyphWidth+1)*scale + scale) / 2
+		drawText(img, line, x, y+scale, scale)
+		y += scale * (glyphHeight + 2)
+	}
+	return img
+}
+
+// drawText draws a line of text from its top left corner, each glyph pixel
+// a square of scale pixels
+func drawText(img *image.Paletted, text string, x, y, scale int) {
+	for _, r := range text {
+		rows, ok := glyphs[r]
+		if !ok {
+			rows = glyphs['?']
+		}
+		for gy, row := range rows {
+			for gx, c := range row {
+				if c != '#' {
+					continue
+				}
+				for py := 0; py < scale; py++ {
+					for px := 0; px < scale; px++ {
+						img.SetColorIndex(x+gx*scale+px, y+gy*scale+py, 1)
+					}
+				}
+			}
+		}
+		x += (glyphWidth + 1) * scale
+	}
+}
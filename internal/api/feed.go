@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/feed"
+)
+
+// atomFeed is the /api/v1/feed.atom response
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomAuthor is the author of an atomFeed, which Atom requires
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// atomEntry is an entry of an atomFeed
+type atomEntry struct {
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  string       `xml:"updated"`
+	Category atomCategory `xml:"category"`
+	Content  string       `xml:"content,omitempty"`
+}
+
+// atomCategory is the kind of an atomEntry
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// rssFeed is the /api/v1/feed.rss response
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssChannel is the channel of an rssFeed
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+// rssItem is an item of an rssChannel
+type rssItem struct {
+	GUID        rssGUID `xml:"guid"`
+	Title       string  `xml:"title"`
+	Category    string  `xml:"category"`
+	Description string  `xml:"description,omitempty"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+// rssGUID identifies an rssItem without being a link
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+// feedTitle is the title of the feeds
+const feedTitle = "gommutetime alerts and daily summaries"
+
+// handleAtomFeed serves the alerts and daily summaries of the caller's
+// itineraries as an Atom feed
+func (s *Server) handleAtomFeed(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	entries, ok := st.feedEntries(w, u)
+	if !ok {
+		return
+	}
+
+	result := atomFeed{ID: "urn:gommutetime:feed", Title: feedTitle, Author: atomAuthor{Name: "gommutetime"}, Updated: time.Now().UTC().Format(time.RFC3339)}
+	if len(entries) > 0 {
+		result.Updated = entries[0].Time.UTC().Format(time.RFC3339)
+	}
+	for _, e := range entries {
+		result.Entries = append(result.Entries, atomEntry{
+			ID:       "urn:gommutetime:" + e.ID,
+			Title:    e.Title,
+			Updated:  e.Time.UTC().Format(time.RFC3339),
+			Category: atomCategory{Term: e.Kind},
+			Content:  e.Body,
+		})
+	}
+	writeXML(w, "application/atom+xml", result)
+}
+
+// handleRSSFeed serves the alerts and daily summaries of the caller's
+// itineraries as an RSS 2.0 feed
+func (s *Server) handleRSSFeed(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	entries, ok := st.feedEntries(w, u)
+	if !ok {
+		return
+	}
+
+	result := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:       feedTitle,
+		Link:        "http://" + r.Host + "/",
+		Description: "Commute time alerts and daily summaries",
+	}}
+	for _, e := range entries {
+		result.Channel.Items = append(result.Channel.Items, rssItem{
+			GUID:        rssGUID{ID: e.ID},
+			Title:       e.Title,
+			Category:    e.Kind,
+			Description: e.Body,
+			PubDate:     e.Time.Format(time.RFC1123Z),
+		})
+	}
+	writeXML(w, "application/rss+xml", result)
+}
+
+// feedEntries reads the feed entries the caller may see, newest first.
+// Entries of itineraries removed since are only seen by unrestricted
+// callers.
+func (st *state) feedEntries(w http.ResponseWriter, u *user) ([]feed.Entry, bool) {
+	if !st.cfg.Feed.Enabled() {
+		writeError(w, http.StatusNotFound, "the feed is not enabled")
+		return nil, false
+	}
+	entries, err := feed.Load(feed.Path(st.cfg.DataDir))
+	if err != nil {
+		log.Printf("ERROR API failed to read the feed: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read the feed")
+		return nil, false
+	}
+
+	return slices.DeleteFunc(entries, func(e feed.Entry) bool {
+		index := slices.IndexFunc(st.cfg.Itineraries, func(itin config.Itinerary) bool { return itin.ID == e.Itinerary })
+		if index < 0 {
+			return u != nil && len(u.Profiles) > 0
+		}
+		return !u.visible(st.cfg.Itineraries[index])
+	}), true
+}
+
+// writeXML writes v as an XML response body of a content type
+func writeXML(w http.ResponseWriter, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("ERROR encoding API response: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/history"
+	"gommutetime/internal/series"
+)
+
+// The /api/v1/grafana endpoints implement the protocol of the Grafana JSON
+// datasource plugin, for Grafana to chart the recorded samples without a
+// database in between. A metric is an itinerary, charted from its samples
+// or its hourly or daily series as chosen in the query's payload.
+
+// Payload options of Grafana queries
+const (
+	// grafanaResolution is raw samples, hour or day
+	grafanaResolution = "resolution"
+	// grafanaStat is the statistic of series points: mean, min, max or count
+	grafanaStat = "stat"
+	// grafanaSamples charts every sample
+	grafanaSamples = "samples"
+)
+
+// grafanaStats are the statistics of series points Grafana can chart
+var grafanaStats = []string{"mean", "min", "max", "count"}
+
+// grafanaMetric is an entry of the /api/v1/grafana/metrics response
+type grafanaMetric struct {
+	Label    string           `json:"label"`
+	Value    string           `json:"value"`
+	Payloads []grafanaPayload `json:"payloads"`
+}
+
+// grafanaPayload is an option of the queries of a metric
+type grafanaPayload struct {
+	Label   string          `json:"label"`
+	Name    string          `json:"name"`
+	Type    string          `json:"type"`
+	Options []grafanaOption `json:"options"`
+}
+
+// grafanaOption is a value of a payload option or a variable
+type grafanaOption struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// grafanaQuery is the body of /api/v1/grafana/query requests
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		RefID   string            `json:"refId"`
+		Target  string            `json:"target"`
+		Hide    bool              `json:"hide"`
+		Payload map[string]string `json:"payload"`
+	} `json:"targets"`
+}
+
+// grafanaSeries is a time series of the /api/v1/grafana/query response.
+// Datapoints are [value, Unix milliseconds] pairs.
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// handleGrafanaHealth answers the connection test of the datasource
+func (s *Server) handleGrafanaHealth(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+// handleGrafanaMetrics lists the itineraries the caller may chart, with
+// the options of their queries
+func (s *Server) handleGrafanaMetrics(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	resolutions := []grafanaOption{
+		{Label: "Every sample", Value: grafanaSamples},
+		{Label: "Hourly", Value: history.ResolutionHour},
+		{Label: "Daily", Value: history.ResolutionDay},
+	}
+	var stats []grafanaOption
+	for _, stat := range grafanaStats {
+		stats = append(stats, grafanaOption{Label: stat, Value: stat})
+	}
+	payloads := []grafanaPayload{
+		{Label: "Resolution", Name: grafanaResolution, Type: "select", Options: resolutions},
+		{Label: "Statistic (hourly and daily)", Name: grafanaStat, Type: "select", Options: stats},
+	}
+
+	result := []grafanaMetric{}
+	for _, itin := range st.cfg.Itineraries {
+		if u.visible(itin) && !itin.IsMatrix() {
+			result = append(result, grafanaMetric{Label: itin.Name, Value: itin.ID, Payloads: payloads})
+		}
+	}
+	writeJSON(w, result)
+}
+
+// handleGrafanaVariable lists the itineraries the caller may chart, as the
+// values of a dashboard variable
+func (s *Server) handleGrafanaVariable(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	result := []map[string]string{}
+	for _, itin := range st.cfg.Itineraries {
+		if u.visible(itin) && !itin.IsMatrix() {
+			result = append(result, map[string]string{"__text": itin.Name, "__value": itin.ID})
+		}
+	}
+	writeJSON(w, result)
+}
+
+// handleGrafanaQuery returns the time series of the queried itineraries in
+// the time range of the request, named after the itinerary and the
+// statistic of series. A target may list itineraries like {work,gym}, as
+// Grafana formats variables with several values.
+func (s *Server) handleGrafanaQuery(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	var query grafanaQuery
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigSize)).Decode(&query); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid query: "+err.Error())
+		return
+	}
+
+	result := []grafanaSeries{}
+	for _, target := range query.Targets {
+		if target.Hide {
+			continue
+		}
+		resolution := target.Payload[grafanaResolution]
+		if resolution == "" {
+			resolution = grafanaSamples
+		}
+		if resolution != grafanaSamples && resolution != history.ResolutionHour && resolution != history.ResolutionDay {
+			writeError(w, http.StatusBadRequest, "resolution must be samples, hour or day")
+			return
+		}
+		stat := target.Payload[grafanaStat]
+		if stat == "" {
+			stat = "mean"
+		}
+		if !slices.Contains(grafanaStats, stat) {
+			writeError(w, http.StatusBadRequest, "stat must be one of "+strings.Join(grafanaStats, ", "))
+			return
+		}
+
+		for _, id := range strings.Split(strings.Trim(target.Target, "{}"), ",") {
+			index := slices.IndexFunc(st.cfg.Itineraries, func(itin config.Itinerary) bool {
+				return itin.ID == id && u.visible(itin)
+			})
+			if index < 0 {
+				writeError(w, http.StatusBadRequest, "unknown itinerary: "+id)
+				return
+			}
+			itin := st.cfg.Itineraries[index]
+
+			datapoints, err := grafanaDatapoints(st.cfg, itin, resolution, stat, query.Range.From, query.Range.To)
+			if err != nil {
+				log.Printf("ERROR loading samples of %s for Grafana: %v", itin.ID, err)
+				writeError(w, http.StatusInternalServerError, "failed to load samples")
+				return
+			}
+			name := itin.ID
+			if resolution != grafanaSamples {
+				name += " " + stat
+			}
+			result = append(result, grafanaSeries{Target: name, Datapoints: datapoints})
+		}
+	}
+	writeJSON(w, result)
+}
+
+// grafanaDatapoints returns the samples or series points of an itinerary
+// taken from from (inclusive) to to (exclusive)
+func grafanaDatapoints(cfg *config.Config, itin config.Itinerary, resolution, stat string, from, to time.Time) ([][2]float64, error) {
+	datapoints := [][2]float64{}
+	if cfg.DataDir == "" || itin.OutputFile == "" {
+		return datapoints, nil
+	}
+	path := filepath.Join(cfg.DataDir, itin.OutputFile)
+
+	if resolution == grafanaSamples {
+		err := history.Scan(path, from, to, func(smp history.Sample) error {
+			datapoints = append(datapoints, [2]float64{smp.Duration, float64(smp.Timestamp.UnixMilli())})
+			return nil
+		})
+		return datapoints, err
+	}
+
+	points, err := series.Load(cfg, path, resolution, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range points {
+		value := p.Stats.Mean
+		switch stat {
+		case "min":
+			value = p.Stats.Min
+		case "max":
+			value = p.Stats.Max
+		case "count":
+			value = float64(p.Stats.Count)
+		}
+		datapoints = append(datapoints, [2]float64{value, float64(p.Period.UnixMilli())})
+	}
+	return datapoints, nil
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"gommutetime/internal/audit"
+	"gommutetime/internal/events"
+	"gommutetime/internal/history"
+)
+
+const (
+	// maxIngestMinutes bounds the duration of submitted samples
+	maxIngestMinutes = 24 * 60
+	// ingestSkew is how far in the future a submitted sample may be taken,
+	// for agents whose clock runs ahead
+	ingestSkew = 5 * time.Minute
+)
+
+// sourcePattern matches the names agents submitting samples give themselves
+var sourcePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ingestRequest is the body of POST /api/v1/itineraries/{id}/samples
+type ingestRequest struct {
+	// Timestamp is when the commute was observed, now when unset
+	Timestamp time.Time `json:"timestamp"`
+	Minutes   float64   `json:"duration_minutes"`
+	// Source names the agent, recorded as the sample's schedule
+	Source string `json:"source"`
+}
+
+// PublishTo publishes the samples submitted from now on to an event bus,
+// for the writers and integrations subscribed to recorded samples
+func (s *Server) PublishTo(bus *events.Bus) {
+	s.bus.Store(bus)
+}
+
+// handleIngest records a commute time observed by an external agent, e.g. a
+// phone automation or another machine. The sample is marked with the
+// external provider and its source as schedule, so that it can be told
+// apart from fetched ones.
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	itin, ok := st.itinerary(w, r, u)
+	if !ok {
+		return
+	}
+
+	var req ingestRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigSize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid sample: "+err.Error())
+		return
+	}
+	if req.Timestamp.IsZero() {
+		req.Timestamp = time.Now()
+	}
+	if req.Source == "" {
+		req.Source = history.ExternalProvider
+	}
+	switch {
+	case itin.IsMatrix():
+		writeError(w, http.StatusBadRequest, "matrix itineraries do not take single samples")
+		return
+	case req.Minutes <= 0 || req.Minutes > maxIngestMinutes:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("duration_minutes must be above 0 and at most %d", maxIngestMinutes))
+		return
+	case req.Timestamp.After(time.Now().Add(ingestSkew)):
+		writeError(w, http.StatusBadRequest, "timestamp is in the future")
+		return
+	case !sourcePattern.MatchString(req.Source):
+		writeError(w, http.StatusBadRequest, "source must be up to 64 letters, digits, dots, dashes or underscores")
+		return
+	}
+	if st.cfg.ReadOnly || st.cfg.DataDir == "" || itin.OutputFile == "" {
+		writeError(w, http.StatusConflict, "samples are not written in read-only mode")
+		return
+	}
+
+	smp := history.Sample{
+		Timestamp: req.Timestamp.Truncate(time.Second),
+		Duration:  req.Minutes,
+		Provider:  history.ExternalProvider,
+		Schedule:  req.Source,
+		Tags:      itin.Tags,
+	}
+	if err := history.Append(filepath.Join(st.cfg.DataDir, itin.OutputFile), smp); err != nil {
+		log.Printf("ERROR recording sample of %s from API: %v", itin.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to record sample")
+		return
+	}
+	s.audit.Record(u.name(), audit.ActionIngest, itin.ID, fmt.Sprintf("%.1f min from %s", smp.Duration, smp.Schedule))
+	s.bus.Load().Publish(r.Context(), events.Event{Kind: events.SampleRecorded, Time: smp.Timestamp,
+		Itinerary: itin, Sample: smp})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, sample{
+		Timestamp: smp.Timestamp,
+		Minutes:   smp.Duration,
+		Provider:  smp.Provider,
+		Schedule:  smp.Schedule,
+		Tags:      smp.Tags,
+	})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/jobhistory"
+	"gommutetime/internal/scheduler"
+)
+
+const (
+	// defaultJobRuns is how many job runs are listed by default
+	defaultJobRuns = 100
+	// maxJobRuns bounds the job runs listed
+	maxJobRuns = 10000
+)
+
+// handleJobHistory lists the latest runs of the jobs of the caller's
+// itineraries, newest first. ?itinerary= and ?outcome=succeeded|failed
+// filter them, and ?limit=100 bounds how many are listed.
+func (s *Server) handleJobHistory(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	query := r.URL.Query()
+	outcome := query.Get("outcome")
+	if outcome != "" && outcome != scheduler.JobSucceeded && outcome != scheduler.JobFailed {
+		writeError(w, http.StatusBadRequest, "outcome must be succeeded or failed")
+		return
+	}
+	limit := defaultJobRuns
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxJobRuns {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxJobRuns))
+			return
+		}
+		limit = n
+	}
+
+	result := []jobhistory.Run{}
+	path := st.cfg.JobHistoryPath()
+	if path == "" {
+		writeJSON(w, result)
+		return
+	}
+	runs, err := jobhistory.Load(path)
+	if err != nil {
+		log.Printf("ERROR API failed to read the job history: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read the job history")
+		return
+	}
+
+	// Runs of itineraries removed since are only seen by unrestricted
+	// callers
+	runs = slices.DeleteFunc(runs, func(run jobhistory.Run) bool {
+		index := slices.IndexFunc(st.cfg.Itineraries, func(itin config.Itinerary) bool { return itin.ID == run.Itinerary })
+		if index < 0 {
+			return u != nil && len(u.Profiles) > 0
+		}
+		return !u.visible(st.cfg.Itineraries[index])
+	})
+	result = append(result, jobhistory.Select(runs, query.Get("itinerary"), outcome, limit)...)
+	writeJSON(w, result)
+}
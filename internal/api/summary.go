@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"gommutetime/internal/notify"
+	"gommutetime/internal/statuspage"
+)
+
+// usualMinutes is the largest difference from the baseline still spoken of
+// as usual
+const usualMinutes = 1.0
+
+// CompareWith compares the commute times of summaries with the baselines
+// of notifier, the ones alerts are worded with
+func (s *Server) CompareWith(notifier *notify.Manager) {
+	s.notifier.Store(notifier)
+}
+
+// handleSummary words the latest commute times of the caller's itineraries
+// for voice assistants, e.g. "Home to work is currently 34 minutes, 6 more
+// than usual.", as plain text or with ?format=ssml as SSML. ?itinerary=work
+// only words one.
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request, st *state, u *user) {
+	id := r.URL.Query().Get("itinerary")
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "text" && format != "ssml" {
+		writeError(w, http.StatusBadRequest, "format must be text or ssml")
+		return
+	}
+
+	now := time.Now()
+	found := false
+	var sentences []string
+	for _, itin := range st.cfg.Itineraries {
+		if (id != "" && itin.ID != id) || !u.visible(itin) || itin.IsMatrix() {
+			continue
+		}
+		found = true
+
+		current, err := statuspage.Current(st.cfg, itin, now)
+		if err != nil {
+			log.Printf("ERROR API failed to read samples of %s: %v", itin.ID, err)
+			writeError(w, http.StatusInternalServerError, "failed to read samples")
+			return
+		}
+		if current.Minutes == nil {
+			sentences = append(sentences, fmt.Sprintf("There is no recent commute time for %s.", itin.Name))
+			continue
+		}
+		var usual float64
+		if notifier := s.notifier.Load(); notifier != nil {
+			usual = notifier.Baseline(itin, *current.SampledAt).Mean
+		}
+		sentences = append(sentences, summarize(itin.Name, *current.Minutes, usual))
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "unknown itinerary: "+id)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if format == "ssml" {
+		var b strings.Builder
+		b.WriteString("<speak>")
+		for _, sentence := range sentences {
+			b.WriteString("<s>" + html.EscapeString(sentence) + "</s>")
+		}
+		b.WriteString("</speak>\n")
+		w.Header().Set("Content-Type", "application/ssml+xml")
+		fmt.Fprint(w, b.String())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, strings.Join(sentences, " "))
+}
+
+// summarize words a commute time and how it compares with the usual one,
+// which is zero when unknown
+func summarize(name string, minutes, usual float64) string {
+	sentence := fmt.Sprintf("%s is currently %s", name, pluralMinutes(math.Round(minutes)))
+	if usual <= 0 {
+		return sentence + "."
+	}
+	switch diff := math.Round(minutes - usual); {
+	case math.Abs(minutes-usual) <= usualMinutes:
+		return sentence + ", about as usual."
+	case diff > 0:
+		return fmt.Sprintf("%s, %.0f more than usual.", sentence, diff)
+	default:
+		return fmt.Sprintf("%s, %.0f less than usual.", sentence, -diff)
+	}
+}
+
+// pluralMinutes words a whole number of minutes
+func pluralMinutes(minutes float64) string {
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%.0f minutes", minutes)
+}
@@ -0,0 +1,115 @@
+package apperr
+
+import (
+	"errors"
+	"strings"
+)
+
+// Kind categorizes errors so callers can react differently to each
+type Kind int
+
+const (
+	// KindUnknown is any error that was not categorized
+	KindUnknown Kind = iota
+	// KindConfig is an invalid or unreadable configuration
+	KindConfig
+	// KindProvider is a failed request to the routing provider
+	KindProvider
+	// KindQuota is a provider rejection due to exceeded quota or rate limits
+	KindQuota
+	// KindStorage is a failure reading or writing collected data
+	KindStorage
+)
+
+// Process exit codes for each error kind
+const (
+	ExitUnknown  = 1
+	ExitConfig   = 3
+	ExitProvider = 4
+	ExitQuota    = 5
+	ExitStorage  = 6
+)
+
+// String returns the name used in log fields
+func (k Kind) String() string {
+	switch k {
+	case KindConfig:
+		return "config"
+	case KindProvider:
+		return "provider"
+	case KindQuota:
+		return "quota"
+	case KindStorage:
+		return "storage"
+	default:
+		return "unknown"
+	}
+}
+
+// ExitCode returns the process exit code for the kind
+func (k Kind) ExitCode() int {
+	switch k {
+	case KindConfig:
+		return ExitConfig
+	case KindProvider:
+		return ExitProvider
+	case KindQuota:
+		return ExitQuota
+	case KindStorage:
+		return ExitStorage
+	default:
+		return ExitUnknown
+	}
+}
+
+// Error is an error tagged with a kind
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap tags err with kind, returning nil for a nil error
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// KindOf returns the kind of the first tagged error in err's chain
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindUnknown
+}
+
+// ExitCode returns the process exit code for err
+func ExitCode(err error) int {
+	return KindOf(err).ExitCode()
+}
+
+// quotaStatuses are provider statuses reporting exhausted quota
+var quotaStatuses = []string{"OVER_QUERY_LIMIT", "OVER_DAILY_LIMIT", "RESOURCE_EXHAUSTED"}
+
+// Provider tags a provider error, recognizing quota rejections
+func Provider(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, status := range quotaStatuses {
+		if strings.Contains(err.Error(), status) {
+			return Wrap(KindQuota, err)
+		}
+	}
+	return Wrap(KindProvider, err)
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"gommutetime/internal/apperr"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionStart        = "daemon.start"
+	ActionStop         = "daemon.stop"
+	ActionReload       = "config.reload"
+	ActionReloadFailed = "config.reload_failed"
+	ActionReplace      = "config.replace"
+	ActionRollback     = "config.rollback"
+	ActionSync         = "config.sync"
+	ActionRun          = "itinerary.run"
+	ActionPause        = "itinerary.pause"
+	ActionResume       = "itinerary.resume"
+	ActionPurge        = "itinerary.purge"
+	ActionIngest       = "itinerary.ingest"
+	ActionBackup       = "data.backup"
+	ActionAnnotate     = "annotation.add"
+	ActionUnannotate   = "annotation.remove"
+)
+
+// Actors of changes not made through the API
+const (
+	// ActorDaemon starts and stops the daemon
+	ActorDaemon = "daemon"
+	// ActorConfigFile makes changes by editing the config file
+	ActorConfigFile = "config-file"
+	// ActorGit makes changes by pulling the config from a git repository
+	ActorGit = "git"
+)
+
+// Entry is one line of the audit log
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Log appends entries to a JSON lines file that is never rewritten. A Log
+// without a file only writes entries to the process log.
+type Log struct {
+	mu   sync.Mutex
+	path string
+}
+
+// New creates an audit log appending to path, or only logging when path is
+// empty
+func New(path string) *Log {
+	return &Log{path: path}
+}
+
+// Record appends an entry. Failures to write are logged rather than
+// returned so that auditing never blocks the audited change.
+func (l *Log) Record(actor, action, target, detail string) {
+	entry := Entry{Time: time.Now(), Actor: actor, Action: action, Target: target, Detail: detail}
+	message := action
+	if target != "" {
+		message += " " + target
+	}
+	if detail != "" {
+		message += " (" + detail + ")"
+	}
+	log.Printf("Audit: %s by %s", message, actor)
+
+	if l == nil || l.path == "" {
+		return
+	}
+	if err := l.append(entry); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// append writes an entry as one JSON line
+func (l *Log) append(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to open audit log: %w", err))
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write audit log: %w", err))
+	}
+	return nil
+}
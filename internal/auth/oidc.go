@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, expired, not
+// signed by the provider or not meant for this application
+var ErrInvalidToken = errors.New("invalid token")
+
+// jwksRefreshInterval is how long provider keys are cached before being
+// fetched again; unknown key IDs trigger an earlier refresh
+const jwksRefreshInterval = time.Hour
+
+// OIDC verifies ID and access tokens issued by an OpenID Connect provider
+type OIDC struct {
+	issuer   string
+	audience string
+	client   *http.Client
+
+	mu      sync.Mutex
+	jwksURI string
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// NewOIDC creates a verifier for tokens from issuer, e.g.
+// https://auth.example.com, that name audience in their aud claim. The
+// provider's keys are discovered on first use.
+func NewOIDC(issuer, audience string, client *http.Client) *OIDC {
+	return &OIDC{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		audience: audience,
+		client:   client,
+	}
+}
+
+// Verify checks a signed JWT and returns its claims
+func (o *OIDC) Verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: bad header: %v", ErrInvalidToken, err)
+	}
+
+	key, err := o.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad claims: %v", ErrInvalidToken, err)
+	}
+	if err := o.checkClaims(claims, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
+
+// checkClaims validates the issuer, audience and validity period
+func (o *OIDC) checkClaims(claims map[string]any, now time.Time) error {
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != o.issuer {
+		return fmt.Errorf("issued by %q", iss)
+	}
+
+	var audiences []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = []string{aud}
+	case []any:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+	if !slices.Contains(audiences, o.audience) {
+		return fmt.Errorf("not issued for %s", o.audience)
+	}
+
+	// Allow a little clock skew with the provider
+	const leeway = time.Minute
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return errors.New("expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("not valid yet")
+	}
+
+	return nil
+}
+
+// key returns the provider key with the given ID, refreshing the key set
+// when it is stale or does not have the key
+func (o *OIDC) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key, ok := o.keys[kid]; ok && time.Since(o.fetched) < jwksRefreshInterval {
+		return key, nil
+	}
+
+	// Avoid hammering the provider with tokens naming unknown keys
+	if time.Since(o.fetched) < 10*time.Second {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+	if err := o.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	key, ok := o.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// refresh discovers the provider's key set URL if needed and fetches its keys
+func (o *OIDC) refresh(ctx context.Context) error {
+	if o.jwksURI == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := o.getJSON(ctx, o.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return fmt.Errorf("failed to discover OIDC provider: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return fmt.Errorf("OIDC provider %s has no jwks_uri", o.issuer)
+		}
+		o.jwksURI = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := o.getJSON(ctx, o.jwksURI, &set); err != nil {
+		return fmt.Errorf("failed to fetch OIDC provider keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	o.keys = keys
+	o.fetched = time.Now()
+	return nil
+}
+
+// getJSON fetches and decodes a JSON document
+func (o *OIDC) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: HTTP %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// jwk is a JSON Web Key with the fields of RSA and EC public keys
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts the JWK to an RSA or ECDSA public key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// verifySignature checks a JWS signature over signed with the algorithm
+// named in the token header
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var h func() hash.Hash
+	var hashID crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		h, hashID = sha256.New, crypto.SHA256
+	case "RS384", "ES384":
+		h, hashID = sha512.New384, crypto.SHA384
+	case "RS512":
+		h, hashID = sha512.New, crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	digest := h()
+	digest.Write([]byte(signed))
+	sum := digest.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm %s does not match RSA key", alg)
+		}
+		return rsa.VerifyPKCS1v15(key, hashID, sum, signature)
+	case *ecdsa.PublicKey:
+		// Each algorithm has its own curve
+		curves := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384()}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if curves[alg] != key.Curve || len(signature) != 2*size {
+			return fmt.Errorf("algorithm %s does not match EC key", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, sum, r, s) {
+			return errors.New("bad signature")
+		}
+		return nil
+	default:
+		return errors.New("unsupported key")
+	}
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeInt decodes a base64url big-endian integer
+func decodeInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// hashScheme prefixes password hashes, which read
+	// pbkdf2-sha256$<iterations>$<salt>$<key> with base64 salt and key
+	hashScheme     = "pbkdf2-sha256"
+	hashIterations = 600000
+	saltLength     = 16
+	keyLength      = 32
+)
+
+// DummyHash is a valid hash matching no password, to verify the passwords of
+// unknown users against so that they take as long to reject as wrong ones
+var DummyHash = fmt.Sprintf("%s$%d$%s$%s", hashScheme, hashIterations,
+	base64.RawStdEncoding.EncodeToString(make([]byte, saltLength)), base64.RawStdEncoding.EncodeToString(make([]byte, keyLength)))
+
+// HashPassword derives a salted hash of password for storing in the config
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, hashIterations, keyLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return fmt.Sprintf("%s$%d$%s$%s", hashScheme, hashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword reports whether password matches a hash from HashPassword
+func VerifyPassword(hash, password string) bool {
+	iterations, salt, key, err := parseHash(hash)
+	if err != nil {
+		return false
+	}
+
+	derived, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(key))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(derived, key) == 1
+}
+
+// CheckHash reports whether hash is in the format produced by HashPassword
+func CheckHash(hash string) error {
+	_, _, _, err := parseHash(hash)
+	return err
+}
+
+// parseHash splits a password hash into its parameters
+func parseHash(hash string) (iterations int, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return 0, nil, nil, fmt.Errorf("password hash must look like %s$<iterations>$<salt>$<key> (use the hash-password command)", hashScheme)
+	}
+
+	iterations, err = strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return 0, nil, nil, fmt.Errorf("invalid password hash iterations: %s", parts[1])
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return 0, nil, nil, fmt.Errorf("invalid password hash salt: %w", err)
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil || len(key) == 0 {
+		return 0, nil, nil, fmt.Errorf("invalid password hash key")
+	}
+
+	return iterations, salt, key, nil
+}
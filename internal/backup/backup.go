@@ -0,0 +1,379 @@
+// Package backup archives the config file and data directory as a
+// zstd-compressed tar file and restores them, e.g. on a new machine
+package backup
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/history"
+)
+
+// formatVersion is the version of the archive layout
+const formatVersion = 1
+
+// Archive layout: the manifest comes first, then the config file, the data
+// directory and an audit log kept outside of it
+const (
+	manifestName = "manifest.json"
+	configDir    = "config/"
+	dataDir      = "data/"
+	auditDir     = "audit/"
+)
+
+// Manifest describes a backup
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// ConfigFile is the base name of the backed up config file
+	ConfigFile string `json:"config_file"`
+	// DataDir is where the data directory was backed up from
+	DataDir string `json:"data_dir,omitempty"`
+}
+
+// Create writes a backup of the config file at configPath and the data
+// directory of cfg, returning how many files it holds. Indexes, temporary
+// files and scheduled backups in the data directory are left out. Files are
+// opened together between appends, so that a running daemon can keep
+// recording while they are copied and the backup only holds whole rows.
+func Create(w io.Writer, cfg *config.Config, configPath string) (int, error) {
+	entries, err := listFiles(cfg, configPath)
+	if err != nil {
+		return 0, err
+	}
+
+	// Record the files as they are at one instant
+	unfreeze := history.Freeze()
+	snapshot := make([]snapshotFile, 0, len(entries))
+	for _, e := range entries {
+		file, err := os.Open(e.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			var info fs.FileInfo
+			if info, err = file.Stat(); err == nil {
+				snapshot = append(snapshot, snapshotFile{name: e.name, file: file, info: info})
+				continue
+			}
+			file.Close()
+		}
+		unfreeze()
+		closeAll(snapshot)
+		return 0, fmt.Errorf("failed to back up %s: %w", e.path, err)
+	}
+	unfreeze()
+	defer closeAll(snapshot)
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return 0, err
+	}
+	tw := tar.NewWriter(zw)
+
+	manifest := Manifest{
+		Version:    formatVersion,
+		Created:    time.Now(),
+		ConfigFile: filepath.Base(configPath),
+	}
+	if cfg.DataDir != "" {
+		manifest.DataDir, _ = filepath.Abs(cfg.DataDir)
+	}
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := writeEntry(tw, manifestName, 0644, manifest.Created, data); err != nil {
+		return 0, err
+	}
+
+	for _, f := range snapshot {
+		if err := addFile(tw, f); err != nil {
+			return 0, fmt.Errorf("failed to back up %s: %w", f.file.Name(), err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	return len(snapshot), zw.Close()
+}
+
+// archiveFile is a file to back up and its name in the archive
+type archiveFile struct {
+	name string
+	path string
+}
+
+// listFiles lists the files to back up: the config file as written (not as
+// overridden by the environment), the data directory and an audit log kept
+// outside of it
+func listFiles(cfg *config.Config, configPath string) ([]archiveFile, error) {
+	files := []archiveFile{{name: configDir + filepath.Base(configPath), path: configPath}}
+
+	if cfg.DataDir != "" {
+		skipDir := cfg.BackupDir()
+		err := filepath.WalkDir(cfg.DataDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if p == cfg.DataDir && errors.Is(err, fs.ErrNotExist) {
+					return filepath.SkipAll
+				}
+				return err
+			}
+			// Temporary files and clones start with a dot
+			if p != cfg.DataDir && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				if same(p, skipDir) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || strings.HasSuffix(p, ".idx") {
+				return nil
+			}
+
+			rel, err := filepath.Rel(cfg.DataDir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, archiveFile{name: dataDir + filepath.ToSlash(rel), path: p})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list data directory: %w", err)
+		}
+	}
+
+	if audit := cfg.AuditPath(); audit != "" && !within(audit, cfg.DataDir) {
+		files = append(files, archiveFile{name: auditDir + filepath.Base(audit), path: audit})
+	}
+	return files, nil
+}
+
+// snapshotFile is a file opened for backup and its size at the time
+type snapshotFile struct {
+	name string
+	file *os.File
+	info fs.FileInfo
+}
+
+// closeAll closes the files of a snapshot
+func closeAll(files []snapshotFile) {
+	for _, f := range files {
+		f.file.Close()
+	}
+}
+
+// addFile adds a file to the archive, up to its size in the snapshot
+func addFile(tw *tar.Writer, f snapshotFile) error {
+	header := &tar.Header{
+		Name:    f.name,
+		Mode:    int64(f.info.Mode().Perm()),
+		Size:    f.info.Size(),
+		ModTime: f.info.ModTime(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(tw, f.file, f.info.Size())
+	return err
+}
+
+// writeEntry adds a file with the given content to the archive
+func writeEntry(tw *tar.Writer, name string, mode int64, modTime time.Time, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: int64(len(data)), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// RestoreOptions selects where a backup is restored to
+type RestoreOptions struct {
+	// ConfigPath is where the config file is written
+	ConfigPath string
+	// DataDir overrides the data_dir of the restored config
+	DataDir string
+	// Force overwrites an existing config file and files in a non-empty
+	// data directory
+	Force bool
+}
+
+// Restore extracts a backup, writing the config file first, then the data
+// directory it names (or opts.DataDir) and any audit log kept outside of it.
+// Nothing is written when the config file exists or the data directory is
+// not empty, unless opts.Force is set.
+func Restore(r io.Reader, opts RestoreOptions) (Manifest, int, error) {
+	var manifest Manifest
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return manifest, 0, err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != manifestName {
+		return manifest, 0, invalid(fmt.Errorf("missing %s", manifestName))
+	}
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return manifest, 0, invalid(err)
+	}
+	if manifest.Version != formatVersion {
+		return manifest, 0, invalid(fmt.Errorf("unsupported version %d", manifest.Version))
+	}
+
+	// The config file comes next and tells where data goes
+	header, err = tr.Next()
+	if err != nil || !strings.HasPrefix(header.Name, configDir) {
+		return manifest, 0, invalid(fmt.Errorf("missing config file"))
+	}
+	if _, err := os.Stat(opts.ConfigPath); err == nil && !opts.Force {
+		return manifest, 0, apperr.Wrap(apperr.KindConfig, fmt.Errorf("%s already exists; pass -force to overwrite it", opts.ConfigPath))
+	}
+	cfg, staged, err := stageConfig(tr, header, opts.ConfigPath)
+	if err != nil {
+		return manifest, 0, err
+	}
+	defer os.Remove(staged)
+
+	target := opts.DataDir
+	if target == "" {
+		target = cfg.DataDir
+	}
+	if target == "" {
+		return manifest, 0, apperr.Wrap(apperr.KindConfig, fmt.Errorf("the restored config has no data_dir; pass -data-dir"))
+	}
+	if entries, err := os.ReadDir(target); err == nil && len(entries) > 0 && !opts.Force {
+		return manifest, 0, apperr.Wrap(apperr.KindConfig, fmt.Errorf("data directory %s is not empty; pass -force to overwrite its files", target))
+	}
+	if err := os.Rename(staged, opts.ConfigPath); err != nil {
+		return manifest, 0, apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write config file: %w", err))
+	}
+	files := 1
+	auditPath := ""
+	if cfg.AuditLog != "" && filepath.IsAbs(cfg.AuditLog) {
+		auditPath = cfg.AuditLog
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, files, invalid(err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		var dest string
+		switch {
+		case strings.HasPrefix(header.Name, dataDir):
+			rel := strings.TrimPrefix(header.Name, dataDir)
+			// Refuse names escaping the data directory
+			if clean := path.Clean(rel); clean != rel || !fs.ValidPath(clean) {
+				return manifest, files, invalid(fmt.Errorf("unsafe file name %s", header.Name))
+			}
+			dest = filepath.Join(target, filepath.FromSlash(rel))
+		case strings.HasPrefix(header.Name, auditDir) && auditPath != "":
+			dest = auditPath
+		default:
+			continue
+		}
+
+		if err := extract(tr, dest, os.FileMode(header.Mode).Perm(), header.ModTime); err != nil {
+			return manifest, files, apperr.Wrap(apperr.KindStorage, err)
+		}
+		files++
+	}
+	return manifest, files, nil
+}
+
+// stageConfig writes the config file of a backup next to configPath,
+// returning it as loaded with the environment applied and the path of the
+// staged file, which the caller renames or removes
+func stageConfig(r io.Reader, header *tar.Header, configPath string) (*config.Config, string, error) {
+	dir := filepath.Dir(configPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, "", apperr.Wrap(apperr.KindStorage, err)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(configPath)+".*")
+	if err != nil {
+		return nil, "", apperr.Wrap(apperr.KindStorage, err)
+	}
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, "", apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write config file: %w", err))
+	}
+	os.Chmod(tmp.Name(), os.FileMode(header.Mode).Perm())
+
+	cfg, err := config.LoadConfig(tmp.Name())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, "", err
+	}
+	return cfg, tmp.Name(), nil
+}
+
+// extract writes a file of the archive to dest
+func extract(r io.Reader, dest string, mode os.FileMode, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to restore %s: %w", dest, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	os.Chtimes(dest, modTime, modTime)
+	return nil
+}
+
+// invalid reports a damaged or foreign archive
+func invalid(err error) error {
+	return apperr.Wrap(apperr.KindStorage, fmt.Errorf("invalid backup: %w", err))
+}
+
+// same reports whether two paths name the same directory
+func same(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
+
+// within reports whether p is inside dir
+func within(p, dir string) bool {
+	if dir == "" {
+		return false
+	}
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,180 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gommutetime/internal/config"
+)
+
+// Scheduled backups are named with the time they were made, so that they
+// sort chronologically
+const (
+	filePrefix = "gommutetime-"
+	fileSuffix = ".tar.zst"
+	timeFormat = "20060102-150405"
+)
+
+// defaultKeep is how many scheduled backups are kept by default
+const defaultKeep = 7
+
+// Job makes the daily backups configured in backup, removing the oldest
+// ones beyond backup.keep
+type Job struct {
+	configPath string
+	mu         sync.Mutex
+	cfg        *config.Config
+	reload     chan struct{}
+}
+
+// NewJob creates the backup job of a config file
+func NewJob(configPath string, cfg *config.Config) *Job {
+	return &Job{configPath: configPath, cfg: cfg, reload: make(chan struct{}, 1)}
+}
+
+// Reload switches to a new config, rescheduling the next backup
+func (j *Job) Reload(cfg *config.Config) {
+	j.mu.Lock()
+	j.cfg = cfg
+	j.mu.Unlock()
+
+	select {
+	case j.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Run makes backups at the configured time until ctx is cancelled
+func (j *Job) Run(ctx context.Context) {
+	for {
+		j.mu.Lock()
+		cfg := j.cfg
+		j.mu.Unlock()
+
+		// Wait for a reload when backups are disabled
+		var due <-chan time.Time
+		var timer *time.Timer
+		if cfg.Backup.Enabled() {
+			hour, minute, _ := config.ParseTime(cfg.Backup.Time)
+			timer = time.NewTimer(time.Until(nextRun(time.Now(), hour, minute)))
+			due = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.reload:
+			if timer != nil {
+				timer.Stop()
+			}
+			continue
+		case <-due:
+		}
+
+		path, err := Scheduled(cfg, j.configPath)
+		if err != nil {
+			log.Printf("ERROR: scheduled backup failed: %v", err)
+			continue
+		}
+		log.Printf("Backup written to %s", path)
+	}
+}
+
+// nextRun returns the next time of day at hour:minute after now
+func nextRun(now time.Time, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Scheduled writes a backup to the backup directory of cfg and removes the
+// oldest ones beyond backup.keep, returning the path of the new backup
+func Scheduled(cfg *config.Config, configPath string) (string, error) {
+	dir := cfg.BackupDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(dir, filePrefix+time.Now().Format(timeFormat)+fileSuffix)
+	if _, err := WriteFile(path, cfg, configPath); err != nil {
+		return "", err
+	}
+
+	keep := cfg.Backup.Keep
+	if keep == 0 {
+		keep = defaultKeep
+	}
+	if err := prune(dir, keep); err != nil {
+		log.Printf("Warning: failed to remove old backups: %v", err)
+	}
+	return path, nil
+}
+
+// WriteFile writes a backup to path, replacing it only once complete
+func WriteFile(path string, cfg *config.Config, configPath string) (int, error) {
+	var files int
+	err := writeAtomic(path, func(w io.Writer) (err error) {
+		files, err = Create(w, cfg, configPath)
+		return err
+	})
+	return files, err
+}
+
+// writeAtomic writes a backup to a temporary file renamed to path once
+// write succeeds
+func writeAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	// Backups hold API keys and password hashes
+	os.Chmod(tmp.Name(), 0600)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+// prune removes the oldest scheduled backups of dir beyond keep
+func prune(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	slices.Sort(backups)
+
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package caldav reads the events of a CalDAV (RFC 4791) calendar over a
+// time range. The server expands recurring events, so each occurrence is
+// returned as an event of its own.
+package caldav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"gommutetime/internal/ical"
+)
+
+// maxResponseSize bounds the size of calendar responses
+const maxResponseSize = 16 << 20
+
+// queryTemplate is a calendar-query REPORT for the events of a time range,
+// expanded by the server
+const queryTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-data>
+      <C:expand start="%[1]s" end="%[2]s"/>
+    </C:calendar-data>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="%[1]s" end="%[2]s"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>
+`
+
+// multistatus is the response to a calendar-query
+type multistatus struct {
+	Responses []struct {
+		Propstats []struct {
+			CalendarData string `xml:"prop>calendar-data"`
+			Status       string `xml:"status"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// Events reads the events of the calendar collection at url that overlap
+// [start, end), authenticating with HTTP Basic when username is set
+func Events(ctx context.Context, client *http.Client, url, username, password string, start, end time.Time) ([]ical.Event, error) {
+	stamp := func(t time.Time) string { return t.UTC().Format("20060102T150405Z") }
+	body := fmt.Sprintf(queryTemplate, stamp(start), stamp(end))
+	req, err := http.NewRequestWithContext(ctx, "REPORT", url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "1")
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach calendar: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("calendar returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result multistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid calendar response: %w", err)
+	}
+	var events []ical.Event
+	for _, r := range result.Responses {
+		for _, ps := range r.Propstats {
+			if ps.CalendarData == "" || (ps.Status != "" && !strings.Contains(ps.Status, " 200 ")) {
+				continue
+			}
+			parsed, err := ical.Parse(strings.NewReader(ps.CalendarData))
+			if err != nil {
+				return nil, fmt.Errorf("invalid calendar data: %w", err)
+			}
+			events = append(events, parsed...)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,161 @@
+// Package check reports the commute time of an itinerary like a monitoring
+// plugin, for Nagios, Icinga, Zabbix and other classic monitoring stacks: a
+// status line with performance data, and the standard exit codes
+//
+//	COMMUTE WARNING - work: 45.2 min (warn 40, crit 60), 3 min ago | minutes=45.2;40;60;0; age=180s;;900;0;
+package check
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/history"
+)
+
+// Status is the outcome of a check, which is also its exit code
+type Status int
+
+// Statuses of monitoring plugins
+const (
+	OK       Status = 0
+	Warning  Status = 1
+	Critical Status = 2
+	Unknown  Status = 3
+)
+
+// String returns the status as monitoring plugins print it
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "OK"
+	case Warning:
+		return "WARNING"
+	case Critical:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+// Thresholds are the limits a commute time is checked against, zero for
+// none
+type Thresholds struct {
+	// Warn and Crit are the minutes above which the check warns or is
+	// critical
+	Warn float64
+	Crit float64
+	// MaxAge is the age above which a stored sample is too old to tell the
+	// current commute
+	MaxAge time.Duration
+}
+
+// Result is the outcome of checking an itinerary
+type Result struct {
+	Status    Status
+	Itinerary string
+	// Minutes and Age describe the sample checked; Age is zero for live
+	// fetches
+	Minutes float64
+	Age     time.Duration
+	// Reason explains an unknown status
+	Reason string
+	// measured is false when no commute time could be checked
+	measured   bool
+	thresholds Thresholds
+}
+
+// Evaluate checks an itinerary's commute time against thresholds, taken
+// age ago
+func Evaluate(itinID string, minutes float64, age time.Duration, t Thresholds) Result {
+	r := Result{Status: OK, Itinerary: itinID, Minutes: minutes, Age: age, measured: true, thresholds: t}
+	switch {
+	case t.MaxAge > 0 && age > t.MaxAge:
+		r.Status = Unknown
+		r.Reason = fmt.Sprintf("stale, more than %s old", ago(t.MaxAge))
+	case t.Crit > 0 && minutes > t.Crit:
+		r.Status = Critical
+	case t.Warn > 0 && minutes > t.Warn:
+		r.Status = Warning
+	}
+	return r
+}
+
+// Failed is the unknown result of a check that could not be made
+func Failed(itinID string, err error) Result {
+	return Result{Status: Unknown, Itinerary: itinID, Reason: err.Error()}
+}
+
+// Latest returns the latest of an itinerary's samples recorded from its
+// primary provider, and whether there is one
+func Latest(samples []history.Sample, itin config.Itinerary) (history.Sample, bool) {
+	var latest history.Sample
+	found := false
+	for _, s := range history.PrimaryOnly(samples, itin.PrimaryProvider()) {
+		if !found || !s.Timestamp.Before(latest.Timestamp) {
+			latest, found = s, true
+		}
+	}
+	return latest, found
+}
+
+// String returns the status line and performance data of the result
+func (r Result) String() string {
+	if !r.measured {
+		return fmt.Sprintf("COMMUTE %s - %s: %s", r.Status, r.Itinerary, r.Reason)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "COMMUTE %s - %s: %s min", r.Status, r.Itinerary, number(r.Minutes))
+	var limits []string
+	if r.thresholds.Warn > 0 {
+		limits = append(limits, "warn "+number(r.thresholds.Warn))
+	}
+	if r.thresholds.Crit > 0 {
+		limits = append(limits, "crit "+number(r.thresholds.Crit))
+	}
+	if len(limits) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(limits, ", "))
+	}
+	if r.Age > 0 {
+		fmt.Fprintf(&b, ", %s ago", ago(r.Age))
+	}
+	if r.Reason != "" {
+		fmt.Fprintf(&b, ", %s", r.Reason)
+	}
+
+	// Performance data: label=value;warn;crit;min;max, minutes having no
+	// unit of their own
+	fmt.Fprintf(&b, " | minutes=%s;%s;%s;0;", number(r.Minutes), limit(r.thresholds.Warn), limit(r.thresholds.Crit))
+	if r.Age > 0 {
+		maxAge := ""
+		if r.thresholds.MaxAge > 0 {
+			maxAge = strconv.Itoa(int(r.thresholds.MaxAge.Seconds()))
+		}
+		fmt.Fprintf(&b, " age=%ds;;%s;0;", int(r.Age.Seconds()), maxAge)
+	}
+	return b.String()
+}
+
+// number formats minutes with at most one decimal
+func number(minutes float64) string {
+	return strconv.FormatFloat(math.Round(minutes*10)/10, 'f', -1, 64)
+}
+
+// limit formats a threshold for performance data, empty when unset
+func limit(minutes float64) string {
+	if minutes <= 0 {
+		return ""
+	}
+	return number(minutes)
+}
+
+// ago formats the age of a sample in minutes, or seconds below a minute
+func ago(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d s", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%d min", int(d.Round(time.Minute).Minutes()))
+}
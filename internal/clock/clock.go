@@ -0,0 +1,134 @@
+// Package clock checks the system clock against the Date header of remote
+// servers while the daemon runs. Samples are timestamped and schedules run
+// by the local clock, so a clock that drifts, or that a Raspberry Pi
+// without a battery-backed clock restores from its last shutdown, silently
+// corrupts both.
+package clock
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/fetcher"
+	"gommutetime/internal/notify"
+)
+
+// checkInterval is how often the clock is checked. A reference server is
+// only asked when no provider responded since the last check.
+const checkInterval = 15 * time.Minute
+
+// Checker warns when the clock is off by more than clock.max_skew_seconds,
+// and alerts the clock's channels once until it is back within
+type Checker struct {
+	mu       sync.Mutex
+	cfg      *config.Config
+	notifier *notify.Manager
+	// off is whether the clock was last found off, and unsynced whether
+	// the kernel last said it was not synchronized by NTP
+	off      bool
+	unsynced bool
+}
+
+// New creates a clock checker sending alerts through notifier
+func New(cfg *config.Config, notifier *notify.Manager) *Checker {
+	return &Checker{cfg: cfg, notifier: notifier}
+}
+
+// Reload switches to a new config
+func (c *Checker) Reload(cfg *config.Config) {
+	c.mu.Lock()
+	c.cfg = cfg
+	c.mu.Unlock()
+}
+
+// Run checks the clock right away and then periodically, until ctx is
+// cancelled
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		c.check(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check compares the clock with the latest response, or with the reference
+// server when there was none lately
+func (c *Checker) check(ctx context.Context, now time.Time) {
+	c.mu.Lock()
+	cfg := c.cfg
+	c.mu.Unlock()
+
+	if synced, known := Synchronized(); known && synced == c.unsynced {
+		c.unsynced = !synced
+		if c.unsynced {
+			log.Printf("Warning: the system clock is not synchronized by NTP")
+		} else {
+			log.Printf("The system clock is synchronized by NTP again")
+		}
+	}
+
+	skew, ok := fetcher.LastSkew()
+	if !ok || now.Sub(skew.At) > checkInterval {
+		// Simulations make no requests at all
+		if cfg.Simulate {
+			return
+		}
+		var err error
+		if skew, err = measure(ctx, cfg); err != nil {
+			log.Printf("Warning: failed to check the clock: %v", err)
+			return
+		}
+	}
+
+	offset := skew.Offset.Round(time.Second)
+	if offset.Abs() <= cfg.Clock.MaxSkew() {
+		if c.off {
+			log.Printf("The system clock is back within %s of %s", cfg.Clock.MaxSkew(), skew.Host)
+		}
+		c.off = false
+		return
+	}
+
+	direction := "ahead of"
+	if offset < 0 {
+		direction = "behind"
+	}
+	detail := fmt.Sprintf("The system clock is %s %s %s; samples are timestamped and schedules run by it", offset.Abs(), direction, skew.Host)
+	log.Printf("Warning: %s", detail)
+	alerted := c.off
+	c.off = true
+	if alerted || len(cfg.Clock.Channels) == 0 {
+		return
+	}
+
+	c.notifier.Send(ctx, notify.Message{
+		Title:     fmt.Sprintf("System clock is off by %s", offset.Abs()),
+		Body:      detail,
+		Severity:  "warning",
+		Rule:      "clock",
+		Timestamp: now,
+	}, cfg.Clock.Channels)
+}
+
+// measure asks the reference server for its time, through the proxy and CA
+// bundle of API requests
+func measure(ctx context.Context, cfg *config.Config) (fetcher.Skew, error) {
+	client, err := fetcher.NewHTTPClient(cfg.API)
+	if err != nil {
+		client = http.DefaultClient
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return fetcher.MeasureSkew(reqCtx, client, fetcher.ClockReference)
+}
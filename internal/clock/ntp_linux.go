@@ -0,0 +1,17 @@
+//go:build linux
+
+package clock
+
+import "golang.org/x/sys/unix"
+
+// Synchronized reports whether the kernel considers the clock synchronized
+// by NTP, which it stops doing when the NTP daemon is missing or cannot
+// reach its servers
+func Synchronized() (synced, known bool) {
+	var timex unix.Timex
+	state, err := unix.Adjtimex(&timex)
+	if err != nil {
+		return false, false
+	}
+	return state != unix.TIME_ERROR && timex.Status&unix.STA_UNSYNC == 0, true
+}
@@ -0,0 +1,44 @@
+package config
+
+import "fmt"
+
+// Adaptive spreads a daily number of samples over the times of a schedule,
+// every interval_minutes within its window, sampling more of the times
+// when commute times varied most in the last weeks and fewer of the stable
+// ones
+type Adaptive struct {
+	// DailyRequests is how many times the schedule samples each day it
+	// runs, all of its times when it has no more
+	DailyRequests int `yaml:"daily_requests"`
+}
+
+// Requests returns how many samples a schedule takes each day it runs: all
+// of its times unless adaptive
+func (s Schedule) Requests() int {
+	slots := len(s.Slots())
+	if s.Adaptive != nil {
+		return min(s.Adaptive.DailyRequests, slots)
+	}
+	return slots
+}
+
+// validateAdaptive checks the adaptive sampling of the schedules of an
+// itinerary
+func validateAdaptive(itin Itinerary) error {
+	for _, sched := range itin.Schedules {
+		a := sched.Adaptive
+		if a == nil {
+			continue
+		}
+		if sched.SuppressOnly() {
+			return fmt.Errorf("itinerary %s, schedule %s: adaptive needs times to sample", itin.ID, sched.Name)
+		}
+		if itin.IsMatrix() {
+			return fmt.Errorf("itinerary %s, schedule %s: adaptive sampling is not supported for matrix itineraries", itin.ID, sched.Name)
+		}
+		if a.DailyRequests <= 0 {
+			return fmt.Errorf("itinerary %s, schedule %s: adaptive: daily_requests must be positive", itin.ID, sched.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// ClockConfig checks the system clock against the Date header of provider
+// responses. Samples are timestamped and schedules run by the local clock,
+// which drifts without NTP, e.g. on a Raspberry Pi without a battery-backed
+// clock.
+type ClockConfig struct {
+	// MaxSkewSeconds is how far the clock may be off before warning, 60 by
+	// default
+	MaxSkewSeconds int `yaml:"max_skew_seconds,omitempty"`
+	// Channels receive an alert when the clock is off, besides the warning
+	// in the log
+	Channels []string `yaml:"channels,omitempty"`
+}
+
+// defaultMaxSkew is how far the clock may be off by default
+const defaultMaxSkew = time.Minute
+
+// MaxSkew returns how far the clock may be off before warning
+func (c ClockConfig) MaxSkew() time.Duration {
+	if c.MaxSkewSeconds == 0 {
+		return defaultMaxSkew
+	}
+	return time.Duration(c.MaxSkewSeconds) * time.Second
+}
+
+// validateClock checks the clock settings against the notification channels
+func validateClock(c ClockConfig, channels map[string]bool) error {
+	if c.MaxSkewSeconds < 0 {
+		return fmt.Errorf("clock: max_skew_seconds must not be negative")
+	}
+	for _, name := range c.Channels {
+		if !channels[name] {
+			return fmt.Errorf("clock: unknown channel '%s'", name)
+		}
+	}
+	return nil
+}
@@ -1,82 +1,1024 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"text/template"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/auth"
+	"gommutetime/internal/geo"
 )
 
 // Config represents the entire application configuration
 type Config struct {
-	API         APIConfig   `yaml:"api"`
-	DataDir     string      `yaml:"data_dir"`
-	Itineraries []Itinerary `yaml:"itineraries"`
+	API           APIConfig           `yaml:"api,omitempty"`
+	DataDir       string              `yaml:"data_dir"`
+	ReadOnly      bool                `yaml:"read_only,omitempty"`
+	Simulate      bool                `yaml:"simulate,omitempty"`
+	Notifications NotificationsConfig `yaml:"notifications,omitempty"`
+	Telemetry     TelemetryConfig     `yaml:"telemetry,omitempty"`
+	Errors        ErrorsConfig        `yaml:"errors,omitempty"`
+	Logging       LoggingConfig       `yaml:"logging,omitempty"`
+	Profiles      []Profile           `yaml:"profiles,omitempty"`
+	Dashboard     DashboardConfig     `yaml:"dashboard,omitempty"`
+	Server        ServerConfig        `yaml:"server,omitempty"`
+	OIDC          OIDCConfig          `yaml:"oidc,omitempty"`
+	Analytics     AnalyticsConfig     `yaml:"analytics,omitempty"`
+	Sheets        SheetsConfig        `yaml:"sheets,omitempty"`
+	Backup        BackupConfig        `yaml:"backup,omitempty"`
+	Storage       StorageConfig       `yaml:"storage,omitempty"`
+	Rollup        RollupConfig        `yaml:"rollup,omitempty"`
+	Series        SeriesConfig        `yaml:"series,omitempty"`
+	Gaps          GapsConfig          `yaml:"gaps,omitempty"`
+	Heartbeat     HeartbeatConfig     `yaml:"heartbeat,omitempty"`
+	Plugins       []Plugin            `yaml:"plugins,omitempty"`
+	Streams       StreamsConfig       `yaml:"streams,omitempty"`
+	Redis         RedisConfig         `yaml:"redis,omitempty"`
+	StatsD        StatsDConfig        `yaml:"statsd,omitempty"`
+	StatusPage    StatusPageConfig    `yaml:"status_page,omitempty"`
+	Feed          FeedConfig          `yaml:"feed,omitempty"`
+	Clock         ClockConfig         `yaml:"clock,omitempty"`
+	Outbox        OutboxConfig        `yaml:"outbox,omitempty"`
+	Itineraries   []Itinerary         `yaml:"itineraries"`
+
+	// AuditLog records config reloads and remote changes, relative to
+	// data_dir; audit.jsonl by default
+	AuditLog string `yaml:"audit_log,omitempty"`
+	// ConfigVersions is how many validated config snapshots are kept in
+	// data_dir for rollback, 10 by default
+	ConfigVersions int `yaml:"config_versions,omitempty"`
+	// JobHistory is how many job runs are kept in data_dir for debugging
+	// scheduling problems, 1000 by default
+	JobHistory int `yaml:"job_history,omitempty"`
+	// Pricing overrides the built-in pricing of providers by name, for
+	// cost estimates
+	Pricing map[string]Price `yaml:"pricing,omitempty"`
+	// Budget is the most to spend on provider requests per calendar month,
+	// in the currency of the pricing; zero for none
+	Budget float64 `yaml:"budget,omitempty"`
+
+	// offline is set while ValidateOffline leaves out the provider checks
+	offline bool
+}
+
+// AuditPath returns the path of the audit log, or an empty string when
+// nothing may be written to the data directory
+func (c *Config) AuditPath() string {
+	if c.ReadOnly || c.DataDir == "" {
+		return ""
+	}
+
+	name := c.AuditLog
+	if name == "" {
+		name = "audit.jsonl"
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(c.DataDir, name)
+}
+
+// defaultJobHistory is how many job runs are kept by default
+const defaultJobHistory = 1000
+
+// JobHistoryPath returns the path of the job history, or an empty string
+// when nothing may be written to the data directory
+func (c *Config) JobHistoryPath() string {
+	if c.ReadOnly || c.DataDir == "" {
+		return ""
+	}
+	return filepath.Join(c.DataDir, "jobs.jsonl")
+}
+
+// JobRuns returns how many job runs the job history keeps
+func (c *Config) JobRuns() int {
+	if c.JobHistory == 0 {
+		return defaultJobHistory
+	}
+	return c.JobHistory
+}
+
+// CacheDir returns the directory provider responses are cached in, or an
+// empty string when nothing may be written to the data directory
+func (c *Config) CacheDir() string {
+	if c.ReadOnly || c.DataDir == "" {
+		return ""
+	}
+	return filepath.Join(c.DataDir, "cache")
+}
+
+// DashboardConfig holds web dashboard settings
+type DashboardConfig struct {
+	// Users can log in to the dashboard. Without users the dashboard is
+	// open to anyone who can reach it.
+	Users []DashboardUser `yaml:"users,omitempty"`
+}
+
+// DashboardUser is a dashboard and API account
+type DashboardUser struct {
+	// Username is matched against the OIDC username claim for users who
+	// log in through the provider
+	Username string `yaml:"username"`
+	// PasswordHash is generated with the hash-password command. It can be
+	// omitted when OIDC is configured, for users who only log in through
+	// the provider.
+	PasswordHash string `yaml:"password_hash,omitempty"`
+	// Profiles are the profiles whose itineraries the user sees; empty
+	// shows every itinerary
+	Profiles []string `yaml:"profiles,omitempty"`
+	// Role governs the API operations the user may perform, viewer by default
+	Role string `yaml:"role,omitempty"`
+}
+
+// Roles of dashboard users. Each role may perform the operations of the
+// roles before it.
+const (
+	// RoleViewer reads itineraries and their history
+	RoleViewer = "viewer"
+	// RoleOperator also triggers runs and pauses itineraries
+	RoleOperator = "operator"
+	// RoleAdmin also edits the config
+	RoleAdmin = "admin"
+)
+
+// Roles lists the roles from least to most privileged
+var Roles = []string{RoleViewer, RoleOperator, RoleAdmin}
+
+// Allows reports whether role may perform the operations of required. An
+// empty role is a viewer.
+func Allows(role, required string) bool {
+	if role == "" {
+		role = RoleViewer
+	}
+	return slices.Index(Roles, role) >= slices.Index(Roles, required)
+}
+
+// ServerConfig holds settings of the HTTP API served by the schedule command
+type ServerConfig struct {
+	// Listen is the API address, e.g. :8080; empty disables the API
+	Listen string `yaml:"listen,omitempty"`
+}
+
+// Analytics engines computing statistics over history
+const (
+	EngineBuiltin = "builtin"
+	EngineDuckDB  = "duckdb"
+)
+
+// AnalyticsConfig selects how statistics are computed over history
+type AnalyticsConfig struct {
+	// Engine is builtin (the default) or duckdb, which queries the history
+	// files in place with the DuckDB CLI
+	Engine string `yaml:"engine,omitempty"`
+	// Command is the DuckDB CLI, found on PATH by default
+	Command string `yaml:"command,omitempty"`
+}
+
+// SheetsConfig holds the Google service account appending samples to the
+// Google Sheets of itineraries
+type SheetsConfig struct {
+	// CredentialsFile is the service account's JSON key; the
+	// GOOGLE_APPLICATION_CREDENTIALS environment variable by default
+	CredentialsFile string `yaml:"credentials_file,omitempty"`
+}
+
+// Credentials returns the path of the service account key, if any
+func (s SheetsConfig) Credentials() string {
+	if s.CredentialsFile != "" {
+		return s.CredentialsFile
+	}
+	return os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+}
+
+// StorageConfig batches the writes of samples to their output files, for
+// many itineraries sampled often or data directories on network storage
+type StorageConfig struct {
+	// FlushIntervalSeconds is how long samples may wait in memory before
+	// they are written; zero writes every sample right away
+	FlushIntervalSeconds int `yaml:"flush_interval_seconds,omitempty"`
+	// BatchSize writes the waiting samples as soon as this many are
+	// queued, 100 by default
+	BatchSize int `yaml:"batch_size,omitempty"`
+}
+
+// FlushInterval returns how long samples may wait before they are written,
+// zero when writes are not batched
+func (s StorageConfig) FlushInterval() time.Duration {
+	return time.Duration(s.FlushIntervalSeconds) * time.Second
+}
+
+// RollupConfig replaces old samples with hourly or daily aggregates, which
+// statistics still cover but the samples API and exports do not
+type RollupConfig struct {
+	// AfterDays is the age in days beyond which samples are rolled up; zero
+	// keeps every sample
+	AfterDays int `yaml:"after_days,omitempty"`
+	// Resolution is hour (default) or day
+	Resolution string `yaml:"resolution,omitempty"`
+}
+
+// Enabled reports whether old samples are rolled up
+func (r RollupConfig) Enabled() bool {
+	return r.AfterDays > 0
+}
+
+// SeriesConfig maintains hourly and daily aggregates of every single-route
+// itinerary as samples arrive, for charts over long ranges
+type SeriesConfig struct {
+	// Resolutions lists the series kept, hour and/or day; empty keeps none
+	Resolutions []string `yaml:"resolutions,omitempty"`
+}
+
+// GapsConfig alerts when scheduled samples are missing, e.g. while the
+// provider keeps failing or after the daemon was down
+type GapsConfig struct {
+	// AlertAfter is how many scheduled samples in a row may be missing
+	// before an alert is sent; zero disables alerts
+	AlertAfter int `yaml:"alert_after,omitempty"`
+	// Channels receive the alerts, along with the channels of the
+	// itinerary's profile
+	Channels []string `yaml:"channels,omitempty"`
+}
+
+// HeartbeatConfig pings a dead man's switch, e.g. healthchecks.io or an
+// Uptime Kuma push monitor, which alerts when the pings stop because the
+// daemon or its host died
+type HeartbeatConfig struct {
+	// URL is requested after successful fetches, at most once a minute
+	URL string `yaml:"url,omitempty"`
+}
+
+// Price is what a provider charges for route lookups
+type Price struct {
+	// PerThousand is the price of a thousand elements, e.g. one per
+	// origin/destination pair of a request
+	PerThousand float64 `yaml:"per_thousand"`
+	// FreePerMonth is how many elements are free each month
+	FreePerMonth int    `yaml:"free_per_month,omitempty"`
+	Currency     string `yaml:"currency,omitempty"`
+}
+
+// BackupConfig schedules daily backups of the config file and data
+// directory
+type BackupConfig struct {
+	// Time is when the daily backup is made, HH:MM; empty disables backups
+	Time string `yaml:"time,omitempty"`
+	// Dir is where backups are written, relative to data_dir; backups by
+	// default
+	Dir string `yaml:"dir,omitempty"`
+	// Keep is how many backups are kept, 7 by default
+	Keep int `yaml:"keep,omitempty"`
+}
+
+// Enabled reports whether scheduled backups are configured
+func (b BackupConfig) Enabled() bool {
+	return b.Time != ""
+}
+
+// BackupDir returns the directory scheduled backups are written to
+func (c *Config) BackupDir() string {
+	dir := c.Backup.Dir
+	if dir == "" {
+		dir = "backups"
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(c.DataDir, dir)
+}
+
+// SheetTarget is a Google Sheet an itinerary's samples are appended to
+type SheetTarget struct {
+	// SpreadsheetID is the long ID in the spreadsheet's URL
+	SpreadsheetID string `yaml:"spreadsheet_id"`
+	// Tab is the sheet of the spreadsheet rows are appended to, Sheet1 by
+	// default
+	Tab string `yaml:"tab,omitempty"`
+	// Daily appends a summary row for each day after midnight instead of a
+	// row for every sample
+	Daily bool `yaml:"daily,omitempty"`
+}
+
+// OIDCConfig delegates API and dashboard logins to an OpenID Connect
+// provider such as Authelia, Keycloak or Google
+type OIDCConfig struct {
+	// Issuer is the provider URL serving /.well-known/openid-configuration
+	Issuer string `yaml:"issuer,omitempty"`
+	// ClientID is the client registered with the provider; API tokens must
+	// be issued for it
+	ClientID string `yaml:"client_id,omitempty"`
+	// UsernameClaim is the token claim matched against dashboard usernames,
+	// preferred_username by default
+	UsernameClaim string `yaml:"username_claim,omitempty"`
+}
+
+// Enabled reports whether an OIDC provider is configured
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != ""
+}
+
+// Claim returns the name of the username claim
+func (o OIDCConfig) Claim() string {
+	if o.UsernameClaim == "" {
+		return "preferred_username"
+	}
+	return o.UsernameClaim
+}
+
+// Profile groups the itineraries of one person, e.g. a household member
+type Profile struct {
+	Name string `yaml:"name"`
+	// Channels receive every alert of the profile's itineraries, in
+	// addition to the channels of each rule
+	Channels []string `yaml:"channels,omitempty"`
 }
 
 // APIConfig holds Google Maps API settings
 type APIConfig struct {
-	Key string `yaml:"key"`
+	// Provider is google (the default), azure or waze
+	Provider string `yaml:"provider,omitempty"`
+	// Key is the Google Maps API key
+	Key   string      `yaml:"key"`
+	Azure AzureConfig `yaml:"azure,omitempty"`
+	Waze  WazeConfig  `yaml:"waze,omitempty"`
+
+	// Proxy is an http, https or socks5 proxy URL for API requests. When
+	// empty the HTTPS_PROXY and NO_PROXY environment variables are honored.
+	Proxy string `yaml:"proxy,omitempty"`
+	// CAFile is a PEM bundle of extra certificate authorities to trust,
+	// e.g. for a TLS-intercepting corporate proxy
+	CAFile string `yaml:"ca_file,omitempty"`
+	// TimeoutSeconds bounds each API request, zero keeps the job timeout only
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty"`
+	// ShareSeconds serves a route fetched again within this many seconds,
+	// e.g. by another itinerary with the same from, to and mode, from the
+	// first fetch instead of a new request. Zero always makes a request.
+	ShareSeconds int `yaml:"share_seconds,omitempty"`
+	// CacheSeconds keeps the provider responses this long in memory and in
+	// the cache directory of the data directory, for the fetch command to
+	// read without a request. Scheduled samples always make their own.
+	CacheSeconds int `yaml:"cache_seconds,omitempty"`
+}
+
+// Route providers
+const (
+	ProviderGoogle = "google"
+	ProviderAzure  = "azure"
+	ProviderWaze   = "waze"
+)
+
+// Waze routing regions
+const (
+	WazeWorld  = "row"
+	WazeUS     = "us"
+	WazeIsrael = "il"
+)
+
+// AzureConfig holds the Azure Maps account fetched from with provider azure
+type AzureConfig struct {
+	// Key is a shared key of the Azure Maps account
+	Key string `yaml:"key,omitempty"`
+	// Endpoint overrides https://atlas.microsoft.com, e.g. with the
+	// geographic endpoint https://eu.atlas.microsoft.com
+	Endpoint string `yaml:"endpoint,omitempty"`
+}
+
+// WazeConfig opts in to the Waze provider, which uses the routing endpoints
+// of the Waze live map rather than a public API
+type WazeConfig struct {
+	// AcceptTerms confirms that Waze's terms permit this use, required
+	AcceptTerms bool `yaml:"accept_terms,omitempty"`
+	// Region is the routing server: row (rest of world, the default), us
+	// (United States and Canada) or il (Israel)
+	Region string `yaml:"region,omitempty"`
+}
+
+// NeedsKey reports whether the route provider needs a key
+func (a APIConfig) NeedsKey() bool {
+	return a.ProviderName() != ProviderWaze
+}
+
+// Share returns how long a fetched route is shared with identical fetches
+func (a APIConfig) Share() time.Duration {
+	return time.Duration(a.ShareSeconds) * time.Second
+}
+
+// Cache returns how long provider responses are cached
+func (a APIConfig) Cache() time.Duration {
+	return time.Duration(a.CacheSeconds) * time.Second
+}
+
+// ProviderName returns the route provider, google when unset
+func (a APIConfig) ProviderName() string {
+	if a.Provider == "" {
+		return ProviderGoogle
+	}
+	return a.Provider
+}
+
+// ProviderKey returns the key of the route provider
+func (a APIConfig) ProviderKey() string {
+	if a.ProviderName() == ProviderAzure {
+		return a.Azure.Key
+	}
+	return a.Key
 }
 
-// Itinerary represents a single route to monitor
+// TelemetryConfig holds OpenTelemetry export settings
+type TelemetryConfig struct {
+	OTLPEndpoint string `yaml:"otlp_endpoint,omitempty"`
+	Insecure     bool   `yaml:"insecure,omitempty"`
+	ServiceName  string `yaml:"service_name,omitempty"`
+}
+
+// ErrorsConfig reports panics and repeated job failures to Sentry, or a
+// compatible service, and to a webhook
+type ErrorsConfig struct {
+	// SentryDSN is the DSN of the Sentry project; the SENTRY_DSN
+	// environment variable is used when empty
+	SentryDSN string `yaml:"sentry_dsn,omitempty"`
+	// WebhookURL receives each report as a JSON POST
+	WebhookURL  string `yaml:"webhook_url,omitempty"`
+	Environment string `yaml:"environment,omitempty"`
+	// FailuresInARow is how many fetches of an itinerary must fail in a row
+	// to be reported, 3 by default
+	FailuresInARow int `yaml:"failures_in_a_row,omitempty"`
+}
+
+// Log outputs
+const (
+	LogStderr   = "stderr"
+	LogSyslog   = "syslog"
+	LogEventLog = "eventlog"
+)
+
+// LoggingConfig selects where the daemon logs, standard error by default
+type LoggingConfig struct {
+	// Output is stderr, syslog or eventlog (Windows only)
+	Output string       `yaml:"output,omitempty"`
+	Syslog SyslogConfig `yaml:"syslog,omitempty"`
+	// EventLogSource is the event log source, gommutetime by default
+	EventLogSource string `yaml:"eventlog_source,omitempty"`
+}
+
+// SyslogConfig selects the syslog daemon to log to
+type SyslogConfig struct {
+	// Address is a remote daemon as udp://host:port or tcp://host:port;
+	// empty for the local one
+	Address string `yaml:"address,omitempty"`
+	// Tag names the program in messages, gommutetime by default
+	Tag string `yaml:"tag,omitempty"`
+	// Facility is e.g. daemon (the default), user or local0 to local7
+	Facility string `yaml:"facility,omitempty"`
+}
+
+// syslogFacilities are the facility names accepted in SyslogConfig
+var syslogFacilities = []string{"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp",
+	"cron", "authpriv", "ftp", "local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"}
+
+// NotificationsConfig holds alert delivery settings
+type NotificationsConfig struct {
+	Channels  []Channel       `yaml:"channels,omitempty"`
+	RateLimit RateLimitConfig `yaml:"rate_limit,omitempty"`
+}
+
+// Channel defines a destination for alert messages
+type Channel struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type,omitempty"`
+	URL      string `yaml:"url,omitempty"`
+	Template string `yaml:"template,omitempty"`
+
+	// Matrix settings
+	Homeserver  string `yaml:"homeserver,omitempty"`
+	AccessToken string `yaml:"access_token,omitempty"`
+	RoomID      string `yaml:"room_id,omitempty"`
+
+	// Apprise settings
+	URLs    []string `yaml:"urls,omitempty"`
+	Command string   `yaml:"command,omitempty"`
+}
+
+// RateLimitConfig controls suppression of repeated alerts
+type RateLimitConfig struct {
+	// WindowMinutes suppresses identical alerts for this long after one is sent.
+	// Suppressed alerts are collapsed into a single summary at the end of the
+	// window. Zero disables rate limiting.
+	WindowMinutes int `yaml:"window_minutes,omitempty"`
+}
+
+// Itinerary represents a single route to monitor, or with type matrix every
+// route between a set of origins and a set of destinations
 type Itinerary struct {
-	ID         string     `yaml:"id"`
-	Name       string     `yaml:"name"`
-	From       string     `yaml:"from"`
-	To         string     `yaml:"to"`
-	OutputFile string     `yaml:"output_file"`
-	Schedules  []Schedule `yaml:"schedules"`
+	ID           string      `yaml:"id"`
+	Name         string      `yaml:"name"`
+	Type         string      `yaml:"type,omitempty"`
+	From         string      `yaml:"from,omitempty"`
+	To           string      `yaml:"to,omitempty"`
+	Origins      []Place     `yaml:"origins,omitempty"`
+	Destinations []Place     `yaml:"destinations,omitempty"`
+	OutputFile   string      `yaml:"output_file"`
+	Schedules    []Schedule  `yaml:"schedules"`
+	Alerts       []AlertRule `yaml:"alerts,omitempty"`
+	// Tags are written with each sample, e.g. to tell weekday and weekend
+	// trips apart during analysis
+	Tags []string `yaml:"tags,omitempty"`
+	// Profile is the name of the profile the itinerary belongs to, if any
+	Profile string `yaml:"profile,omitempty"`
+	// Sheet is a Google Sheet samples are also appended to, if any
+	Sheet *SheetTarget `yaml:"sheet,omitempty"`
+	// Heartbeat is a URL requested after each successful fetch of the
+	// itinerary, like heartbeat.url
+	Heartbeat string `yaml:"heartbeat,omitempty"`
+	// Providers fetches the itinerary from each of these providers in every
+	// run, one sample each, to compare them. The first one is the primary:
+	// its samples drive alerts. Empty uses api.provider alone.
+	Providers []string `yaml:"providers,omitempty"`
+	// Mode is how the itinerary is travelled: driving in traffic unless set
+	// to bicycling
+	Mode string `yaml:"mode,omitempty"`
+	// Pace adjusts bicycling durations to the rider's own pace, if set
+	Pace *Pace `yaml:"pace,omitempty"`
+	// Via is the parking location of park-and-ride itineraries, driven to
+	// from From before taking transit to To
+	Via string `yaml:"via,omitempty"`
+	// Stops are the pickups of carpool itineraries, in the order they are
+	// driven to between From and To
+	Stops []Stop `yaml:"stops,omitempty"`
+	// Direct also fetches carpool itineraries from From to To without the
+	// stops, to measure what the stops cost, e.g. a school drop-off on the
+	// way to work
+	Direct bool `yaml:"direct,omitempty"`
+	// SchoolCalendar tags samples as taken in school term or during
+	// vacations, which are then compared with each other only
+	SchoolCalendar *SchoolCalendar `yaml:"school_calendar,omitempty"`
+	// Dense samples the itinerary more often while a condition holds
+	Dense *Dense `yaml:"dense,omitempty"`
+	// Shifts samples the itinerary ahead of the shifts of a calendar
+	Shifts *ShiftCalendar `yaml:"shifts,omitempty"`
+	// Streams replaces the global Kafka or NATS target for the itinerary's
+	// samples and alerts
+	Streams *StreamsConfig `yaml:"streams,omitempty"`
+}
+
+// Tags added to samples next to the itinerary's own: the school season of
+// itineraries with a school calendar, and whether the sun was up at the
+// origin
+const (
+	TagTerm     = "term"
+	TagVacation = "vacation"
+	TagDaylight = "daylight"
+	TagDark     = "dark"
+)
+
+// Travel modes. Transit is only used by the second leg of park-and-ride
+// itineraries.
+const (
+	ModeDriving   = "driving"
+	ModeBicycling = "bicycling"
+	ModeTransit   = "transit"
+)
+
+// Pace is a rider's own pace, replacing the generic cyclist of providers.
+// Either a factor or an average speed is set.
+type Pace struct {
+	// Factor divides the provider's durations, e.g. 1.25 for a rider a
+	// quarter faster than the provider assumes
+	Factor float64 `yaml:"factor,omitempty"`
+	// SpeedKmh is an average speed over the route distance, e.g. 25 for an
+	// e-bike
+	SpeedKmh float64 `yaml:"speed_kmh,omitempty"`
+}
+
+// Adjust returns the duration in minutes of a route of the given length in
+// meters at this pace, from the provider's duration. A nil pace, or a speed
+// without the length, keeps the provider's duration.
+func (p *Pace) Adjust(minutes, meters float64) float64 {
+	switch {
+	case p == nil:
+		return minutes
+	case p.SpeedKmh > 0 && meters > 0:
+		return meters / 1000 / p.SpeedKmh * 60
+	case p.Factor > 0:
+		return minutes / p.Factor
+	}
+	return minutes
+}
+
+// PrimaryProvider returns the provider whose samples drive the alerts of
+// the itinerary, empty when it only uses api.provider
+func (itin Itinerary) PrimaryProvider() string {
+	if len(itin.Providers) == 0 {
+		return ""
+	}
+	return itin.Providers[0]
+}
+
+// HasTag reports whether the itinerary is tagged with tag
+func (itin Itinerary) HasTag(tag string) bool {
+	return slices.Contains(itin.Tags, tag)
+}
+
+// FilterTags keeps only the itineraries tagged with at least one of tags.
+// Without tags every itinerary is kept; it is an error if none match.
+func (c *Config) FilterTags(tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	var kept []Itinerary
+	for _, itin := range c.Itineraries {
+		if slices.ContainsFunc(tags, itin.HasTag) {
+			kept = append(kept, itin)
+		}
+	}
+	if len(kept) == 0 {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("no itinerary is tagged %s", strings.Join(tags, " or ")))
+	}
+
+	c.Itineraries = kept
+	return nil
+}
+
+// FilterProfile keeps only the itineraries of the named profile. An empty
+// name keeps every itinerary.
+func (c *Config) FilterProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	if c.Profile(name) == nil {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("unknown profile: %s", name))
+	}
+
+	var kept []Itinerary
+	for _, itin := range c.Itineraries {
+		if itin.Profile == name {
+			kept = append(kept, itin)
+		}
+	}
+	if len(kept) == 0 {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("profile %s has no itineraries", name))
+	}
+
+	c.Itineraries = kept
+	return nil
+}
+
+// Profile returns the named profile, or nil if there is none
+func (c *Config) Profile(name string) *Profile {
+	for i := range c.Profiles {
+		if c.Profiles[i].Name == name {
+			return &c.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// Stop is a pickup of a carpool itinerary, where the driver waits
+// DwellMinutes for the passenger
+type Stop struct {
+	Label        string  `yaml:"label"`
+	Address      string  `yaml:"address"`
+	DwellMinutes float64 `yaml:"dwell_minutes,omitempty"`
+}
+
+// Place is a labeled address in a matrix itinerary
+type Place struct {
+	Label   string `yaml:"label"`
+	Address string `yaml:"address"`
+}
+
+// Itinerary types
+const (
+	TypeRoute       = "route"
+	TypeMatrix      = "matrix"
+	TypeParkAndRide = "park_and_ride"
+	TypeCarpool     = "carpool"
+)
+
+// Distance Matrix API limits for a single request
+const (
+	maxMatrixPlaces   = 25
+	maxMatrixElements = 100
+)
+
+// IsMatrix reports whether the itinerary fetches an origins × destinations matrix
+func (i Itinerary) IsMatrix() bool {
+	return i.Type == TypeMatrix
+}
+
+// IsParkAndRide reports whether the itinerary drives to a parking location
+// and takes transit from there
+func (i Itinerary) IsParkAndRide() bool {
+	return i.Type == TypeParkAndRide
+}
+
+// IsCarpool reports whether the itinerary picks up passengers at stops on
+// the way
+func (i Itinerary) IsCarpool() bool {
+	return i.Type == TypeCarpool
+}
+
+// FirstOrigin returns an origin address of the itinerary
+func (i Itinerary) FirstOrigin() string {
+	if i.IsMatrix() && len(i.Origins) > 0 {
+		return i.Origins[0].Address
+	}
+	return i.From
+}
+
+// AlertRule triggers a notification when a commute exceeds a threshold
+type AlertRule struct {
+	Name         string   `yaml:"name"`
+	AboveMinutes float64  `yaml:"above_minutes"`
+	Severity     string   `yaml:"severity,omitempty"`
+	Channels     []string `yaml:"channels,omitempty"`
+	Template     string   `yaml:"template,omitempty"`
 }
 
 // Schedule defines when to fetch commute times
 type Schedule struct {
 	Name            string   `yaml:"name"`
-	Days            []string `yaml:"days"`
-	StartTime       string   `yaml:"start_time"`
-	EndTime         string   `yaml:"end_time"`
-	IntervalMinutes int      `yaml:"interval_minutes"`
+	Days            []string `yaml:"days,omitempty"`
+	StartTime       string   `yaml:"start_time,omitempty"`
+	EndTime         string   `yaml:"end_time,omitempty"`
+	IntervalMinutes int      `yaml:"interval_minutes,omitempty"`
+	// Interval is the time between samples as a duration, e.g. 90s, in
+	// place of interval_minutes. Start and end times may then have seconds.
+	Interval string `yaml:"interval,omitempty"`
+	// Override schedules only run on their dates, and replace the regular
+	// schedules of the itinerary on those dates. An override without times
+	// only suppresses the regular schedules.
+	Override bool `yaml:"override,omitempty"`
+	// Dates are YYYY-MM-DD days or inclusive YYYY-MM-DD..YYYY-MM-DD ranges
+	Dates []string `yaml:"dates,omitempty"`
+	// Adaptive samples only some of the times of the schedule each day
+	Adaptive *Adaptive `yaml:"adaptive,omitempty"`
+	// Rotation only runs the schedule on the working days of a roster;
+	// days are then optional and narrow it further
+	Rotation *Rotation `yaml:"rotation,omitempty"`
+
+	// derived is set when the name comes from a schedule phrase, which
+	// nameDerived may suffix
+	derived bool
 }
 
 // LoadConfig reads and parses the config file
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
+	// A deployment may be configured through the environment alone
+	if os.IsNotExist(err) && HasEnv() {
+		data, err = nil, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to read config file: %w", err))
 	}
 
+	return parse(data)
+}
+
+// parse decodes a config file and applies the values set through the
+// environment
+func parse(data []byte) (*Config, error) {
 	var cfg Config
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to parse YAML: %w", err))
+	}
+	for i := range cfg.Itineraries {
+		cfg.Itineraries[i].nameDerived()
 	}
 
-	// Override API key with environment variable if present
+	// Override API keys with environment variables if present
 	if envKey := os.Getenv("GOOGLE_MAPS_API_KEY"); envKey != "" {
 		cfg.API.Key = envKey
 	}
+	if envKey := os.Getenv("AZURE_MAPS_KEY"); envKey != "" {
+		cfg.API.Azure.Key = envKey
+	}
+
+	if err := applyEnv(&cfg, os.Environ()); err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, err)
+	}
 
 	return &cfg, nil
 }
 
+// Marshal encodes v as YAML with the two-space indentation of config.example.yaml
+func Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
 // Validate checks config for errors
 func (c *Config) Validate() error {
-	// Check API key
-	if c.API.Key == "" {
+	return apperr.Wrap(apperr.KindConfig, c.validate())
+}
+
+// ValidateOffline checks config for errors like Validate, leaving out the
+// provider key and settings, for commands reading stored samples without
+// fetching any
+func (c *Config) ValidateOffline() error {
+	c.offline = true
+	defer func() { c.offline = false }()
+	return c.Validate()
+}
+
+// routesOffline reports whether the config is validated without a provider:
+// simulated or for an offline command
+func (c *Config) routesOffline() bool {
+	return c.Simulate || c.offline
+}
+
+// validate performs the checks for Validate
+func (c *Config) validate() error {
+	// Check API key (synthetic data and offline commands need none)
+	if c.API.NeedsKey() && c.API.ProviderKey() == "" && !c.routesOffline() {
+		if c.API.ProviderName() == ProviderAzure {
+			return fmt.Errorf("Azure Maps key is required (set api.azure.key or AZURE_MAPS_KEY env var)")
+		}
 		return fmt.Errorf("API key is required (set in config or GOOGLE_MAPS_API_KEY env var)")
 	}
 
-	// Check data directory
-	if c.DataDir == "" {
+	// Check HTTP client settings
+	if err := validateAPI(c.API); err != nil {
+		return err
+	}
+
+	// Check data directory (not needed when results are never written)
+	if c.DataDir == "" && !c.ReadOnly {
 		return fmt.Errorf("data_dir is required")
 	}
 
+	if c.ConfigVersions < 0 {
+		return fmt.Errorf("config_versions cannot be negative")
+	}
+	if c.JobHistory < 0 {
+		return fmt.Errorf("job_history cannot be negative")
+	}
+
 	// Check itineraries
 	if len(c.Itineraries) == 0 {
 		return fmt.Errorf("at least one itinerary is required")
 	}
 
+	// Check notification channels
+	channels, err := validateNotifications(c.Notifications)
+	if err != nil {
+		return err
+	}
+
+	// Check profiles
+	profiles, err := validateProfiles(c.Profiles, channels)
+	if err != nil {
+		return err
+	}
+
+	// Check dashboard users and API authentication
+	if err := validateOIDC(c.OIDC); err != nil {
+		return err
+	}
+	if err := validateDashboard(c.Dashboard, profiles, c.OIDC.Enabled()); err != nil {
+		return err
+	}
+	if err := validateServer(c.Server, c.Dashboard, c.OIDC); err != nil {
+		return err
+	}
+
+	// Check analytics
+	switch c.Analytics.Engine {
+	case "", EngineBuiltin, EngineDuckDB:
+	default:
+		return fmt.Errorf("analytics: unknown engine %s (expected builtin or duckdb)", c.Analytics.Engine)
+	}
+
+	// Check scheduled backups
+	if c.Backup.Enabled() {
+		if _, _, err := ParseTime(c.Backup.Time); err != nil {
+			return fmt.Errorf("backup: invalid time: %w", err)
+		}
+		if c.Backup.Keep < 0 {
+			return fmt.Errorf("backup: keep must not be negative")
+		}
+		if c.ReadOnly {
+			return fmt.Errorf("backup: backups are not written in read-only mode")
+		}
+		if c.DataDir == "" {
+			return fmt.Errorf("backup: data_dir is required")
+		}
+	}
+
+	// Check pricing overrides
+	for provider, price := range c.Pricing {
+		if price.PerThousand < 0 || price.FreePerMonth < 0 {
+			return fmt.Errorf("pricing: %s: prices must not be negative", provider)
+		}
+	}
+	if c.Budget < 0 {
+		return fmt.Errorf("budget must not be negative")
+	}
+
+	// Check gap alerts
+	if c.Gaps.AlertAfter < 0 {
+		return fmt.Errorf("gaps: alert_after must not be negative")
+	}
+	if c.Gaps.AlertAfter > 0 && len(c.Gaps.Channels) == 0 {
+		return fmt.Errorf("gaps: at least one channel is required")
+	}
+	for _, name := range c.Gaps.Channels {
+		if !channels[name] {
+			return fmt.Errorf("gaps: unknown channel '%s'", name)
+		}
+	}
+	if err := validateClock(c.Clock, channels); err != nil {
+		return err
+	}
+
+	// Check error reporting and logging
+	if err := ValidateErrors(c.Errors); err != nil {
+		return err
+	}
+	if err := ValidateLogging(c.Logging); err != nil {
+		return err
+	}
+
+	// Check heartbeats
+	if c.Heartbeat.URL != "" {
+		if err := validateHeartbeat(c.Heartbeat.URL); err != nil {
+			return fmt.Errorf("heartbeat: %w", err)
+		}
+	}
+
+	if err := c.validatePlugins(); err != nil {
+		return err
+	}
+	if err := validateStreams("streams", c.Streams); err != nil {
+		return err
+	}
+	if err := validateRedis(c.Redis); err != nil {
+		return err
+	}
+	if err := validateStatsD(c.StatsD); err != nil {
+		return err
+	}
+	if err := validateStatusPage(c); err != nil {
+		return err
+	}
+	if err := validateFeed(c); err != nil {
+		return err
+	}
+	if err := validateOutbox(c.Outbox); err != nil {
+		return err
+	}
+
+	// Check rollups
+	if c.Rollup.AfterDays < 0 {
+		return fmt.Errorf("rollup: after_days must not be negative")
+	}
+	switch c.Rollup.Resolution {
+	case "", "hour", "day":
+	default:
+		return fmt.Errorf("rollup: unknown resolution %s (expected hour or day)", c.Rollup.Resolution)
+	}
+	if c.Rollup.Enabled() && c.ReadOnly {
+		return fmt.Errorf("rollup: samples are not rolled up in read-only mode")
+	}
+
+	// Check aggregate series
+	for _, resolution := range c.Series.Resolutions {
+		if resolution != "hour" && resolution != "day" {
+			return fmt.Errorf("series: unknown resolution %s (expected hour or day)", resolution)
+		}
+	}
+	if len(c.Series.Resolutions) > 0 && c.ReadOnly {
+		return fmt.Errorf("series: series are not written in read-only mode")
+	}
+
+	// Check batched writes
+	if c.Storage.FlushIntervalSeconds < 0 || c.Storage.FlushIntervalSeconds > 3600 {
+		return fmt.Errorf("storage: flush_interval_seconds must be between 0 and 3600")
+	}
+	if c.Storage.BatchSize < 0 {
+		return fmt.Errorf("storage: batch_size must not be negative")
+	}
+
 	// Track unique IDs and output files
 	seenIDs := make(map[string]bool)
 	seenFiles := make(map[string]bool)
@@ -89,13 +1031,56 @@ func (c *Config) Validate() error {
 		if itin.Name == "" {
 			return fmt.Errorf("itinerary %s: name is required", itin.ID)
 		}
-		if itin.From == "" {
-			return fmt.Errorf("itinerary %s: from address is required", itin.ID)
+		switch itin.Type {
+		case "", TypeRoute:
+			if itin.From == "" {
+				return fmt.Errorf("itinerary %s: from address is required", itin.ID)
+			}
+			if itin.To == "" {
+				return fmt.Errorf("itinerary %s: to address is required", itin.ID)
+			}
+			if err := geo.ValidateLocation(itin.From); err != nil {
+				return fmt.Errorf("itinerary %s: from: %w", itin.ID, err)
+			}
+			if err := geo.ValidateLocation(itin.To); err != nil {
+				return fmt.Errorf("itinerary %s: to: %w", itin.ID, err)
+			}
+		case TypeMatrix:
+			if err := validateMatrix(itin); err != nil {
+				return err
+			}
+		case TypeParkAndRide:
+			if err := c.validateParkAndRide(itin); err != nil {
+				return err
+			}
+		case TypeCarpool:
+			if err := validateCarpool(itin); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("itinerary %s: unknown type '%s'", itin.ID, itin.Type)
 		}
-		if itin.To == "" {
-			return fmt.Errorf("itinerary %s: to address is required", itin.ID)
+		if err := c.validateProviders(itin); err != nil {
+			return err
 		}
-		if itin.OutputFile == "" {
+		if err := c.validateMode(itin); err != nil {
+			return err
+		}
+		if err := validateSchoolCalendar(itin); err != nil {
+			return err
+		}
+		if err := validateDense(itin); err != nil {
+			return err
+		}
+		if err := validateShifts(itin); err != nil {
+			return err
+		}
+		if itin.Streams != nil {
+			if err := validateStreams("itinerary "+itin.ID+": streams", *itin.Streams); err != nil {
+				return err
+			}
+		}
+		if itin.OutputFile == "" && !c.ReadOnly {
 			return fmt.Errorf("itinerary %s: output_file is required", itin.ID)
 		}
 
@@ -106,14 +1091,49 @@ func (c *Config) Validate() error {
 		seenIDs[itin.ID] = true
 
 		// Check for duplicate output files
-		if seenFiles[itin.OutputFile] {
-			return fmt.Errorf("duplicate output_file: %s (used by multiple itineraries)", itin.OutputFile)
+		if itin.OutputFile != "" {
+			if seenFiles[itin.OutputFile] {
+				return fmt.Errorf("duplicate output_file: %s (used by multiple itineraries)", itin.OutputFile)
+			}
+			seenFiles[itin.OutputFile] = true
+		}
+
+		// Check the profile exists
+		profile, ok := profiles[itin.Profile]
+		if itin.Profile != "" && !ok {
+			return fmt.Errorf("itinerary %s: unknown profile '%s'", itin.ID, itin.Profile)
+		}
+
+		// Validate tags, which are written to the output file
+		for _, tag := range itin.Tags {
+			if tag == "" || strings.ContainsAny(tag, ",;\"\r\n\t ") {
+				return fmt.Errorf("itinerary %s: invalid tag %q (cannot be empty or contain spaces, commas, semicolons or quotes)", itin.ID, tag)
+			}
+		}
+
+		// Check the Google Sheet
+		if itin.Sheet != nil {
+			if itin.Sheet.SpreadsheetID == "" {
+				return fmt.Errorf("itinerary %s: sheet: spreadsheet_id is required", itin.ID)
+			}
+			if c.Sheets.Credentials() == "" {
+				return fmt.Errorf("itinerary %s: sheet: sheets.credentials_file or GOOGLE_APPLICATION_CREDENTIALS is required", itin.ID)
+			}
+			if itin.Sheet.Daily && (c.ReadOnly || itin.OutputFile == "") {
+				return fmt.Errorf("itinerary %s: sheet: daily summaries are computed from output_file, which read-only mode does not write", itin.ID)
+			}
+		}
+
+		// Check the heartbeat
+		if itin.Heartbeat != "" {
+			if err := validateHeartbeat(itin.Heartbeat); err != nil {
+				return fmt.Errorf("itinerary %s: heartbeat: %w", itin.ID, err)
+			}
 		}
-		seenFiles[itin.OutputFile] = true
 
 		// Validate schedules
-		if len(itin.Schedules) == 0 {
-			return fmt.Errorf("itinerary %s: at least one schedule is required", itin.ID)
+		if len(itin.Schedules) == 0 && itin.Shifts == nil {
+			return fmt.Errorf("itinerary %s: at least one schedule or shifts is required", itin.ID)
 		}
 
 		for j, sched := range itin.Schedules {
@@ -121,57 +1141,565 @@ func (c *Config) Validate() error {
 				return err
 			}
 		}
+		if err := validateAdaptive(itin); err != nil {
+			return err
+		}
+
+		// Validate alert rules
+		for j, rule := range itin.Alerts {
+			if err := validateAlertRule(rule, itin.ID, j, channels, profile.Channels); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-// validateSchedule checks a single schedule for errors
-func validateSchedule(sched Schedule, itinID string, schedIndex int) error {
-	if sched.Name == "" {
-		return fmt.Errorf("itinerary %s, schedule %d: name is required", itinID, schedIndex)
+// validateMatrix checks the origins and destinations of a matrix itinerary
+func validateMatrix(itin Itinerary) error {
+	if itin.From != "" || itin.To != "" {
+		return fmt.Errorf("itinerary %s: matrix itineraries use origins and destinations instead of from and to", itin.ID)
+	}
+	if len(itin.Alerts) > 0 {
+		return fmt.Errorf("itinerary %s: alerts are not supported on matrix itineraries", itin.ID)
+	}
+	if itin.Sheet != nil {
+		return fmt.Errorf("itinerary %s: sheets are not supported on matrix itineraries", itin.ID)
 	}
 
-	// Validate days
-	if len(sched.Days) == 0 {
-		return fmt.Errorf("itinerary %s, schedule %s: at least one day is required", itinID, sched.Name)
+	if err := validatePlaces(itin.ID, "origins", itin.Origins); err != nil {
+		return err
 	}
-	for _, day := range sched.Days {
-		if _, err := DayNameToWeekday(day); err != nil {
-			return fmt.Errorf("itinerary %s, schedule %s: %w", itinID, sched.Name, err)
+	if err := validatePlaces(itin.ID, "destinations", itin.Destinations); err != nil {
+		return err
+	}
+
+	if n := len(itin.Origins) * len(itin.Destinations); n > maxMatrixElements {
+		return fmt.Errorf("itinerary %s: %d origin/destination pairs exceed the limit of %d per request", itin.ID, n, maxMatrixElements)
+	}
+
+	return nil
+}
+
+// validatePlaces checks one side of a matrix itinerary
+func validatePlaces(itinID, field string, places []Place) error {
+	if len(places) == 0 {
+		return fmt.Errorf("itinerary %s: at least one entry is required in %s", itinID, field)
+	}
+	if len(places) > maxMatrixPlaces {
+		return fmt.Errorf("itinerary %s: %s cannot have more than %d entries", itinID, field, maxMatrixPlaces)
+	}
+
+	seen := make(map[string]bool)
+	for i, p := range places {
+		if p.Label == "" {
+			return fmt.Errorf("itinerary %s, %s %d: label is required", itinID, field, i)
+		}
+		if strings.ContainsAny(p.Label, ",\"\r\n") {
+			return fmt.Errorf("itinerary %s, %s %s: label cannot contain commas, quotes or newlines", itinID, field, p.Label)
+		}
+		if seen[p.Label] {
+			return fmt.Errorf("itinerary %s: duplicate label in %s: %s", itinID, field, p.Label)
+		}
+		seen[p.Label] = true
+
+		if p.Address == "" {
+			return fmt.Errorf("itinerary %s, %s %s: address is required", itinID, field, p.Label)
+		}
+		if err := geo.ValidateLocation(p.Address); err != nil {
+			return fmt.Errorf("itinerary %s, %s %s: %w", itinID, field, p.Label, err)
 		}
 	}
 
-	// Validate start time
-	startHour, startMin, err := ParseTime(sched.StartTime)
-	if err != nil {
-		return fmt.Errorf("itinerary %s, schedule %s: invalid start_time: %w", itinID, sched.Name, err)
+	return nil
+}
+
+// validateProviders checks that the providers an itinerary is fetched from
+// are configured and can route its places
+func (c *Config) validateProviders(itin Itinerary) error {
+	if itin.Direct && !itin.IsCarpool() {
+		return fmt.Errorf("itinerary %s: direct is only supported for carpool itineraries", itin.ID)
+	}
+	if len(itin.Providers) > 0 && itin.IsMatrix() {
+		return fmt.Errorf("itinerary %s: providers are not supported for matrix itineraries", itin.ID)
+	}
+	for i, name := range itin.Providers {
+		if slices.Contains(itin.Providers[:i], name) {
+			return fmt.Errorf("itinerary %s: duplicate provider %s", itin.ID, name)
+		}
+		if !slices.Contains([]string{ProviderGoogle, ProviderAzure, ProviderWaze}, name) {
+			return fmt.Errorf("itinerary %s: unknown provider %s (expected google, azure or waze)", itin.ID, name)
+		}
+	}
+
+	// Synthetic data and offline commands need no provider settings
+	if c.routesOffline() {
+		return nil
+	}
+	for _, name := range itin.Providers {
+		if err := c.API.checkProvider(name); err != nil {
+			return fmt.Errorf("itinerary %s: %w", itin.ID, err)
+		}
+	}
+	if slices.Contains(itin.Providers, ProviderWaze) || (len(itin.Providers) == 0 && c.API.ProviderName() == ProviderWaze) {
+		return validateWazePlaces(itin)
+	}
+	return nil
+}
+
+// validateParkAndRide checks the legs of a park-and-ride itinerary. Its
+// transit leg needs Google Maps, the only provider routing transit.
+func (c *Config) validateParkAndRide(itin Itinerary) error {
+	for _, leg := range []struct{ name, place string }{{"from", itin.From}, {"via", itin.Via}, {"to", itin.To}} {
+		if leg.place == "" {
+			return fmt.Errorf("itinerary %s: %s address is required", itin.ID, leg.name)
+		}
+		if err := geo.ValidateLocation(leg.place); err != nil {
+			return fmt.Errorf("itinerary %s: %s: %w", itin.ID, leg.name, err)
+		}
+	}
+	if len(itin.Providers) > 0 {
+		return fmt.Errorf("itinerary %s: providers are not supported for park-and-ride itineraries", itin.ID)
+	}
+	if itin.Mode != "" && itin.Mode != ModeDriving {
+		return fmt.Errorf("itinerary %s: park-and-ride itineraries are driven then taken by transit", itin.ID)
+	}
+	if !c.routesOffline() && c.API.ProviderName() != ProviderGoogle {
+		return fmt.Errorf("itinerary %s: park-and-ride itineraries need the google provider for transit", itin.ID)
+	}
+	return nil
+}
+
+// validateCarpool checks the places and stops of a carpool itinerary
+func validateCarpool(itin Itinerary) error {
+	if itin.From == "" {
+		return fmt.Errorf("itinerary %s: from address is required", itin.ID)
+	}
+	if itin.To == "" {
+		return fmt.Errorf("itinerary %s: to address is required", itin.ID)
+	}
+	if err := geo.ValidateLocation(itin.From); err != nil {
+		return fmt.Errorf("itinerary %s: from: %w", itin.ID, err)
+	}
+	if err := geo.ValidateLocation(itin.To); err != nil {
+		return fmt.Errorf("itinerary %s: to: %w", itin.ID, err)
+	}
+	if len(itin.Stops) == 0 {
+		return fmt.Errorf("itinerary %s: at least one stop is required", itin.ID)
+	}
+
+	seen := make(map[string]bool)
+	for i, stop := range itin.Stops {
+		if stop.Label == "" {
+			return fmt.Errorf("itinerary %s, stop %d: label is required", itin.ID, i)
+		}
+		if seen[stop.Label] {
+			return fmt.Errorf("itinerary %s: duplicate stop %s", itin.ID, stop.Label)
+		}
+		seen[stop.Label] = true
+		if stop.Address == "" {
+			return fmt.Errorf("itinerary %s, stop %s: address is required", itin.ID, stop.Label)
+		}
+		if err := geo.ValidateLocation(stop.Address); err != nil {
+			return fmt.Errorf("itinerary %s, stop %s: %w", itin.ID, stop.Label, err)
+		}
+		if stop.DwellMinutes < 0 {
+			return fmt.Errorf("itinerary %s, stop %s: dwell_minutes cannot be negative", itin.ID, stop.Label)
+		}
+	}
+
+	if len(itin.Providers) > 0 {
+		return fmt.Errorf("itinerary %s: providers are not supported for carpool itineraries", itin.ID)
+	}
+	if itin.Mode != "" && itin.Mode != ModeDriving {
+		return fmt.Errorf("itinerary %s: carpool itineraries are driven", itin.ID)
+	}
+	return nil
+}
+
+// validateMode checks the travel mode and pace of an itinerary, and that
+// its providers can route it
+func (c *Config) validateMode(itin Itinerary) error {
+	switch itin.Mode {
+	case "", ModeDriving:
+		if itin.Pace != nil {
+			return fmt.Errorf("itinerary %s: pace requires mode bicycling", itin.ID)
+		}
+		return nil
+	case ModeBicycling:
+	default:
+		return fmt.Errorf("itinerary %s: unknown mode '%s' (expected driving or bicycling)", itin.ID, itin.Mode)
+	}
+
+	if itin.IsMatrix() {
+		return fmt.Errorf("itinerary %s: mode bicycling is not supported for matrix itineraries", itin.ID)
+	}
+	if p := itin.Pace; p != nil {
+		if p.Factor < 0 || p.SpeedKmh < 0 {
+			return fmt.Errorf("itinerary %s: pace must be positive", itin.ID)
+		}
+		if (p.Factor > 0) == (p.SpeedKmh > 0) {
+			return fmt.Errorf("itinerary %s: pace needs either factor or speed_kmh", itin.ID)
+		}
+	}
+	if !c.routesOffline() && (slices.Contains(itin.Providers, ProviderWaze) || (len(itin.Providers) == 0 && c.API.ProviderName() == ProviderWaze)) {
+		return fmt.Errorf("itinerary %s: waze cannot route bicycles", itin.ID)
+	}
+	return nil
+}
+
+// checkProvider checks that a provider has its key or opt-in
+func (a APIConfig) checkProvider(name string) error {
+	switch name {
+	case ProviderGoogle:
+		if a.Key == "" {
+			return fmt.Errorf("provider google needs api.key or GOOGLE_MAPS_API_KEY")
+		}
+	case ProviderAzure:
+		if a.Azure.Key == "" {
+			return fmt.Errorf("provider azure needs api.azure.key or AZURE_MAPS_KEY")
+		}
+	case ProviderWaze:
+		if !a.Waze.AcceptTerms {
+			return fmt.Errorf("provider waze needs api.waze.accept_terms")
+		}
+	}
+	return nil
+}
+
+// validateWazePlaces checks that the places of an itinerary are coordinates
+// or full Plus Codes, since Waze cannot geocode addresses
+func validateWazePlaces(itin Itinerary) error {
+	places := []string{itin.From, itin.To}
+	for _, stop := range itin.Stops {
+		places = append(places, stop.Address)
+	}
+	if itin.IsMatrix() {
+		places = nil
+		for _, p := range append(slices.Clone(itin.Origins), itin.Destinations...) {
+			places = append(places, p.Address)
+		}
+	}
+	for _, place := range places {
+		if _, ok := geo.Locate(place); !ok {
+			return fmt.Errorf("itinerary %s: waze needs coordinates or a full Plus Code, not %q", itin.ID, place)
+		}
+	}
+	return nil
+}
+
+// validateAPI checks the proxy, CA bundle and timeout settings
+func validateAPI(api APIConfig) error {
+	switch api.ProviderName() {
+	case ProviderGoogle, ProviderAzure:
+	case ProviderWaze:
+		if !api.Waze.AcceptTerms {
+			return fmt.Errorf("api: the waze provider uses unofficial endpoints; set waze.accept_terms once you have checked that Waze's terms permit your use")
+		}
+	default:
+		return fmt.Errorf("api: unknown provider %s (expected google, azure or waze)", api.Provider)
+	}
+	switch api.Waze.Region {
+	case "", WazeWorld, WazeUS, WazeIsrael:
+	default:
+		return fmt.Errorf("api: unknown waze region %s (expected row, us or il)", api.Waze.Region)
+	}
+	if api.Azure.Endpoint != "" {
+		if u, err := url.Parse(api.Azure.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("api: azure endpoint must be an https URL")
+		}
+	}
+
+	if api.Proxy != "" {
+		u, err := url.Parse(api.Proxy)
+		if err != nil {
+			return fmt.Errorf("api: invalid proxy: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("api: proxy scheme must be http, https or socks5")
+		}
+		if u.Host == "" {
+			return fmt.Errorf("api: proxy host is required")
+		}
+	}
+
+	if api.CAFile != "" {
+		if _, err := os.Stat(api.CAFile); err != nil {
+			return fmt.Errorf("api: ca_file: %w", err)
+		}
+	}
+
+	if api.TimeoutSeconds < 0 {
+		return fmt.Errorf("api: timeout_seconds cannot be negative")
+	}
+	if api.ShareSeconds < 0 || api.ShareSeconds > 3600 {
+		return fmt.Errorf("api: share_seconds must be between 0 and 3600")
+	}
+	if api.CacheSeconds < 0 || api.CacheSeconds > 86400 {
+		return fmt.Errorf("api: cache_seconds must be between 0 and 86400")
+	}
+
+	return nil
+}
+
+// validateNotifications checks channel definitions and returns the set of channel names
+func validateNotifications(n NotificationsConfig) (map[string]bool, error) {
+	names := make(map[string]bool)
+	for i, ch := range n.Channels {
+		if ch.Name == "" {
+			return nil, fmt.Errorf("notification channel %d: name is required", i)
+		}
+		if names[ch.Name] {
+			return nil, fmt.Errorf("duplicate notification channel: %s", ch.Name)
+		}
+		names[ch.Name] = true
+
+		switch ch.Type {
+		case "webhook", "discord":
+			if ch.URL == "" {
+				return nil, fmt.Errorf("notification channel %s: url is required", ch.Name)
+			}
+		case "matrix":
+			if ch.Homeserver == "" || ch.AccessToken == "" || ch.RoomID == "" {
+				return nil, fmt.Errorf("notification channel %s: homeserver, access_token and room_id are required", ch.Name)
+			}
+		case "apprise":
+			if len(ch.URLs) == 0 {
+				return nil, fmt.Errorf("notification channel %s: at least one url is required in urls", ch.Name)
+			}
+		default:
+			return nil, fmt.Errorf("notification channel %s: unknown type '%s'", ch.Name, ch.Type)
+		}
+
+		if _, err := template.New(ch.Name).Parse(ch.Template); err != nil {
+			return nil, fmt.Errorf("notification channel %s: invalid template: %w", ch.Name, err)
+		}
+	}
+
+	if n.RateLimit.WindowMinutes < 0 {
+		return nil, fmt.Errorf("notifications: rate_limit.window_minutes cannot be negative")
+	}
+
+	return names, nil
+}
+
+// validateProfiles checks profile names and channels, returning the
+// profiles by name
+func validateProfiles(profiles []Profile, channels map[string]bool) (map[string]Profile, error) {
+	byName := make(map[string]Profile)
+	for i, p := range profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("profile %d: name is required", i)
+		}
+		if _, ok := byName[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate profile: %s", p.Name)
+		}
+		byName[p.Name] = p
+
+		for _, name := range p.Channels {
+			if !channels[name] {
+				return nil, fmt.Errorf("profile %s: unknown channel '%s'", p.Name, name)
+			}
+		}
+	}
+
+	return byName, nil
+}
+
+// validateOIDC checks the OIDC provider settings
+func validateOIDC(o OIDCConfig) error {
+	if !o.Enabled() {
+		if o.ClientID != "" || o.UsernameClaim != "" {
+			return fmt.Errorf("oidc: issuer is required")
+		}
+		return nil
+	}
+
+	u, err := url.Parse(o.Issuer)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("oidc: issuer must be an http(s) URL: %s", o.Issuer)
+	}
+	if o.ClientID == "" {
+		return fmt.Errorf("oidc: client_id is required")
+	}
+
+	return nil
+}
+
+// ValidateErrors checks the error reporting settings, which the tenants
+// file also holds
+func ValidateErrors(e ErrorsConfig) error {
+	if e.WebhookURL != "" {
+		u, err := url.Parse(e.WebhookURL)
+		if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+			return fmt.Errorf("errors: webhook_url must be an http(s) URL: %s", e.WebhookURL)
+		}
+	}
+	if e.FailuresInARow < 0 {
+		return fmt.Errorf("errors: failures_in_a_row must not be negative")
+	}
+	return nil
+}
+
+// ValidateLogging checks the log output, which the tenants file also holds
+func ValidateLogging(l LoggingConfig) error {
+	switch l.Output {
+	case "", LogStderr, LogSyslog, LogEventLog:
+	default:
+		return fmt.Errorf("logging: unknown output %s (expected stderr, syslog or eventlog)", l.Output)
+	}
+	if l.Syslog.Address != "" {
+		network, address, ok := strings.Cut(l.Syslog.Address, "://")
+		if !ok || (network != "udp" && network != "tcp") || address == "" {
+			return fmt.Errorf("logging: syslog address must be udp://host:port or tcp://host:port: %s", l.Syslog.Address)
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("logging: invalid syslog address: %w", err)
+		}
+	}
+	if l.Syslog.Facility != "" && !slices.Contains(syslogFacilities, l.Syslog.Facility) {
+		return fmt.Errorf("logging: unknown syslog facility %s", l.Syslog.Facility)
+	}
+	return nil
+}
+
+// validateHeartbeat checks a heartbeat URL
+func validateHeartbeat(heartbeat string) error {
+	u, err := url.Parse(heartbeat)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("must be an http(s) URL: %s", heartbeat)
+	}
+	return nil
+}
+
+// validateServer checks the API settings. The API may only be served
+// without authentication on a loopback address.
+func validateServer(s ServerConfig, d DashboardConfig, o OIDCConfig) error {
+	if s.Listen == "" {
+		return nil
 	}
 
-	// Validate end time
-	endHour, endMin, err := ParseTime(sched.EndTime)
+	host, _, err := net.SplitHostPort(s.Listen)
 	if err != nil {
-		return fmt.Errorf("itinerary %s, schedule %s: invalid end_time: %w", itinID, sched.Name, err)
+		return fmt.Errorf("server: invalid listen address %s: %w", s.Listen, err)
+	}
+	if len(d.Users) > 0 || o.Enabled() {
+		return nil
 	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return nil
+	}
+
+	return fmt.Errorf("server: listening on %s requires dashboard users or oidc for authentication", s.Listen)
+}
+
+// validateDashboard checks dashboard accounts. Passwords are optional when
+// users can log in through an OIDC provider.
+func validateDashboard(d DashboardConfig, profiles map[string]Profile, oidc bool) error {
+	seen := make(map[string]bool)
+	for i, u := range d.Users {
+		if u.Username == "" {
+			return fmt.Errorf("dashboard user %d: username is required", i)
+		}
+		if seen[u.Username] {
+			return fmt.Errorf("duplicate dashboard user: %s", u.Username)
+		}
+		seen[u.Username] = true
 
-	// Check start < end
-	startMinutes := startHour*60 + startMin
-	endMinutes := endHour*60 + endMin
-	if startMinutes >= endMinutes {
-		return fmt.Errorf("itinerary %s, schedule %s: start_time must be before end_time", itinID, sched.Name)
+		if u.PasswordHash != "" || !oidc {
+			if err := auth.CheckHash(u.PasswordHash); err != nil {
+				return fmt.Errorf("dashboard user %s: %w", u.Username, err)
+			}
+		}
+		for _, name := range u.Profiles {
+			if _, ok := profiles[name]; !ok {
+				return fmt.Errorf("dashboard user %s: unknown profile '%s'", u.Username, name)
+			}
+		}
+		if u.Role != "" && !slices.Contains(Roles, u.Role) {
+			return fmt.Errorf("dashboard user %s: invalid role '%s' (must be one of %s)", u.Username, u.Role, strings.Join(Roles, ", "))
+		}
 	}
 
-	// Validate interval
-	if sched.IntervalMinutes <= 0 {
-		return fmt.Errorf("itinerary %s, schedule %s: interval_minutes must be positive", itinID, sched.Name)
+	return nil
+}
+
+// validateAlertRule checks a single alert rule for errors. Rules may omit
+// channels when their itinerary's profile has some.
+func validateAlertRule(rule AlertRule, itinID string, ruleIndex int, channels map[string]bool, profileChannels []string) error {
+	if rule.Name == "" {
+		return fmt.Errorf("itinerary %s, alert %d: name is required", itinID, ruleIndex)
 	}
-	if sched.IntervalMinutes > 1440 {
-		return fmt.Errorf("itinerary %s, schedule %s: interval_minutes cannot exceed 1440 (1 day)", itinID, sched.Name)
+	if rule.AboveMinutes <= 0 {
+		return fmt.Errorf("itinerary %s, alert %s: above_minutes must be positive", itinID, rule.Name)
+	}
+
+	switch rule.Severity {
+	case "", "info", "warning", "critical":
+	default:
+		return fmt.Errorf("itinerary %s, alert %s: severity must be info, warning or critical", itinID, rule.Name)
+	}
+
+	if _, err := template.New(rule.Name).Parse(rule.Template); err != nil {
+		return fmt.Errorf("itinerary %s, alert %s: invalid template: %w", itinID, rule.Name, err)
+	}
+
+	if len(rule.Channels) == 0 && len(profileChannels) == 0 {
+		return fmt.Errorf("itinerary %s, alert %s: at least one channel is required", itinID, rule.Name)
+	}
+	for _, name := range rule.Channels {
+		if !channels[name] {
+			return fmt.Errorf("itinerary %s, alert %s: unknown channel '%s'", itinID, rule.Name, name)
+		}
 	}
 
 	return nil
 }
 
+// validateSchedule checks a single schedule for errors
+func validateSchedule(sched Schedule, itinID string, schedIndex int) error {
+	if sched.Name == "" {
+		return fmt.Errorf("itinerary %s, schedule %d: name is required", itinID, schedIndex)
+	}
+	if strings.ContainsAny(sched.Name, ",\"\r\n") {
+		return fmt.Errorf("itinerary %s, schedule %s: name cannot contain commas, quotes or newlines", itinID, sched.Name)
+	}
+
+	// Validate override dates
+	if sched.Override && len(sched.Dates) == 0 {
+		return fmt.Errorf("itinerary %s, schedule %s: override schedules require dates", itinID, sched.Name)
+	}
+	if !sched.Override && len(sched.Dates) > 0 {
+		return fmt.Errorf("itinerary %s, schedule %s: dates are only supported on override schedules", itinID, sched.Name)
+	}
+	for _, dates := range sched.Dates {
+		if _, _, err := parseDateRange(dates); err != nil {
+			return fmt.Errorf("itinerary %s, schedule %s: %w", itinID, sched.Name, err)
+		}
+	}
+	if sched.SuppressOnly() {
+		return nil
+	}
+
+	// Validate days, which schedules on a roster may leave out
+	if err := validateRotation(sched, itinID); err != nil {
+		return err
+	}
+	if len(sched.Days) == 0 && sched.Rotation == nil {
+		return fmt.Errorf("itinerary %s, schedule %s: at least one day or a rotation is required", itinID, sched.Name)
+	}
+	for _, day := range sched.Days {
+		if _, err := DayNameToWeekday(day); err != nil {
+			return fmt.Errorf("itinerary %s, schedule %s: %w", itinID, sched.Name, err)
+		}
+	}
+
+	return validateWindow(sched, itinID)
+}
+
 // ParseTime converts HH:MM string to hour and minute components
 func ParseTime(timeStr string) (hour, minute int, err error) {
 	var h, m int
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gommutetime/internal/weather"
+)
+
+// DefaultDenseHoldMinutes is how long dense sampling lasts after its
+// condition last held, unless set
+const DefaultDenseHoldMinutes = 60
+
+// Dense samples an itinerary more often while a condition holds, within
+// the windows of its schedules, e.g. on snowy days or when traffic is
+// unusually slow
+type Dense struct {
+	// IntervalMinutes is the time between samples while sampling densely
+	IntervalMinutes int `yaml:"interval_minutes"`
+	// HoldMinutes keeps sampling densely this long after the condition
+	// last held, DefaultDenseHoldMinutes unless set
+	HoldMinutes int `yaml:"hold_minutes,omitempty"`
+	// AboveBaselineMinutes starts dense sampling when a sample takes this
+	// many minutes more than usual at that time of the week, as alert
+	// baselines compute it
+	AboveBaselineMinutes float64 `yaml:"above_baseline_minutes,omitempty"`
+	// Weather starts dense sampling while one of these conditions holds at
+	// the origin: snow, freezing_rain, heavy_rain, thunderstorm or fog
+	Weather []string `yaml:"weather,omitempty"`
+}
+
+// Hold returns how long dense sampling lasts after its condition held
+func (d Dense) Hold() time.Duration {
+	if d.HoldMinutes > 0 {
+		return time.Duration(d.HoldMinutes) * time.Minute
+	}
+	return DefaultDenseHoldMinutes * time.Minute
+}
+
+// InWindow reports whether t falls within the window of a schedule of the
+// itinerary that runs that day
+func (itin Itinerary) InWindow(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	for _, sched := range itin.Schedules {
+		if sched.SuppressOnly() || !itin.Active(sched, t) || !sched.OnRoster(t) {
+			continue
+		}
+		if !slices.Contains(sched.Weekdays(), t.Weekday()) {
+			continue
+		}
+		startHour, startMin, err := ParseTime(sched.StartTime)
+		if err != nil {
+			continue
+		}
+		endHour, endMin, err := ParseTime(sched.EndTime)
+		if err != nil {
+			continue
+		}
+		if minute >= startHour*60+startMin && minute <= endHour*60+endMin {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDense checks the dense sampling of an itinerary
+func validateDense(itin Itinerary) error {
+	d := itin.Dense
+	if d == nil {
+		return nil
+	}
+	if itin.IsMatrix() {
+		return fmt.Errorf("itinerary %s: dense sampling is not supported for matrix itineraries", itin.ID)
+	}
+	if d.IntervalMinutes <= 0 {
+		return fmt.Errorf("itinerary %s: dense: interval_minutes must be positive", itin.ID)
+	}
+	if d.HoldMinutes < 0 || d.AboveBaselineMinutes < 0 {
+		return fmt.Errorf("itinerary %s: dense: hold_minutes and above_baseline_minutes cannot be negative", itin.ID)
+	}
+	if d.AboveBaselineMinutes == 0 && len(d.Weather) == 0 {
+		return fmt.Errorf("itinerary %s: dense: above_baseline_minutes or weather is required", itin.ID)
+	}
+	for _, condition := range d.Weather {
+		if !slices.Contains(weather.Conditions, condition) {
+			return fmt.Errorf("itinerary %s: dense: unknown weather '%s' (expected one of %s)",
+				itin.ID, condition, strings.Join(weather.Conditions, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"gommutetime/internal/apperr"
+)
+
+// AddItinerary appends itin to the config file at path, keeping the rest of
+// the file, including comments, as it is. The file is only rewritten if the
+// resulting config is valid.
+func AddItinerary(path string, itin Itinerary) error {
+	// Check the config stays valid with the new itinerary
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	cfg.Itineraries = append(cfg.Itineraries, itin)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to read config file: %w", err))
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to parse YAML: %w", err))
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("config file is not a YAML mapping"))
+	}
+
+	// Insert the itinerary as text after the existing ones to keep the file's
+	// layout, falling back to re-encoding the document
+	if out, ok := insertItinerary(data, doc.Content[0], itin); ok {
+		return writeFile(path, out)
+	}
+
+	// Append to the itineraries sequence, creating it if needed
+	seq := mappingValue(doc.Content[0], "itineraries")
+	if seq.Kind != yaml.SequenceNode {
+		seq.Kind = yaml.SequenceNode
+		seq.Tag = "!!seq"
+		seq.Value = ""
+	}
+	seq.Style = 0
+
+	var item yaml.Node
+	if err := item.Encode(itin); err != nil {
+		return fmt.Errorf("failed to encode itinerary: %w", err)
+	}
+	seq.Content = append(seq.Content, &item)
+
+	out, err := Marshal(&doc)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, out)
+}
+
+// Replace overwrites the config file at path with data, e.g. a config
+// edited remotely, if data is a valid config that check, when given,
+// accepts
+func Replace(path string, data []byte, check func(*Config) error) error {
+	cfg, err := parse(data)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if check != nil {
+		if err := check(cfg); err != nil {
+			return apperr.Wrap(apperr.KindConfig, err)
+		}
+	}
+
+	return writeFile(path, data)
+}
+
+// insertItinerary adds itin as text at the end of a non-empty block
+// itineraries sequence, indented like the existing items
+func insertItinerary(data []byte, root *yaml.Node, itin Itinerary) ([]byte, bool) {
+	var seq, next *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "itineraries" {
+			seq = root.Content[i+1]
+			if i+2 < len(root.Content) {
+				next = root.Content[i+2]
+			}
+		}
+	}
+	if seq == nil || seq.Kind != yaml.SequenceNode || seq.Style&yaml.FlowStyle != 0 || len(seq.Content) == 0 {
+		return nil, false
+	}
+
+	rendered, err := Marshal([]Itinerary{itin})
+	if err != nil {
+		return nil, false
+	}
+
+	// Items start two columns after their dash
+	indent := strings.Repeat(" ", max(seq.Content[0].Column-3, 0))
+	var item strings.Builder
+	for _, line := range strings.SplitAfter(string(rendered), "\n") {
+		if line != "" {
+			item.WriteString(indent + line)
+		}
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// Insert before the next top-level key and its leading comments, or at the end
+	at := len(lines)
+	if next != nil {
+		at = next.Line - 1
+		for at > 0 && isBlankOrComment(lines[at-1]) {
+			at--
+		}
+	}
+	if at > 0 && !strings.HasSuffix(lines[at-1], "\n") {
+		lines[at-1] += "\n"
+	}
+
+	out := []byte(strings.Join(lines[:at], "") + item.String() + strings.Join(lines[at:], ""))
+
+	// Make sure the edited text parses to the expected itineraries
+	var check Config
+	if err := yaml.Unmarshal(out, &check); err != nil || len(check.Itineraries) != len(seq.Content)+1 ||
+		check.Itineraries[len(check.Itineraries)-1].ID != itin.ID {
+		return nil, false
+	}
+
+	return out, true
+}
+
+// isBlankOrComment reports whether a line is empty or a top-level comment
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(line, "#")
+}
+
+// mappingValue returns the value node for key in a mapping, adding an empty
+// one at the end if the key is missing
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+
+	value := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	return value
+}
+
+// writeFile replaces the file at path atomically, keeping its permissions
+func writeFile(path string, data []byte) error {
+	// Keep the permissions of an existing file
+	perm := os.FileMode(0600)
+	info, err := os.Stat(path)
+	if err == nil {
+		perm = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to stat config file: %w", err))
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.yaml")
+	if err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to create temporary file: %w", err))
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write config file: %w", err))
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to set config file permissions: %w", err))
+	}
+	if err := tmp.Close(); err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write config file: %w", err))
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to replace config file: %w", err))
+	}
+
+	return nil
+}
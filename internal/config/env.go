@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the environment variables that set config values
+const EnvPrefix = "GOMMUTETIME_"
+
+// maxEnvIndex bounds list indexes in environment variable names
+const maxEnvIndex = 999
+
+// HasEnv reports whether any config value is set through the environment
+func HasEnv() bool {
+	return slices.ContainsFunc(os.Environ(), func(kv string) bool {
+		return strings.HasPrefix(kv, EnvPrefix)
+	})
+}
+
+// applyEnv sets config values from environment variables named after their
+// YAML keys in upper case, with list indexes as keys, e.g.
+// GOMMUTETIME_DATA_DIR or GOMMUTETIME_ITINERARIES_0_FROM. Lists of strings
+// such as days and tags are comma-separated. Values from the environment
+// take precedence over the config file.
+func applyEnv(cfg *Config, environ []string) error {
+	// Sorted so lists are filled in a stable order
+	environ = slices.Sorted(slices.Values(environ))
+
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		rest, ok := strings.CutPrefix(key, EnvPrefix)
+		if !ok || rest == "" {
+			continue
+		}
+		if err := setEnvValue(reflect.ValueOf(cfg).Elem(), strings.Split(rest, "_"), value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// setEnvValue sets the value at the path of key parts below v
+func setEnvValue(v reflect.Value, parts []string, value string) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		if len(parts) == 0 {
+			return fmt.Errorf("missing key after %s", v.Type().Name())
+		}
+		// YAML keys may contain underscores, so try the longest match first
+		t := v.Type()
+		for n := len(parts); n > 0; n-- {
+			name := strings.ToLower(strings.Join(parts[:n], "_"))
+			for i := range t.NumField() {
+				if yamlName(t.Field(i)) == name {
+					return setEnvValue(v.Field(i), parts[n:], value)
+				}
+			}
+		}
+		return fmt.Errorf("unknown key %s", strings.ToLower(strings.Join(parts, "_")))
+
+	case reflect.Slice:
+		if len(parts) == 0 {
+			if v.Type().Elem().Kind() != reflect.String {
+				return fmt.Errorf("a list index is required")
+			}
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			v.Set(reflect.ValueOf(items).Convert(v.Type()))
+			return nil
+		}
+
+		index, err := strconv.Atoi(parts[0])
+		if err != nil || index < 0 || index > maxEnvIndex {
+			return fmt.Errorf("invalid list index %s", parts[0])
+		}
+		if index >= v.Len() {
+			grown := reflect.MakeSlice(v.Type(), index+1, index+1)
+			reflect.Copy(grown, v)
+			v.Set(grown)
+		}
+		return setEnvValue(v.Index(index), parts[1:], value)
+	}
+
+	if len(parts) > 0 {
+		return fmt.Errorf("unknown key %s", strings.ToLower(strings.Join(parts, "_")))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("cannot be set from the environment")
+	}
+
+	return nil
+}
+
+// yamlName returns the YAML key of a struct field
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
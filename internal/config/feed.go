@@ -0,0 +1,27 @@
+package config
+
+import "fmt"
+
+// FeedConfig publishes alerts and daily summaries as RSS and Atom feeds of
+// the HTTP API, for feed readers to follow
+type FeedConfig struct {
+	// Entries is how many of the latest entries are kept; zero keeps no
+	// feed
+	Entries int `yaml:"entries,omitempty"`
+}
+
+// Enabled reports whether alerts and summaries are kept for the feeds
+func (f FeedConfig) Enabled() bool {
+	return f.Entries > 0
+}
+
+// validateFeed checks the feed, which is kept in the data directory
+func validateFeed(c *Config) error {
+	if c.Feed.Entries < 0 {
+		return fmt.Errorf("feed: entries cannot be negative")
+	}
+	if c.Feed.Enabled() && (c.ReadOnly || c.DataDir == "") {
+		return fmt.Errorf("feed: entries are kept in data_dir, which read-only mode does not write")
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxInterval is the longest time between the samples of a schedule
+const maxInterval = 24 * time.Hour
+
+// ParseClock converts a HH:MM or HH:MM:SS time of day to the time since
+// midnight
+func ParseClock(timeStr string) (time.Duration, error) {
+	var h, m, sec int
+	// Seconds are optional: HH:MM stops short of them
+	n, err := fmt.Sscanf(timeStr, "%d:%d:%d", &h, &m, &sec)
+	if err != nil && (n != 2 || !errors.Is(err, io.ErrUnexpectedEOF)) {
+		return 0, fmt.Errorf("invalid time format '%s' (expected HH:MM or HH:MM:SS)", timeStr)
+	}
+	if h < 0 || h > 23 {
+		return 0, fmt.Errorf("hour must be 0-23, got %d", h)
+	}
+	if m < 0 || m > 59 {
+		return 0, fmt.Errorf("minute must be 0-59, got %d", m)
+	}
+	if sec < 0 || sec > 59 {
+		return 0, fmt.Errorf("second must be 0-59, got %d", sec)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second, nil
+}
+
+// Every returns the time between the samples of a valid schedule, from
+// interval or interval_minutes
+func (s Schedule) Every() time.Duration {
+	if s.Interval != "" {
+		d, _ := time.ParseDuration(s.Interval)
+		return d
+	}
+	return time.Duration(s.IntervalMinutes) * time.Minute
+}
+
+// Times returns the sampling times of a valid schedule as the time since
+// midnight, from start_time to end_time inclusive
+func (s Schedule) Times() []time.Duration {
+	start, err := ParseClock(s.StartTime)
+	if err != nil {
+		return nil
+	}
+	end, err := ParseClock(s.EndTime)
+	every := s.Every()
+	if err != nil || every <= 0 {
+		return nil
+	}
+
+	var times []time.Duration
+	for t := start; t <= end && t < 24*time.Hour; t += every {
+		times = append(times, t)
+	}
+	return times
+}
+
+// Burst reports whether a valid schedule samples at times cron minutes
+// cannot express, e.g. every 90 seconds or from 07:30:15
+func (s Schedule) Burst() bool {
+	start, _ := ParseClock(s.StartTime)
+	end, _ := ParseClock(s.EndTime)
+	return s.Every()%time.Minute != 0 || start%time.Minute != 0 || end%time.Minute != 0
+}
+
+// validateWindow checks the times and interval of a schedule
+func validateWindow(sched Schedule, itinID string) error {
+	start, err := ParseClock(sched.StartTime)
+	if err != nil {
+		return fmt.Errorf("itinerary %s, schedule %s: invalid start_time: %w", itinID, sched.Name, err)
+	}
+	end, err := ParseClock(sched.EndTime)
+	if err != nil {
+		return fmt.Errorf("itinerary %s, schedule %s: invalid end_time: %w", itinID, sched.Name, err)
+	}
+	if start >= end {
+		return fmt.Errorf("itinerary %s, schedule %s: start_time must be before end_time", itinID, sched.Name)
+	}
+
+	if sched.Interval != "" {
+		if sched.IntervalMinutes != 0 {
+			return fmt.Errorf("itinerary %s, schedule %s: set either interval or interval_minutes", itinID, sched.Name)
+		}
+		every, err := time.ParseDuration(sched.Interval)
+		if err != nil {
+			return fmt.Errorf("itinerary %s, schedule %s: invalid interval: %w", itinID, sched.Name, err)
+		}
+		if every < time.Second || every%time.Second != 0 {
+			return fmt.Errorf("itinerary %s, schedule %s: interval must be a whole number of seconds", itinID, sched.Name)
+		}
+		if every > maxInterval {
+			return fmt.Errorf("itinerary %s, schedule %s: interval cannot exceed 24h", itinID, sched.Name)
+		}
+	} else {
+		if sched.IntervalMinutes <= 0 {
+			return fmt.Errorf("itinerary %s, schedule %s: interval_minutes must be positive", itinID, sched.Name)
+		}
+		if sched.IntervalMinutes > 1440 {
+			return fmt.Errorf("itinerary %s, schedule %s: interval_minutes cannot exceed 1440 (1 day)", itinID, sched.Name)
+		}
+	}
+
+	// Adaptive plans pick among the minutes of a schedule
+	if sched.Adaptive != nil && sched.Burst() {
+		return fmt.Errorf("itinerary %s, schedule %s: adaptive sampling needs whole minutes", itinID, sched.Name)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		clock string
+		want  time.Duration
+	}{
+		{"00:00", 0},
+		{"07:30", 7*time.Hour + 30*time.Minute},
+		{"7:05", 7*time.Hour + 5*time.Minute},
+		{"07:30:15", 7*time.Hour + 30*time.Minute + 15*time.Second},
+		{"23:59:59", 24*time.Hour - time.Second},
+	}
+	for _, tt := range tests {
+		got, err := ParseClock(tt.clock)
+		if err != nil {
+			t.Errorf("ParseClock(%q) error = %v", tt.clock, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseClock(%q) = %v, want %v", tt.clock, got, tt.want)
+		}
+	}
+}
+
+func TestParseClockErrors(t *testing.T) {
+	tests := []struct {
+		clock string
+		want  string
+	}{
+		{"", "invalid time format"},
+		{"7", "invalid time format"},
+		{"7am", "invalid time format"},
+		{"07:30:", "invalid time format"},
+		{"24:00", "hour must be 0-23"},
+		{"07:60", "minute must be 0-59"},
+		{"07:30:60", "second must be 0-59"},
+	}
+	for _, tt := range tests {
+		_, err := ParseClock(tt.clock)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseClock(%q) error = %v, want %q", tt.clock, err, tt.want)
+		}
+	}
+}
+
+func TestScheduleTimes(t *testing.T) {
+	tests := []struct {
+		name  string
+		sched Schedule
+		want  []string
+		burst bool
+	}{
+		{"minutes", Schedule{StartTime: "07:00", EndTime: "08:00", IntervalMinutes: 20},
+			[]string{"07:00", "07:20", "07:40", "08:00"}, false},
+		{"end between samples", Schedule{StartTime: "07:00", EndTime: "07:50", IntervalMinutes: 20},
+			[]string{"07:00", "07:20", "07:40"}, false},
+		{"interval in minutes", Schedule{StartTime: "07:00", EndTime: "07:30", Interval: "15m"},
+			[]string{"07:00", "07:15", "07:30"}, false},
+		{"seconds", Schedule{StartTime: "07:00", EndTime: "07:05", Interval: "90s"},
+			[]string{"07:00", "07:01:30", "07:03", "07:04:30"}, true},
+		{"start with seconds", Schedule{StartTime: "07:30:15", EndTime: "07:32", IntervalMinutes: 1},
+			[]string{"07:30:15", "07:31:15"}, true},
+		{"end with seconds", Schedule{StartTime: "07:30", EndTime: "07:31:30", IntervalMinutes: 1},
+			[]string{"07:30", "07:31"}, true},
+		{"up to midnight", Schedule{StartTime: "23:00", EndTime: "23:59", Interval: "24h"},
+			[]string{"23:00"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range tt.sched.Times() {
+				got = append(got, formatClock(d))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Times() = %v, want %v", got, tt.want)
+			}
+			if burst := tt.sched.Burst(); burst != tt.burst {
+				t.Errorf("Burst() = %v, want %v", burst, tt.burst)
+			}
+		})
+	}
+}
+
+func TestScheduleTimesInvalid(t *testing.T) {
+	for _, sched := range []Schedule{
+		{StartTime: "7am", EndTime: "08:00", IntervalMinutes: 10},
+		{StartTime: "07:00", EndTime: "", IntervalMinutes: 10},
+		{StartTime: "07:00", EndTime: "08:00"},
+	} {
+		if times := sched.Times(); times != nil {
+			t.Errorf("Times() of %+v = %v, want none", sched, times)
+		}
+	}
+}
+
+func TestOverlapBurst(t *testing.T) {
+	regular := Schedule{Days: []string{"mon", "tue"}, StartTime: "07:00", EndTime: "08:00", IntervalMinutes: 15}
+	burst := Schedule{Days: []string{"tue", "wed"}, StartTime: "07:00", EndTime: "07:30", Interval: "90s"}
+	days, shared := Overlap(regular, burst)
+	// 07:00, 07:15 and 07:30 are every 90 seconds from 07:00
+	if !slices.Equal(days, []string{"tue"}) || shared != 3 {
+		t.Errorf("Overlap() = %v, %d, want [tue], 3", days, shared)
+	}
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gommutetime/internal/geo"
+)
+
+// Thresholds of the config warnings
+const (
+	// lintInterval is the densest interval not warned about
+	lintInterval = 5 * time.Minute
+	// lintDailyRequests is the most route lookups a day not warned about
+	lintDailyRequests = 500
+	// lintLateEnd is the end_time from which a schedule looks like it was
+	// meant to carry on past midnight, in minutes after midnight
+	lintLateEnd = 23*60 + 45
+)
+
+// Warnings returns problems that do not prevent the config from loading but
+// are probably mistakes, such as schedules sampling the same minute twice or
+// addresses without a city. The config must be valid.
+func (c *Config) Warnings() []string {
+	var warnings []string
+	for _, itin := range c.Itineraries {
+		warnings = append(warnings, overlapWarnings(itin)...)
+		warnings = append(warnings, intervalWarnings(itin)...)
+		warnings = append(warnings, midnightWarnings(itin)...)
+		warnings = append(warnings, addressWarnings(itin)...)
+	}
+	if day, requests := c.busiestDay(); requests > lintDailyRequests {
+		warnings = append(warnings, fmt.Sprintf(
+			"schedules make %d route lookups on %ss, more than %d a day: check the cost estimate and the provider's quota",
+			requests, day, lintDailyRequests))
+	}
+	return warnings
+}
+
+// intervalWarnings reports the schedules of an itinerary sampling more
+// often than every lintInterval, which seldom tells more about a
+// commute than sampling every 5 minutes but costs more. Adaptive schedules
+// bound their requests themselves.
+func intervalWarnings(itin Itinerary) []string {
+	var warnings []string
+	for _, sched := range itin.Schedules {
+		if every := sched.Every(); every > 0 && every < lintInterval && sched.Adaptive == nil {
+			interval := sched.Interval
+			if interval == "" {
+				interval = fmt.Sprintf("%d minutes", sched.IntervalMinutes)
+			}
+			warnings = append(warnings, fmt.Sprintf(
+				"itinerary %s, schedule %s: an interval of %s is denser than every %d minutes",
+				itin.ID, sched.Name, interval, int(lintInterval/time.Minute)))
+		}
+	}
+	return warnings
+}
+
+// midnightWarnings reports the schedules of an itinerary ending just before
+// midnight without another one carrying on from 00:00 the next day. Windows
+// cannot span midnight, so a night shift needs two schedules.
+func midnightWarnings(itin Itinerary) []string {
+	var warnings []string
+	for _, sched := range itin.Schedules {
+		if sched.Override {
+			continue
+		}
+		hour, minute, err := ParseTime(sched.EndTime)
+		if err != nil || hour*60+minute < lintLateEnd {
+			continue
+		}
+		var missing []string
+		for _, day := range sched.Weekdays() {
+			next := (day + 1) % 7
+			if !slices.ContainsFunc(itin.Schedules, func(s Schedule) bool {
+				return !s.Override && startsAtMidnight(s) && slices.Contains(s.Weekdays(), next)
+			}) {
+				missing = append(missing, strings.ToLower(next.String()[:3]))
+			}
+		}
+		if len(missing) > 0 {
+			warnings = append(warnings, fmt.Sprintf(
+				"itinerary %s, schedule %s: sampling stops at midnight, as schedules cannot span it; add a schedule from 00:00 on %s to carry on",
+				itin.ID, sched.Name, strings.Join(missing, ",")))
+		}
+	}
+	return warnings
+}
+
+// startsAtMidnight reports whether a schedule starts at 00:00
+func startsAtMidnight(s Schedule) bool {
+	hour, minute, err := ParseTime(s.StartTime)
+	return err == nil && hour == 0 && minute == 0
+}
+
+// addressWarnings reports the addresses of an itinerary that have no city,
+// which providers may resolve to a street of the same name elsewhere
+func addressWarnings(itin Itinerary) []string {
+	var warnings []string
+	check := func(field, address string) {
+		if address != "" && lacksCity(address) {
+			warnings = append(warnings, fmt.Sprintf(
+				"itinerary %s: %s %q has no city, providers may pick a place of that name elsewhere", itin.ID, field, address))
+		}
+	}
+	check("from", itin.From)
+	check("to", itin.To)
+	check("via", itin.Via)
+	for _, stop := range itin.Stops {
+		check("stop "+stop.Label, stop.Address)
+	}
+	for _, p := range itin.Origins {
+		check("origin "+p.Label, p.Address)
+	}
+	for _, p := range itin.Destinations {
+		check("destination "+p.Label, p.Address)
+	}
+	return warnings
+}
+
+// lacksCity reports whether a location is an address without a comma
+// separating a city. Coordinates, Plus Codes and place IDs are precise.
+func lacksCity(location string) bool {
+	location = strings.TrimSpace(location)
+	if _, ok := geo.Locate(location); ok {
+		return false
+	}
+	if code, _, _ := strings.Cut(location, " "); geo.IsPlusCode(code) {
+		return false
+	}
+	if strings.HasPrefix(location, "place_id:") {
+		return false
+	}
+	return !strings.Contains(location, ",")
+}
+
+// busiestDay returns the weekday the regular schedules make the most route
+// lookups on, and how many: one per pair of a matrix itinerary, leg of a
+// park-and-ride or carpool itinerary and compared provider. Dense sampling
+// and overrides are left out.
+func (c *Config) busiestDay() (string, int) {
+	var requests [7]int
+	for _, itin := range c.Itineraries {
+		for _, sched := range itin.Schedules {
+			if sched.Override {
+				continue
+			}
+			for _, day := range sched.Weekdays() {
+				requests[day] += sched.Requests() * itin.lookups()
+			}
+		}
+	}
+	busiest := time.Monday
+	for day := range requests {
+		if requests[day] > requests[busiest] {
+			busiest = time.Weekday(day)
+		}
+	}
+	return busiest.String(), requests[busiest]
+}
+
+// lookups returns how many route lookups a fetch of the itinerary makes
+func (itin Itinerary) lookups() int {
+	n := 1
+	switch {
+	case itin.IsMatrix():
+		n = len(itin.Origins) * len(itin.Destinations)
+	case itin.IsParkAndRide():
+		n = 2
+	case itin.IsCarpool():
+		n = len(itin.Stops) + 1
+	}
+	if itin.Direct {
+		n++
+	}
+	return n * max(len(itin.Providers), 1)
+}
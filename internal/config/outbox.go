@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// OutboxConfig keeps the notifications and stream messages that could not
+// be delivered in the data directory, retrying them until they are
+type OutboxConfig struct {
+	// MaxAgeHours is how long deliveries are retried, 24 by default
+	MaxAgeHours int `yaml:"max_age_hours,omitempty"`
+	// MaxEntries bounds the deliveries waiting, 10000 by default; the
+	// oldest are dropped beyond it
+	MaxEntries int `yaml:"max_entries,omitempty"`
+}
+
+// Defaults of the outbox
+const (
+	defaultOutboxAge     = 24 * time.Hour
+	defaultOutboxEntries = 10000
+)
+
+// MaxAge returns how long deliveries are retried
+func (o OutboxConfig) MaxAge() time.Duration {
+	if o.MaxAgeHours == 0 {
+		return defaultOutboxAge
+	}
+	return time.Duration(o.MaxAgeHours) * time.Hour
+}
+
+// Limit returns how many deliveries may wait
+func (o OutboxConfig) Limit() int {
+	if o.MaxEntries == 0 {
+		return defaultOutboxEntries
+	}
+	return o.MaxEntries
+}
+
+// OutboxDir returns the directory of the outbox, or an empty string when
+// nothing may be written to the data directory
+func (c *Config) OutboxDir() string {
+	if c.ReadOnly || c.DataDir == "" {
+		return ""
+	}
+	return filepath.Join(c.DataDir, "outbox")
+}
+
+// validateOutbox checks the outbox limits
+func validateOutbox(o OutboxConfig) error {
+	if o.MaxAgeHours < 0 {
+		return fmt.Errorf("outbox: max_age_hours must not be negative")
+	}
+	if o.MaxEntries < 0 {
+		return fmt.Errorf("outbox: max_entries must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// overlapWarnings reports the schedules of an itinerary sampling the same
+// minute twice
+func overlapWarnings(itin Itinerary) []string {
+	var warnings []string
+	for i := range itin.Schedules {
+		for j := i + 1; j < len(itin.Schedules); j++ {
+			a, b := itin.Schedules[i], itin.Schedules[j]
+			if a.Layer() != b.Layer() {
+				continue
+			}
+			if days, shared := Overlap(a, b); shared > 0 {
+				warnings = append(warnings, fmt.Sprintf(
+					"itinerary %s: schedules %s and %s overlap on %s (%d shared time slots are sampled once)",
+					itin.ID, a.Name, b.Name, strings.Join(days, ","), shared))
+			}
+		}
+	}
+	return warnings
+}
+
+// Overlap returns the days on which two valid schedules sample the same time
+// and the number of time slots they share on each of those days
+func Overlap(a, b Schedule) ([]string, int) {
+	var days []string
+	seen := make(map[time.Weekday]bool)
+	for _, wa := range a.Weekdays() {
+		for _, wb := range b.Weekdays() {
+			if wa == wb && !seen[wa] {
+				seen[wa] = true
+				days = append(days, strings.ToLower(wa.String()[:3]))
+			}
+		}
+	}
+	if len(days) == 0 {
+		return nil, 0
+	}
+
+	timesA := make(map[time.Duration]bool)
+	for _, t := range a.Times() {
+		timesA[t] = true
+	}
+	shared := 0
+	for _, t := range b.Times() {
+		if timesA[t] {
+			shared++
+		}
+	}
+	if shared == 0 {
+		return nil, 0
+	}
+
+	return days, shared
+}
+
+// Slots returns the sampling times of a valid schedule in minutes after
+// midnight, from start_time to end_time inclusive. Burst schedules repeat
+// the minutes they sample several times in.
+func (s Schedule) Slots() []int {
+	var slots []int
+	for _, t := range s.Times() {
+		slots = append(slots, int(t/time.Minute))
+	}
+	return slots
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// SuppressOnly reports whether the schedule is an override that only
+// suppresses the regular schedules, without sampling times of its own
+func (s Schedule) SuppressOnly() bool {
+	return s.Override && len(s.Days) == 0 && s.StartTime == "" && s.EndTime == "" && s.IntervalMinutes == 0 && s.Interval == ""
+}
+
+// OnDate reports whether day falls within one of the schedule's dates
+func (s Schedule) OnDate(day time.Time) bool {
+	date := day.Format(dateLayout)
+	for _, dates := range s.Dates {
+		start, end, err := parseDateRange(dates)
+		if err == nil && date >= start && date <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// HasOverrides reports whether any of the itinerary's schedules is an override
+func (itin Itinerary) HasOverrides() bool {
+	for _, sched := range itin.Schedules {
+		if sched.Override {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether a schedule of the itinerary runs on day. Override
+// schedules run on their dates only, and regular schedules run on any day
+// no override covers.
+func (itin Itinerary) Active(sched Schedule, day time.Time) bool {
+	if sched.Override {
+		return sched.OnDate(day)
+	}
+	for _, other := range itin.Schedules {
+		if other.Override && other.OnDate(day) {
+			return false
+		}
+	}
+	return true
+}
+
+// Layer groups schedules that run on the same dates: regular schedules
+// together, override schedules by their dates and schedules on a roster by
+// their rotation
+func (s Schedule) Layer() string {
+	if s.Rotation != nil {
+		// Schedules on different rosters share no days
+		return fmt.Sprintf("rotation %s %d/%d", s.Rotation.Start, s.Rotation.OnDays, s.Rotation.OffDays)
+	}
+	if !s.Override {
+		return ""
+	}
+	return strings.Join(s.Dates, ",")
+}
+
+// parseDateRange parses a YYYY-MM-DD date or an inclusive
+// YYYY-MM-DD..YYYY-MM-DD range, returning its first and last days
+func parseDateRange(value string) (start, end string, err error) {
+	first, last, isRange := strings.Cut(value, "..")
+	if !isRange {
+		last = first
+	}
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+	startDate, err := time.Parse(dateLayout, first)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid date %q (expected YYYY-MM-DD or YYYY-MM-DD..YYYY-MM-DD)", value)
+	}
+	endDate, err := time.Parse(dateLayout, last)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid date %q (expected YYYY-MM-DD or YYYY-MM-DD..YYYY-MM-DD)", value)
+	}
+	if endDate.Before(startDate) {
+		return "", "", fmt.Errorf("invalid date range %q: end is before start", value)
+	}
+
+	return first, last, nil
+}
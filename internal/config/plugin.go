@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// PluginEvents are the events plugins can receive, as published on the
+// internal event bus
+var PluginEvents = []string{"sample.recorded", "job.succeeded", "job.failed", "alert.fired", "config.reloaded"}
+
+// Plugin is an external program receiving events as lines of JSON on its
+// standard input, e.g. to write samples to a destination the project does
+// not support
+type Plugin struct {
+	Name    string   `yaml:"name"`
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args,omitempty"`
+	// Events are the events sent to the plugin, sample.recorded when empty
+	Events []string `yaml:"events,omitempty"`
+	// TimeoutSeconds bounds the wait for the plugin's reply to an event,
+	// DefaultPluginTimeoutSeconds unless set
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty"`
+}
+
+// DefaultPluginTimeoutSeconds is how long a plugin may take to reply to an
+// event, unless set
+const DefaultPluginTimeoutSeconds = 10
+
+// Receives reports whether the plugin is sent an event of a kind
+func (p Plugin) Receives(kind string) bool {
+	if len(p.Events) == 0 {
+		return kind == "sample.recorded"
+	}
+	return slices.Contains(p.Events, kind)
+}
+
+// validatePlugins checks the plugins of the config
+func (c *Config) validatePlugins() error {
+	names := make(map[string]bool)
+	for i, p := range c.Plugins {
+		if p.Name == "" {
+			return fmt.Errorf("plugin %d: name is required", i)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate plugin name: %s", p.Name)
+		}
+		names[p.Name] = true
+		if p.Command == "" {
+			return fmt.Errorf("plugin %s: command is required", p.Name)
+		}
+		for _, event := range p.Events {
+			if !slices.Contains(PluginEvents, event) {
+				return fmt.Errorf("plugin %s: unknown event '%s'", p.Name, event)
+			}
+		}
+		if p.TimeoutSeconds < 0 {
+			return fmt.Errorf("plugin %s: timeout_seconds cannot be negative", p.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// RedisConfig keeps the latest sample of each itinerary in Redis, for other
+// services to read the current commute with a single GET
+type RedisConfig struct {
+	// URL is the server, e.g. redis://:password@localhost:6379/0; empty
+	// writes nothing
+	URL string `yaml:"url,omitempty"`
+	// KeyPrefix is put before the itinerary IDs of keys, gommutetime: by
+	// default
+	KeyPrefix string `yaml:"key_prefix,omitempty"`
+	// TTLSeconds is how long the latest sample is kept, after which it is
+	// stale and its keys expire; DefaultRedisTTLSeconds unless set
+	TTLSeconds int `yaml:"ttl_seconds,omitempty"`
+	// Stream is a Redis stream every sample is also added to, if set
+	Stream string `yaml:"stream,omitempty"`
+	// StreamMaxLen trims the stream to about this many entries,
+	// DefaultRedisStreamMaxLen unless set
+	StreamMaxLen int64 `yaml:"stream_max_len,omitempty"`
+}
+
+// Defaults of the Redis output
+const (
+	DefaultRedisKeyPrefix    = "gommutetime:"
+	DefaultRedisTTLSeconds   = 3600
+	DefaultRedisStreamMaxLen = 10000
+)
+
+// Prefix returns the prefix of keys
+func (r RedisConfig) Prefix() string {
+	if r.KeyPrefix != "" {
+		return r.KeyPrefix
+	}
+	return DefaultRedisKeyPrefix
+}
+
+// TTL returns how long the latest sample is kept
+func (r RedisConfig) TTL() time.Duration {
+	if r.TTLSeconds > 0 {
+		return time.Duration(r.TTLSeconds) * time.Second
+	}
+	return DefaultRedisTTLSeconds * time.Second
+}
+
+// MaxLen returns about how many entries the stream keeps
+func (r RedisConfig) MaxLen() int64 {
+	if r.StreamMaxLen > 0 {
+		return r.StreamMaxLen
+	}
+	return DefaultRedisStreamMaxLen
+}
+
+// validateRedis checks the Redis output
+func validateRedis(r RedisConfig) error {
+	if r.URL == "" {
+		if r.Stream != "" {
+			return fmt.Errorf("redis: url is required for the stream")
+		}
+		return nil
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss" && u.Scheme != "unix") {
+		return fmt.Errorf("redis: url must be like redis://localhost:6379/0, got '%s'", r.URL)
+	}
+	if r.TTLSeconds < 0 {
+		return fmt.Errorf("redis: ttl_seconds cannot be negative")
+	}
+	if r.StreamMaxLen < 0 {
+		return fmt.Errorf("redis: stream_max_len cannot be negative")
+	}
+	return nil
+}
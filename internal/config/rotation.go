@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rotation runs a schedule on the working days of a rotating roster rather
+// than on weekdays, e.g. 4 days on and 4 off. Rosters alternating day and
+// night shifts take a schedule each, with starts offset by the days between
+// them.
+type Rotation struct {
+	// Start is the first working day of a cycle, YYYY-MM-DD; the cycles
+	// repeat before and after it
+	Start string `yaml:"start"`
+	// OnDays and OffDays are the working days and the days off of a cycle
+	OnDays  int `yaml:"on_days"`
+	OffDays int `yaml:"off_days"`
+}
+
+// allWeekdays are the days schedules on a roster run on unless narrowed
+var allWeekdays = []time.Weekday{
+	time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday,
+}
+
+// Working reports whether the local day of t is a working day of the roster
+func (r Rotation) Working(t time.Time) bool {
+	start, err := time.ParseInLocation(dateLayout, r.Start, time.Local)
+	cycle := r.OnDays + r.OffDays
+	if err != nil || r.OnDays <= 0 || cycle <= 0 {
+		return false
+	}
+	local := t.In(time.Local)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+	// Days are counted on the calendar so that DST changes do not shift them
+	days := int(day.Sub(start).Round(24*time.Hour) / (24 * time.Hour))
+	return ((days%cycle)+cycle)%cycle < r.OnDays
+}
+
+// Weekdays returns the weekdays a valid schedule runs on: its days, or
+// every day for schedules on a roster without days
+func (s Schedule) Weekdays() []time.Weekday {
+	if len(s.Days) == 0 && s.Rotation != nil {
+		return allWeekdays
+	}
+	var weekdays []time.Weekday
+	for _, name := range s.Days {
+		if day, err := DayNameToWeekday(name); err == nil {
+			weekdays = append(weekdays, day)
+		}
+	}
+	return weekdays
+}
+
+// OnRoster reports whether the schedule runs on the day of t as far as its
+// roster goes, always for schedules without one
+func (s Schedule) OnRoster(t time.Time) bool {
+	return s.Rotation == nil || s.Rotation.Working(t)
+}
+
+// validateRotation checks the roster of a schedule
+func validateRotation(sched Schedule, itinID string) error {
+	r := sched.Rotation
+	if r == nil {
+		return nil
+	}
+	if sched.Override {
+		return fmt.Errorf("itinerary %s, schedule %s: override schedules cannot have a rotation", itinID, sched.Name)
+	}
+	if _, err := time.Parse(dateLayout, r.Start); err != nil {
+		return fmt.Errorf("itinerary %s, schedule %s: rotation: start must be a date like 2026-01-05, got %q", itinID, sched.Name, r.Start)
+	}
+	if r.OnDays <= 0 || r.OffDays <= 0 {
+		return fmt.Errorf("itinerary %s, schedule %s: rotation: on_days and off_days must be positive", itinID, sched.Name)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gommutetime/internal/ical"
+)
+
+// What the events of a school calendar are
+const (
+	SchoolEventsVacations = "vacations"
+	SchoolEventsTerms     = "terms"
+)
+
+// SchoolCalendar tells school term days from vacations with the events of
+// an iCalendar file, e.g. exported from the school's website
+type SchoolCalendar struct {
+	// File is the iCalendar (.ics) file
+	File string `yaml:"file"`
+	// Events are the vacations (default), every other day being in term,
+	// or the terms, every other day being a vacation
+	Events string `yaml:"events,omitempty"`
+	// Match only counts the events whose summary matches this regular
+	// expression, case-insensitively, e.g. "break|holiday|no school"
+	Match string `yaml:"match,omitempty"`
+}
+
+// Terms reports whether the events of the calendar are the terms
+func (s SchoolCalendar) Terms() bool {
+	return s.Events == SchoolEventsTerms
+}
+
+// Matcher compiles the expression selecting events, nil when every event
+// counts
+func (s SchoolCalendar) Matcher() (*regexp.Regexp, error) {
+	if s.Match == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + s.Match)
+}
+
+// validateSchoolCalendar checks the school calendar of an itinerary and
+// that its file can be read
+func validateSchoolCalendar(itin Itinerary) error {
+	s := itin.SchoolCalendar
+	if s == nil {
+		return nil
+	}
+	if itin.IsMatrix() {
+		return fmt.Errorf("itinerary %s: school_calendar is not supported for matrix itineraries", itin.ID)
+	}
+	if s.File == "" {
+		return fmt.Errorf("itinerary %s: school_calendar: file is required", itin.ID)
+	}
+	if s.Events != "" && s.Events != SchoolEventsVacations && s.Events != SchoolEventsTerms {
+		return fmt.Errorf("itinerary %s: school_calendar: unknown events '%s' (expected vacations or terms)", itin.ID, s.Events)
+	}
+	if _, err := s.Matcher(); err != nil {
+		return fmt.Errorf("itinerary %s: school_calendar: invalid match: %w", itin.ID, err)
+	}
+
+	file, err := os.Open(s.File)
+	if err != nil {
+		return fmt.Errorf("itinerary %s: school_calendar: %w", itin.ID, err)
+	}
+	defer file.Close()
+	if _, err := ical.Parse(file); err != nil {
+		return fmt.Errorf("itinerary %s: school_calendar: %s: %w", itin.ID, s.File, err)
+	}
+	return nil
+}
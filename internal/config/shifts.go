@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Defaults of shift calendars
+const (
+	DefaultShiftLeadMinutes     = 90
+	DefaultShiftIntervalMinutes = 15
+)
+
+// ShiftCalendar samples an itinerary ahead of the shifts in a CalDAV
+// calendar, for shift workers whose hours change from week to week. It
+// replaces or adds to the itinerary's weekday schedules.
+type ShiftCalendar struct {
+	// URL is the CalDAV calendar collection, e.g.
+	// https://cloud.example.com/remote.php/dav/calendars/alice/shifts/
+	URL      string `yaml:"url"`
+	Username string `yaml:"username,omitempty"`
+	// Password defaults to the CALDAV_PASSWORD environment variable
+	Password string `yaml:"password,omitempty"`
+	// Match only counts the events whose summary matches this regular
+	// expression, case-insensitively, e.g. "shift|on call"
+	Match string `yaml:"match,omitempty"`
+	// LeadMinutes is how long before the start of each shift sampling
+	// starts, DefaultShiftLeadMinutes unless set; it goes on until the
+	// shift starts
+	LeadMinutes int `yaml:"lead_minutes,omitempty"`
+	// IntervalMinutes is the time between samples before a shift,
+	// DefaultShiftIntervalMinutes unless set
+	IntervalMinutes int `yaml:"interval_minutes,omitempty"`
+}
+
+// Lead returns how long before shifts sampling starts
+func (s ShiftCalendar) Lead() time.Duration {
+	if s.LeadMinutes > 0 {
+		return time.Duration(s.LeadMinutes) * time.Minute
+	}
+	return DefaultShiftLeadMinutes * time.Minute
+}
+
+// Interval returns the time between samples before a shift
+func (s ShiftCalendar) Interval() time.Duration {
+	if s.IntervalMinutes > 0 {
+		return time.Duration(s.IntervalMinutes) * time.Minute
+	}
+	return DefaultShiftIntervalMinutes * time.Minute
+}
+
+// Credentials returns the username and password of the calendar
+func (s ShiftCalendar) Credentials() (username, password string) {
+	password = s.Password
+	if password == "" {
+		password = os.Getenv("CALDAV_PASSWORD")
+	}
+	return s.Username, password
+}
+
+// Matcher compiles the expression selecting shifts, nil when every event
+// is one
+func (s ShiftCalendar) Matcher() (*regexp.Regexp, error) {
+	if s.Match == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + s.Match)
+}
+
+// validateShifts checks the shift calendar of an itinerary
+func validateShifts(itin Itinerary) error {
+	s := itin.Shifts
+	if s == nil {
+		return nil
+	}
+	if itin.IsMatrix() {
+		return fmt.Errorf("itinerary %s: shifts are not supported for matrix itineraries", itin.ID)
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("itinerary %s: shifts: url must be an http(s) URL, got '%s'", itin.ID, s.URL)
+	}
+	if s.LeadMinutes < 0 || s.IntervalMinutes < 0 {
+		return fmt.Errorf("itinerary %s: shifts: lead_minutes and interval_minutes cannot be negative", itin.ID)
+	}
+	if s.Interval() > s.Lead() {
+		return fmt.Errorf("itinerary %s: shifts: interval_minutes cannot exceed lead_minutes", itin.ID)
+	}
+	if _, err := s.Matcher(); err != nil {
+		return fmt.Errorf("itinerary %s: shifts: invalid match: %w", itin.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// StatsDConfig sends the metrics of each fetch to a StatsD or DogStatsD
+// agent, for monitoring that takes pushed metrics rather than OTLP
+type StatsDConfig struct {
+	// Address is the host:port of the agent, e.g. localhost:8125; empty
+	// sends nothing
+	Address string `yaml:"address,omitempty"`
+	// Prefix is put before metric names, gommutetime. by default
+	Prefix string `yaml:"prefix,omitempty"`
+	// DogStatsD tags metrics with the itinerary and provider, which plain
+	// StatsD puts in the metric names instead
+	DogStatsD bool `yaml:"dogstatsd,omitempty"`
+	// Tags are added to every metric with DogStatsD, e.g. env:prod
+	Tags []string `yaml:"tags,omitempty"`
+}
+
+// DefaultStatsDPrefix is put before metric names unless set
+const DefaultStatsDPrefix = "gommutetime."
+
+// MetricPrefix returns the prefix of metric names
+func (s StatsDConfig) MetricPrefix() string {
+	if s.Prefix != "" {
+		return s.Prefix
+	}
+	return DefaultStatsDPrefix
+}
+
+// validateStatsD checks the StatsD agent
+func validateStatsD(s StatsDConfig) error {
+	if s.Address == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(s.Address); err != nil {
+		return fmt.Errorf("statsd: address must be host:port, got '%s'", s.Address)
+	}
+	for _, tag := range s.Tags {
+		if tag == "" || strings.ContainsAny(tag, ",|#@ ") {
+			return fmt.Errorf("statsd: invalid tag '%s'", tag)
+		}
+	}
+	if len(s.Tags) > 0 && !s.DogStatsD {
+		return fmt.Errorf("statsd: tags need dogstatsd")
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// StatusPageConfig periodically renders a compact status page of the
+// current commute times, as static HTML and JSON files for any web server
+// or e-ink display to show
+type StatusPageConfig struct {
+	// IntervalMinutes is how often the page is rendered; zero renders none
+	IntervalMinutes int `yaml:"interval_minutes,omitempty"`
+	// Dir is where the files are written, absolute or relative to the data
+	// directory: status by default, and only when set with an S3 bucket
+	Dir string `yaml:"dir,omitempty"`
+	// S3 uploads the files to a bucket
+	S3 *S3Target `yaml:"s3,omitempty"`
+	// Title heads the HTML page, Commute times by default
+	Title string `yaml:"title,omitempty"`
+}
+
+// S3Target is a bucket of S3 or an S3-compatible store, e.g. MinIO
+type S3Target struct {
+	// Endpoint is the store's host, AWS by default; an http:// URL connects
+	// without TLS
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// Region is us-east-1 by default
+	Region string `yaml:"region,omitempty"`
+	Bucket string `yaml:"bucket"`
+	// Prefix is put before the names of the files, e.g. commute/
+	Prefix string `yaml:"prefix,omitempty"`
+	// AccessKey and SecretKey default to the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY environment variables
+	AccessKey string `yaml:"access_key,omitempty"`
+	SecretKey string `yaml:"secret_key,omitempty"`
+}
+
+// DefaultStatusPageTitle heads status pages without a title
+const DefaultStatusPageTitle = "Commute times"
+
+// Enabled reports whether status pages are rendered
+func (s StatusPageConfig) Enabled() bool {
+	return s.IntervalMinutes > 0
+}
+
+// Interval returns how often the page is rendered
+func (s StatusPageConfig) Interval() time.Duration {
+	return time.Duration(s.IntervalMinutes) * time.Minute
+}
+
+// PageTitle returns the title of the HTML page
+func (s StatusPageConfig) PageTitle() string {
+	if s.Title != "" {
+		return s.Title
+	}
+	return DefaultStatusPageTitle
+}
+
+// StatusPageDir returns the directory status pages are written to, empty
+// when they are only uploaded
+func (c *Config) StatusPageDir() string {
+	dir := c.StatusPage.Dir
+	if dir == "" {
+		if c.StatusPage.S3 != nil {
+			return ""
+		}
+		dir = "status"
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(c.DataDir, dir)
+}
+
+// Credentials returns the access and secret keys of the bucket
+func (s S3Target) Credentials() (accessKey, secretKey string) {
+	accessKey, secretKey = s.AccessKey, s.SecretKey
+	if accessKey == "" {
+		accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if secretKey == "" {
+		secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	return accessKey, secretKey
+}
+
+// validateStatusPage checks where status pages are written
+func validateStatusPage(c *Config) error {
+	s := c.StatusPage
+	if s.IntervalMinutes < 0 {
+		return fmt.Errorf("status_page: interval_minutes cannot be negative")
+	}
+	if !s.Enabled() {
+		return nil
+	}
+	if dir := c.StatusPageDir(); dir != "" && c.ReadOnly && !filepath.IsAbs(s.Dir) {
+		return fmt.Errorf("status_page: an absolute dir or s3 is required in read-only mode")
+	}
+	if s.S3 != nil {
+		if s.S3.Bucket == "" {
+			return fmt.Errorf("status_page: s3: bucket is required")
+		}
+		if strings.Contains(s.S3.Endpoint, "://") {
+			u, err := url.Parse(s.S3.Endpoint)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("status_page: s3: endpoint must be a host or http(s) URL, got '%s'", s.S3.Endpoint)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// StreamsConfig publishes samples and alerts to the streaming platforms of
+// data pipelines, as the JSON messages sent to plugins
+type StreamsConfig struct {
+	Kafka *KafkaTarget `yaml:"kafka,omitempty"`
+	NATS  *NATSTarget  `yaml:"nats,omitempty"`
+}
+
+// KafkaTarget is a Kafka topic messages are produced to, keyed by
+// itinerary ID
+type KafkaTarget struct {
+	// Brokers are the host:port addresses of the brokers to bootstrap from
+	Brokers []string `yaml:"brokers"`
+	Topic   string   `yaml:"topic"`
+}
+
+// NATSTarget is a NATS subject messages are published on
+type NATSTarget struct {
+	// URL is the server to connect to, e.g. nats://localhost:4222
+	URL     string `yaml:"url"`
+	Subject string `yaml:"subject"`
+}
+
+// StreamsFor returns where samples and alerts of an itinerary are
+// published: the itinerary's own targets, and the global ones it does not
+// replace
+func (c *Config) StreamsFor(itin Itinerary) StreamsConfig {
+	streams := c.Streams
+	if itin.Streams != nil {
+		if itin.Streams.Kafka != nil {
+			streams.Kafka = itin.Streams.Kafka
+		}
+		if itin.Streams.NATS != nil {
+			streams.NATS = itin.Streams.NATS
+		}
+	}
+	return streams
+}
+
+// HasStreams reports whether anything is published to Kafka or NATS
+func (c *Config) HasStreams() bool {
+	if c.Streams.Kafka != nil || c.Streams.NATS != nil {
+		return true
+	}
+	for _, itin := range c.Itineraries {
+		if itin.Streams != nil && (itin.Streams.Kafka != nil || itin.Streams.NATS != nil) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateStreams checks streaming targets, field being where they are
+// configured
+func validateStreams(field string, s StreamsConfig) error {
+	if k := s.Kafka; k != nil {
+		if len(k.Brokers) == 0 {
+			return fmt.Errorf("%s.kafka.brokers is required", field)
+		}
+		for _, broker := range k.Brokers {
+			if _, port, ok := strings.Cut(broker, ":"); !ok || port == "" {
+				return fmt.Errorf("%s.kafka.brokers: '%s' must be host:port", field, broker)
+			}
+		}
+		if k.Topic == "" {
+			return fmt.Errorf("%s.kafka.topic is required", field)
+		}
+	}
+	if n := s.NATS; n != nil {
+		u, err := url.Parse(n.URL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("%s.nats.url must be a URL like nats://localhost:4222, got '%s'", field, n.URL)
+		}
+		if n.Subject == "" || strings.ContainsAny(n.Subject, " \t*>") {
+			return fmt.Errorf("%s.nats.subject must be a subject without spaces or wildcards, got '%s'", field, n.Subject)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gommutetime/internal/apperr"
+)
+
+const (
+	// versionsDir holds config snapshots inside the data directory
+	versionsDir = "config-history"
+	// defaultVersions is how many snapshots are kept by default
+	defaultVersions = 10
+	// versionTimeFormat names snapshot files so they sort by time
+	versionTimeFormat = "20060102-150405"
+)
+
+// Version is a snapshot of a config file that was valid when taken
+type Version struct {
+	Path string
+	Time time.Time
+}
+
+// VersionsDir returns the directory of config snapshots for a data directory
+func VersionsDir(dataDir string) string {
+	return filepath.Join(dataDir, versionsDir)
+}
+
+// Snapshot saves the config file at path, which cfg was loaded and
+// validated from, as a new version unless it matches the latest one. Only
+// the newest config_versions snapshots are kept. Nothing is saved in
+// read-only mode.
+func Snapshot(path string, cfg *Config) error {
+	if cfg.ReadOnly || cfg.DataDir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		// Configured through the environment only
+		return nil
+	}
+	if err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to read config file: %w", err))
+	}
+
+	dir := VersionsDir(cfg.DataDir)
+	versions, err := Versions(cfg.DataDir)
+	if err != nil {
+		return err
+	}
+	if len(versions) > 0 {
+		latest, err := os.ReadFile(versions[0].Path)
+		if err == nil && bytes.Equal(latest, data) {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to create config history: %w", err))
+	}
+	name := time.Now().Format(versionTimeFormat) + ".yaml"
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to save config version: %w", err))
+	}
+
+	// Prune the oldest versions, counting the one just written
+	keep := cfg.ConfigVersions
+	if keep == 0 {
+		keep = defaultVersions
+	}
+	for i := keep - 1; i < len(versions); i++ {
+		if versions[i].Path == filepath.Join(dir, name) {
+			continue
+		}
+		if err := os.Remove(versions[i].Path); err != nil {
+			return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to prune config version: %w", err))
+		}
+	}
+
+	return nil
+}
+
+// Versions lists the config snapshots in a data directory, newest first
+func Versions(dataDir string) ([]Version, error) {
+	dir := VersionsDir(dataDir)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to read config history: %w", err))
+	}
+
+	var versions []Version
+	for _, entry := range entries {
+		stamp, ok := strings.CutSuffix(entry.Name(), ".yaml")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		t, err := time.ParseInLocation(versionTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, Version{Path: filepath.Join(dir, entry.Name()), Time: t})
+	}
+
+	slices.SortFunc(versions, func(a, b Version) int { return b.Time.Compare(a.Time) })
+	return versions, nil
+}
+
+// Rollback replaces the config file at path with a saved version, checking
+// that the version is still valid, e.g. with the current environment
+func Rollback(path string, version Version) error {
+	data, err := os.ReadFile(version.Path)
+	if err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to read config version: %w", err))
+	}
+	return Replace(path, data, nil)
+}
+
+// PreviousVersion returns the newest snapshot that differs from the config
+// file at path, i.e. the version a rollback returns to
+func PreviousVersion(path, dataDir string) (Version, error) {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return Version{}, apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to read config file: %w", err))
+	}
+
+	versions, err := Versions(dataDir)
+	if err != nil {
+		return Version{}, err
+	}
+	for _, v := range versions {
+		data, err := os.ReadFile(v.Path)
+		if err == nil && !bytes.Equal(data, current) {
+			return v, nil
+		}
+	}
+
+	return Version{}, apperr.Wrap(apperr.KindConfig, fmt.Errorf("no earlier config version in %s", VersionsDir(dataDir)))
+}
@@ -0,0 +1,333 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UnmarshalYAML reads a schedule written out in full, or as a phrase like
+// "weekdays 7am-9:30am every 10m", either alone or as the when of a
+// schedule with other settings such as a name
+func (s *Schedule) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		parsed, err := ParseSchedule(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		*s = parsed
+		return nil
+	}
+
+	type plain Schedule
+	var raw struct {
+		plain `yaml:",inline"`
+		When  string `yaml:"when,omitempty"`
+	}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	*s = Schedule(raw.plain)
+	if raw.When == "" {
+		return nil
+	}
+	if len(s.Days) > 0 || s.StartTime != "" || s.EndTime != "" || s.IntervalMinutes != 0 || s.Interval != "" {
+		return fmt.Errorf("line %d: when cannot be combined with days, start_time, end_time or an interval", node.Line)
+	}
+	parsed, err := ParseSchedule(raw.When)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	if s.Name == "" {
+		s.Name, s.derived = parsed.Name, true
+	}
+	s.Days, s.StartTime, s.EndTime = parsed.Days, parsed.StartTime, parsed.EndTime
+	s.IntervalMinutes, s.Interval = parsed.IntervalMinutes, parsed.Interval
+	return nil
+}
+
+// nameDerived tells apart the schedule names derived from phrases that
+// another schedule of the itinerary has, e.g. a second morning schedule
+// becomes morning-2, as schedules are told apart by name in adaptive plans
+// and output files
+func (itin *Itinerary) nameDerived() {
+	taken := make(map[string]bool)
+	for _, sched := range itin.Schedules {
+		if !sched.derived {
+			taken[sched.Name] = true
+		}
+	}
+	for i, sched := range itin.Schedules {
+		if !sched.derived {
+			continue
+		}
+		name := sched.Name
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s-%d", sched.Name, n)
+		}
+		itin.Schedules[i].Name = name
+		taken[name] = true
+	}
+}
+
+// Day groups of schedule phrases
+var (
+	weekdayNames = []string{"mon", "tue", "wed", "thu", "fri"}
+	weekendNames = []string{"sat", "sun"}
+	everyDay     = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+)
+
+// ParseSchedule reads a schedule phrase: days such as "weekdays",
+// "weekends", "daily", "mon,wed" or "mon-thu", a window such as
+// "7am-9:30am", "from 16:30 to 18:00" or "7-9am", and an interval such as
+// "every 10m", "every 90 seconds" or "every hour", in any order. The
+// schedule is named after the time of day it starts: morning, afternoon or
+// evening.
+func ParseSchedule(phrase string) (Schedule, error) {
+	fields := strings.Fields(strings.NewReplacer(",", " ", " – ", "-", "–", "-", " - ", "-").Replace(strings.ToLower(phrase)))
+
+	var sched Schedule
+	var days []string
+	var times []string
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		switch {
+		case field == "from" || field == "between" || field == "to" || field == "until" || field == "and" || field == "on" || field == "at":
+			// Only join the other words
+		case field == "every" && i+1 < len(fields) && (fields[i+1] == "day" || isDays(fields[i+1])):
+			// "every day" and "every monday" name days rather than an interval
+			if fields[i+1] == "day" {
+				days = append(days, everyDay...)
+				i++
+			}
+		case field == "every":
+			every, used, err := parseEvery(fields[i+1:])
+			if err != nil {
+				return Schedule{}, fmt.Errorf("schedule %q: %w", phrase, err)
+			}
+			if every%time.Minute == 0 {
+				sched.IntervalMinutes = int(every / time.Minute)
+			} else {
+				sched.Interval = every.String()
+			}
+			i += used
+		case field == "weekdays" || field == "weekday":
+			days = append(days, weekdayNames...)
+		case field == "weekends" || field == "weekend":
+			days = append(days, weekendNames...)
+		case field == "daily" || field == "everyday":
+			days = append(days, everyDay...)
+		case isDays(field):
+			names, err := parseDays(field)
+			if err != nil {
+				return Schedule{}, fmt.Errorf("schedule %q: %w", phrase, err)
+			}
+			days = append(days, names...)
+		default:
+			words := []string{field}
+			if start, end, isRange := strings.Cut(field, "-"); isRange {
+				words = []string{start, end}
+			}
+			for _, word := range words {
+				_, _, err := parseClockWord(word, "")
+				switch {
+				case err == nil:
+				case word != "" && word[0] >= '0' && word[0] <= '9':
+					return Schedule{}, fmt.Errorf("schedule %q: %w", phrase, err)
+				default:
+					return Schedule{}, fmt.Errorf("schedule %q: unknown word %q, expected days, a window or an interval", phrase, field)
+				}
+			}
+			times = append(times, words...)
+		}
+	}
+
+	if len(days) == 0 {
+		return Schedule{}, fmt.Errorf("schedule %q: no days, e.g. weekdays or mon,wed", phrase)
+	}
+	if len(times) < 2 {
+		return Schedule{}, fmt.Errorf("schedule %q: expected a window, e.g. 7am-9:30am", phrase)
+	}
+	if len(times) > 2 {
+		return Schedule{}, fmt.Errorf("schedule %q: expected a single window, got %s", phrase, strings.Join(times, ", "))
+	}
+	if sched.IntervalMinutes == 0 && sched.Interval == "" {
+		return Schedule{}, fmt.Errorf("schedule %q: no interval, e.g. every 10m", phrase)
+	}
+	start, end, err := parseWindow(times[0], times[1])
+	if err != nil {
+		return Schedule{}, fmt.Errorf("schedule %q: %w", phrase, err)
+	}
+
+	for _, day := range days {
+		if !slices.Contains(sched.Days, day) {
+			sched.Days = append(sched.Days, day)
+		}
+	}
+	sched.StartTime, sched.EndTime = formatClock(start), formatClock(end)
+	sched.derived = true
+	switch {
+	case start < 12*time.Hour:
+		sched.Name = "morning"
+	case start < 17*time.Hour:
+		sched.Name = "afternoon"
+	default:
+		sched.Name = "evening"
+	}
+	return sched, nil
+}
+
+// parseEvery reads the interval after "every", e.g. "10m", "10 min" or
+// "hour", returning how many words it used. Numbers alone are minutes.
+func parseEvery(words []string) (time.Duration, int, error) {
+	if len(words) == 0 {
+		return 0, 0, fmt.Errorf("every needs an interval, e.g. every 10m")
+	}
+	number, unit := words[0], ""
+	used := 1
+	if i := strings.IndexFunc(number, func(r rune) bool { return r < '0' || r > '9' }); i > 0 {
+		number, unit = number[:i], number[i:]
+	} else if i == 0 {
+		// "every hour" is every 1 hour
+		number, unit = "1", number
+	} else if len(words) > 1 && intervalUnits[words[1]] != 0 {
+		unit = words[1]
+		used = 2
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid interval %q", strings.Join(words[:used], " "))
+	}
+	if unit == "" {
+		return time.Duration(n) * time.Minute, used, nil
+	}
+	if intervalUnits[unit] == 0 {
+		return 0, 0, fmt.Errorf("unknown interval unit %q, e.g. s, m or h", unit)
+	}
+	return time.Duration(n) * intervalUnits[unit], used, nil
+}
+
+// intervalUnits are the units of intervals in schedule phrases
+var intervalUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+}
+
+// isDays reports whether a word names days, e.g. "mon", "fridays" or
+// "mon-thu"
+func isDays(word string) bool {
+	first, _, _ := strings.Cut(word, "-")
+	_, err := dayName(first)
+	return err == nil
+}
+
+// dayName converts a day name, possibly plural, to a weekday
+func dayName(word string) (time.Weekday, error) {
+	if day, err := DayNameToWeekday(word); err == nil {
+		return day, nil
+	}
+	return DayNameToWeekday(strings.TrimSuffix(word, "s"))
+}
+
+// parseDays converts a day or an inclusive range of days to short day
+// names, e.g. "fri-sun" to fri, sat and sun
+func parseDays(word string) ([]string, error) {
+	first, last, isRange := strings.Cut(word, "-")
+	from, err := dayName(first)
+	if err != nil {
+		return nil, err
+	}
+	if !isRange {
+		return []string{everyDay[(from+6)%7]}, nil
+	}
+	to, err := dayName(last)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for day := from; ; day = (day + 1) % 7 {
+		names = append(names, everyDay[(day+6)%7])
+		if day == to {
+			return names, nil
+		}
+	}
+}
+
+// parseWindow reads the start and end of a window, e.g. "7" and "9:30am".
+// A start without am or pm takes the end's when that keeps it before the
+// end, as in 7-9am or 1-3pm.
+func parseWindow(startWord, endWord string) (time.Duration, time.Duration, error) {
+	end, endMeridiem, err := parseClockWord(endWord, "")
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, _, err := parseClockWord(startWord, ""); err != nil {
+		return 0, 0, err
+	}
+	// 11-1pm starts in the morning, and 17:00-9pm is on a 24-hour clock
+	for _, meridiem := range []string{endMeridiem, "am", ""} {
+		if start, _, err := parseClockWord(startWord, meridiem); err == nil && start < end {
+			return start, end, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("window %s-%s must start before it ends, on the same day", startWord, endWord)
+}
+
+// parseClockWord reads a time of day such as "7am", "9:30pm", "17:45",
+// "07:30:15" or "noon", returning the time since midnight and its am or pm.
+// Times without either take meridiem when given.
+func parseClockWord(word, meridiem string) (time.Duration, string, error) {
+	switch word {
+	case "noon":
+		return 12 * time.Hour, "pm", nil
+	case "midnight":
+		return 0, "am", nil
+	}
+
+	own := ""
+	for _, suffix := range []string{"am", "pm", "a.m.", "p.m."} {
+		if rest, ok := strings.CutSuffix(word, suffix); ok {
+			word, own = rest, suffix[:1]+"m"
+			break
+		}
+	}
+	if own != "" {
+		meridiem = own
+	}
+	if !strings.Contains(word, ":") {
+		word += ":00"
+	}
+	clock, err := ParseClock(word)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid time %q", word)
+	}
+
+	if meridiem != "" {
+		if clock < time.Hour || clock >= 13*time.Hour {
+			return 0, "", fmt.Errorf("invalid time %q with %s", word, meridiem)
+		}
+		if clock >= 12*time.Hour {
+			clock -= 12 * time.Hour
+		}
+		if meridiem == "pm" {
+			clock += 12 * time.Hour
+		}
+	}
+	return clock, own, nil
+}
+
+// formatClock formats a time of day as HH:MM, or HH:MM:SS when it has
+// seconds
+func formatClock(d time.Duration) string {
+	clock := fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	if sec := d % time.Minute; sec != 0 {
+		clock += fmt.Sprintf(":%02d", int(sec/time.Second))
+	}
+	return clock
+}
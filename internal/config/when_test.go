@@ -0,0 +1,156 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSchedule(t *testing.T) {
+	weekdays := []string{"mon", "tue", "wed", "thu", "fri"}
+	tests := []struct {
+		phrase   string
+		days     []string
+		start    string
+		end      string
+		minutes  int
+		interval string
+		name     string
+	}{
+		// The examples of the README
+		{"weekdays 7am-9:30am every 10m", weekdays, "07:00", "09:30", 10, "", "morning"},
+		{"mon-thu from 16:30 to 18:00 every 15 minutes", []string{"mon", "tue", "wed", "thu"}, "16:30", "18:00", 15, "", "afternoon"},
+		{"weekends 8am-10am every 30m", []string{"sat", "sun"}, "08:00", "10:00", 30, "", "morning"},
+		{"daily 7-9am every hour", everyDay, "07:00", "09:00", 60, "", "morning"},
+		{"mon,wed,fri noon-2pm every 20 min", []string{"mon", "wed", "fri"}, "12:00", "14:00", 20, "", "afternoon"},
+		{"fridays between 7:30:15am and 8am every 90 seconds", []string{"fri"}, "07:30:15", "08:00", 0, "1m30s", "morning"},
+		// In any order, with other spellings
+		{"every 5 mins 6:45-8:15 on thurs", []string{"thu"}, "06:45", "08:15", 5, "", "morning"},
+		{"7am – 9am weekdays every 10", weekdays, "07:00", "09:00", 10, "", "morning"},
+		{"every day from 17:00 until 19:00 every 30s", everyDay, "17:00", "19:00", 0, "30s", "evening"},
+		{"every monday 8-9am every 10m", []string{"mon"}, "08:00", "09:00", 10, "", "morning"},
+		{"fri-sun 10am-noon every 2h", []string{"fri", "sat", "sun"}, "10:00", "12:00", 120, "", "morning"},
+		{"weekdays weekends 7-8am every 10m", everyDay, "07:00", "08:00", 10, "", "morning"},
+		// Starts without am or pm
+		{"weekdays 1-3pm every 10m", weekdays, "13:00", "15:00", 10, "", "afternoon"},
+		{"weekdays 11-1pm every 10m", weekdays, "11:00", "13:00", 10, "", "morning"},
+		{"weekdays 17:00-9pm every 10m", weekdays, "17:00", "21:00", 10, "", "evening"},
+		{"weekdays 9-11 every 10m", weekdays, "09:00", "11:00", 10, "", "morning"},
+		{"weekdays midnight-1am every 10m", weekdays, "00:00", "01:00", 10, "", "morning"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.phrase, func(t *testing.T) {
+			sched, err := ParseSchedule(tt.phrase)
+			if err != nil {
+				t.Fatalf("ParseSchedule() error = %v", err)
+			}
+			if !slices.Equal(sched.Days, tt.days) {
+				t.Errorf("days = %v, want %v", sched.Days, tt.days)
+			}
+			if sched.StartTime != tt.start || sched.EndTime != tt.end {
+				t.Errorf("window = %s-%s, want %s-%s", sched.StartTime, sched.EndTime, tt.start, tt.end)
+			}
+			if sched.IntervalMinutes != tt.minutes || sched.Interval != tt.interval {
+				t.Errorf("interval = %d minutes, %q, want %d minutes, %q", sched.IntervalMinutes, sched.Interval, tt.minutes, tt.interval)
+			}
+			if sched.Name != tt.name {
+				t.Errorf("name = %q, want %q", sched.Name, tt.name)
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := []struct {
+		phrase string
+		want   string
+	}{
+		{"7am-9am every 10m", "no days"},
+		{"weekdays every 10m", "expected a window"},
+		{"weekdays 7am every 10m", "expected a window"},
+		{"weekdays 7am-9am", "no interval"},
+		{"weekdays 7am-9am every", "every needs an interval"},
+		{"weekdays 7am-9am every 10 fortnights", "unknown word \"fortnights\""},
+		{"weekdays 7am-9am every 10y", "unknown interval unit"},
+		{"weekdays 7am-9am every 0m", "invalid interval"},
+		{"weekdays 7am-9am every 10m please", "unknown word \"please\""},
+		{"weekdays mornings every 10m", "unknown word \"mornings\""},
+		{"weekdays 7am-9am 4pm-6pm every 10m", "expected a single window"},
+		{"weekdays 9am-7am every 10m", "must start before it ends"},
+		{"weekdays 10pm-1am every 10m", "must start before it ends"},
+		{"weekdays 25-27 every 10m", "invalid time"},
+		{"weekdays 13pm-2pm every 10m", "invalid time"},
+		{"mon-funday 7-9am every 10m", "invalid day name: funday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.phrase, func(t *testing.T) {
+			_, err := ParseSchedule(tt.phrase)
+			if err == nil {
+				t.Fatalf("ParseSchedule() error = nil, want %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseSchedule() error = %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleYAML(t *testing.T) {
+	cfg, err := parse([]byte(`
+itineraries:
+  - id: work
+    schedules:
+      - "weekdays 7am-9am every 10m"
+      - name: late
+        when: "weekdays 4pm-6pm every 15m"
+      - when: "weekends 8am-10am every 30m"
+        adaptive: {daily_requests: 2}
+      - "weekdays 5pm-7pm every 10m"
+      - name: morning-2
+        days: [sat]
+        start_time: "06:00"
+        end_time: "07:00"
+        interval_minutes: 10
+`))
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+
+	schedules := cfg.Itineraries[0].Schedules
+	var names []string
+	for _, sched := range schedules {
+		names = append(names, sched.Name)
+	}
+	// Derived names that collide get a suffix, skipping the names taken
+	want := []string{"morning", "late", "morning-3", "evening", "morning-2"}
+	if !slices.Equal(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+	if got := schedules[2]; got.StartTime != "08:00" || got.IntervalMinutes != 30 || got.Adaptive == nil || got.Adaptive.DailyRequests != 2 {
+		t.Errorf("schedule with when = %+v, want its phrase and adaptive settings", got)
+	}
+}
+
+func TestScheduleYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"invalid phrase", `["weekdays 7am-9am"]`, "line 4: schedule \"weekdays 7am-9am\": no interval"},
+		{"when with times", "- when: weekdays 7am-9am every 10m\n  start_time: \"07:00\"", "when cannot be combined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parse([]byte("itineraries:\n  - id: work\n    schedules:\n" + indent(tt.yaml, "      ")))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parse() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// indent prefixes every line of s
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
@@ -0,0 +1,253 @@
+// Package cost estimates the provider requests the schedules of a config
+// make and what they cost
+package cost
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/gaps"
+	"gommutetime/internal/history"
+)
+
+// Prices holds the built-in pricing of each provider, per thousand
+// elements (route lookups) and with the elements free each month. Google
+// bills the traffic-aware Distance Matrix Pro SKU, as of March 2025, and
+// Azure route transactions of the Azure Maps Gen2 pricing tier.
+var Prices = map[string]config.Price{
+	"google":    {PerThousand: 10, FreePerMonth: 5000, Currency: "USD"},
+	"azure":     {PerThousand: 4.5, FreePerMonth: 5000, Currency: "USD"},
+	"waze":      {},
+	"simulated": {},
+}
+
+// Itinerary is the usage estimated for an itinerary
+type Itinerary struct {
+	ID   string
+	Name string
+	// Fetches is how many times its schedules run
+	Fetches int
+	// Elements is how many route lookups those fetches bill: one per
+	// origin/destination pair
+	Elements int
+}
+
+// Estimate is the usage and cost of a config over a number of days
+type Estimate struct {
+	Provider    string
+	Price       config.Price
+	Days        int
+	Itineraries []Itinerary
+	Elements    int
+	// Billed is the elements beyond the free ones, scaled to the period
+	Billed int
+	Cost   float64
+}
+
+// Provider returns the provider the config fetches from
+func Provider(cfg *config.Config) string {
+	if cfg.Simulate {
+		return "simulated"
+	}
+	return cfg.API.ProviderName()
+}
+
+// Providers returns the providers the config fetches from: the default one
+// and those itineraries compare it with
+func Providers(cfg *config.Config) []string {
+	providers := []string{Provider(cfg)}
+	if cfg.Simulate {
+		return providers
+	}
+	for _, itin := range cfg.Itineraries {
+		for _, name := range itin.Providers {
+			if !slices.Contains(providers, name) {
+				providers = append(providers, name)
+			}
+		}
+	}
+	return providers
+}
+
+// Price returns the pricing of a provider, overridden by the config
+func Price(cfg *config.Config, provider string) config.Price {
+	price := Prices[provider]
+	if override, ok := cfg.Pricing[provider]; ok {
+		price = override
+		if price.Currency == "" {
+			price.Currency = Prices[provider].Currency
+		}
+	}
+	return price
+}
+
+// Estimated counts the fetches scheduled from the start of the day of from
+// over days and prices them, pro rating the free elements of a month
+func Estimated(cfg *config.Config, from time.Time, days int) Estimate {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, days)
+
+	provider := Provider(cfg)
+	estimate := Estimate{Provider: provider, Price: Price(cfg, provider), Days: days}
+	for _, itin := range cfg.Itineraries {
+		fetches := len(gaps.Expected(itin, start, end)) + gaps.Adaptive(itin, start, end)
+		perFetch := 1
+		if itin.IsMatrix() {
+			perFetch = len(itin.Origins) * len(itin.Destinations)
+		}
+		// One route for each leg
+		if itin.IsParkAndRide() {
+			perFetch = 2
+		}
+		if itin.IsCarpool() {
+			perFetch = len(itin.Stops) + 1
+		}
+		if itin.Direct {
+			perFetch++
+		}
+		// Itineraries comparing providers may leave this one out
+		if len(itin.Providers) > 0 && !cfg.Simulate && !slices.Contains(itin.Providers, provider) {
+			perFetch = 0
+		}
+		estimate.Itineraries = append(estimate.Itineraries, Itinerary{
+			ID:       itin.ID,
+			Name:     itin.Name,
+			Fetches:  fetches,
+			Elements: fetches * perFetch,
+		})
+		estimate.Elements += fetches * perFetch
+	}
+	slices.SortStableFunc(estimate.Itineraries, func(a, b Itinerary) int {
+		return b.Elements - a.Elements
+	})
+
+	free := estimate.Price.FreePerMonth * days / 30
+	estimate.Billed = max(estimate.Elements-free, 0)
+	estimate.Cost = float64(estimate.Billed) * estimate.Price.PerThousand / 1000
+	return estimate
+}
+
+// Usage is what the recorded samples of an itinerary cost
+type Usage struct {
+	// Requests counts the fetches, a matrix fetch being one request
+	Requests int
+	Elements int
+	Cost     float64
+	// Provider is the provider of the latest sample with a cost
+	Provider string
+	// Days breaks the usage down by the local day samples were recorded
+	// on, in order
+	Days []Day
+}
+
+// Day is the usage of a day, e.g. 2026-01-31
+type Day struct {
+	Date     string
+	Requests int
+	Elements int
+	Cost     float64
+}
+
+// add counts a sample, a new request unless it shares the time of the
+// previous one like the rows of a matrix fetch
+func (u *Usage) add(s history.Sample, newRequest bool) {
+	date := s.Timestamp.Format(time.DateOnly)
+	if len(u.Days) == 0 || u.Days[len(u.Days)-1].Date != date {
+		u.Days = append(u.Days, Day{Date: date})
+	}
+	day := &u.Days[len(u.Days)-1]
+	if newRequest {
+		u.Requests++
+		day.Requests++
+	}
+	u.Elements += s.Elements
+	day.Elements += s.Elements
+	u.Cost += s.Cost
+	day.Cost += s.Cost
+	if s.Elements > 0 {
+		u.Provider = s.Provider
+	}
+}
+
+// Merge adds the usage of another itinerary, merging their days
+func (u *Usage) Merge(other Usage) {
+	u.Requests += other.Requests
+	u.Elements += other.Elements
+	u.Cost += other.Cost
+	if u.Provider == "" {
+		u.Provider = other.Provider
+	}
+
+	days := make(map[string]*Day, len(u.Days))
+	for i := range u.Days {
+		days[u.Days[i].Date] = &u.Days[i]
+	}
+	for _, d := range other.Days {
+		if day, ok := days[d.Date]; ok {
+			day.Requests += d.Requests
+			day.Elements += d.Elements
+			day.Cost += d.Cost
+			continue
+		}
+		u.Days = append(u.Days, d)
+	}
+	slices.SortFunc(u.Days, func(a, b Day) int {
+		return strings.Compare(a.Date, b.Date)
+	})
+}
+
+// Recorded adds up the requests, elements and estimated cost recorded with
+// the samples of a CSV output file between from and to (zero for no
+// bound). Samples predating cost attribution count no elements, and rolled
+// up samples count for nothing.
+func Recorded(path string, from, to time.Time) (Usage, error) {
+	var usage Usage
+	var last history.Sample
+	err := history.Scan(path, from, to, func(s history.Sample) error {
+		usage.add(s, !s.Timestamp.Equal(last.Timestamp) || s.Provider != last.Provider)
+		last = s
+		return nil
+	})
+	return usage, err
+}
+
+// Budget is the spending of the current month against the budget of the
+// config
+type Budget struct {
+	Limit     float64
+	Spent     float64
+	Remaining float64
+	Currency  string
+}
+
+// MonthToDate adds up the cost of the itineraries since the start of the
+// month of now, and what remains of the budget. Remaining is zero once
+// the budget is spent, or without a budget.
+func MonthToDate(cfg *config.Config, itineraries []config.Itinerary, now time.Time) (Budget, error) {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	var usage Usage
+	for _, itin := range itineraries {
+		if cfg.DataDir == "" || itin.OutputFile == "" {
+			continue
+		}
+		recorded, err := Recorded(filepath.Join(cfg.DataDir, itin.OutputFile), start, time.Time{})
+		if err != nil {
+			return Budget{}, err
+		}
+		usage.Merge(recorded)
+	}
+
+	provider := usage.Provider
+	if provider == "" {
+		provider = Provider(cfg)
+	}
+	return Budget{
+		Limit:     cfg.Budget,
+		Spent:     usage.Cost,
+		Remaining: max(cfg.Budget-usage.Cost, 0),
+		Currency:  Price(cfg, provider).Currency,
+	}, nil
+}
@@ -0,0 +1,122 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"slices"
+	"time"
+
+	"gommutetime/internal/scheduler"
+)
+
+// Server exposes pprof and internal state on a loopback address
+type Server struct {
+	server *http.Server
+	jobs   func() []scheduler.JobInfo
+}
+
+// state is the response of the /debug/state endpoint
+type state struct {
+	Goroutines int                 `json:"goroutines"`
+	HeapAlloc  uint64              `json:"heap_alloc_bytes"`
+	HeapInuse  uint64              `json:"heap_inuse_bytes"`
+	NumGC      uint32              `json:"num_gc"`
+	Jobs       []scheduler.JobInfo `json:"jobs"`
+	Time       time.Time           `json:"time"`
+}
+
+// New creates a debug server reporting the scheduled jobs returned by jobs.
+// The address must be a loopback address since pprof exposes process internals.
+func New(addr string, jobs func() []scheduler.JobInfo) (*Server, error) {
+	if err := checkLoopback(addr); err != nil {
+		return nil, err
+	}
+
+	s := &Server{jobs: jobs}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/state", s.handleState)
+
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s, nil
+}
+
+// Start serves until ctx is cancelled
+func (s *Server) Start(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Debug server listening on %s", s.server.Addr)
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleState reports runtime and scheduler state as JSON. The jobs can be
+// narrowed down to those of itineraries with a tag, e.g. ?tag=carpool.
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	jobs := s.jobs()
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		jobs = slices.DeleteFunc(jobs, func(job scheduler.JobInfo) bool {
+			return !slices.Contains(job.Tags, tag)
+		})
+	}
+
+	st := state{
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  mem.HeapAlloc,
+		HeapInuse:  mem.HeapInuse,
+		NumGC:      mem.NumGC,
+		Jobs:       jobs,
+		Time:       time.Now(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(st); err != nil {
+		log.Printf("ERROR encoding debug state: %v", err)
+	}
+}
+
+// checkLoopback ensures addr only listens on a loopback interface
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid debug address %s: %w", addr, err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("debug address %s must be a loopback address (e.g. 127.0.0.1:6060)", addr)
+}
@@ -0,0 +1,246 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gommutetime/internal/clock"
+	"gommutetime/internal/config"
+	"gommutetime/internal/fetcher"
+)
+
+// Status is the outcome of a single check
+type Status string
+
+const (
+	Pass Status = "PASS"
+	Warn Status = "WARN"
+	Fail Status = "FAIL"
+	Skip Status = "SKIP"
+)
+
+// Result is the outcome of a check with a human readable detail
+type Result struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// Run performs all diagnostic checks for the config at configPath
+func Run(ctx context.Context, configPath string) []Result {
+	var results []Result
+
+	cfg, result := checkConfig(configPath)
+	results = append(results, result)
+
+	if cfg == nil {
+		results = append(results,
+			Result{"API key", Skip, "config not loaded"},
+			Result{"Data directory", Skip, "config not loaded"},
+		)
+	} else {
+		results = append(results, checkAPIKey(ctx, cfg))
+		if cfg.ReadOnly {
+			results = append(results, Result{"Data directory", Skip, "read-only mode"})
+		} else {
+			results = append(results, checkDataDir(cfg.DataDir))
+		}
+	}
+
+	// Reach the reference server through the configured proxy, if any
+	client := http.DefaultClient
+	if cfg != nil {
+		if c, err := fetcher.NewHTTPClient(cfg.API); err == nil {
+			client = c
+		}
+	}
+
+	maxSkew := config.ClockConfig{}.MaxSkew()
+	if cfg != nil {
+		maxSkew = cfg.Clock.MaxSkew()
+	}
+	results = append(results, checkClock(ctx, client, maxSkew), checkNTP(), checkTimezone())
+
+	if cfg != nil {
+		for _, ch := range cfg.Notifications.Channels {
+			results = append(results, checkChannel(ctx, ch))
+		}
+	}
+
+	return results
+}
+
+// Print writes results as a checklist and reports whether all checks passed
+func Print(w io.Writer, results []Result) bool {
+	ok := true
+	for _, r := range results {
+		fmt.Fprintf(w, "[%s] %s: %s\n", r.Status, r.Name, r.Detail)
+		if r.Status == Fail {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// checkConfig loads and validates the config file
+func checkConfig(path string) (*config.Config, Result) {
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		return nil, Result{"Config", Fail, err.Error()}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, Result{"Config", Fail, err.Error()}
+	}
+
+	if warnings := cfg.Warnings(); len(warnings) > 0 {
+		return cfg, Result{"Config", Warn, strings.Join(warnings, "; ")}
+	}
+
+	return cfg, Result{"Config", Pass, fmt.Sprintf("%s is valid (%d itineraries)", path, len(cfg.Itineraries))}
+}
+
+// checkAPIKey makes a cheap request to verify the API key
+func checkAPIKey(ctx context.Context, cfg *config.Config) Result {
+	if !cfg.API.NeedsKey() {
+		return Result{"API key", Skip, cfg.API.ProviderName() + " needs no API key"}
+	}
+	if cfg.API.ProviderKey() == "" {
+		return Result{"API key", Fail, "no API key configured"}
+	}
+	if len(cfg.Itineraries) == 0 {
+		return Result{"API key", Skip, "no itinerary to probe with"}
+	}
+
+	fetch, err := fetcher.New(cfg.API, "")
+	if err != nil {
+		return Result{"API key", Fail, err.Error()}
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	if err := fetch.Probe(probeCtx, cfg.Itineraries[0].FirstOrigin()); err != nil {
+		return Result{"API key", Fail, err.Error()}
+	}
+
+	return Result{"API key", Pass, "Distance Matrix API accepted the key"}
+}
+
+// checkDataDir verifies the data directory exists and is writable
+func checkDataDir(dir string) Result {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Result{"Data directory", Fail, err.Error()}
+	}
+
+	file, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return Result{"Data directory", Fail, fmt.Sprintf("%s is not writable: %v", dir, err)}
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	abs, _ := filepath.Abs(dir)
+	return Result{"Data directory", Pass, fmt.Sprintf("%s is writable", abs)}
+}
+
+// checkClock compares the local clock against the Date header of a well-known server
+func checkClock(ctx context.Context, client *http.Client, maxSkew time.Duration) Result {
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	measured, err := fetcher.MeasureSkew(reqCtx, client, fetcher.ClockReference)
+	if err != nil {
+		return Result{"Clock", Warn, fmt.Sprintf("could not check against reference server: %v", err)}
+	}
+
+	skew := measured.Offset.Round(time.Second)
+	if skew > maxSkew || skew < -maxSkew {
+		return Result{"Clock", Fail, fmt.Sprintf("local clock is off by %s", skew)}
+	}
+
+	return Result{"Clock", Pass, fmt.Sprintf("within %s of reference (%s)", maxSkew, skew)}
+}
+
+// checkNTP asks the kernel whether the clock is synchronized by NTP
+func checkNTP() Result {
+	synced, known := clock.Synchronized()
+	switch {
+	case !known:
+		return Result{"NTP", Skip, "synchronization status is only known on Linux"}
+	case !synced:
+		return Result{"NTP", Warn, "the clock is not synchronized; install or check the NTP daemon (e.g. systemd-timesyncd or chrony)"}
+	}
+	return Result{"NTP", Pass, "the clock is synchronized"}
+}
+
+// checkTimezone verifies the local timezone and the timezone database
+func checkTimezone() Result {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		return Result{"Timezone", Fail, fmt.Sprintf("timezone database unavailable: %v", err)}
+	}
+
+	now := time.Now()
+	if zone, offset := now.Zone(); zone == "UTC" && offset == 0 {
+		return Result{"Timezone", Warn, "local timezone is UTC; schedules run in UTC (mount /etc/localtime or set TZ)"}
+	}
+
+	return Result{"Timezone", Pass, fmt.Sprintf("%s (%s, UTC%s)", time.Local, now.Format("MST"), now.Format("-07:00"))}
+}
+
+// checkChannel verifies a notification channel is reachable without sending a message
+func checkChannel(ctx context.Context, ch config.Channel) Result {
+	name := fmt.Sprintf("Channel %s", ch.Name)
+
+	switch ch.Type {
+	case "apprise":
+		command := ch.Command
+		if command == "" {
+			command = "apprise"
+		}
+		path, err := exec.LookPath(command)
+		if err != nil {
+			return Result{name, Fail, fmt.Sprintf("%s not found: %v", command, err)}
+		}
+		return Result{name, Pass, fmt.Sprintf("found %s", path)}
+	case "matrix":
+		return checkReachable(ctx, name, ch.Homeserver)
+	default:
+		return checkReachable(ctx, name, ch.URL)
+	}
+}
+
+// checkReachable opens a TCP connection to the host of rawURL
+func checkReachable(ctx context.Context, name, rawURL string) Result {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return Result{name, Fail, fmt.Sprintf("invalid url %q", rawURL)}
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return Result{name, Fail, fmt.Sprintf("cannot connect to %s: %v", addr, err)}
+	}
+	conn.Close()
+
+	return Result{name, Pass, fmt.Sprintf("%s is reachable", addr)}
+}
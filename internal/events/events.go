@@ -0,0 +1,158 @@
+// Package events is the internal event bus of the daemon. The scheduler,
+// the notifier and the config watcher publish what happens, and output
+// writers, notifiers and integrations subscribe to the kinds of events they
+// handle instead of being called by each publisher:
+//
+//	bus := events.New()
+//	bus.Subscribe(exporter.Record, events.SampleRecorded)
+//
+// Handlers run in the publisher's goroutine, in the order they subscribed,
+// so they must hand slow work off to their own goroutines.
+package events
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/history"
+)
+
+// Kinds of events
+const (
+	// SampleRecorded: Itinerary recorded Sample, from one of the providers
+	// it compares or for one pair of a matrix itinerary
+	SampleRecorded = "sample.recorded"
+	// JobSucceeded: a scheduled or manual fetch of Itinerary succeeded,
+	// including matrix fetches where only some pairs failed
+	JobSucceeded = "job.succeeded"
+	// JobFailed: a fetch of Itinerary failed with Err, Failures in a row
+	JobFailed = "job.failed"
+	// AlertFired: Alert about Itinerary was sent to its channels
+	AlertFired = "alert.fired"
+	// ConfigReloaded: Config replaced the running config
+	ConfigReloaded = "config.reloaded"
+)
+
+// Event is something that happened in the daemon. The fields set depend on
+// its kind.
+type Event struct {
+	Kind string
+	Time time.Time
+
+	Itinerary config.Itinerary
+	Sample    history.Sample
+	// Sequence numbers the samples of Itinerary in the order they were
+	// published, from 1, when the bus has a sequencer. Key identifies
+	// Sample, the same whenever it is published again, for consumers to
+	// drop duplicates.
+	Sequence uint64
+	Key      string
+	Alert    Alert
+	Err      error
+	Failures int
+	Config   *config.Config
+}
+
+// Alert is a fired alert
+type Alert struct {
+	// Rule is the alert rule that fired, empty for alerts no rule raised,
+	// e.g. missing samples
+	Rule     string
+	Severity string
+	Title    string
+	Body     string
+	Duration float64
+	Channels []string
+}
+
+// Handler handles events
+type Handler func(ctx context.Context, e Event)
+
+// Bus dispatches published events to the handlers subscribed to their kind.
+// A nil bus drops every event.
+type Bus struct {
+	mu        sync.RWMutex
+	handlers  []subscription
+	sequencer Sequencer
+}
+
+// Sequencer numbers the samples of each itinerary
+type Sequencer interface {
+	// Next returns the sequence number of the next sample of an itinerary
+	Next(itinerary string) uint64
+}
+
+// subscription is a handler and the kinds it handles, all of them when
+// empty
+type subscription struct {
+	handler Handler
+	kinds   []string
+}
+
+// New creates an event bus without subscribers
+func New() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls h with the events of kinds, or of every kind when none
+// are given
+func (b *Bus) Subscribe(h Handler, kinds ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, subscription{handler: h, kinds: kinds})
+}
+
+// NumberWith numbers the samples published from now on with s
+func (b *Bus) NumberWith(s Sequencer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sequencer = s
+}
+
+// Publish calls the handlers subscribed to the kind of an event, timing it
+// now unless set. Samples get their key and sequence number first.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers
+	sequencer := b.sequencer
+	b.mu.RUnlock()
+	if e.Kind == SampleRecorded {
+		e.Key = SampleKey(e.Itinerary.ID, e.Sample)
+		if sequencer != nil {
+			e.Sequence = sequencer.Next(e.Itinerary.ID)
+		}
+	}
+	for _, sub := range handlers {
+		if len(sub.kinds) == 0 || slices.Contains(sub.kinds, e.Kind) {
+			sub.handler(ctx, e)
+		}
+	}
+}
+
+// sampleSpace is the namespace of the UUIDs of samples
+var sampleSpace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("urn:gommutetime:sample"))
+
+// SampleKey returns the idempotency key of a sample of an itinerary, a
+// UUID derived from the itinerary, provider, matrix pair and time of the
+// sample
+func SampleKey(itinerary string, s history.Sample) string {
+	name := itinerary + "\x00" + s.Provider + "\x00" + s.Timestamp.UTC().Format(time.RFC3339Nano)
+	// Samples of other itineraries keep the keys they had before pairs
+	// were published
+	if s.Origin != "" || s.Destination != "" {
+		name += "\x00" + s.Origin + "\x00" + s.Destination
+	}
+	return uuid.NewSHA1(sampleSpace, []byte(name)).String()
+}
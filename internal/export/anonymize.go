@@ -0,0 +1,43 @@
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"gommutetime/internal/history"
+)
+
+// Anonymize replaces the itinerary IDs and names, schedule names and tags,
+// which often name places, with pseudonyms derived from key. Times,
+// durations and providers are kept. The same key gives the same pseudonyms,
+// so that datasets exported at different times can be joined.
+func Anonymize(itineraries []Itinerary, key []byte) []Itinerary {
+	pseudonym := func(kind, name string) string {
+		if name == "" {
+			return ""
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(kind + "\x00" + name))
+		return kind + "-" + hex.EncodeToString(mac.Sum(nil)[:4])
+	}
+
+	anonymized := make([]Itinerary, 0, len(itineraries))
+	for _, itin := range itineraries {
+		id := pseudonym("itinerary", itin.ID)
+		samples := make([]history.Sample, len(itin.Samples))
+		for i, s := range itin.Samples {
+			s.Schedule = pseudonym("schedule", s.Schedule)
+			if len(s.Tags) > 0 {
+				tags := make([]string, len(s.Tags))
+				for j, tag := range s.Tags {
+					tags[j] = pseudonym("tag", tag)
+				}
+				s.Tags = tags
+			}
+			samples[i] = s
+		}
+		anonymized = append(anonymized, Itinerary{ID: id, Name: id, Samples: samples})
+	}
+	return anonymized
+}
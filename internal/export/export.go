@@ -0,0 +1,266 @@
+// Package export writes the stored samples of several itineraries to a
+// single file for use in other tools
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/history"
+	"gommutetime/internal/xlsx"
+)
+
+// Export formats
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Formats lists the supported formats
+var Formats = []string{FormatCSV, FormatXLSX}
+
+// Itinerary holds the samples of an itinerary to export
+type Itinerary struct {
+	ID      string
+	Name    string
+	Samples []history.Sample
+}
+
+// label returns the display name of an itinerary
+func (i Itinerary) label() string {
+	if i.Name != "" {
+		return i.Name
+	}
+	return i.ID
+}
+
+// Write writes the itineraries in a format
+func Write(w io.Writer, format string, itineraries []Itinerary) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, itineraries)
+	case FormatXLSX:
+		return writeXLSX(w, itineraries)
+	}
+	return apperr.Wrap(apperr.KindConfig, fmt.Errorf("unknown format %s (expected one of %s)", format, strings.Join(Formats, ", ")))
+}
+
+// writeCSV writes a CSV file with a header and the itinerary ID on each row
+func writeCSV(w io.Writer, itineraries []Itinerary) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"itinerary", "timestamp", "duration_minutes", "provider", "schedule", "tags", "elements", "cost", "legs", "direct",
+		"origin", "destination"})
+	for _, itin := range itineraries {
+		for _, s := range itin.Samples {
+			out.Write([]string{
+				itin.ID,
+				s.Timestamp.Format(time.RFC3339),
+				strconv.FormatFloat(s.Duration, 'f', -1, 64),
+				s.Provider,
+				s.Schedule,
+				strings.Join(s.Tags, ";"),
+				strconv.Itoa(s.Elements),
+				strconv.FormatFloat(s.Cost, 'f', -1, 64),
+				formatLegs(s.Legs),
+				formatDirect(s.Direct),
+				s.Origin,
+				s.Destination,
+			})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// formatLegs joins the leg durations of a sample with semicolons
+func formatLegs(legs []float64) string {
+	parts := make([]string, len(legs))
+	for i, leg := range legs {
+		parts[i] = strconv.FormatFloat(leg, 'f', -1, 64)
+	}
+	return strings.Join(parts, ";")
+}
+
+// formatDirect formats the direct trip of a sample, empty when it has none
+func formatDirect(direct float64) string {
+	if direct == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(direct, 'f', -1, 64)
+}
+
+// pairs splits matrix itineraries into one per origin/destination pair,
+// labeled "Name (origin to destination)", in the order they first appear
+func pairs(itineraries []Itinerary) []Itinerary {
+	var split []Itinerary
+	for _, itin := range itineraries {
+		type pair struct{ origin, destination string }
+		var order []pair
+		samples := make(map[pair][]history.Sample)
+		for _, s := range itin.Samples {
+			p := pair{s.Origin, s.Destination}
+			if _, ok := samples[p]; !ok {
+				order = append(order, p)
+			}
+			samples[p] = append(samples[p], s)
+		}
+		// Other itineraries have a single pair, without places
+		if len(order) == 0 || len(order) == 1 && order[0] == (pair{}) {
+			split = append(split, itin)
+			continue
+		}
+		for _, p := range order {
+			split = append(split, Itinerary{
+				ID:      itin.ID,
+				Name:    fmt.Sprintf("%s (%s to %s)", itin.label(), p.origin, p.destination),
+				Samples: samples[p],
+			})
+		}
+	}
+	return split
+}
+
+// writeXLSX writes a workbook with a summary sheet charting the average
+// commute by weekday and hour, per origin/destination pair of matrix
+// itineraries, followed by a sheet of samples per itinerary
+func writeXLSX(w io.Writer, itineraries []Itinerary) error {
+	book := xlsx.New()
+	summary := book.AddSheet("Summary")
+	summary.SetWidth(1, 14)
+	summary.SetWidth(2, 24)
+	for col := 3; col <= 7; col++ {
+		summary.SetWidth(col, 14)
+	}
+
+	// Overall statistics of each itinerary
+	summary.AddRow(xlsx.Header("Itinerary"), xlsx.Header("Name"), xlsx.Header("Samples"), xlsx.Header("Average (min)"),
+		xlsx.Header("Min (min)"), xlsx.Header("Max (min)"), xlsx.Header("Std dev (min)"))
+	summarized := pairs(itineraries)
+	for _, itin := range summarized {
+		stats := history.Compute(itin.Samples)
+		if stats.Count == 0 {
+			summary.AddRow(itin.ID, itin.label(), 0)
+			continue
+		}
+		summary.AddRow(itin.ID, itin.label(), stats.Count, stats.Mean, stats.Min, stats.Max, stats.StdDev)
+	}
+
+	// Average by weekday, Monday first, and by hour of the day
+	weekdays := make([]string, 7)
+	for i := range weekdays {
+		weekdays[i] = time.Weekday((i + 1) % 7).String()[:3]
+	}
+	weekday := func(s history.Sample) string { return weekdays[(s.Timestamp.Weekday()+6)%7] }
+	hour := func(s history.Sample) string { return fmt.Sprintf("%02d:00", s.Timestamp.Hour()) }
+
+	var hours []string
+	for _, itin := range summarized {
+		for _, s := range itin.Samples {
+			if h := hour(s); !slices.Contains(hours, h) {
+				hours = append(hours, h)
+			}
+		}
+	}
+	slices.Sort(hours)
+
+	if len(summarized) > 0 {
+		summary.AddRow()
+		byWeekday := averageTable(summary, "Weekday", weekdays, weekday, summarized)
+		summary.AddRow()
+		byHour := averageTable(summary, "Hour", hours, hour, summarized)
+
+		summary.AddChart(xlsx.Chart{
+			Kind: xlsx.Column, Title: "Average commute by weekday", AxisTitle: "Minutes",
+			Categories: byWeekday.Categories, Series: byWeekday.Series,
+			Col: 8, Row: 0, Cols: 9, Rows: 16,
+		})
+		if len(hours) > 0 {
+			summary.AddChart(xlsx.Chart{
+				Kind: xlsx.Line, Title: "Average commute by hour", AxisTitle: "Minutes",
+				Categories: byHour.Categories, Series: byHour.Series,
+				Col: 8, Row: 17, Cols: 9, Rows: 16,
+			})
+		}
+	}
+
+	// Samples of each itinerary
+	for _, itin := range itineraries {
+		sheet := book.AddSheet(itin.ID)
+		if len(itin.Samples) >= xlsx.MaxRows {
+			return apperr.Wrap(apperr.KindConfig, fmt.Errorf("%s has %d samples, more than an Excel sheet holds; narrow the dates", itin.ID, len(itin.Samples)))
+		}
+		sheet.FreezeHeader()
+		sheet.SetWidth(1, 18)
+		sheet.SetWidth(2, 10)
+		sheet.SetWidth(3, 16)
+		sheet.SetWidth(4, 12)
+		sheet.SetWidth(5, 20)
+		sheet.SetWidth(6, 16)
+		sheet.SetWidth(7, 16)
+		sheet.AddRow(xlsx.Header("Time"), xlsx.Header("Minutes"), xlsx.Header("Schedule"), xlsx.Header("Provider"), xlsx.Header("Tags"),
+			xlsx.Header("Origin"), xlsx.Header("Destination"))
+		for _, s := range itin.Samples {
+			sheet.AddRow(s.Timestamp, s.Duration, s.Schedule, s.Provider, strings.Join(s.Tags, ";"), s.Origin, s.Destination)
+		}
+	}
+
+	return book.Write(w)
+}
+
+// chartData references the cells of a table for a chart
+type chartData struct {
+	Categories xlsx.Range
+	Series     []xlsx.Series
+}
+
+// averageTable adds a table of the average commute of each itinerary (in
+// columns) per key (in rows), leaving cells without samples empty
+func averageTable(sheet *xlsx.Sheet, title string, keys []string, key func(history.Sample) string, itineraries []Itinerary) chartData {
+	header := []any{xlsx.Header(title)}
+	for _, itin := range itineraries {
+		header = append(header, xlsx.Header(itin.label()))
+	}
+	headerRow := sheet.AddRow(header...)
+
+	averages := make([]map[string]float64, len(itineraries))
+	for i, itin := range itineraries {
+		groups := make(map[string][]history.Sample)
+		for _, s := range itin.Samples {
+			groups[key(s)] = append(groups[key(s)], s)
+		}
+		averages[i] = make(map[string]float64, len(groups))
+		for k, samples := range groups {
+			averages[i][k] = history.Compute(samples).Mean
+		}
+	}
+
+	for _, k := range keys {
+		row := []any{k}
+		for i := range itineraries {
+			if mean, ok := averages[i][k]; ok {
+				row = append(row, mean)
+			} else {
+				row = append(row, nil)
+			}
+		}
+		sheet.AddRow(row...)
+	}
+
+	name := sheet.Name()
+	first, last := headerRow+1, headerRow+max(len(keys), 1)
+	data := chartData{Categories: xlsx.Range{Sheet: name, FromCol: 1, FromRow: first, ToCol: 1, ToRow: last}}
+	for i := range itineraries {
+		col := i + 2
+		data.Series = append(data.Series, xlsx.Series{
+			Name:   xlsx.Cell(name, col, headerRow),
+			Values: xlsx.Range{Sheet: name, FromCol: col, FromRow: first, ToCol: col, ToRow: last},
+		})
+	}
+	return data
+}
@@ -0,0 +1,189 @@
+// Package feed keeps the latest alerts and daily summaries of the daemon in
+// a JSON file of the data directory, for the HTTP API to publish as RSS and
+// Atom feeds. Feed readers then notify people without any setup on the
+// daemon's side.
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/events"
+	"gommutetime/internal/history"
+)
+
+// File is the name of the feed file in the data directory
+const File = "feed.json"
+
+// Kinds of entries
+const (
+	KindAlert   = "alert"
+	KindSummary = "summary"
+)
+
+// Entry is an item of the feed
+type Entry struct {
+	// ID is unique and never reused, for readers to tell new entries
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Itinerary string    `json:"itinerary"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Path returns the path of the feed file of a data directory
+func Path(dataDir string) string {
+	return filepath.Join(dataDir, File)
+}
+
+// Load reads the entries in path, newest first. A missing file has none.
+func Load(path string) ([]Entry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to read feed: %w", err))
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("invalid feed file %s: %w", path, err))
+	}
+	return entries, nil
+}
+
+// Recorder adds the alerts of the daemon and the daily summaries of its
+// itineraries to the feed
+type Recorder struct {
+	mu  sync.Mutex
+	cfg *config.Config
+}
+
+// New creates a recorder for the feed of cfg
+func New(cfg *config.Config) *Recorder {
+	return &Recorder{cfg: cfg}
+}
+
+// Reload switches to a new config
+func (r *Recorder) Reload(cfg *config.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cfg = cfg
+}
+
+// Record adds a fired alert to the feed
+func (r *Recorder) Record(_ context.Context, ev events.Event) {
+	r.add(Entry{
+		Kind:      KindAlert,
+		Itinerary: ev.Itinerary.ID,
+		Title:     ev.Alert.Title,
+		Body:      ev.Alert.Body,
+		Time:      ev.Time,
+	})
+}
+
+// Run adds the previous day's summary of every itinerary to the feed
+// shortly after each midnight, until ctx is cancelled
+func (r *Recorder) Run(ctx context.Context) {
+	for {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		next := today.AddDate(0, 0, 1).Add(time.Minute)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		end := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, next.Location())
+		r.summarize(end.AddDate(0, 0, -1), end)
+	}
+}
+
+// summarize adds a summary of the samples between start and end of every
+// single-route itinerary that recorded any
+func (r *Recorder) summarize(start, end time.Time) {
+	r.mu.Lock()
+	cfg := r.cfg
+	r.mu.Unlock()
+	if !cfg.Feed.Enabled() {
+		return
+	}
+
+	for _, itin := range cfg.Itineraries {
+		if itin.IsMatrix() || itin.OutputFile == "" {
+			continue
+		}
+		samples, err := history.LoadRange(filepath.Join(cfg.DataDir, itin.OutputFile), start, end)
+		if err != nil {
+			log.Printf("Warning: failed to summarize %s for the feed: %v", itin.ID, err)
+			continue
+		}
+		stats := history.Compute(history.PrimaryOnly(samples, itin.PrimaryProvider()))
+		if stats.Count == 0 {
+			continue
+		}
+
+		r.add(Entry{
+			Kind:      KindSummary,
+			Itinerary: itin.ID,
+			Title:     fmt.Sprintf("%s on %s: %.0f min on average", itin.Name, start.Format("Monday, January 2"), stats.Mean),
+			Body: fmt.Sprintf("%d samples, %.1f minutes on average, from %.1f to %.1f.",
+				stats.Count, stats.Mean, stats.Min, stats.Max),
+			Time: end,
+		})
+	}
+}
+
+// add puts an entry at the top of the feed file, dropping the oldest ones
+// beyond feed.entries
+func (r *Recorder) add(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.cfg.Feed.Enabled() {
+		return
+	}
+
+	path := Path(r.cfg.DataDir)
+	entries, err := Load(path)
+	if err != nil {
+		log.Printf("Warning: failed to add to the feed: %v", err)
+		return
+	}
+	e.ID = fmt.Sprintf("%s-%s-%d", e.Kind, e.Itinerary, e.Time.UnixNano())
+	entries = append([]Entry{e}, entries...)
+	if len(entries) > r.cfg.Feed.Entries {
+		entries = entries[:r.cfg.Feed.Entries]
+	}
+	if err := write(path, entries); err != nil {
+		log.Printf("Warning: failed to add to the feed: %v", err)
+	}
+}
+
+// write replaces the feed file in path once the new one is complete
+func write(path string, entries []Entry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write feed: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write feed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/geo"
+)
+
+// defaultAzureEndpoint serves the Azure Maps REST APIs
+const defaultAzureEndpoint = "https://atlas.microsoft.com"
+
+// azureMatrixLimit is the most origin/destination pairs of a synchronous
+// Route Matrix request
+const azureMatrixLimit = 100
+
+// azure fetches travel times from the Azure Maps Route API. It routes
+// between coordinates, so addresses are geocoded first, once per address.
+type azure struct {
+	client   *http.Client
+	endpoint string
+	key      string
+
+	mu     sync.Mutex
+	points map[string]geo.Point
+}
+
+// newAzure creates an Azure Maps provider
+func newAzure(api config.APIConfig) (*azure, error) {
+	httpClient, err := NewHTTPClient(api)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := strings.TrimSuffix(api.Azure.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = defaultAzureEndpoint
+	}
+
+	return &azure{
+		client:   httpClient,
+		endpoint: endpoint,
+		key:      api.Azure.Key,
+		points:   make(map[string]geo.Point),
+	}, nil
+}
+
+// Name identifies the provider
+func (a *azure) Name() string {
+	return "azure"
+}
+
+// azureSummary is the summary of a route
+type azureSummary struct {
+	LengthInMeters      float64 `json:"lengthInMeters"`
+	TravelTimeInSeconds float64 `json:"travelTimeInSeconds"`
+}
+
+// Duration returns the travel time in traffic, departing now
+func (a *azure) Duration(ctx context.Context, from, to string) (Result, error) {
+	return a.route(ctx, from, to, "car")
+}
+
+// BicycleDuration returns the travel time by bicycle, on roads and paths
+// that allow them
+func (a *azure) BicycleDuration(ctx context.Context, from, to string) (Result, error) {
+	return a.route(ctx, from, to, "bicycle")
+}
+
+// route returns the travel time between two places in a travel mode,
+// departing now
+func (a *azure) route(ctx context.Context, from, to, travelMode string) (Result, error) {
+	origin, err := a.resolve(ctx, from)
+	if err != nil {
+		return Result{}, err
+	}
+	destination, err := a.resolve(ctx, to)
+	if err != nil {
+		return Result{}, err
+	}
+
+	query := url.Values{
+		"query":      {origin.String() + ":" + destination.String()},
+		"traffic":    {"true"},
+		"departAt":   {"now"},
+		"travelMode": {travelMode},
+		"routeType":  {"fastest"},
+	}
+	var resp struct {
+		Routes []struct {
+			Summary azureSummary `json:"summary"`
+		} `json:"routes"`
+	}
+	status, err := a.call(ctx, http.MethodGet, "/route/directions/json", query, nil, &resp)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", status))
+	if err != nil {
+		return Result{}, azureError("route directions", status, err)
+	}
+	if len(resp.Routes) == 0 {
+		return Result{HTTPStatus: status}, apperr.Wrap(apperr.KindProvider, fmt.Errorf("no route from %s to %s", from, to))
+	}
+
+	return Result{
+		Duration:   resp.Routes[0].Summary.TravelTimeInSeconds / 60,
+		HTTPStatus: status,
+		Status:     "OK",
+		Distance:   resp.Routes[0].Summary.LengthInMeters,
+	}, nil
+}
+
+// Matrix returns travel times in traffic for every origin/destination pair
+// in a single Route Matrix request, departing now, or pair by pair beyond
+// the pairs a request can hold
+func (a *azure) Matrix(ctx context.Context, origins, destinations []string) ([]Element, error) {
+	if len(origins)*len(destinations) > azureMatrixLimit {
+		var elements []Element
+		for _, from := range origins {
+			for _, to := range destinations {
+				result, err := a.Duration(ctx, from, to)
+				elements = append(elements, Element{From: from, To: to, Result: result, Err: err})
+			}
+		}
+		return elements, nil
+	}
+
+	multiPoint := func(places []string) (map[string]any, error) {
+		coords := make([][2]float64, len(places))
+		for i, place := range places {
+			p, err := a.resolve(ctx, place)
+			if err != nil {
+				return nil, err
+			}
+			// GeoJSON orders longitude first
+			coords[i] = [2]float64{p.Lng, p.Lat}
+		}
+		return map[string]any{"type": "MultiPoint", "coordinates": coords}, nil
+	}
+	from, err := multiPoint(origins)
+	if err != nil {
+		return nil, err
+	}
+	to, err := multiPoint(destinations)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"traffic":    {"true"},
+		"departAt":   {"now"},
+		"travelMode": {"car"},
+		"routeType":  {"fastest"},
+	}
+	var resp struct {
+		Matrix [][]struct {
+			StatusCode int `json:"statusCode"`
+			Response   struct {
+				RouteSummary azureSummary `json:"routeSummary"`
+			} `json:"response"`
+		} `json:"matrix"`
+	}
+	body := map[string]any{"origins": from, "destinations": to}
+	status, err := a.call(ctx, http.MethodPost, "/route/matrix/sync/json", query, body, &resp)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", status))
+	if err != nil {
+		return nil, azureError("route matrix", status, err)
+	}
+	if len(resp.Matrix) != len(origins) {
+		return nil, apperr.Wrap(apperr.KindProvider, fmt.Errorf("expected %d rows in response, got %d", len(origins), len(resp.Matrix)))
+	}
+
+	elements := make([]Element, 0, len(origins)*len(destinations))
+	for i, row := range resp.Matrix {
+		if len(row) != len(destinations) {
+			return nil, apperr.Wrap(apperr.KindProvider, fmt.Errorf("expected %d elements in row %d, got %d", len(destinations), i, len(row)))
+		}
+
+		for j, cell := range row {
+			element := Element{
+				From:   origins[i],
+				To:     destinations[j],
+				Result: Result{HTTPStatus: status, Status: http.StatusText(cell.StatusCode)},
+			}
+			if cell.StatusCode == http.StatusOK {
+				element.Result.Status = "OK"
+				element.Result.Duration = cell.Response.RouteSummary.TravelTimeInSeconds / 60
+			} else {
+				element.Err = apperr.Wrap(apperr.KindProvider, fmt.Errorf("route status from %s to %s: %d", origins[i], destinations[j], cell.StatusCode))
+			}
+			elements = append(elements, element)
+		}
+	}
+
+	return elements, nil
+}
+
+// resolve returns the coordinates of a place: as given, decoded from a full
+// Plus Code or geocoded, remembering geocoded addresses
+func (a *azure) resolve(ctx context.Context, place string) (geo.Point, error) {
+	if p, ok := geo.Locate(place); ok {
+		return p, nil
+	}
+	if strings.HasPrefix(place, PlaceIDPrefix) {
+		return geo.Point{}, apperr.Wrap(apperr.KindConfig, fmt.Errorf("Google place IDs cannot be routed with Azure Maps: %s", place))
+	}
+
+	a.mu.Lock()
+	p, ok := a.points[place]
+	a.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	locations, err := a.Geocode(ctx, place)
+	if err != nil {
+		return geo.Point{}, err
+	}
+	if len(locations) == 0 {
+		return geo.Point{}, apperr.Wrap(apperr.KindProvider, fmt.Errorf("address not found: %s", place))
+	}
+
+	a.mu.Lock()
+	a.points[place] = locations[0].Point
+	a.mu.Unlock()
+	return locations[0].Point, nil
+}
+
+// azureSearchResult is a match of the Search API
+type azureSearchResult struct {
+	Type    string `json:"type"`
+	Address struct {
+		FreeformAddress string `json:"freeformAddress"`
+	} `json:"address"`
+	Position struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"position"`
+	POI struct {
+		Name       string   `json:"name"`
+		Categories []string `json:"categories"`
+	} `json:"poi"`
+}
+
+// location converts a search result. Azure result IDs are left out, since
+// places are routed by their coordinates.
+func (r azureSearchResult) location() Location {
+	return Location{
+		Name:      r.POI.Name,
+		Address:   r.Address.FreeformAddress,
+		Point:     geo.Point{Lat: r.Position.Lat, Lng: r.Position.Lon},
+		Precision: r.Type,
+		Types:     r.POI.Categories,
+	}
+}
+
+// search calls a Search API, returning its matches best first
+func (a *azure) search(ctx context.Context, path, query string) ([]Location, error) {
+	var resp struct {
+		Results []azureSearchResult `json:"results"`
+	}
+	status, err := a.call(ctx, http.MethodGet, path, url.Values{"query": {query}, "limit": {"5"}}, nil, &resp)
+	if err != nil {
+		return nil, azureError("search", status, err)
+	}
+
+	locations := make([]Location, len(resp.Results))
+	for i, r := range resp.Results {
+		locations[i] = r.location()
+	}
+	return locations, nil
+}
+
+// Geocode resolves an address with the Search Address API
+func (a *azure) Geocode(ctx context.Context, address string) ([]Location, error) {
+	return a.search(ctx, "/search/address/json", address)
+}
+
+// SearchPlaces finds places matching a free-text query with the fuzzy
+// Search API
+func (a *azure) SearchPlaces(ctx context.Context, query string) ([]Location, error) {
+	return a.search(ctx, "/search/fuzzy/json", query)
+}
+
+// Probe geocodes a place to verify that the key is valid
+func (a *azure) Probe(ctx context.Context, place string) error {
+	_, err := a.Geocode(ctx, place)
+	return err
+}
+
+// call makes a request to the Azure Maps API, decoding the JSON response
+// into out, and returns the HTTP status of the response. The key is sent as
+// a header so that it stays out of URLs in errors and logs.
+func (a *azure) call(ctx context.Context, method, path string, query url.Values, body, out any) (int, error) {
+	query.Set("api-version", "1.0")
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.endpoint+path+"?"+query.Encode(), reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("subscription-key", a.key)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		message := resp.Status
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			message = fmt.Sprintf("%s: %s", resp.Status, apiErr.Error.Message)
+		}
+		return resp.StatusCode, fmt.Errorf("HTTP %s", message)
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("invalid response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// azureError tags an error of an Azure Maps API, recognizing quota
+// rejections by their status
+func azureError(api string, status int, err error) error {
+	err = fmt.Errorf("%s API error: %w", api, err)
+	if status == http.StatusTooManyRequests {
+		return apperr.Wrap(apperr.KindQuota, err)
+	}
+	return apperr.Provider(err)
+}
@@ -0,0 +1,131 @@
+package fetcher
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBatchSize is how many lines are queued before they are written,
+// unless configured otherwise
+const defaultBatchSize = 100
+
+// writeQueue holds lines waiting to be appended to output files, so that
+// each file is opened once per batch rather than once per sample
+type writeQueue struct {
+	mu       sync.Mutex
+	interval time.Duration
+	size     int
+	// pending holds the queued lines of each output file, in order
+	pending map[string][]string
+	queued  int
+	timer   *time.Timer
+	// flushing keeps the batches of a file in order
+	flushing sync.Mutex
+}
+
+// SetBatching queues the lines to write for up to interval, writing them
+// sooner once size lines are queued (defaultBatchSize for zero). A zero
+// interval writes every line right away, after writing any queued ones.
+func (f *Fetcher) SetBatching(interval time.Duration, size int) {
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+
+	f.queue.mu.Lock()
+	f.queue.interval, f.queue.size = interval, size
+	f.queue.mu.Unlock()
+
+	if interval == 0 {
+		f.Flush()
+	}
+}
+
+// Flush writes the queued lines, e.g. on shutdown. Lines that could not be
+// written stay queued for the next attempt.
+func (f *Fetcher) Flush() error {
+	f.queue.flushing.Lock()
+	defer f.queue.flushing.Unlock()
+
+	f.queue.mu.Lock()
+	pending := f.queue.pending
+	f.queue.pending, f.queue.queued = nil, 0
+	if f.queue.timer != nil {
+		f.queue.timer.Stop()
+		f.queue.timer = nil
+	}
+	f.queue.mu.Unlock()
+
+	// Write files in a stable order, so that errors are reproducible
+	files := make([]string, 0, len(pending))
+	for file := range pending {
+		files = append(files, file)
+	}
+	slices.Sort(files)
+
+	var firstErr error
+	for _, file := range files {
+		lines := pending[file]
+		if err := f.write(context.Background(), file, strings.Join(lines, "")); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			f.requeue(file, lines)
+		}
+	}
+	return firstErr
+}
+
+// enqueue queues a line for an output file, reporting false when writes are
+// not batched. The queue is written once full or after the flush interval.
+func (f *Fetcher) enqueue(outputFile, line string) bool {
+	q := &f.queue
+	q.mu.Lock()
+	if q.interval == 0 {
+		q.mu.Unlock()
+		return false
+	}
+
+	if q.pending == nil {
+		q.pending = make(map[string][]string)
+	}
+	q.pending[outputFile] = append(q.pending[outputFile], line)
+	q.queued++
+	full := q.queued >= q.size
+	if !full && q.timer == nil {
+		q.timer = time.AfterFunc(q.interval, f.flushLogged)
+	}
+	q.mu.Unlock()
+
+	if full {
+		f.flushLogged()
+	}
+	return true
+}
+
+// requeue puts back lines that failed to be written, ahead of those queued
+// meanwhile
+func (f *Fetcher) requeue(outputFile string, lines []string) {
+	q := &f.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending == nil {
+		q.pending = make(map[string][]string)
+	}
+	q.pending[outputFile] = append(lines, q.pending[outputFile]...)
+	q.queued += len(lines)
+	if q.timer == nil && q.interval > 0 {
+		q.timer = time.AfterFunc(q.interval, f.flushLogged)
+	}
+}
+
+// flushLogged writes the queued lines, logging failures
+func (f *Fetcher) flushLogged() {
+	if err := f.Flush(); err != nil {
+		log.Printf("ERROR writing queued samples: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package fetcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gommutetime/internal/apperr"
+)
+
+// responseCache keeps the latest provider response of each route, in memory
+// and, with a directory, on disk so that other processes such as the fetch
+// command can read what the daemon fetched
+type responseCache struct {
+	mu      sync.Mutex
+	dir     string
+	ttl     time.Duration
+	entries map[route]cachedResponse
+}
+
+// cachedResponse is a provider response and when it was fetched
+type cachedResponse struct {
+	Fetched time.Time `json:"fetched"`
+	Result  Result    `json:"result"`
+}
+
+// SetCache keeps the provider responses of every lookup for ttl, in memory
+// and in dir unless empty, for Fetch to serve them. Zero turns the cache
+// off. It may be changed while fetching, e.g. on config reload.
+func (f *Fetcher) SetCache(dir string, ttl time.Duration) error {
+	if dir != "" && ttl > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to create cache dir: %w", err))
+		}
+	}
+
+	f.cache.mu.Lock()
+	defer f.cache.mu.Unlock()
+	f.cache.dir, f.cache.ttl = dir, ttl
+	f.cache.entries = nil
+	return nil
+}
+
+// get returns the response of a route fetched less than the ttl ago, from
+// memory or else from disk
+func (c *responseCache) get(r route) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl == 0 {
+		return cachedResponse{}, false
+	}
+
+	entry, ok := c.entries[r]
+	if !ok && c.dir != "" {
+		data, err := os.ReadFile(c.path(r))
+		ok = err == nil && json.Unmarshal(data, &entry) == nil
+	}
+	if !ok || time.Since(entry.Fetched) >= c.ttl {
+		return cachedResponse{}, false
+	}
+	return entry, true
+}
+
+// put records the response of a route. Cache files that cannot be written
+// are logged: the response was fetched all the same.
+func (c *responseCache) put(r route, result Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl == 0 {
+		return
+	}
+
+	entry := cachedResponse{Fetched: time.Now().UTC(), Result: result}
+	if c.entries == nil {
+		c.entries = make(map[route]cachedResponse)
+	}
+	for key, cached := range c.entries {
+		if time.Since(cached.Fetched) >= c.ttl {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[r] = entry
+
+	if c.dir != "" {
+		if err := writeCacheFile(c.path(r), entry); err != nil {
+			log.Printf("Warning: could not cache the response of %s to %s: %v", r.from, r.to, err)
+		}
+	}
+}
+
+// path returns the cache file of a route
+func (c *responseCache) path(r route) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{r.provider, r.from, r.to, r.mode}, "\n")))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// writeCacheFile replaces a cache file atomically, for readers in other
+// processes
+func writeCacheFile(path string, entry cachedResponse) error {
+	data, _ := json.Marshal(entry)
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".cache-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	return err
+}
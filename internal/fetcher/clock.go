@@ -0,0 +1,89 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ClockReference is the server the clock is checked against when no
+// provider responded lately
+const ClockReference = "https://maps.googleapis.com/"
+
+// maxSkewRoundTrip bounds the round trip of the responses the clock is
+// checked with, as the server's time is only known to within it
+const maxSkewRoundTrip = 10 * time.Second
+
+// Skew is how far the local clock is ahead of a server's, from the Date
+// header of one of its responses; negative when it is behind
+type Skew struct {
+	Offset time.Duration
+	Host   string
+	// At is when the response was received
+	At time.Time
+}
+
+// lastSkew is the skew measured with the latest response of any client
+var lastSkew atomic.Pointer[Skew]
+
+// LastSkew returns the skew measured with the latest response with a Date
+// header of the clients of NewHTTPClient, if any
+func LastSkew() (Skew, bool) {
+	if skew := lastSkew.Load(); skew != nil {
+		return *skew, true
+	}
+	return Skew{}, false
+}
+
+// MeasureSkew makes a HEAD request to url to compare the local clock with
+// the Date header of the response
+func MeasureSkew(ctx context.Context, client *http.Client, url string) (Skew, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return Skew{}, err
+	}
+	sent := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return Skew{}, err
+	}
+	resp.Body.Close()
+
+	skew, ok := skewOf(resp, sent, time.Now())
+	if !ok {
+		return Skew{}, errors.New("reference server sent no usable Date header")
+	}
+	return skew, nil
+}
+
+// skewOf compares the Date header of a response with the middle of its
+// round trip. Dates are truncated to the second, so they are taken to be
+// half a second later.
+func skewOf(resp *http.Response, sent, received time.Time) (Skew, bool) {
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil || received.Sub(sent) > maxSkewRoundTrip {
+		return Skew{}, false
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	return Skew{Offset: local.Sub(remote.Add(500 * time.Millisecond)), Host: resp.Request.URL.Host, At: received}, true
+}
+
+// skewTransport keeps the skew measured with every response
+type skewTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t skewTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sent := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if skew, ok := skewOf(resp, sent, time.Now()); ok {
+		lastSkew.Store(&skew)
+	}
+	return resp, nil
+}
@@ -2,107 +2,660 @@ package fetcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
-	"googlemaps.github.io/maps"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/geo"
+	"gommutetime/internal/history"
 )
 
+var (
+	tracer = otel.Tracer("gommutetime/internal/fetcher")
+	meter  = otel.Meter("gommutetime/internal/fetcher")
+
+	apiLatency, _ = meter.Float64Histogram("gommutetime.api.latency",
+		metric.WithDescription("Provider API call latency"),
+		metric.WithUnit("ms"))
+	storageLatency, _ = meter.Float64Histogram("gommutetime.storage.write.latency",
+		metric.WithDescription("Output file write latency"),
+		metric.WithUnit("ms"))
+	apiErrors, _ = meter.Int64Counter("gommutetime.api.errors",
+		metric.WithDescription("Failed provider API calls"))
+	apiShared, _ = meter.Int64Counter("gommutetime.api.shared",
+		metric.WithDescription("Route lookups served from an identical lookup's request"))
+)
+
+// Provider returns current travel times between two places
+type Provider interface {
+	// Name identifies the provider in logs and telemetry
+	Name() string
+	// Duration returns the travel time and response metadata. Latency,
+	// Provider, Elements and Cost are filled in by the Fetcher.
+	Duration(ctx context.Context, from, to string) (Result, error)
+}
+
+// Result is a travel time along with metadata about the provider response
+type Result struct {
+	Duration   float64       // minutes
+	Latency    time.Duration // time spent waiting for the provider
+	HTTPStatus int           // zero when the provider makes no HTTP request
+	Status     string        // provider-specific response status
+	Provider   string
+	Elements   int     // route lookups billed for this result
+	Cost       float64 // estimated from the price set with SetPrice
+	Distance   float64 // route length in meters, zero when not reported
+	// Legs are the durations of the legs of a park-and-ride or carpool
+	// itinerary, in minutes and in order; Duration is their total, with the
+	// time spent at carpool stops
+	Legs []float64
+	// Direct is the duration of a carpool itinerary's trip without its
+	// stops, zero when not fetched
+	Direct float64
+	// Cached is when a result served from the response cache was fetched,
+	// zero for fresh results
+	Cached time.Time
+}
+
+// cyclist is implemented by providers that can route bicycles
+type cyclist interface {
+	// BicycleDuration returns the travel time by bicycle, like Duration
+	BicycleDuration(ctx context.Context, from, to string) (Result, error)
+}
+
+// transitRouter is implemented by providers that can route public transit
+type transitRouter interface {
+	// TransitDuration returns the travel time by transit departing at a
+	// given time, like Duration
+	TransitDuration(ctx context.Context, from, to string, depart time.Time) (Result, error)
+}
+
+// Travel is how an itinerary is travelled
+type Travel struct {
+	Mode   string       // config.ModeDriving when empty
+	Pace   *config.Pace // adjusts bicycling durations, if set
+	Depart time.Time    // departure of transit, now when zero
+}
+
+// prober is implemented by providers that can verify their credentials
+type prober interface {
+	Probe(ctx context.Context, place string) error
+}
+
+// geocoder is implemented by providers that can resolve addresses
+type geocoder interface {
+	Geocode(ctx context.Context, address string) ([]Location, error)
+}
+
+// placeSearcher is implemented by providers that can search for places by
+// name, e.g. "Acme headquarters near Springfield"
+type placeSearcher interface {
+	SearchPlaces(ctx context.Context, query string) ([]Location, error)
+}
+
+// Location is a candidate match for an address or place search
+type Location struct {
+	Name    string // place name, set by place searches
+	Address string // as formatted by the provider
+	PlaceID string
+	Point   geo.Point
+	// Precision is the provider's location type, e.g. ROOFTOP or APPROXIMATE
+	Precision string
+	// PartialMatch is set when only part of the address could be matched
+	PartialMatch bool
+	// Types are the provider's place types, e.g. university or parking
+	Types []string
+}
+
+// matrixProvider is implemented by providers that can fetch every
+// origin/destination pair in a single request
+type matrixProvider interface {
+	Matrix(ctx context.Context, origins, destinations []string) ([]Element, error)
+}
+
+// Element is the outcome for one origin/destination pair of a matrix fetch.
+// Err is set when the provider could not route this pair.
+type Element struct {
+	From   string
+	To     string
+	Result Result
+	Err    error
+}
+
 // Fetcher handles commute time fetching
 type Fetcher struct {
-	client  *maps.Client
-	dataDir string
+	provider Provider
+	dataDir  string
+	quota    *quota
+	queue    writeQueue
+	share    sharing
+	cache    responseCache
+
+	mu sync.RWMutex
+	// others are the providers itineraries can be fetched from besides the
+	// default one, by name
+	others map[string]Provider
+	// prices are the estimated cost of an element by provider name
+	prices map[string]float64
 }
 
-// New creates a new Fetcher instance
-func New(apiKey, dataDir string) (*Fetcher, error) {
-	client, err := maps.NewClient(maps.WithAPIKey(apiKey))
+// New creates a new Fetcher instance using the configured provider, Google
+// Maps, Azure Maps or Waze. An empty dataDir makes the fetcher read-only:
+// results are fetched and returned but never written to disk.
+func New(api config.APIConfig, dataDir string) (*Fetcher, error) {
+	provider, err := NewProvider(api, api.ProviderName())
 	if err != nil {
-		return nil, fmt.Errorf("failed to create maps client: %w", err)
+		return nil, err
 	}
 
+	return NewWithProvider(provider, dataDir)
+}
+
+// NewProvider creates the named provider with the settings of api
+func NewProvider(api config.APIConfig, name string) (Provider, error) {
+	switch name {
+	case config.ProviderAzure:
+		return newAzure(api)
+	case config.ProviderWaze:
+		return newWaze(api)
+	default:
+		return newGoogle(api)
+	}
+}
+
+// NewWithProvider creates a Fetcher backed by provider
+func NewWithProvider(provider Provider, dataDir string) (*Fetcher, error) {
 	// Ensure data directory exists
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create data dir: %w", err)
+	if dataDir != "" {
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to create data dir: %w", err))
+		}
 	}
 
 	return &Fetcher{
-		client:  client,
-		dataDir: dataDir,
+		provider: provider,
+		dataDir:  dataDir,
 	}, nil
 }
 
-// FetchAndSave gets commute time and appends to CSV file
-func (f *Fetcher) FetchAndSave(ctx context.Context, from, to, outputFile string) error {
-	// Create distance matrix request
-	req := &maps.DistanceMatrixRequest{
-		Origins:       []string{from},
-		Destinations:  []string{to},
-		DepartureTime: "now",
+// ReadOnly reports whether the fetcher never writes results
+func (f *Fetcher) ReadOnly() bool {
+	return f.dataDir == ""
+}
+
+// Labels describe why a sample was taken and are saved with it
+type Labels struct {
+	Schedule string   // name of the schedule that triggered the fetch
+	Tags     []string // tags of the itinerary
+}
+
+// FetchAndSave gets commute time, appends it to CSV file and returns it.
+// In read-only mode the result is returned without being saved.
+func (f *Fetcher) FetchAndSave(ctx context.Context, from, to string, travel Travel, outputFile string, labels Labels) (Result, error) {
+	return f.FetchAndSaveFrom(ctx, "", from, to, travel, outputFile, labels)
+}
+
+// FetchAndSaveFrom is FetchAndSave with a provider set with SetProviders,
+// or the default one when provider is empty
+func (f *Fetcher) FetchAndSaveFrom(ctx context.Context, provider, from, to string, travel Travel, outputFile string, labels Labels) (Result, error) {
+	p, err := f.lookup(provider)
+	if err != nil {
+		return Result{}, err
+	}
+	result, err := f.fetch(ctx, p, from, to, travel)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if f.ReadOnly() {
+		return result, nil
+	}
+
+	line := formatLine(time.Now(), result, "", "", labels)
+	if err := f.save(ctx, outputFile, line); err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+// FetchParkAndRideAndSave gets the commute time of a park-and-ride
+// itinerary, driving from one place to a parking location and taking transit
+// from there, departing when the car is parked. The result holds both legs
+// and their total, which is saved and returned like FetchAndSave's.
+func (f *Fetcher) FetchParkAndRideAndSave(ctx context.Context, from, via, to, outputFile string, labels Labels) (Result, error) {
+	drive, err := f.fetch(ctx, f.provider, from, via, Travel{})
+	if err != nil {
+		return Result{}, fmt.Errorf("driving leg: %w", err)
+	}
+	parked := time.Now().Add(time.Duration(drive.Duration * float64(time.Minute)))
+	transit, err := f.fetch(ctx, f.provider, via, to, Travel{Mode: config.ModeTransit, Depart: parked})
+	if err != nil {
+		return Result{}, fmt.Errorf("transit leg: %w", err)
 	}
 
-	// Call API
-	routes, err := f.client.DistanceMatrix(ctx, req)
+	return f.saveLegs(ctx, []Result{drive, transit}, 0, nil, outputFile, labels)
+}
+
+// FetchCarpoolAndSave gets the commute time of a carpool itinerary, driving
+// from one place to each stop in order and then to the destination. The
+// result holds every leg and their total along with the time spent at the
+// stops, which is saved and returned like FetchAndSave's. With direct, the
+// trip without the stops is fetched too and saved alongside.
+func (f *Fetcher) FetchCarpoolAndSave(ctx context.Context, from string, stops []config.Stop, to string, direct bool, outputFile string, labels Labels) (Result, error) {
+	places := []string{from}
+	dwell := 0.0
+	for _, stop := range stops {
+		places = append(places, stop.Address)
+		dwell += stop.DwellMinutes
+	}
+	places = append(places, to)
+
+	legs := make([]Result, len(places)-1)
+	for i := range legs {
+		leg, err := f.fetch(ctx, f.provider, places[i], places[i+1], Travel{})
+		if err != nil {
+			return Result{}, fmt.Errorf("leg %d: %w", i+1, err)
+		}
+		legs[i] = leg
+	}
+
+	var trip *Result
+	if direct {
+		result, err := f.fetch(ctx, f.provider, from, to, Travel{})
+		if err != nil {
+			return Result{}, fmt.Errorf("direct trip: %w", err)
+		}
+		trip = &result
+	}
+
+	return f.saveLegs(ctx, legs, dwell, trip, outputFile, labels)
+}
+
+// saveLegs combines the results of the legs of an itinerary, plus dwell
+// minutes spent between them, and saves the total with the duration of each
+// leg and of the direct trip, if any. The response metadata is the last
+// leg's.
+func (f *Fetcher) saveLegs(ctx context.Context, legs []Result, dwell float64, direct *Result, outputFile string, labels Labels) (Result, error) {
+	last := legs[len(legs)-1]
+	result := Result{
+		Duration:   dwell,
+		HTTPStatus: last.HTTPStatus,
+		Status:     last.Status,
+		Provider:   last.Provider,
+	}
+	for _, leg := range legs {
+		result.Duration += leg.Duration
+		result.Latency += leg.Latency
+		result.Elements += leg.Elements
+		result.Cost += leg.Cost
+		result.Distance += leg.Distance
+		result.Legs = append(result.Legs, leg.Duration)
+	}
+	if direct != nil {
+		result.Direct = direct.Duration
+		result.Latency += direct.Latency
+		result.Elements += direct.Elements
+		result.Cost += direct.Cost
+	}
+	if f.ReadOnly() {
+		return result, nil
+	}
+
+	line := formatLine(time.Now(), result, "", "", labels)
+	if err := f.save(ctx, outputFile, line); err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+// FetchMatrixAndSave gets commute times for every origin/destination pair
+// and appends the successful ones to the CSV file, labeled with their origin
+// and destination. Failed pairs are returned with Err set and not written.
+func (f *Fetcher) FetchMatrixAndSave(ctx context.Context, origins, destinations []config.Place, outputFile string, labels Labels) ([]Element, error) {
+	elements, err := f.FetchMatrix(ctx, addresses(origins), addresses(destinations))
 	if err != nil {
-		return fmt.Errorf("distance matrix API error: %w", err)
+		return nil, err
+	}
+
+	if f.ReadOnly() {
+		return elements, nil
+	}
+
+	// Elements are in row-major order: every destination for each origin
+	timestamp := time.Now()
+	var lines strings.Builder
+	for i, el := range elements {
+		if el.Err == nil {
+			lines.WriteString(formatLine(timestamp, el.Result,
+				origins[i/len(destinations)].Label, destinations[i%len(destinations)].Label, labels))
+		}
+	}
+
+	if lines.Len() > 0 {
+		if err := f.save(ctx, outputFile, lines.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	return elements, nil
+}
+
+// formatLine formats a CSV line:
+// timestamp,duration,latency_ms,http_status,status,provider,origin,destination,schedule,tags,elements,cost,legs,direct
+// The origin and destination are only set for matrix itineraries, the legs
+// for park-and-ride and carpool ones and the direct trip for carpool ones
+// fetching it. Tags and legs are separated by semicolons.
+func formatLine(timestamp time.Time, result Result, origin, destination string, labels Labels) string {
+	legs := make([]string, len(result.Legs))
+	for i, leg := range result.Legs {
+		legs[i] = fmt.Sprintf("%f", leg)
+	}
+	direct := ""
+	if result.Direct > 0 {
+		direct = fmt.Sprintf("%f", result.Direct)
 	}
+	return fmt.Sprintf("%s,%f,%d,%d,%s,%s,%s,%s,%s,%s,%d,%f,%s,%s\n", timestamp.Format(time.RFC3339), result.Duration,
+		result.Latency.Milliseconds(), result.HTTPStatus, result.Status, result.Provider,
+		origin, destination, labels.Schedule, strings.Join(labels.Tags, ";"), result.Elements, result.Cost,
+		strings.Join(legs, ";"), direct)
+}
 
-	// Extract duration
-	if len(routes.Rows) == 0 || len(routes.Rows[0].Elements) == 0 {
-		return fmt.Errorf("no route found from %s to %s", from, to)
+// addresses returns the address of each place
+func addresses(places []config.Place) []string {
+	result := make([]string, len(places))
+	for i, p := range places {
+		result[i] = p.Address
 	}
+	return result
+}
 
-	element := routes.Rows[0].Elements[0]
-	if element.Status != "OK" {
-		return fmt.Errorf("route status: %s", element.Status)
+// save appends lines to the output file, or queues them when writes are
+// batched
+func (f *Fetcher) save(ctx context.Context, outputFile, line string) error {
+	if f.enqueue(outputFile, line) {
+		return nil
 	}
+	return f.write(ctx, outputFile, line)
+}
 
-	// Format CSV line
-	timestamp := time.Now().Format(time.RFC3339)
-	duration := element.DurationInTraffic.Minutes()
-	line := fmt.Sprintf("%s,%f\n", timestamp, duration)
+// write appends lines to the output file
+func (f *Fetcher) write(ctx context.Context, outputFile, lines string) (err error) {
+	_, span := tracer.Start(ctx, "storage.write")
+	start := time.Now()
+	defer func() {
+		storageLatency.Record(ctx, float64(time.Since(start).Microseconds())/1000)
+		endSpan(span, err)
+	}()
 
-	// Append to file
 	filePath := filepath.Join(f.dataDir, outputFile)
+	if err := history.EnsureSchema(filePath); err != nil {
+		return apperr.Wrap(apperr.KindStorage, err)
+	}
+
+	// Append to file, as whole lines in snapshots
+	defer history.BeginAppend()()
 	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to open output file: %w", err)
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to open output file: %w", err))
 	}
 	defer file.Close()
 
-	if _, err := file.WriteString(line); err != nil {
-		return fmt.Errorf("failed to write to file: %w", err)
+	if _, err := file.WriteString(lines); err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write to file: %w", err))
+	}
+
+	return nil
+}
+
+// SetProviders replaces the providers itineraries can be fetched from
+// besides the default one, e.g. on config reload
+func (f *Fetcher) SetProviders(providers ...Provider) {
+	others := make(map[string]Provider, len(providers))
+	for _, p := range providers {
+		others[p.Name()] = p
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.others = others
+}
+
+// lookup returns the named provider, the default one when name is empty or
+// names it
+func (f *Fetcher) lookup(name string) (Provider, error) {
+	if name == "" || name == f.provider.Name() {
+		return f.provider, nil
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if p, ok := f.others[name]; ok {
+		return p, nil
+	}
+	return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("provider %s is not set up", name))
+}
+
+// Fetch gets commute time without saving (for fetch subcommand), from the
+// response cache when it holds a fresh one, which costs no request
+func (f *Fetcher) Fetch(ctx context.Context, from, to string) (Result, error) {
+	if entry, ok := f.cache.get(route{f.provider.Name(), from, to, config.ModeDriving}); ok {
+		result := entry.Result
+		result.Elements, result.Cost, result.Cached = 0, 0, entry.Fetched
+		return result, nil
+	}
+	return f.fetch(ctx, f.provider, from, to, Travel{})
+}
+
+// fetch gets commute time from a provider in a travel mode, at the rider's
+// pace when bicycling
+func (f *Fetcher) fetch(ctx context.Context, provider Provider, from, to string, travel Travel) (result Result, err error) {
+	providerAttr := attribute.String("provider", provider.Name())
+	ctx, span := tracer.Start(ctx, "provider.duration", trace.WithAttributes(providerAttr))
+	start := time.Now()
+	defer func() {
+		apiLatency.Record(ctx, float64(time.Since(start).Microseconds())/1000, metric.WithAttributes(providerAttr))
+		if err != nil {
+			apiErrors.Add(ctx, 1, metric.WithAttributes(providerAttr))
+		}
+		endSpan(span, err)
+	}()
+
+	duration := provider.Duration
+	switch travel.Mode {
+	case config.ModeBicycling:
+		c, ok := provider.(cyclist)
+		if !ok {
+			return Result{}, apperr.Wrap(apperr.KindConfig, fmt.Errorf("provider %s cannot route bicycles", provider.Name()))
+		}
+		duration = c.BicycleDuration
+	case config.ModeTransit:
+		t, ok := provider.(transitRouter)
+		if !ok {
+			return Result{}, apperr.Wrap(apperr.KindConfig, fmt.Errorf("provider %s cannot route transit", provider.Name()))
+		}
+		duration = func(ctx context.Context, from, to string) (Result, error) {
+			return t.TransitDuration(ctx, from, to, travel.Depart)
+		}
 	}
 
+	lookup := func() (Result, error) {
+		if err := f.quota.take(1); err != nil {
+			return Result{}, err
+		}
+		return duration(ctx, from, to)
+	}
+
+	// Transit departing at a set time is looked up on its own
+	shared := false
+	if travel.Depart.IsZero() {
+		mode := travel.Mode
+		if mode == "" {
+			mode = config.ModeDriving
+		}
+		r := route{provider.Name(), from, to, mode}
+		result, shared, err = f.share.do(ctx, r, lookup)
+		if err == nil && !shared {
+			f.cache.put(r, result)
+		}
+	} else {
+		result, err = lookup()
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	result.Duration = travel.Pace.Adjust(result.Duration, result.Distance)
+
+	result.Latency = time.Since(start)
+	result.Provider = provider.Name()
+	result.Elements, result.Cost = 1, f.elementPrice(provider.Name())
+	// A shared result was billed with the request it came from
+	if shared {
+		result.Elements, result.Cost = 0, 0
+		apiShared.Add(ctx, 1, metric.WithAttributes(providerAttr))
+	}
+	return result, nil
+}
+
+// FetchMatrix gets commute times for every origin/destination pair, in one
+// request when the provider supports it. Pairs that fail on their own are
+// returned with Err set; an error is returned only when the whole request fails.
+func (f *Fetcher) FetchMatrix(ctx context.Context, origins, destinations []string) (elements []Element, err error) {
+	providerAttr := attribute.String("provider", f.provider.Name())
+	ctx, span := tracer.Start(ctx, "provider.matrix", trace.WithAttributes(providerAttr,
+		attribute.Int("matrix.origins", len(origins)), attribute.Int("matrix.destinations", len(destinations))))
+	start := time.Now()
+	defer func() {
+		apiLatency.Record(ctx, float64(time.Since(start).Microseconds())/1000, metric.WithAttributes(providerAttr))
+		if err != nil {
+			apiErrors.Add(ctx, 1, metric.WithAttributes(providerAttr))
+		}
+		endSpan(span, err)
+	}()
+
+	if err = f.quota.take(len(origins) * len(destinations)); err != nil {
+		return nil, err
+	}
+
+	if m, ok := f.provider.(matrixProvider); ok {
+		elements, err = m.Matrix(ctx, origins, destinations)
+		if err != nil {
+			return nil, err
+		}
+		for i := range elements {
+			elements[i].Result.Latency = time.Since(start)
+		}
+	} else {
+		// Fall back to one request per pair
+		for _, from := range origins {
+			for _, to := range destinations {
+				pairStart := time.Now()
+				result, err := f.provider.Duration(ctx, from, to)
+				result.Latency = time.Since(pairStart)
+				elements = append(elements, Element{From: from, To: to, Result: result, Err: err})
+			}
+		}
+	}
+
+	// Count failed pairs without failing the fetch
+	failed := 0
+	for i := range elements {
+		elements[i].Result.Provider = f.provider.Name()
+		elements[i].Result.Elements, elements[i].Result.Cost = 1, f.elementPrice(f.provider.Name())
+		if elements[i].Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		apiErrors.Add(ctx, int64(failed), metric.WithAttributes(providerAttr, attribute.String("scope", "element")))
+	}
+	span.SetAttributes(attribute.Int("matrix.failed", failed))
+
+	return elements, nil
+}
+
+// Probe makes a minimal request to verify that the provider accepts our
+// credentials. Providers without credentials always pass.
+func (f *Fetcher) Probe(ctx context.Context, place string) error {
+	if p, ok := f.provider.(prober); ok {
+		return p.Probe(ctx, place)
+	}
 	return nil
 }
 
-// Fetch gets commute time without saving (for fetch subcommand)
-func (f *Fetcher) Fetch(ctx context.Context, from, to string) (float64, error) {
-	// Create distance matrix request
-	req := &maps.DistanceMatrixRequest{
-		Origins:       []string{from},
-		Destinations:  []string{to},
-		DepartureTime: "now",
+// Geocode resolves an address to the coordinates of its best match
+func (f *Fetcher) Geocode(ctx context.Context, address string) (geo.Point, error) {
+	locations, err := f.Lookup(ctx, address)
+	if err != nil {
+		return geo.Point{}, err
 	}
+	return locations[0].Point, nil
+}
 
-	// Call API
-	routes, err := f.client.DistanceMatrix(ctx, req)
+// Lookup returns the candidate locations for an address, best match first.
+// An address with no match is an error.
+func (f *Fetcher) Lookup(ctx context.Context, address string) ([]Location, error) {
+	g, ok := f.provider.(geocoder)
+	if !ok {
+		return nil, fmt.Errorf("provider %s cannot geocode addresses", f.provider.Name())
+	}
+
+	locations, err := g.Geocode(ctx, address)
 	if err != nil {
-		return 0, fmt.Errorf("distance matrix API error: %w", err)
+		return nil, err
+	}
+	if len(locations) == 0 {
+		return nil, apperr.Wrap(apperr.KindProvider, fmt.Errorf("address not found: %s", address))
 	}
 
-	// Extract duration
-	if len(routes.Rows) == 0 || len(routes.Rows[0].Elements) == 0 {
-		return 0, fmt.Errorf("no route found from %s to %s", from, to)
+	return locations, nil
+}
+
+// SearchPlaces returns the places matching a free-text query, most relevant
+// first. A query with no match is an error.
+func (f *Fetcher) SearchPlaces(ctx context.Context, query string) ([]Location, error) {
+	p, ok := f.provider.(placeSearcher)
+	if !ok {
+		return nil, fmt.Errorf("provider %s cannot search places", f.provider.Name())
 	}
 
-	element := routes.Rows[0].Elements[0]
-	if element.Status != "OK" {
-		return 0, fmt.Errorf("route status: %s", element.Status)
+	locations, err := p.SearchPlaces(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(locations) == 0 {
+		return nil, apperr.Wrap(apperr.KindProvider, fmt.Errorf("no places found: %s", query))
 	}
 
-	return element.DurationInTraffic.Minutes(), nil
+	return locations, nil
+}
+
+// IsTransportError reports whether err is a network failure rather than a
+// response from the provider
+func IsTransportError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// endSpan records err on span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
 }
@@ -0,0 +1,252 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"googlemaps.github.io/maps"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/geo"
+)
+
+// PlaceIDPrefix marks a location given by Google place ID rather than by
+// address, e.g. "place_id:ChIJ2eUgeAK6j4ARbn5u_wAGqWA"
+const PlaceIDPrefix = "place_id:"
+
+// google fetches travel times from the Google Maps Distance Matrix API
+type google struct {
+	client *maps.Client
+	apiKey string
+}
+
+// newGoogle creates a Google Maps provider
+func newGoogle(api config.APIConfig) (*google, error) {
+	httpClient, err := NewHTTPClient(api)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Transport = statusTransport{httpClient.Transport}
+
+	client, err := maps.NewClient(maps.WithAPIKey(api.Key), maps.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to create maps client: %w", err))
+	}
+
+	return &google{
+		client: client,
+		apiKey: api.Key,
+	}, nil
+}
+
+// Name identifies the provider
+func (g *google) Name() string {
+	return "google"
+}
+
+// Duration returns the travel time in traffic, departing now
+func (g *google) Duration(ctx context.Context, from, to string) (Result, error) {
+	return g.duration(ctx, from, to, maps.TravelModeDriving, time.Time{})
+}
+
+// BicycleDuration returns the travel time by bicycle, along bike paths and
+// preferred streets
+func (g *google) BicycleDuration(ctx context.Context, from, to string) (Result, error) {
+	return g.duration(ctx, from, to, maps.TravelModeBicycling, time.Time{})
+}
+
+// TransitDuration returns the travel time by public transit, departing at a
+// given time or now
+func (g *google) TransitDuration(ctx context.Context, from, to string, depart time.Time) (Result, error) {
+	return g.duration(ctx, from, to, maps.TravelModeTransit, depart)
+}
+
+// duration returns the travel time between two places in a travel mode
+func (g *google) duration(ctx context.Context, from, to string, mode maps.Mode, depart time.Time) (Result, error) {
+	elements, err := g.matrix(ctx, []string{from}, []string{to}, mode, depart)
+	if err != nil {
+		return Result{}, err
+	}
+
+	element := elements[0]
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("maps.element.status", element.Result.Status))
+	if element.Err != nil {
+		return Result{}, element.Err
+	}
+
+	return element.Result, nil
+}
+
+// Matrix returns travel times in traffic for every origin/destination pair
+// in a single request, departing now. Pairs the API could not route, e.g.
+// NOT_FOUND or ZERO_RESULTS, carry their own error.
+func (g *google) Matrix(ctx context.Context, origins, destinations []string) ([]Element, error) {
+	return g.matrix(ctx, origins, destinations, maps.TravelModeDriving, time.Time{})
+}
+
+// matrix fetches travel times in a travel mode, in traffic when driving.
+// Driving and transit depart at the given time, or now when it is zero.
+func (g *google) matrix(ctx context.Context, origins, destinations []string, mode maps.Mode, depart time.Time) ([]Element, error) {
+	// Create distance matrix request
+	req := &maps.DistanceMatrixRequest{
+		Origins:      origins,
+		Destinations: destinations,
+		Mode:         mode,
+	}
+	switch {
+	case mode == maps.TravelModeBicycling:
+	case depart.IsZero():
+		req.DepartureTime = "now"
+	default:
+		req.DepartureTime = strconv.FormatInt(depart.Unix(), 10)
+	}
+
+	// Call API, recording the HTTP status of the response
+	status := new(int)
+	routes, err := g.client.DistanceMatrix(context.WithValue(ctx, statusKey{}, status), req)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", *status))
+	if err != nil && *status != 0 {
+		return nil, apperr.Provider(fmt.Errorf("distance matrix API error (HTTP %d): %w", *status, g.redact(err)))
+	}
+	if err != nil {
+		return nil, apperr.Provider(fmt.Errorf("distance matrix API error: %w", g.redact(err)))
+	}
+
+	// Check the response covers every pair
+	if len(routes.Rows) != len(origins) {
+		return nil, apperr.Wrap(apperr.KindProvider, fmt.Errorf("expected %d rows in response, got %d", len(origins), len(routes.Rows)))
+	}
+
+	// Extract durations, keeping failed elements alongside successful ones
+	elements := make([]Element, 0, len(origins)*len(destinations))
+	for i, row := range routes.Rows {
+		if len(row.Elements) != len(destinations) {
+			return nil, apperr.Wrap(apperr.KindProvider, fmt.Errorf("expected %d elements in row %d, got %d", len(destinations), i, len(row.Elements)))
+		}
+
+		for j, el := range row.Elements {
+			element := Element{
+				From:   origins[i],
+				To:     destinations[j],
+				Result: Result{HTTPStatus: *status, Status: el.Status},
+			}
+			if el.Status == "OK" {
+				element.Result.Duration = el.DurationInTraffic.Minutes()
+				if mode != maps.TravelModeDriving {
+					// Only driving durations account for traffic
+					element.Result.Duration = el.Duration.Minutes()
+				}
+				element.Result.Distance = float64(el.Distance.Meters)
+			} else {
+				element.Err = apperr.Wrap(apperr.KindProvider, fmt.Errorf("route status from %s to %s: %s", origins[i], destinations[j], el.Status))
+			}
+			elements = append(elements, element)
+		}
+	}
+
+	return elements, nil
+}
+
+// Geocode resolves an address with the Geocoding API. Addresses of the form
+// "place_id:<id>" are looked up by place ID.
+func (g *google) Geocode(ctx context.Context, address string) ([]Location, error) {
+	req := &maps.GeocodingRequest{Address: address}
+	if id, ok := strings.CutPrefix(address, PlaceIDPrefix); ok {
+		req = &maps.GeocodingRequest{PlaceID: id}
+	}
+
+	results, err := g.client.Geocode(ctx, req)
+	if err != nil {
+		return nil, apperr.Provider(fmt.Errorf("geocoding API error: %w", g.redact(err)))
+	}
+
+	locations := make([]Location, len(results))
+	for i, r := range results {
+		locations[i] = Location{
+			Address:      r.FormattedAddress,
+			PlaceID:      r.PlaceID,
+			Point:        geo.Point{Lat: r.Geometry.Location.Lat, Lng: r.Geometry.Location.Lng},
+			Precision:    r.Geometry.LocationType,
+			PartialMatch: r.PartialMatch,
+		}
+	}
+
+	return locations, nil
+}
+
+// SearchPlaces finds places matching a free-text query with the Places API
+// text search
+func (g *google) SearchPlaces(ctx context.Context, query string) ([]Location, error) {
+	resp, err := g.client.TextSearch(ctx, &maps.TextSearchRequest{Query: query})
+	if err != nil {
+		return nil, apperr.Provider(fmt.Errorf("places API error: %w", g.redact(err)))
+	}
+
+	locations := make([]Location, len(resp.Results))
+	for i, r := range resp.Results {
+		locations[i] = Location{
+			Name:    r.Name,
+			Address: r.FormattedAddress,
+			PlaceID: r.PlaceID,
+			Point:   geo.Point{Lat: r.Geometry.Location.Lat, Lng: r.Geometry.Location.Lng},
+			Types:   r.Types,
+		}
+	}
+
+	return locations, nil
+}
+
+// Probe makes a minimal Distance Matrix request to verify that the API key is
+// valid and the API is enabled. The route itself does not need to exist.
+func (g *google) Probe(ctx context.Context, place string) error {
+	req := &maps.DistanceMatrixRequest{
+		Origins:      []string{place},
+		Destinations: []string{place},
+	}
+
+	if _, err := g.client.DistanceMatrix(ctx, req); err != nil {
+		return apperr.Provider(fmt.Errorf("distance matrix API error: %w", g.redact(err)))
+	}
+
+	return nil
+}
+
+// redact removes the API key from request URLs embedded in transport errors
+func (g *google) redact(err error) error {
+	var urlErr *url.Error
+	if g.apiKey == "" || !errors.As(err, &urlErr) {
+		return err
+	}
+
+	redacted := *urlErr
+	redacted.URL = strings.ReplaceAll(urlErr.URL, g.apiKey, "REDACTED")
+	return &redacted
+}
+
+// statusKey is the context key under which statusTransport records the HTTP
+// status of a response
+type statusKey struct{}
+
+// statusTransport records response status codes for requests whose context
+// carries a statusKey, since the maps client does not expose them
+type statusTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip performs the request and records its status code
+func (t statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if status, ok := req.Context().Value(statusKey{}).(*int); ok && resp != nil {
+		*status = resp.StatusCode
+	}
+	return resp, err
+}
@@ -0,0 +1,69 @@
+package fetcher
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gommutetime/internal/apperr"
+)
+
+// quota caps the number of route lookups made per local calendar day. A
+// matrix request counts one lookup per origin/destination pair, like the
+// provider bills it.
+type quota struct {
+	mu    sync.Mutex
+	limit int
+	day   string
+	used  int
+}
+
+// take reserves n lookups, failing with a quota error when the day's limit
+// would be exceeded. A nil quota is unlimited.
+func (q *quota) take(n int) error {
+	if q == nil {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if today := time.Now().Format(time.DateOnly); today != q.day {
+		q.day, q.used = today, 0
+	}
+	if q.used+n > q.limit {
+		return apperr.Wrap(apperr.KindQuota, fmt.Errorf("daily quota of %d requests reached (%d used today)", q.limit, q.used))
+	}
+
+	q.used += n
+	return nil
+}
+
+// SetDailyQuota limits the route lookups made per local calendar day, e.g.
+// to share an API key fairly between tenants. Zero removes the limit.
+func (f *Fetcher) SetDailyQuota(limit int) {
+	if limit <= 0 {
+		f.quota = nil
+		return
+	}
+	f.quota = &quota{limit: limit}
+}
+
+// SetPrice sets the estimated cost of a thousand elements of a provider,
+// recorded with each sample to attribute spending to itineraries. It may be
+// changed while fetching, e.g. on config reload.
+func (f *Fetcher) SetPrice(provider string, perThousand float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.prices == nil {
+		f.prices = make(map[string]float64)
+	}
+	f.prices[provider] = perThousand / 1000
+}
+
+// elementPrice returns the estimated cost of an element of a provider
+func (f *Fetcher) elementPrice(provider string) float64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.prices[provider]
+}
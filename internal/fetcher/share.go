@@ -0,0 +1,92 @@
+package fetcher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sharing serves identical route lookups made close together, e.g. by
+// two itineraries tracking the same route, from a single request. Lookups
+// made while one is in flight wait for it, and those made within the ttl
+// after it completed reuse its result.
+type sharing struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[route]*sharedFetch
+}
+
+// route identifies a lookup: its provider, places and travel mode
+type route struct {
+	provider, from, to, mode string
+}
+
+// sharedFetch is a lookup in flight or done
+type sharedFetch struct {
+	// done is closed once the lookup completes, setting the rest
+	done   chan struct{}
+	result Result
+	err    error
+	at     time.Time
+}
+
+// SetSharing serves route lookups repeated within ttl, including those made
+// while the first is in flight, from the first one's result, which costs no
+// request. Zero always makes a request. It may be changed while fetching,
+// e.g. on config reload.
+func (f *Fetcher) SetSharing(ttl time.Duration) {
+	f.share.mu.Lock()
+	defer f.share.mu.Unlock()
+	f.share.ttl = ttl
+	if ttl == 0 {
+		f.share.entries = nil
+	}
+}
+
+// do returns the result of lookup for a route, made once for the lookups
+// sharing it. shared is true for the results served from another lookup's
+// request.
+func (s *sharing) do(ctx context.Context, r route, lookup func() (Result, error)) (result Result, shared bool, err error) {
+	s.mu.Lock()
+	if s.ttl == 0 {
+		s.mu.Unlock()
+		result, err = lookup()
+		return result, false, err
+	}
+	now := time.Now()
+	for key, entry := range s.entries {
+		if !entry.at.IsZero() && now.Sub(entry.at) >= s.ttl {
+			delete(s.entries, key)
+		}
+	}
+	if entry, ok := s.entries[r]; ok {
+		s.mu.Unlock()
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return Result{}, false, ctx.Err()
+		}
+		if entry.err != nil {
+			return Result{}, false, entry.err
+		}
+		return entry.result, true, nil
+	}
+	entry := &sharedFetch{done: make(chan struct{})}
+	if s.entries == nil {
+		s.entries = make(map[route]*sharedFetch)
+	}
+	s.entries[r] = entry
+	s.mu.Unlock()
+
+	entry.result, entry.err = lookup()
+
+	s.mu.Lock()
+	entry.at = time.Now()
+	// Failures are not shared beyond the lookups waiting for them
+	if entry.err != nil && s.entries[r] == entry {
+		delete(s.entries, r)
+	}
+	s.mu.Unlock()
+	close(entry.done)
+	return entry.result, false, entry.err
+}
@@ -0,0 +1,52 @@
+package fetcher
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+)
+
+// NewHTTPClient builds the HTTP client used for API requests from the proxy,
+// CA bundle and timeout settings. Defaults match http.DefaultClient.
+func NewHTTPClient(api config.APIConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	// Route requests through the configured proxy
+	if api.Proxy != "" {
+		proxyURL, err := url.Parse(api.Proxy)
+		if err != nil {
+			return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("invalid proxy: %w", err))
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	// Trust extra certificate authorities on top of the system ones
+	if api.CAFile != "" {
+		pem, err := os.ReadFile(api.CAFile)
+		if err != nil {
+			return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to read CA bundle: %w", err))
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("no certificates found in %s", api.CAFile))
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	// Check the clock with the Date header of every response
+	return &http.Client{
+		Transport: skewTransport{next: transport},
+		Timeout:   time.Duration(api.TimeoutSeconds) * time.Second,
+	}, nil
+}
@@ -0,0 +1,144 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/geo"
+)
+
+// wazeServers are the routing servers of the Waze live map by region
+var wazeServers = map[string]string{
+	config.WazeWorld:  "https://www.waze.com/row-RoutingManager/routingRequest",
+	config.WazeUS:     "https://www.waze.com/RoutingManager/routingRequest",
+	config.WazeIsrael: "https://www.waze.com/il-RoutingManager/routingRequest",
+}
+
+// waze fetches travel times from the routing endpoints of the Waze live
+// map. They are not a public API: the config must opt in, and places must
+// be coordinates since Waze does not geocode them.
+type waze struct {
+	client *http.Client
+	server string
+}
+
+// newWaze creates a Waze provider
+func newWaze(api config.APIConfig) (*waze, error) {
+	httpClient, err := NewHTTPClient(api)
+	if err != nil {
+		return nil, err
+	}
+
+	region := api.Waze.Region
+	if region == "" {
+		region = config.WazeWorld
+	}
+	return &waze{client: httpClient, server: wazeServers[region]}, nil
+}
+
+// Name identifies the provider
+func (w *waze) Name() string {
+	return "waze"
+}
+
+// wazeRoute is a route of a routing response, as segments
+type wazeRoute struct {
+	Results []struct {
+		// CrossTime is the real-time travel time of the segment in seconds
+		CrossTime float64 `json:"crossTime"`
+	} `json:"results"`
+}
+
+// Duration returns the real-time travel time of the best route, departing
+// now
+func (w *waze) Duration(ctx context.Context, from, to string) (Result, error) {
+	origin, ok := geo.Locate(from)
+	if !ok {
+		return Result{}, apperr.Wrap(apperr.KindConfig, fmt.Errorf("waze needs coordinates, not %q", from))
+	}
+	destination, ok := geo.Locate(to)
+	if !ok {
+		return Result{}, apperr.Wrap(apperr.KindConfig, fmt.Errorf("waze needs coordinates, not %q", to))
+	}
+
+	query := url.Values{
+		"from":               {wazePoint(origin)},
+		"to":                 {wazePoint(destination)},
+		"at":                 {"0"},
+		"returnJSON":         {"true"},
+		"returnGeometries":   {"false"},
+		"returnInstructions": {"false"},
+		"timeout":            {"60000"},
+		"nPaths":             {"1"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.server+"?"+query.Encode(), nil)
+	if err != nil {
+		return Result{}, err
+	}
+	// The live map rejects requests without its referer
+	req.Header.Set("Referer", "https://www.waze.com/")
+	req.Header.Set("User-Agent", "gommutetime")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return Result{}, apperr.Provider(fmt.Errorf("waze routing error: %w", err))
+	}
+	defer resp.Body.Close()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Result{}, apperr.Provider(fmt.Errorf("waze routing error: %w", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("waze routing error: HTTP %s", resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return Result{}, apperr.Wrap(apperr.KindQuota, err)
+		}
+		return Result{}, apperr.Provider(err)
+	}
+
+	// A single path comes as response, several as alternatives
+	var body struct {
+		Error        string     `json:"error"`
+		Response     *wazeRoute `json:"response"`
+		Alternatives []struct {
+			Response wazeRoute `json:"response"`
+		} `json:"alternatives"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return Result{}, apperr.Wrap(apperr.KindProvider, fmt.Errorf("invalid waze response: %w", err))
+	}
+	route := body.Response
+	if route == nil && len(body.Alternatives) > 0 {
+		route = &body.Alternatives[0].Response
+	}
+	if body.Error != "" || route == nil || len(route.Results) == 0 {
+		status := body.Error
+		if status == "" {
+			status = "no route"
+		}
+		return Result{HTTPStatus: resp.StatusCode, Status: status},
+			apperr.Wrap(apperr.KindProvider, fmt.Errorf("waze route from %s to %s: %s", from, to, status))
+	}
+
+	seconds := 0.0
+	for _, segment := range route.Results {
+		seconds += segment.CrossTime
+	}
+	return Result{Duration: seconds / 60, HTTPStatus: resp.StatusCode, Status: "OK"}, nil
+}
+
+// wazePoint formats a point as the live map does, longitude first
+func wazePoint(p geo.Point) string {
+	return fmt.Sprintf("x:%f y:%f", p.Lng, p.Lat)
+}
@@ -0,0 +1,181 @@
+// Package gaps compares the samples an itinerary's schedules should have
+// recorded with those in its output file, to find collection outages
+package gaps
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/history"
+)
+
+// Samples are recorded when the fetch completes, a little after the
+// scheduled time, and count for it until the next one or maxDelay
+const (
+	earlyTolerance = time.Minute
+	maxDelay       = 15 * time.Minute
+)
+
+// Gap is a run of scheduled samples that were not recorded
+type Gap struct {
+	// From and To are the scheduled times of the first and last missing
+	// samples
+	From   time.Time
+	To     time.Time
+	Missed int
+}
+
+// Report compares the scheduled and recorded samples of an itinerary
+type Report struct {
+	// From and To are the times checked, after clamping to the recorded
+	// history
+	From     time.Time
+	To       time.Time
+	Expected int
+	Recorded int
+	Gaps     []Gap
+}
+
+// Coverage returns the share of scheduled samples that were recorded
+func (r Report) Coverage() float64 {
+	if r.Expected == 0 {
+		return 1
+	}
+	return float64(r.Recorded) / float64(r.Expected)
+}
+
+// Expected returns the times the itinerary's schedules sample from from
+// (inclusive) to to (exclusive), in order, taking overrides into account.
+// Adaptive schedules are left out: their times depend on the history.
+func Expected(itin config.Itinerary, from, to time.Time) []time.Time {
+	seen := make(map[time.Time]bool)
+	var times []time.Time
+	from, to = from.In(time.Local), to.In(time.Local)
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local); day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, sched := range itin.Schedules {
+			if sched.Adaptive != nil || !samplesOn(itin, sched, day) {
+				continue
+			}
+			for _, at := range sched.Times() {
+				t := time.Date(day.Year(), day.Month(), day.Day(),
+					int(at/time.Hour), int(at%time.Hour/time.Minute), int(at%time.Minute/time.Second), 0, time.Local)
+				if t.Before(from) || !t.Before(to) || seen[t] {
+					continue
+				}
+				seen[t] = true
+				times = append(times, t)
+			}
+		}
+	}
+	slices.SortFunc(times, time.Time.Compare)
+	return times
+}
+
+// Adaptive counts the samples the adaptive schedules of an itinerary take
+// on the days from the day of from to the day of to (exclusive)
+func Adaptive(itin config.Itinerary, from, to time.Time) int {
+	count := 0
+	from, to = from.In(time.Local), to.In(time.Local)
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local); day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, sched := range itin.Schedules {
+			if sched.Adaptive != nil && samplesOn(itin, sched, day) {
+				count += sched.Requests()
+			}
+		}
+	}
+	return count
+}
+
+// samplesOn reports whether a schedule samples on the day of t, taking
+// overrides and rosters into account
+func samplesOn(itin config.Itinerary, sched config.Schedule, t time.Time) bool {
+	if sched.SuppressOnly() || !slices.Contains(sched.Weekdays(), t.Weekday()) || !sched.OnRoster(t) {
+		return false
+	}
+	return !itin.HasOverrides() || itin.Active(sched, t)
+}
+
+// errStop ends a scan early
+var errStop = errors.New("stop")
+
+// Find reports the gaps of an itinerary from from to to (exclusive). The
+// range is clamped to start at its first sample, or after its last rollup,
+// and to end a minute ago: nothing is expected before an itinerary starts
+// recording.
+func Find(cfg *config.Config, itin config.Itinerary, from, to time.Time) (Report, error) {
+	// The samples of the last minute may still be fetched
+	now := time.Now().Add(-time.Minute)
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+	if itin.OutputFile == "" || cfg.DataDir == "" {
+		return Report{From: from, To: to}, nil
+	}
+	path := filepath.Join(cfg.DataDir, itin.OutputFile)
+
+	rolled, err := history.RolledBefore(path)
+	if err != nil {
+		return Report{}, err
+	}
+	if rolled.After(from) {
+		from = rolled
+	}
+	var first time.Time
+	err = history.Scan(path, rolled, time.Time{}, func(s history.Sample) error {
+		first = s.Timestamp
+		return errStop
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return Report{}, err
+	}
+	if first.IsZero() {
+		return Report{From: from, To: to}, nil
+	}
+	if first.After(from) {
+		from = first
+	}
+
+	var recorded []time.Time
+	err = history.Scan(path, from.Add(-earlyTolerance), to.Add(maxDelay), func(s history.Sample) error {
+		recorded = append(recorded, s.Timestamp)
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	slices.SortFunc(recorded, time.Time.Compare)
+
+	return compare(Expected(itin, from, to), recorded, from, to), nil
+}
+
+// compare matches scheduled times with sorted recorded times: a scheduled
+// sample is recorded if a sample was taken from shortly before it until the
+// next scheduled one
+func compare(expected, recorded []time.Time, from, to time.Time) Report {
+	report := Report{From: from, To: to, Expected: len(expected)}
+	var gap *Gap
+	for i, t := range expected {
+		end := t.Add(maxDelay)
+		if i+1 < len(expected) && expected[i+1].Before(end) {
+			end = expected[i+1]
+		}
+		start := t.Add(-earlyTolerance)
+		j, _ := slices.BinarySearchFunc(recorded, start, time.Time.Compare)
+		if j < len(recorded) && recorded[j].Before(end) {
+			report.Recorded++
+			gap = nil
+			continue
+		}
+
+		if gap == nil {
+			report.Gaps = append(report.Gaps, Gap{From: t})
+			gap = &report.Gaps[len(report.Gaps)-1]
+		}
+		gap.To = t
+		gap.Missed++
+	}
+	return report
+}
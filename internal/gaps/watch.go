@@ -0,0 +1,101 @@
+package gaps
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/notify"
+)
+
+// checkInterval is how often the watcher looks for gaps
+const checkInterval = 15 * time.Minute
+
+// lookback is how far back the watcher looks, so that an outage of the
+// daemon itself is reported when it restarts
+const lookback = 7 * 24 * time.Hour
+
+// Watcher alerts when an itinerary misses gaps.alert_after scheduled
+// samples in a row. Each gap is reported once, while it is ongoing.
+type Watcher struct {
+	mu       sync.Mutex
+	cfg      *config.Config
+	notifier *notify.Manager
+	paused   func(id string) bool
+	// alerted holds the start of the last gap reported for each itinerary
+	alerted map[string]time.Time
+}
+
+// NewWatcher creates a gap watcher sending alerts through notifier and
+// skipping paused itineraries
+func NewWatcher(cfg *config.Config, notifier *notify.Manager, paused func(id string) bool) *Watcher {
+	return &Watcher{cfg: cfg, notifier: notifier, paused: paused, alerted: make(map[string]time.Time)}
+}
+
+// Reload switches to a new config
+func (w *Watcher) Reload(cfg *config.Config) {
+	w.mu.Lock()
+	w.cfg = cfg
+	w.mu.Unlock()
+}
+
+// Run checks for gaps right away and then periodically, until ctx is
+// cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		w.mu.Lock()
+		cfg := w.cfg
+		w.mu.Unlock()
+		if cfg.Gaps.AlertAfter > 0 && !cfg.ReadOnly {
+			w.check(ctx, cfg, time.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check alerts on the ongoing gaps of every itinerary
+func (w *Watcher) check(ctx context.Context, cfg *config.Config, now time.Time) {
+	// Queued samples are not in the output files yet
+	to := now.Add(-cfg.Storage.FlushInterval())
+	for _, itin := range cfg.Itineraries {
+		if w.paused(itin.ID) {
+			continue
+		}
+		report, err := Find(cfg, itin, now.Add(-lookback), to)
+		if err != nil {
+			log.Printf("Warning: failed to check %s for missing samples: %v", itin.ID, err)
+			continue
+		}
+		if len(report.Gaps) == 0 {
+			continue
+		}
+
+		// Only a gap reaching the last scheduled sample is ongoing
+		gap := report.Gaps[len(report.Gaps)-1]
+		expected := Expected(itin, gap.To, report.To)
+		if gap.Missed < cfg.Gaps.AlertAfter || len(expected) > 1 || w.alerted[itin.ID].Equal(gap.From) {
+			continue
+		}
+		w.alerted[itin.ID] = gap.From
+
+		msg := notify.Message{
+			Title:       fmt.Sprintf("%s: samples missing", itin.Name),
+			Body:        fmt.Sprintf("%d scheduled samples were not recorded since %s", gap.Missed, gap.From.Format("Mon Jan 2 15:04")),
+			Severity:    "warning",
+			ItineraryID: itin.ID,
+			Rule:        "gaps",
+			Timestamp:   now,
+		}
+		w.notifier.Notify(ctx, itin, msg, cfg.Gaps.Channels)
+	}
+}
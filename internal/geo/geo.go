@@ -0,0 +1,88 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// earthRadius is the mean Earth radius in meters
+const earthRadius = 6371000.0
+
+// Point is a WGS84 coordinate
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// String formats the point as "lat,lng", as accepted by the Maps APIs
+func (p Point) String() string {
+	return fmt.Sprintf("%.6f,%.6f", p.Lat, p.Lng)
+}
+
+// Distance returns the great-circle distance between a and b in meters
+func Distance(a, b Point) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// ParsePoint parses "lat,lng" coordinates. ok is false when s does not look
+// like coordinates; err is set when it does but they are out of range.
+func ParsePoint(s string) (p Point, ok bool, err error) {
+	latStr, lngStr, found := strings.Cut(s, ",")
+	if !found {
+		return Point{}, false, nil
+	}
+
+	lat, errLat := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	lng, errLng := strconv.ParseFloat(strings.TrimSpace(lngStr), 64)
+	if errLat != nil || errLng != nil {
+		return Point{}, false, nil
+	}
+
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return Point{}, true, fmt.Errorf("coordinates %q out of range", s)
+	}
+
+	return Point{Lat: lat, Lng: lng}, true, nil
+}
+
+// ValidateLocation checks a from/to value: coordinates must be in range and
+// Plus Codes well formed, with a locality after short codes. Anything else
+// is taken as an address and left to the provider.
+func ValidateLocation(s string) error {
+	if _, ok, err := ParsePoint(s); ok {
+		return err
+	}
+
+	code, locality, _ := strings.Cut(strings.TrimSpace(s), " ")
+	if !IsPlusCode(code) {
+		return nil
+	}
+	if err := ValidatePlusCode(code); err != nil {
+		return err
+	}
+	if strings.IndexByte(code, plusSeparator) < plusSepIndex && strings.TrimSpace(locality) == "" {
+		return fmt.Errorf("short plus code %q needs a locality, e.g. %q", code, code+" Mountain View, CA")
+	}
+
+	return nil
+}
+
+// Locate returns the point for coordinates or a full Plus Code without
+// geocoding. ok is false for addresses and short Plus Codes.
+func Locate(s string) (Point, bool) {
+	if p, ok, err := ParsePoint(s); ok {
+		return p, err == nil
+	}
+	if p, err := DecodePlusCode(strings.TrimSpace(s)); err == nil {
+		return p, true
+	}
+	return Point{}, false
+}
@@ -0,0 +1,99 @@
+package geo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Open Location Code (Plus Code) parameters
+const (
+	plusAlphabet   = "23456789CFGHJMPQRVWX"
+	plusSeparator  = '+'
+	plusSepIndex   = 8  // position of the separator in a full code
+	plusPairDigits = 10 // digits encoded as latitude/longitude pairs
+	plusPadding    = '0'
+)
+
+// IsPlusCode reports whether s has the shape of a Plus Code, full
+// (e.g. 87G8Q2PH+Q6) or short (e.g. Q2PH+Q6), without validating it
+func IsPlusCode(s string) bool {
+	sep := strings.IndexByte(s, plusSeparator)
+	if sep < 2 || sep > plusSepIndex || strings.Count(s, string(plusSeparator)) != 1 {
+		return false
+	}
+	for _, c := range strings.ToUpper(s) {
+		if c != plusSeparator && c != plusPadding && !strings.ContainsRune(plusAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidatePlusCode checks the syntax of a full or short Plus Code
+func ValidatePlusCode(code string) error {
+	code = strings.ToUpper(code)
+	sep := strings.IndexByte(code, plusSeparator)
+	if !IsPlusCode(code) || sep%2 != 0 {
+		return fmt.Errorf("invalid plus code %q", code)
+	}
+
+	// A single character after the separator is not allowed
+	if len(code)-sep-1 == 1 {
+		return fmt.Errorf("invalid plus code %q: need 0 or at least 2 characters after '+'", code)
+	}
+
+	// Padding is only allowed in full codes, up to the separator, with
+	// nothing after it
+	if pad := strings.IndexByte(code, plusPadding); pad >= 0 {
+		if sep != plusSepIndex || pad == 0 || pad%2 != 0 || strings.Trim(code[pad:sep], "0") != "" || sep != len(code)-1 {
+			return fmt.Errorf("invalid plus code %q: misplaced padding", code)
+		}
+	}
+	if strings.IndexByte(code[sep+1:], plusPadding) >= 0 {
+		return fmt.Errorf("invalid plus code %q: misplaced padding", code)
+	}
+
+	// The first pair of a full code must be within range
+	if sep == plusSepIndex {
+		if strings.IndexByte(plusAlphabet, code[0]) >= 9 || strings.IndexByte(plusAlphabet, code[1]) >= 18 {
+			return fmt.Errorf("invalid plus code %q: out of range", code)
+		}
+	}
+
+	return nil
+}
+
+// DecodePlusCode returns the center of the area of a full Plus Code
+func DecodePlusCode(code string) (Point, error) {
+	if err := ValidatePlusCode(code); err != nil {
+		return Point{}, err
+	}
+	code = strings.ToUpper(code)
+	if strings.IndexByte(code, plusSeparator) != plusSepIndex {
+		return Point{}, fmt.Errorf("plus code %q is a short code and needs a locality", code)
+	}
+
+	digits := strings.TrimRight(strings.Replace(code, string(plusSeparator), "", 1), string(plusPadding))
+
+	lat, lng := -90.0, -180.0
+	latRes, lngRes := 400.0, 400.0
+
+	// Pairs of latitude and longitude digits
+	for i := 0; i < len(digits) && i < plusPairDigits; i += 2 {
+		latRes /= 20
+		lngRes /= 20
+		lat += float64(strings.IndexByte(plusAlphabet, digits[i])) * latRes
+		lng += float64(strings.IndexByte(plusAlphabet, digits[i+1])) * lngRes
+	}
+
+	// Grid refinement digits, 5 rows by 4 columns each
+	for i := plusPairDigits; i < len(digits); i++ {
+		latRes /= 5
+		lngRes /= 4
+		idx := strings.IndexByte(plusAlphabet, digits[i])
+		lat += float64(idx/4) * latRes
+		lng += float64(idx%4) * lngRes
+	}
+
+	return Point{Lat: lat + latRes/2, Lng: lng + lngRes/2}, nil
+}
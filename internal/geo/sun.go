@@ -0,0 +1,65 @@
+package geo
+
+import (
+	"math"
+	"time"
+)
+
+// Julian dates of the J2000 epoch and of the Unix epoch
+const (
+	julian2000 = 2451545.0
+	julianUnix = 2440587.5
+)
+
+// sunAltitude is the altitude of the sun's center at sunrise and sunset in
+// degrees, below the horizon for refraction and the sun's radius
+const sunAltitude = -0.833
+
+// Sun returns the sunrise and sunset at p on the solar day around t, with
+// the sunrise equation, accurate to a minute or two. During polar day or
+// night both are zero and always tells which it is.
+func Sun(p Point, t time.Time) (sunrise, sunset time.Time, always bool) {
+	rad := math.Pi / 180
+
+	// Days since J2000 at the local solar noon nearest t
+	solar := t.UTC().Add(time.Duration(p.Lng / 15 * float64(time.Hour)))
+	noon := time.Date(solar.Year(), solar.Month(), solar.Day(), 12, 0, 0, 0, time.UTC)
+	n := math.Round(julian(noon) - julian2000 + 0.0008)
+	mean := n - p.Lng/360
+
+	anomaly := math.Mod(357.5291+0.98560028*mean, 360)
+	center := 1.9148*math.Sin(anomaly*rad) + 0.02*math.Sin(2*anomaly*rad) + 0.0003*math.Sin(3*anomaly*rad)
+	longitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := julian2000 + mean + 0.0053*math.Sin(anomaly*rad) - 0.0069*math.Sin(2*longitude*rad)
+
+	declination := math.Asin(math.Sin(longitude*rad) * math.Sin(23.4397*rad))
+	cosHour := (math.Sin(sunAltitude*rad) - math.Sin(p.Lat*rad)*math.Sin(declination)) /
+		(math.Cos(p.Lat*rad) * math.Cos(declination))
+	switch {
+	case cosHour < -1:
+		return time.Time{}, time.Time{}, true
+	case cosHour > 1:
+		return time.Time{}, time.Time{}, false
+	}
+	hour := math.Acos(cosHour) / rad
+	return fromJulian(transit - hour/360), fromJulian(transit + hour/360), false
+}
+
+// Daylight reports whether the sun is up at p at time t
+func Daylight(p Point, t time.Time) bool {
+	sunrise, sunset, always := Sun(p, t)
+	if sunrise.IsZero() {
+		return always
+	}
+	return !t.Before(sunrise) && t.Before(sunset)
+}
+
+// julian returns the Julian date of t
+func julian(t time.Time) float64 {
+	return float64(t.Unix())/86400 + julianUnix
+}
+
+// fromJulian returns the time of a Julian date, to the second
+func fromJulian(jd float64) time.Time {
+	return time.Unix(int64(math.Round((jd-julianUnix)*86400)), 0)
+}
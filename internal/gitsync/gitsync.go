@@ -0,0 +1,153 @@
+package gitsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+)
+
+// Options locate a config file in a git repository
+type Options struct {
+	URL    string
+	Branch string
+	// Path is the config file inside the repository
+	Path string
+	// DeployKey is an SSH private key file for the repository, if any
+	DeployKey string
+	Interval  time.Duration
+}
+
+// Syncer keeps a local config file in sync with a file in a git repository
+type Syncer struct {
+	opts       Options
+	configPath string
+	dir        string // local clone
+	rejected   string // last commit with an invalid config, not retried
+}
+
+// New creates a syncer writing the repository's config file to configPath.
+// The repository is cloned into the user's cache directory.
+func New(opts Options, configPath string) (*Syncer, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("git repository URL is required")
+	}
+	if opts.Interval <= 0 {
+		return nil, fmt.Errorf("git sync interval must be positive")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git sync needs the git command: %w", err)
+	}
+
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		cache = os.TempDir()
+	}
+	// One clone per repository and branch
+	sum := sha256.Sum256([]byte(opts.URL + "#" + opts.Branch))
+	dir := filepath.Join(cache, "gommutetime", "git", hex.EncodeToString(sum[:8]))
+
+	return &Syncer{opts: opts, configPath: configPath, dir: dir}, nil
+}
+
+// Sync fetches the branch and replaces the local config file with the
+// repository's if it changed and is valid. It returns the fetched commit and
+// whether the local file was replaced. Invalid configs are reported once per
+// commit.
+func (s *Syncer) Sync(ctx context.Context) (commit string, changed bool, err error) {
+	if err := s.fetch(ctx); err != nil {
+		return "", false, err
+	}
+	if commit, err = s.git(ctx, "rev-parse", "--short", "HEAD"); err != nil {
+		return "", false, err
+	}
+	if commit == s.rejected {
+		return commit, false, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, s.opts.Path))
+	if err != nil {
+		return commit, false, apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to read %s at %s: %w", s.opts.Path, commit, err))
+	}
+	if current, err := os.ReadFile(s.configPath); err == nil && bytes.Equal(current, data) {
+		return commit, false, nil
+	}
+
+	if err := config.Replace(s.configPath, data, nil); err != nil {
+		if apperr.KindOf(err) == apperr.KindConfig {
+			s.rejected = commit
+		}
+		return commit, false, fmt.Errorf("config at %s rejected: %w", commit, err)
+	}
+	return commit, true, nil
+}
+
+// Run syncs on every interval until ctx is cancelled, calling report with
+// the outcome of each sync
+func (s *Syncer) Run(ctx context.Context, report func(commit string, changed bool, err error)) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report(s.Sync(ctx))
+		}
+	}
+}
+
+// fetch clones the repository on first use and resets the clone to the
+// tip of the branch afterwards
+func (s *Syncer) fetch(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(s.dir, ".git")); err != nil {
+		if err := os.MkdirAll(filepath.Dir(s.dir), 0700); err != nil {
+			return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to create git cache: %w", err))
+		}
+		os.RemoveAll(s.dir)
+		_, err := s.run(ctx, "", "clone", "--quiet", "--depth", "1", "--single-branch", "--branch", s.opts.Branch, "--", s.opts.URL, s.dir)
+		return err
+	}
+
+	if _, err := s.git(ctx, "fetch", "--quiet", "--depth", "1", "origin", s.opts.Branch); err != nil {
+		return err
+	}
+	_, err := s.git(ctx, "reset", "--quiet", "--hard", "FETCH_HEAD")
+	return err
+}
+
+// git runs a git command in the clone
+func (s *Syncer) git(ctx context.Context, args ...string) (string, error) {
+	return s.run(ctx, s.dir, args...)
+}
+
+// run runs a git command, using the deploy key for SSH remotes
+func (s *Syncer) run(ctx context.Context, dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if s.opts.DeployKey != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %q -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new", s.opts.DeployKey))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", apperr.Wrap(apperr.KindStorage, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String())))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
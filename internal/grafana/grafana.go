@@ -0,0 +1,320 @@
+// Package grafana generates a Grafana dashboard of the commute times of a
+// config, ready to import or push through the Grafana API, from one of the
+// sources the daemon can feed Grafana with:
+//
+//   - prometheus: the OpenTelemetry metrics of the daemon, exported over
+//     OTLP to a collector that Prometheus scrapes
+//   - json: the samples and series served by the daemon's HTTP API to the
+//     JSON datasource plugin
+//   - api: the samples served by the daemon's HTTP API, read with the
+//     Infinity datasource plugin
+//
+// Panels pick their datasource from a dashboard variable, so the same
+// dashboard works with any datasource of the right type.
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+)
+
+// Sources of dashboards
+const (
+	SourcePrometheus = "prometheus"
+	SourceJSON       = "json"
+	SourceAPI        = "api"
+)
+
+// Sources lists the supported sources
+var Sources = []string{SourcePrometheus, SourceJSON, SourceAPI}
+
+// UID identifies the generated dashboard, so pushing it again replaces it
+const UID = "gommutetime"
+
+// Plugin IDs of the JSON and Infinity datasources
+const (
+	jsonPlugin = "simpod-json-datasource"
+	infinity   = "yesoreyeram-infinity-datasource"
+)
+
+// DefaultSource returns the source of a config: its metrics when they are
+// exported, else its API to the JSON datasource
+func DefaultSource(cfg *config.Config) string {
+	if cfg.Telemetry.OTLPEndpoint != "" {
+		return SourcePrometheus
+	}
+	return SourceJSON
+}
+
+// Dashboard is a Grafana dashboard model
+type Dashboard struct {
+	UID           string     `json:"uid"`
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	Timezone      string     `json:"timezone"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Time          timeRange  `json:"time"`
+	Refresh       string     `json:"refresh"`
+	Templating    templating `json:"templating"`
+	Panels        []panel    `json:"panels"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type templating struct {
+	List []variable `json:"list"`
+}
+
+type variable struct {
+	Name    string     `json:"name"`
+	Label   string     `json:"label"`
+	Type    string     `json:"type"`
+	Query   string     `json:"query"`
+	Multi   bool       `json:"multi,omitempty"`
+	Current *selection `json:"current,omitempty"`
+	Options []option   `json:"options,omitempty"`
+}
+
+type selection struct {
+	Text  []string `json:"text"`
+	Value []string `json:"value"`
+}
+
+type option struct {
+	Text     string `json:"text"`
+	Value    string `json:"value"`
+	Selected bool   `json:"selected"`
+}
+
+type panel struct {
+	ID          int         `json:"id"`
+	Type        string      `json:"type"`
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"`
+	GridPos     gridPos     `json:"gridPos"`
+	Datasource  datasource  `json:"datasource"`
+	Targets     []target    `json:"targets"`
+	FieldConfig fieldConfig `json:"fieldConfig"`
+	Options     any         `json:"options,omitempty"`
+	// Repeat repeats the panel for each value of a variable
+	Repeat          string `json:"repeat,omitempty"`
+	RepeatDirection string `json:"repeatDirection,omitempty"`
+	MaxPerRow       int    `json:"maxPerRow,omitempty"`
+}
+
+type gridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type fieldConfig struct {
+	Defaults fieldDefaults `json:"defaults"`
+}
+
+type fieldDefaults struct {
+	Unit     string `json:"unit,omitempty"`
+	Decimals *int   `json:"decimals,omitempty"`
+}
+
+// target is a panel query, of Prometheus, JSON or Infinity
+type target struct {
+	RefID      string     `json:"refId"`
+	Datasource datasource `json:"datasource"`
+	// Prometheus
+	Expr         string `json:"expr,omitempty"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	// JSON
+	Target  string            `json:"target,omitempty"`
+	Payload map[string]string `json:"payload,omitempty"`
+	// Infinity
+	Type    string   `json:"type,omitempty"`
+	Source  string   `json:"source,omitempty"`
+	Format  string   `json:"format,omitempty"`
+	Parser  string   `json:"parser,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	Columns []column `json:"columns,omitempty"`
+}
+
+type column struct {
+	Selector string `json:"selector"`
+	Text     string `json:"text"`
+	Type     string `json:"type"`
+}
+
+// Generate returns the dashboard of a config's itineraries from a source.
+// Matrix itineraries are left out, having no single commute time.
+func Generate(cfg *config.Config, source string) (*Dashboard, error) {
+	var ids []string
+	for _, itin := range cfg.Itineraries {
+		if !itin.IsMatrix() {
+			ids = append(ids, itin.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, apperr.Wrap(apperr.KindConfig, errors.New("no itinerary to chart"))
+	}
+
+	d := &Dashboard{
+		UID:           UID,
+		Title:         "Commute times",
+		Tags:          []string{"gommutetime"},
+		Timezone:      "browser",
+		SchemaVersion: 39,
+		Time:          timeRange{From: "now-7d", To: "now"},
+		Refresh:       "5m",
+	}
+	itineraries := variable{Name: "itinerary", Label: "Itinerary", Type: "custom", Query: strings.Join(ids, ","), Multi: true,
+		Current: &selection{Text: ids, Value: ids}}
+	for _, id := range ids {
+		itineraries.Options = append(itineraries.Options, option{Text: id, Value: id, Selected: true})
+	}
+
+	switch source {
+	case SourcePrometheus:
+		d.Templating.List = []variable{{Name: "datasource", Label: "Prometheus", Type: "datasource", Query: "prometheus"}, itineraries}
+		d.Panels = prometheusPanels()
+	case SourceJSON:
+		if cfg.Server.Listen == "" {
+			return nil, apperr.Wrap(apperr.KindConfig, errors.New("the json source needs server.listen"))
+		}
+		d.Templating.List = []variable{{Name: "datasource", Label: "gommutetime", Type: "datasource", Query: jsonPlugin}, itineraries}
+		d.Panels = jsonPanels()
+	case SourceAPI:
+		if cfg.Server.Listen == "" {
+			return nil, apperr.Wrap(apperr.KindConfig, errors.New("the api source needs server.listen"))
+		}
+		d.Templating.List = []variable{{Name: "datasource", Label: "gommutetime API", Type: "datasource", Query: infinity}, itineraries}
+		d.Panels = apiPanels()
+	default:
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("source must be one of %s", strings.Join(Sources, ", ")))
+	}
+	for i := range d.Panels {
+		d.Panels[i].ID = i + 1
+	}
+	return d, nil
+}
+
+// prometheusPanels charts the metrics of the daemon, as OTLP metrics are
+// named in Prometheus
+func prometheusPanels() []panel {
+	ds := datasource{Type: "prometheus", UID: "${datasource}"}
+	query := func(expr, legend string) target {
+		return target{Datasource: ds, Expr: expr, LegendFormat: legend}
+	}
+	selector := `itinerary_id=~"$itinerary"`
+	return []panel{
+		newPanel("timeseries", "Commute time", gridPos{0, 0, 24, 10}, ds, "m", "Mean of the samples recorded in each interval",
+			query(`sum by (itinerary_id) (rate(gommutetime_commute_duration_minutes_sum{`+selector+`}[$__rate_interval]))`+
+				` / sum by (itinerary_id) (rate(gommutetime_commute_duration_minutes_count{`+selector+`}[$__rate_interval]))`, "{{itinerary_id}}")),
+		newPanel("timeseries", "Job runs", gridPos{0, 10, 12, 8}, ds, "short", "Fetches per hour by outcome",
+			query(`sum by (itinerary_id, outcome) (increase(gommutetime_job_runs_total{`+selector+`}[1h]))`, "{{itinerary_id}} {{outcome}}")),
+		newPanel("timeseries", "Provider latency", gridPos{12, 10, 12, 8}, ds, "ms", "95th percentile of the provider response times",
+			query(`histogram_quantile(0.95, sum by (le, provider) (rate(gommutetime_api_latency_milliseconds_bucket[$__rate_interval])))`, "{{provider}}")),
+		newPanel("timeseries", "Provider errors", gridPos{0, 18, 24, 6}, ds, "short", "Failed provider calls per hour",
+			query(`sum by (provider) (increase(gommutetime_api_errors_total[1h]))`, "{{provider}}")),
+	}
+}
+
+// jsonPanels charts the samples and hourly series served to the JSON
+// datasource, whose targets take every selected itinerary at once
+func jsonPanels() []panel {
+	ds := datasource{Type: jsonPlugin, UID: "${datasource}"}
+	query := func(resolution, stat string) target {
+		return target{Datasource: ds, Target: "${itinerary}", Payload: map[string]string{"resolution": resolution, "stat": stat}}
+	}
+	return []panel{
+		newPanel("timeseries", "Commute time", gridPos{0, 0, 24, 10}, ds, "m", "Every recorded sample", query("samples", "")),
+		newPanel("timeseries", "Hourly mean", gridPos{0, 10, 12, 8}, ds, "m", "Mean of the samples of each hour", query("hour", "mean")),
+		newPanel("timeseries", "Daily range", gridPos{12, 10, 12, 8}, ds, "m", "Shortest and longest commute of each day",
+			query("day", "min"), query("day", "max")),
+	}
+}
+
+// apiPanels charts the samples served by the API, in panels repeated for
+// each selected itinerary
+func apiPanels() []panel {
+	ds := datasource{Type: infinity, UID: "${datasource}"}
+	samples := target{
+		Datasource: ds, Type: "json", Source: "url", Format: "timeseries", Parser: "backend",
+		URL: "/api/v1/itineraries/${itinerary}/samples?since=${__from:date:iso}&until=${__to:date:iso}",
+		Columns: []column{
+			{Selector: "timestamp", Text: "Time", Type: "timestamp"},
+			{Selector: "duration_minutes", Text: "${itinerary}", Type: "number"},
+		},
+	}
+
+	one := 1
+	latest := newPanel("stat", "Latest: ${itinerary}", gridPos{0, 0, 6, 5}, ds, "m", "Most recent sample", samples)
+	latest.FieldConfig.Defaults.Decimals = &one
+	latest.Options = map[string]any{"reduceOptions": map[string]any{"calcs": []string{"lastNotNull"}}}
+	latest.Repeat, latest.RepeatDirection, latest.MaxPerRow = "itinerary", "h", 4
+
+	history := newPanel("timeseries", "Commute time: ${itinerary}", gridPos{0, 5, 24, 10}, ds, "m", "Every recorded sample", samples)
+	history.Repeat, history.RepeatDirection = "itinerary", "v"
+	return []panel{latest, history}
+}
+
+// newPanel returns a panel of queries with reference IDs A, B...
+func newPanel(kind, title string, pos gridPos, ds datasource, unit, description string, targets ...target) panel {
+	for i := range targets {
+		targets[i].RefID = string(rune('A' + i))
+	}
+	return panel{Type: kind, Title: title, Description: description, GridPos: pos, Datasource: ds, Targets: targets,
+		FieldConfig: fieldConfig{Defaults: fieldDefaults{Unit: unit}}}
+}
+
+// Push creates or replaces the dashboard on the Grafana server at base,
+// authenticated with a service account token, returning its URL
+func Push(ctx context.Context, client *http.Client, base, token string, d *Dashboard) (string, error) {
+	body, err := json.Marshal(map[string]any{"dashboard": d, "overwrite": true, "message": "Generated by gommutetime"})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(base, "/")+"/api/dashboards/db", bytes.NewReader(body))
+	if err != nil {
+		return "", apperr.Wrap(apperr.KindConfig, fmt.Errorf("invalid Grafana URL: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", apperr.Wrap(apperr.KindProvider, fmt.Errorf("grafana request failed: %w", err))
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var result struct {
+		URL     string `json:"url"`
+		Message string `json:"message"`
+	}
+	json.Unmarshal(data, &result)
+	if resp.StatusCode != http.StatusOK {
+		kind := apperr.KindProvider
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			kind = apperr.KindConfig
+		}
+		return "", apperr.Wrap(kind, fmt.Errorf("grafana replied HTTP %s: %s", resp.Status, result.Message))
+	}
+	return strings.TrimRight(base, "/") + result.URL, nil
+}
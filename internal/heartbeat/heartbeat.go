@@ -0,0 +1,95 @@
+// Package heartbeat pings dead man's switches such as healthchecks.io or
+// Uptime Kuma push monitors after successful fetches. They alert when the
+// pings stop, which the daemon cannot report itself once it or its host
+// died.
+package heartbeat
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/events"
+	"gommutetime/internal/fetcher"
+)
+
+// globalInterval is the least time between pings of heartbeat.url, so that
+// many itineraries fetched at once ping it once
+const globalInterval = time.Minute
+
+// timeout bounds a ping, which runs in the background
+const timeout = 10 * time.Second
+
+// Pinger requests the heartbeat URLs of the config
+type Pinger struct {
+	mu     sync.Mutex
+	cfg    *config.Config
+	client *http.Client
+	// last is when heartbeat.url was last pinged
+	last time.Time
+}
+
+// New creates a pinger for the heartbeats of cfg
+func New(cfg *config.Config) *Pinger {
+	p := &Pinger{}
+	p.Reload(cfg)
+	return p
+}
+
+// Reload switches to a new config
+func (p *Pinger) Reload(cfg *config.Config) {
+	// Pings go through the proxy and CA bundle of API requests
+	client, err := fetcher.NewHTTPClient(cfg.API)
+	if err != nil {
+		client = http.DefaultClient
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg, p.client = cfg, client
+}
+
+// Success pings the heartbeats of a successful fetch of an itinerary, on
+// job.succeeded events
+func (p *Pinger) Success(_ context.Context, e events.Event) {
+	itin := e.Itinerary
+	p.mu.Lock()
+	var urls []string
+	if url := p.cfg.Heartbeat.URL; url != "" && time.Since(p.last) >= globalInterval {
+		urls = append(urls, url)
+		p.last = time.Now()
+	}
+	if itin.Heartbeat != "" {
+		urls = append(urls, itin.Heartbeat)
+	}
+	client := p.client
+	p.mu.Unlock()
+
+	for _, url := range urls {
+		go ping(client, url)
+	}
+}
+
+// ping requests a heartbeat URL, logging failures
+func ping(client *http.Client, url string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		log.Printf("Warning: heartbeat ping failed: %v", err)
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Warning: heartbeat ping failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Warning: heartbeat ping failed: %s responded %s", req.URL.Host, resp.Status)
+	}
+}
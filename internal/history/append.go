@@ -0,0 +1,71 @@
+package history
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExternalProvider marks samples submitted by external agents, e.g. a phone
+// automation, rather than fetched from a provider
+const ExternalProvider = "external"
+
+// Append adds samples to a CSV output file in the current schema, as whole
+// rows in snapshots. Samples need not be newer than the file's rows.
+func Append(path string, samples ...Sample) error {
+	if err := EnsureSchema(path); err != nil {
+		return err
+	}
+
+	var rows bytes.Buffer
+	w := csv.NewWriter(&rows)
+	for _, s := range samples {
+		w.Write(formatRow(s))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to format samples: %w", err)
+	}
+
+	defer BeginAppend()()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(rows.Bytes()); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return file.Close()
+}
+
+// formatRow lays a sample out in the columns of the current schema. Fetch
+// details it lacks, like the latency and HTTP status, are zero.
+func formatRow(s Sample) []string {
+	legs := make([]string, len(s.Legs))
+	for i, leg := range s.Legs {
+		legs[i] = fmt.Sprintf("%f", leg)
+	}
+	direct := ""
+	if s.Direct > 0 {
+		direct = fmt.Sprintf("%f", s.Direct)
+	}
+	return []string{
+		s.Timestamp.Format(time.RFC3339),
+		fmt.Sprintf("%f", s.Duration),
+		"0", "0", "OK",
+		s.Provider,
+		s.Origin, s.Destination,
+		s.Schedule,
+		strings.Join(s.Tags, ";"),
+		strconv.Itoa(s.Elements),
+		fmt.Sprintf("%f", s.Cost),
+		strings.Join(legs, ";"),
+		direct,
+	}
+}
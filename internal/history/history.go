@@ -0,0 +1,222 @@
+package history
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sample is a single recorded commute time
+type Sample struct {
+	Timestamp time.Time
+	Duration  float64
+	// Provider that recorded the sample, empty in files predating the column
+	Provider string
+	// Origin and Destination are the labels of the pair of a matrix
+	// itinerary the sample is of, empty for other itineraries
+	Origin      string
+	Destination string
+	// Schedule that triggered the sample and the itinerary's tags at the
+	// time, empty in files predating the columns
+	Schedule string
+	Tags     []string
+	// Elements billed for the sample and their estimated cost, zero in
+	// files predating the columns
+	Elements int
+	Cost     float64
+	// Legs are the durations of the legs of a park-and-ride or carpool
+	// itinerary, in order, empty for other itineraries and in files
+	// predating the column
+	Legs []float64
+	// Direct is the duration of the trip of a carpool itinerary without its
+	// stops, zero when it was not fetched
+	Direct float64
+}
+
+// Stats summarizes a set of samples
+type Stats struct {
+	Count  int
+	Mean   float64
+	Min    float64
+	Max    float64
+	StdDev float64
+}
+
+// Load reads all samples from a CSV output file, laid out as its schema
+// says. A missing file yields no samples.
+func Load(path string) ([]Sample, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	schema, err := ReadSchema(path)
+	if err != nil {
+		return nil, err
+	}
+	l := layoutOf(schema)
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	var samples []Sample
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+		sample, ok := parseRecord(record, l)
+		if !ok {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
+}
+
+// parseRecord converts a CSV row laid out as l to a sample, reporting false
+// for rows without a valid timestamp and duration
+func parseRecord(record []string, l layout) (Sample, bool) {
+	timestamp, err := time.Parse(time.RFC3339, field(record, l.timestamp))
+	if err != nil {
+		return Sample{}, false
+	}
+	duration, err := strconv.ParseFloat(field(record, l.duration), 64)
+	if err != nil {
+		return Sample{}, false
+	}
+
+	sample := Sample{
+		Timestamp:   timestamp,
+		Duration:    duration,
+		Provider:    field(record, l.provider),
+		Origin:      field(record, l.origin),
+		Destination: field(record, l.destination),
+		Schedule:    field(record, l.schedule),
+	}
+	if tags := field(record, l.tags); tags != "" {
+		sample.Tags = strings.Split(tags, ";")
+	}
+	sample.Elements, _ = strconv.Atoi(field(record, l.elements))
+	sample.Cost, _ = strconv.ParseFloat(field(record, l.cost), 64)
+	if legs := field(record, l.legs); legs != "" {
+		for _, leg := range strings.Split(legs, ";") {
+			minutes, _ := strconv.ParseFloat(leg, 64)
+			sample.Legs = append(sample.Legs, minutes)
+		}
+	}
+	sample.Direct, _ = strconv.ParseFloat(field(record, l.direct), 64)
+	return sample, true
+}
+
+// Compute calculates summary statistics over samples
+func Compute(samples []Sample) Stats {
+	if len(samples) == 0 {
+		return Stats{}
+	}
+
+	stats := Stats{
+		Count: len(samples),
+		Min:   samples[0].Duration,
+		Max:   samples[0].Duration,
+	}
+
+	sum := 0.0
+	for _, s := range samples {
+		sum += s.Duration
+		stats.Min = min(stats.Min, s.Duration)
+		stats.Max = max(stats.Max, s.Duration)
+	}
+	stats.Mean = sum / float64(len(samples))
+
+	variance := 0.0
+	for _, s := range samples {
+		variance += (s.Duration - stats.Mean) * (s.Duration - stats.Mean)
+	}
+	stats.StdDev = math.Sqrt(variance / float64(len(samples)))
+
+	return stats
+}
+
+// Detour computes stats over the extra minutes samples took compared with
+// their direct trip, for the samples that recorded one
+func Detour(samples []Sample) Stats {
+	var detours []Sample
+	for _, s := range samples {
+		if s.Direct > 0 {
+			detours = append(detours, Sample{Timestamp: s.Timestamp, Duration: s.Duration - s.Direct})
+		}
+	}
+	return Compute(detours)
+}
+
+// PrimaryOnly returns the samples of primary, the provider an itinerary
+// comparing several is analyzed with. Samples of no provider in particular
+// are kept: rows predating the provider column and samples submitted by
+// external agents. An empty primary keeps every sample.
+func PrimaryOnly(samples []Sample, primary string) []Sample {
+	if primary == "" {
+		return samples
+	}
+	var own []Sample
+	for _, s := range samples {
+		if s.FromPrimary(primary) {
+			own = append(own, s)
+		}
+	}
+	return own
+}
+
+// FromPrimary reports whether a sample is kept by PrimaryOnly
+func (s Sample) FromPrimary(primary string) bool {
+	return primary == "" || s.Provider == primary || s.Provider == "" || s.Provider == ExternalProvider
+}
+
+// Baseline computes stats over samples taken on the same weekday as at in
+// previous weeks, within window of its time of day
+func Baseline(samples []Sample, at time.Time, window time.Duration) Stats {
+	target := minuteOfDay(at)
+	windowMin := int(window.Minutes())
+
+	var matching []Sample
+	for _, s := range samples {
+		// Skip today's samples, including the one being evaluated
+		if at.Sub(s.Timestamp) < 24*time.Hour {
+			continue
+		}
+
+		local := s.Timestamp.In(at.Location())
+		if local.Weekday() != at.Weekday() {
+			continue
+		}
+
+		diff := minuteOfDay(local) - target
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= windowMin {
+			matching = append(matching, s)
+		}
+	}
+
+	return Compute(matching)
+}
+
+// minuteOfDay returns minutes elapsed since midnight
+func minuteOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
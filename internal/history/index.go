@@ -0,0 +1,281 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// indexSuffix is appended to a history file's name to name its index
+	indexSuffix = ".idx"
+	// indexHeader starts index files, followed by the indexed size and the
+	// fingerprint of the history file
+	indexHeader = "gommutetime-index 1"
+	// blockRows is how many rows an index block covers
+	blockRows = 1024
+	// fingerprintSize is how much of the history file is checksummed to
+	// detect that it was replaced rather than appended to
+	fingerprintSize = 4096
+)
+
+// block is a run of complete rows and the range of their timestamps, in
+// Unix seconds rounded outwards. Rows need not be sorted.
+type block struct {
+	offset   int64
+	min, max int64
+}
+
+// index lists the blocks of a history file up to size. Rows after size,
+// fewer than blockRows, are always read.
+type index struct {
+	size        int64
+	fingerprint uint32
+	blocks      []block
+}
+
+// LoadRange reads the samples of a CSV output file taken from from
+// (inclusive) to to (exclusive). A zero from or to leaves that end open.
+func LoadRange(path string, from, to time.Time) ([]Sample, error) {
+	var samples []Sample
+	err := Scan(path, from, to, func(s Sample) error {
+		samples = append(samples, s)
+		return nil
+	})
+	return samples, err
+}
+
+// Scan calls fn with each sample of a CSV output file taken from from
+// (inclusive) to to (exclusive), in file order, stopping at the first error
+// fn returns. Rows are read as laid out by the file's schema. Only the parts
+// of the file that can hold such samples are read, located with an index
+// kept next to the file and updated as rows are appended. A missing file
+// yields no samples.
+func Scan(path string, from, to time.Time, fn func(Sample) error) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	idx, err := loadIndex(path, file, info.Size())
+	if err != nil {
+		return err
+	}
+	schema, err := ReadSchema(path)
+	if err != nil {
+		return err
+	}
+	l := layoutOf(schema)
+
+	inRange := func(s Sample) bool {
+		return !s.Timestamp.Before(from) && (to.IsZero() || s.Timestamp.Before(to))
+	}
+	for i, b := range idx.blocks {
+		if time.Unix(b.max, 0).Before(from) || (!to.IsZero() && !time.Unix(b.min, 0).Before(to)) {
+			continue
+		}
+		end := idx.size
+		if i+1 < len(idx.blocks) {
+			end = idx.blocks[i+1].offset
+		}
+		if err := scanSection(file, b.offset, end, l, inRange, fn); err != nil {
+			return err
+		}
+	}
+
+	return scanSection(file, idx.size, info.Size(), l, inRange, fn)
+}
+
+// scanSection calls fn with the samples between two offsets that match,
+// in rows laid out as l
+func scanSection(file *os.File, start, end int64, l layout, match func(Sample) bool, fn func(Sample) error) error {
+	reader := csv.NewReader(io.NewSectionReader(file, start, end-start))
+	reader.FieldsPerRecord = -1
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read history: %w", err)
+		}
+		sample, ok := parseRecord(record, l)
+		if !ok || !match(sample) {
+			continue
+		}
+		if err := fn(sample); err != nil {
+			return err
+		}
+	}
+}
+
+// loadIndex reads the index of the history file at path, rebuilding it if
+// the file was replaced and extending it over rows appended since. Changes
+// are saved when possible; an index that cannot be saved, e.g. in a
+// read-only data directory, is still used for this read.
+func loadIndex(path string, file *os.File, size int64) (*index, error) {
+	idx, err := readIndex(path + indexSuffix)
+	if err == nil && idx.size > size {
+		idx = nil
+	}
+	if idx != nil {
+		fingerprint, err := fingerprintOf(file, idx.size)
+		if err != nil {
+			return nil, err
+		}
+		if fingerprint != idx.fingerprint {
+			idx = nil
+		}
+	}
+	if idx == nil {
+		idx = &index{}
+	}
+
+	// Rows are longer than 16 bytes, so anything less cannot hold a new block
+	if size-idx.size < blockRows*16 {
+		return idx, nil
+	}
+	blocks, covered, err := buildBlocks(file, idx.size, size)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 {
+		return idx, nil
+	}
+	idx.blocks = append(idx.blocks, blocks...)
+	idx.size = covered
+	if idx.fingerprint, err = fingerprintOf(file, idx.size); err != nil {
+		return nil, err
+	}
+
+	writeIndex(path+indexSuffix, idx)
+	return idx, nil
+}
+
+// buildBlocks indexes the complete rows between start and end in blocks of
+// blockRows, returning the offset after the last full block
+func buildBlocks(file *os.File, start, end int64) ([]block, int64, error) {
+	reader := bufio.NewReader(io.NewSectionReader(file, start, end-start))
+
+	var blocks []block
+	current := block{offset: start, min: math.MaxInt64, max: math.MinInt64}
+	offset, rows := start, 0
+	for {
+		line, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// Overlong lines are read whole, and skipped by the reader
+			rest, err := reader.ReadBytes('\n')
+			line = append(append([]byte(nil), line...), rest...)
+			if err != nil {
+				break
+			}
+		} else if err != nil {
+			// A row still being written is left for the next read
+			if err != io.EOF {
+				return nil, 0, fmt.Errorf("failed to index history: %w", err)
+			}
+			break
+		}
+
+		offset += int64(len(line))
+		rows++
+		field, _, _ := bytes.Cut(line, []byte(","))
+		if t, err := time.Parse(time.RFC3339, string(field)); err == nil {
+			current.min = min(current.min, t.Unix())
+			// Rounded up so sub-second timestamps stay inside the range
+			upper := t.Unix()
+			if t.Nanosecond() > 0 {
+				upper++
+			}
+			current.max = max(current.max, upper)
+		}
+
+		if rows == blockRows {
+			blocks = append(blocks, current)
+			current = block{offset: offset, min: math.MaxInt64, max: math.MinInt64}
+			rows = 0
+		}
+	}
+
+	return blocks, current.offset, nil
+}
+
+// fingerprintOf checksums the start of the first size bytes of a file
+func fingerprintOf(file *os.File, size int64) (uint32, error) {
+	data := make([]byte, min(size, fingerprintSize))
+	if _, err := file.ReadAt(data, 0); err != nil {
+		return 0, fmt.Errorf("failed to read history: %w", err)
+	}
+	return crc32.ChecksumIEEE(data), nil
+}
+
+// readIndex parses an index file, returning an error if it is missing or
+// malformed
+func readIndex(path string) (*index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	rest, ok := strings.CutPrefix(lines[0], indexHeader+" ")
+	if !ok {
+		return nil, fmt.Errorf("unknown index format")
+	}
+	var idx index
+	if _, err := fmt.Sscanf(rest, "%d %x", &idx.size, &idx.fingerprint); err != nil {
+		return nil, fmt.Errorf("invalid index header: %w", err)
+	}
+
+	for _, line := range lines[1:] {
+		var b block
+		if _, err := fmt.Sscanf(line, "%d %d %d", &b.offset, &b.min, &b.max); err != nil {
+			return nil, fmt.Errorf("invalid index entry: %w", err)
+		}
+		idx.blocks = append(idx.blocks, b)
+	}
+
+	return &idx, nil
+}
+
+// writeIndex saves an index, replacing the file atomically. Failures are
+// ignored since the index can always be rebuilt.
+func writeIndex(path string, idx *index) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %d %08x\n", indexHeader, idx.size, idx.fingerprint)
+	for _, b := range idx.blocks {
+		fmt.Fprintf(&buf, "%d %d %d\n", b.offset, b.min, b.max)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".index-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	os.Rename(tmp.Name(), path)
+}
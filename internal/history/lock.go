@@ -0,0 +1,23 @@
+package history
+
+import "sync"
+
+// appends is held shared while rows are appended to history files and
+// exclusively while a snapshot records their sizes, so that snapshots only
+// see complete rows
+var appends sync.RWMutex
+
+// BeginAppend marks an append to a history file in progress, returning the
+// function ending it
+func BeginAppend() func() {
+	appends.RLock()
+	return appends.RUnlock
+}
+
+// Freeze waits for the appends in progress and holds back new ones until
+// the returned function is called. Callers should only record file sizes
+// or open files meanwhile.
+func Freeze() func() {
+	appends.Lock()
+	return appends.Unlock
+}
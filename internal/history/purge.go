@@ -0,0 +1,161 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Purge removes the rows of a CSV file whose first column is a time before
+// the cutoff, or all of them for a zero cutoff, returning how many were
+// removed and kept. Rows without a time are kept. The file is replaced
+// atomically, picking up rows appended while it was being rewritten and
+// holding back new ones until it is replaced, and its index is removed. A
+// missing file has nothing to purge.
+func Purge(path string, before time.Time) (removed, kept int, err error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Copy until the end of the file, then again for rows appended meanwhile,
+	// holding back appends for the last pass so that none are lost in the
+	// rename
+	out := bufio.NewWriter(tmp)
+	in := bufio.NewReader(file)
+	var partial []byte
+	var unfreeze func()
+	defer func() {
+		if unfreeze != nil {
+			unfreeze()
+		}
+	}()
+	for {
+		r, k, rest, err := filterRows(in, out, before, partial)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to purge %s: %w", path, err)
+		}
+		removed, kept, partial = removed+r, kept+k, rest
+
+		current, err := os.Stat(path)
+		if err != nil {
+			return 0, 0, err
+		}
+		offset, _ := file.Seek(0, io.SeekCurrent)
+		if current.Size() <= offset-int64(in.Buffered()) {
+			if unfreeze != nil {
+				break
+			}
+			unfreeze = Freeze()
+		}
+	}
+	// A final line without a newline is kept as is
+	if len(partial) > 0 {
+		if keep(partial, before) {
+			out.Write(partial)
+			kept++
+		} else {
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return 0, kept, nil
+	}
+	if err := out.Flush(); err != nil {
+		return 0, 0, fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return 0, 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, 0, fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, 0, fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	os.Remove(path + indexSuffix)
+	return removed, kept, nil
+}
+
+// CountBefore returns how many rows Purge would remove and keep
+func CountBefore(path string, before time.Time) (removed, kept int, err error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	removed, kept, partial, err := filterRows(bufio.NewReader(file), io.Discard, before, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(partial) > 0 {
+		if keep(partial, before) {
+			kept++
+		} else {
+			removed++
+		}
+	}
+	return removed, kept, nil
+}
+
+// filterRows copies the complete lines of in that are kept to out, starting
+// with a partial line left over from a previous call, and returns the
+// partial line at the end of in
+func filterRows(in *bufio.Reader, out io.Writer, before time.Time, partial []byte) (removed, kept int, rest []byte, err error) {
+	for {
+		line, err := in.ReadBytes('\n')
+		line = append(partial, line...)
+		partial = nil
+		if err == io.EOF {
+			return removed, kept, line, nil
+		}
+		if err != nil {
+			return 0, 0, nil, err
+		}
+
+		if keep(line, before) {
+			if _, err := out.Write(line); err != nil {
+				return 0, 0, nil, err
+			}
+			kept++
+		} else {
+			removed++
+		}
+	}
+}
+
+// keep reports whether a line survives a purge before the cutoff
+func keep(line []byte, before time.Time) bool {
+	if before.IsZero() {
+		return false
+	}
+	field, _, _ := bytes.Cut(bytes.TrimRight(line, "\r\n"), []byte(","))
+	at, err := time.Parse(time.RFC3339, string(field))
+	return err != nil || !at.Before(before)
+}
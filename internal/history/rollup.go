@@ -0,0 +1,234 @@
+package history
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resolutions of rollups and aggregate series
+const (
+	ResolutionHour = "hour"
+	ResolutionDay  = "day"
+)
+
+// Aggregate summarizes the samples of an hour or day taken by one schedule
+// and provider, replacing them once rolled up
+type Aggregate struct {
+	// Period is the start of the hour or day, in the local time the samples
+	// were written with
+	Period     time.Time
+	Resolution string
+	Stats      Stats
+	Provider   string
+	Schedule   string
+	// RolledBefore is the cutoff of the rollup that made the aggregate:
+	// every sample before it was rolled up
+	RolledBefore time.Time
+}
+
+// RollupFile returns the file storing the rollups of an output file, e.g.
+// work.rollup.csv for work.csv
+func RollupFile(path string) string {
+	return strings.TrimSuffix(path, ".csv") + ".rollup.csv"
+}
+
+// LoadAggregates reads the aggregates of a rollup file. A missing file
+// yields no aggregates.
+func LoadAggregates(path string) ([]Aggregate, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rollups: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	var aggregates []Aggregate
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rollups: %w", err)
+		}
+		if a, ok := parseAggregate(record); ok {
+			aggregates = append(aggregates, a)
+		}
+	}
+	return aggregates, nil
+}
+
+// parseAggregate converts a rollup row to an aggregate:
+// period,resolution,count,mean,min,max,stddev,provider,schedule,rolled_before
+func parseAggregate(record []string) (Aggregate, bool) {
+	if len(record) < 10 {
+		return Aggregate{}, false
+	}
+
+	var a Aggregate
+	var err error
+	if a.Period, err = time.Parse(time.RFC3339, record[0]); err != nil {
+		return Aggregate{}, false
+	}
+	if a.RolledBefore, err = time.Parse(time.RFC3339, record[9]); err != nil {
+		return Aggregate{}, false
+	}
+	a.Resolution = record[1]
+	if a.Stats.Count, err = strconv.Atoi(record[2]); err != nil || a.Stats.Count <= 0 {
+		return Aggregate{}, false
+	}
+	for i, field := range []*float64{&a.Stats.Mean, &a.Stats.Min, &a.Stats.Max, &a.Stats.StdDev} {
+		if *field, err = strconv.ParseFloat(record[3+i], 64); err != nil {
+			return Aggregate{}, false
+		}
+	}
+	a.Provider, a.Schedule = record[7], record[8]
+	return a, true
+}
+
+// Merge combines the statistics of two sets of samples, with the
+// population standard deviation like Compute
+func Merge(a, b Stats) Stats {
+	if a.Count == 0 {
+		return b
+	}
+	if b.Count == 0 {
+		return a
+	}
+
+	n := float64(a.Count + b.Count)
+	delta := b.Mean - a.Mean
+	mean := a.Mean + delta*float64(b.Count)/n
+	m2 := a.StdDev*a.StdDev*float64(a.Count) + b.StdDev*b.StdDev*float64(b.Count) +
+		delta*delta*float64(a.Count)*float64(b.Count)/n
+	return Stats{
+		Count:  a.Count + b.Count,
+		Mean:   mean,
+		Min:    min(a.Min, b.Min),
+		Max:    max(a.Max, b.Max),
+		StdDev: math.Sqrt(m2 / n),
+	}
+}
+
+// Rollup replaces the samples of a CSV output file taken before the cutoff
+// with aggregates per hour or day, appended to its rollup file, and returns
+// how many samples were rolled up. Samples left behind by an interrupted
+// rollup, already aggregated, are removed without being counted twice.
+func Rollup(path string, before time.Time, resolution string) (int, error) {
+	rollupPath := RollupFile(path)
+	rolled, err := RolledBefore(path)
+	if err != nil {
+		return 0, err
+	}
+	if !rolled.IsZero() {
+		if !before.After(rolled) {
+			return 0, nil
+		}
+		if _, _, err := Purge(path, rolled); err != nil {
+			return 0, err
+		}
+	}
+
+	type key struct {
+		period             string
+		provider, schedule string
+	}
+	totals := make(map[key]*Aggregate)
+	err = Scan(path, rolled, before, func(s Sample) error {
+		period := Truncate(s.Timestamp, resolution)
+		k := key{period.Format(time.RFC3339), s.Provider, s.Schedule}
+		a := totals[k]
+		if a == nil {
+			a = &Aggregate{Period: period, Resolution: resolution, Provider: s.Provider, Schedule: s.Schedule}
+			totals[k] = a
+		}
+		a.Stats = Merge(a.Stats, Stats{Count: 1, Mean: s.Duration, Min: s.Duration, Max: s.Duration})
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(totals) == 0 {
+		return 0, nil
+	}
+
+	aggregates := make([]*Aggregate, 0, len(totals))
+	samples := 0
+	for _, a := range totals {
+		a.RolledBefore = before
+		aggregates = append(aggregates, a)
+		samples += a.Stats.Count
+	}
+	slices.SortFunc(aggregates, func(a, b *Aggregate) int {
+		return cmp.Or(a.Period.Compare(b.Period), cmp.Compare(a.Schedule, b.Schedule), cmp.Compare(a.Provider, b.Provider))
+	})
+	if err := appendAggregates(rollupPath, aggregates); err != nil {
+		return 0, err
+	}
+
+	if _, _, err := Purge(path, before); err != nil {
+		return 0, err
+	}
+	return samples, nil
+}
+
+// RolledBefore returns the cutoff of the last rollup of a CSV output file:
+// its samples from before it are only in the rollup file. It is zero when
+// nothing was rolled up.
+func RolledBefore(path string) (time.Time, error) {
+	aggregates, err := LoadAggregates(RollupFile(path))
+	if err != nil {
+		return time.Time{}, err
+	}
+	var rolled time.Time
+	for _, a := range aggregates {
+		if a.RolledBefore.After(rolled) {
+			rolled = a.RolledBefore
+		}
+	}
+	return rolled, nil
+}
+
+// appendAggregates adds aggregates to a rollup file
+func appendAggregates(path string, aggregates []*Aggregate) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open rollups: %w", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	for _, a := range aggregates {
+		w.Write([]string{
+			a.Period.Format(time.RFC3339),
+			a.Resolution,
+			strconv.Itoa(a.Stats.Count),
+			fmt.Sprintf("%f", a.Stats.Mean),
+			fmt.Sprintf("%f", a.Stats.Min),
+			fmt.Sprintf("%f", a.Stats.Max),
+			fmt.Sprintf("%f", a.Stats.StdDev),
+			a.Provider,
+			a.Schedule,
+			a.RolledBefore.Format(time.RFC3339),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write rollups: %w", err)
+	}
+	return file.Close()
+}
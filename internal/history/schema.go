@@ -0,0 +1,265 @@
+package history
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// SchemaVersion is the version of the layout of the output files written
+// by this build
+const SchemaVersion = 7
+
+// legacyVersion is the layout of output files without a schema file, which
+// predate them: version 5 or, in older rows, a prefix of it
+const legacyVersion = 5
+
+// schemaSuffix is appended to an output file's name to name its schema file
+const schemaSuffix = ".schema.json"
+
+// schemas lists the columns of output files by version. Rows written before
+// columns were appended hold a prefix of them. The timestamp stays first,
+// which indexes and purges rely on.
+var schemas = map[int][]string{
+	1: {"timestamp", "duration"},
+	2: {"timestamp", "duration", "latency_ms", "http_status", "status", "provider"},
+	3: {"timestamp", "duration", "latency_ms", "http_status", "status", "provider", "origin", "destination"},
+	4: {"timestamp", "duration", "latency_ms", "http_status", "status", "provider", "origin", "destination",
+		"schedule", "tags"},
+	5: {"timestamp", "duration", "latency_ms", "http_status", "status", "provider", "origin", "destination",
+		"schedule", "tags", "elements", "cost"},
+	6: {"timestamp", "duration", "latency_ms", "http_status", "status", "provider", "origin", "destination",
+		"schedule", "tags", "elements", "cost", "legs"},
+	7: {"timestamp", "duration", "latency_ms", "http_status", "status", "provider", "origin", "destination",
+		"schedule", "tags", "elements", "cost", "legs", "direct"},
+}
+
+// Schema describes the layout of an output file, stored next to it so that
+// readers and later versions know how its rows were written
+type Schema struct {
+	Version int      `json:"version"`
+	Columns []string `json:"columns"`
+}
+
+// CurrentSchema returns the schema of the output files written by this build
+func CurrentSchema() Schema {
+	return Schema{Version: SchemaVersion, Columns: schemas[SchemaVersion]}
+}
+
+// SchemaFile returns the schema file of an output file, e.g.
+// work.csv.schema.json for work.csv
+func SchemaFile(path string) string {
+	return path + schemaSuffix
+}
+
+// ReadSchema returns the schema of an output file. Files without a schema
+// file have the legacy layout.
+func ReadSchema(path string) (Schema, error) {
+	data, err := os.ReadFile(SchemaFile(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return Schema{Version: legacyVersion, Columns: schemas[legacyVersion]}, nil
+	}
+	if err != nil {
+		return Schema{}, fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return Schema{}, fmt.Errorf("invalid schema %s: %w", SchemaFile(path), err)
+	}
+	if schema.Version > SchemaVersion {
+		return Schema{}, fmt.Errorf("%s was written by a newer version (schema %d, this build reads up to %d)", path, schema.Version, SchemaVersion)
+	}
+	if len(schema.Columns) == 0 {
+		schema.Columns = schemas[schema.Version]
+	}
+	if len(schema.Columns) == 0 {
+		return Schema{}, fmt.Errorf("invalid schema %s: unknown version %d", SchemaFile(path), schema.Version)
+	}
+	return schema, nil
+}
+
+var (
+	// schemaMu serializes schema checks, so that a migration runs once
+	schemaMu sync.Mutex
+	// current holds the output files known to have the current schema
+	current sync.Map
+)
+
+// EnsureSchema prepares an output file for rows of the current schema,
+// before they are appended. A new file gets a schema file. A file of an
+// older version is migrated: when its columns are a prefix of the current
+// ones its rows are read as they are and only the schema file is updated,
+// otherwise its rows are rewritten with the columns moved to their new
+// place, by name.
+func EnsureSchema(path string) error {
+	if _, ok := current.Load(path); ok {
+		return nil
+	}
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+	if _, ok := current.Load(path); ok {
+		return nil
+	}
+
+	schema, err := ReadSchema(path)
+	if err != nil {
+		return err
+	}
+	_, statErr := os.Stat(SchemaFile(path))
+	if schema.Version == SchemaVersion && statErr == nil {
+		current.Store(path, true)
+		return nil
+	}
+
+	latest := CurrentSchema()
+	if !isPrefix(schema.Columns, latest.Columns) {
+		if err := migrate(path, schema, latest); err != nil {
+			return err
+		}
+	}
+	if err := writeSchema(path, latest); err != nil {
+		return err
+	}
+	current.Store(path, true)
+	return nil
+}
+
+// isPrefix reports whether columns are the first columns of latest
+func isPrefix(columns, latest []string) bool {
+	return len(columns) <= len(latest) && slices.Equal(columns, latest[:len(columns)])
+}
+
+// writeSchema writes the schema file of an output file
+func writeSchema(path string, schema Schema) error {
+	data, _ := json.MarshalIndent(schema, "", "  ")
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".schema-*")
+	if err != nil {
+		return fmt.Errorf("failed to write schema: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), SchemaFile(path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write schema: %w", err)
+	}
+	return nil
+}
+
+// migrate rewrites the rows of an output file from one schema to another,
+// moving columns by name and leaving new ones empty. The file is replaced
+// atomically and its index removed; appends are held back meanwhile.
+func migrate(path string, from, to Schema) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	unfreeze := Freeze()
+	defer unfreeze()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// sources[i] is the column of old rows holding column i of new ones
+	sources := make([]int, len(to.Columns))
+	for i, name := range to.Columns {
+		sources[i] = slices.Index(from.Columns, name)
+	}
+
+	reader := csv.NewReader(bufio.NewReader(file))
+	reader.FieldsPerRecord = -1
+	out := bufio.NewWriter(tmp)
+	w := csv.NewWriter(out)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", path, err)
+		}
+		row := make([]string, len(to.Columns))
+		for i, src := range sources {
+			if src >= 0 && src < len(record) {
+				row[i] = record[src]
+			}
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	os.Remove(path + indexSuffix)
+	return nil
+}
+
+// layout locates the fields of samples in the rows of an output file, -1
+// for fields it lacks
+type layout struct {
+	timestamp, duration, provider, origin, destination, schedule, tags, elements, cost, legs, direct int
+}
+
+// layoutOf returns the layout of rows with the columns of a schema
+func layoutOf(schema Schema) layout {
+	col := func(name string) int { return slices.Index(schema.Columns, name) }
+	return layout{
+		timestamp:   col("timestamp"),
+		duration:    col("duration"),
+		provider:    col("provider"),
+		origin:      col("origin"),
+		destination: col("destination"),
+		schedule:    col("schedule"),
+		tags:        col("tags"),
+		elements:    col("elements"),
+		cost:        col("cost"),
+		legs:        col("legs"),
+		direct:      col("direct"),
+	}
+}
+
+// field returns column i of a row, empty when the row lacks it
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
@@ -0,0 +1,147 @@
+package history
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point is a period of an aggregate series
+type Point struct {
+	// Period is the start of the hour or day, in the local time the samples
+	// were written with
+	Period time.Time
+	Stats  Stats
+}
+
+// SeriesFile returns the file storing the hourly or daily series of an
+// output file, e.g. work.hourly.csv or work.daily.csv for work.csv
+func SeriesFile(path, resolution string) string {
+	suffix := ".hourly.csv"
+	if resolution == ResolutionDay {
+		suffix = ".daily.csv"
+	}
+	return strings.TrimSuffix(path, ".csv") + suffix
+}
+
+// Truncate returns the start of the hour or day of t, in its own location
+func Truncate(t time.Time, resolution string) time.Time {
+	hour := t.Hour()
+	if resolution == ResolutionDay {
+		hour = 0
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, t.Location())
+}
+
+// PeriodEnd returns the end of the hour or day starting at period
+func PeriodEnd(period time.Time, resolution string) time.Time {
+	if resolution == ResolutionDay {
+		return period.AddDate(0, 0, 1)
+	}
+	return period.Add(time.Hour)
+}
+
+// LoadSeries reads the points of a series file whose period starts from
+// from (inclusive) to to (exclusive). A zero from or to leaves that end
+// open, and a missing file yields no points.
+func LoadSeries(path string, from, to time.Time) ([]Point, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open series: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	var points []Point
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read series: %w", err)
+		}
+		p, ok := parsePoint(record)
+		if !ok || p.Period.Before(from) || (!to.IsZero() && !p.Period.Before(to)) {
+			continue
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// parsePoint converts a series row to a point:
+// period,count,mean,min,max,stddev
+func parsePoint(record []string) (Point, bool) {
+	if len(record) < 6 {
+		return Point{}, false
+	}
+
+	var p Point
+	var err error
+	if p.Period, err = time.Parse(time.RFC3339, record[0]); err != nil {
+		return Point{}, false
+	}
+	if p.Stats.Count, err = strconv.Atoi(record[1]); err != nil || p.Stats.Count <= 0 {
+		return Point{}, false
+	}
+	for i, field := range []*float64{&p.Stats.Mean, &p.Stats.Min, &p.Stats.Max, &p.Stats.StdDev} {
+		if *field, err = strconv.ParseFloat(record[2+i], 64); err != nil {
+			return Point{}, false
+		}
+	}
+	return p, true
+}
+
+// AppendSeries adds points to a series file
+func AppendSeries(path string, points []Point) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open series: %w", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	for _, p := range points {
+		w.Write([]string{
+			p.Period.Format(time.RFC3339),
+			strconv.Itoa(p.Stats.Count),
+			fmt.Sprintf("%f", p.Stats.Mean),
+			fmt.Sprintf("%f", p.Stats.Min),
+			fmt.Sprintf("%f", p.Stats.Max),
+			fmt.Sprintf("%f", p.Stats.StdDev),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write series: %w", err)
+	}
+	return file.Close()
+}
+
+// AggregateRange computes the points of the samples of a CSV output file taken
+// from from (inclusive) to to (exclusive), in time order
+func AggregateRange(path string, from, to time.Time, resolution string) ([]Point, error) {
+	var points []Point
+	err := Scan(path, from, to, func(s Sample) error {
+		period := Truncate(s.Timestamp, resolution)
+		single := Stats{Count: 1, Mean: s.Duration, Min: s.Duration, Max: s.Duration}
+		if n := len(points); n > 0 && points[n-1].Period.Equal(period) {
+			points[n-1].Stats = Merge(points[n-1].Stats, single)
+			return nil
+		}
+		points = append(points, Point{Period: period, Stats: single})
+		return nil
+	})
+	return points, err
+}
@@ -0,0 +1,171 @@
+// Package ical reads and writes the events of iCalendar (RFC 5545) files,
+// as exported by calendar apps and school websites. Only what commutes need
+// is supported: the start, end, summary and description of events.
+// Recurring events only count their first occurrence.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is a calendar event
+type Event struct {
+	// UID identifies the event across updates of a feed
+	UID         string
+	Summary     string
+	Description string
+	// Start and End bound the event, End excluded. All-day events start
+	// and end at local midnight.
+	Start time.Time
+	End   time.Time
+	// AllDay is true for events spanning whole days rather than times
+	AllDay bool
+}
+
+// Days returns the local midnights of the days the event covers
+func (e Event) Days() []time.Time {
+	first := midnight(e.Start)
+	var days []time.Time
+	for day := first; day.Before(e.End) || day.Equal(first); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// Parse reads the events of an iCalendar stream
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var event *Event
+	for i, line := range lines {
+		name, params, value, ok := property(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event = &Event{}
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if event == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN", i+1)
+			}
+			if event.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: event %q has no DTSTART", i+1, event.Summary)
+			}
+			if event.End.IsZero() {
+				// Without an end, all-day events last a day and others an instant
+				event.End = event.Start
+				if event.AllDay {
+					event.End = event.Start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, *event)
+			event = nil
+		case event == nil:
+			continue
+		case name == "UID":
+			event.UID = value
+		case name == "SUMMARY":
+			event.Summary = unescape(value)
+		case name == "DESCRIPTION":
+			event.Description = unescape(value)
+		case name == "DTSTART", name == "DTEND":
+			t, allDay, err := parseTime(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", i+1, name, err)
+			}
+			if name == "DTSTART" {
+				event.Start, event.AllDay = t, allDay
+			} else {
+				event.End = t
+			}
+		}
+	}
+	return events, nil
+}
+
+// unfold reads the content lines of a stream, joining the lines folded onto
+// the next ones with a leading space or tab
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	return lines, nil
+}
+
+// property splits a content line like DTSTART;TZID=Europe/Paris:20260105T080000
+// into its upper-cased name, its parameters and its value
+func property(line string) (name string, params map[string]string, value string, ok bool) {
+	head, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", nil, "", false
+	}
+	parts := strings.Split(head, ";")
+	params = make(map[string]string, len(parts)-1)
+	for _, param := range parts[1:] {
+		key, val, _ := strings.Cut(param, "=")
+		params[strings.ToUpper(key)] = strings.Trim(val, `"`)
+	}
+	return strings.ToUpper(parts[0]), params, value, true
+}
+
+// parseTime parses a DATE or DATE-TIME value, in UTC with a Z suffix, in
+// its TZID or else in local time, reporting whether it is a date
+func parseTime(value string, params map[string]string) (time.Time, bool, error) {
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, time.Local)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid date %q", value)
+		}
+		return t, true, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid time %q", value)
+		}
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid time %q", value)
+	}
+	return t, false, nil
+}
+
+// unescape decodes the escaped characters of a text value
+func unescape(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// midnight returns the start of the local day of t
+func midnight(t time.Time) time.Time {
+	local := t.Local()
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,78 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxLineOctets is the length content lines are folded at
+const maxLineOctets = 75
+
+// Write writes events as an iCalendar stream named name, as published
+// feeds that calendar apps subscribe to. Events without a UID are given one
+// from their start, so they are only unique per start.
+func Write(w io.Writer, name string, events []Event) error {
+	b := bufio.NewWriter(w)
+	line := func(s string) { writeLine(b, s) }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//gommutetime//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + escape(name))
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, e := range events {
+		uid := e.UID
+		if uid == "" {
+			uid = e.Start.UTC().Format("20060102T150405Z") + "@gommutetime"
+		}
+		line("BEGIN:VEVENT")
+		line("UID:" + uid)
+		line("DTSTAMP:" + stamp)
+		if e.AllDay {
+			line("DTSTART;VALUE=DATE:" + e.Start.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + e.End.Format("20060102"))
+		} else {
+			line("DTSTART:" + e.Start.UTC().Format("20060102T150405Z"))
+			line("DTEND:" + e.End.UTC().Format("20060102T150405Z"))
+		}
+		line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + escape(e.Description))
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.Flush()
+}
+
+// writeLine writes a content line ending with CRLF, folded onto the next
+// lines with a leading space when longer than maxLineOctets, between
+// characters
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8Start(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// The leading space counts towards the next line
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(line + "\r\n")
+}
+
+// utf8Start reports whether b starts a UTF-8 encoded character
+func utf8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// escape encodes the characters of a text value that must be escaped
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(value)
+}
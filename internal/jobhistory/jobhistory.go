@@ -0,0 +1,219 @@
+// Package jobhistory keeps the latest runs of the scheduler's jobs in a
+// JSON lines file of the data directory, apart from the samples they
+// record. When a commute is missing from the data, the history tells
+// whether its job ran at all, when, and why it failed.
+package jobhistory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/scheduler"
+)
+
+// Run is a finished run of a job
+type Run struct {
+	// Job is the name of the job, e.g. work-morning-07:30
+	Job       string    `json:"job"`
+	Itinerary string    `json:"itinerary"`
+	Schedule  string    `json:"schedule"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	// Outcome is scheduler.JobSucceeded or scheduler.JobFailed
+	Outcome string `json:"outcome"`
+	// Error is why the run failed, and Failures how many fetches of the
+	// itinerary failed in a row
+	Error    string `json:"error,omitempty"`
+	Failures int    `json:"failures,omitempty"`
+	// FailedPairs counts the pairs of a matrix fetch that failed while
+	// others succeeded
+	FailedPairs int `json:"failed_pairs,omitempty"`
+}
+
+// Duration returns how long the run took
+func (r Run) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// Load reads the runs in path, oldest first. A missing file has none.
+// Lines that cannot be decoded, such as one cut short by a crash, are
+// skipped.
+func Load(path string) ([]Run, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to read job history: %w", err))
+	}
+	defer file.Close()
+
+	var runs []Run
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to read job history: %w", err))
+	}
+	return runs, nil
+}
+
+// Select returns the latest runs of an itinerary with an outcome, newest
+// first and at most limit of them. Empty itinerary and outcome match any
+// run, and a limit of zero returns them all.
+func Select(runs []Run, itinerary, outcome string, limit int) []Run {
+	var selected []Run
+	for _, run := range slices.Backward(runs) {
+		if (itinerary != "" && run.Itinerary != itinerary) || (outcome != "" && run.Outcome != outcome) {
+			continue
+		}
+		selected = append(selected, run)
+		if limit > 0 && len(selected) == limit {
+			break
+		}
+	}
+	return selected
+}
+
+// Recorder appends the finished runs of the scheduler's jobs to the job
+// history. Skipped runs are left out: dense sampling and shift jobs check
+// every minute whether they are due, and would soon push out every other
+// run.
+type Recorder struct {
+	mu  sync.Mutex
+	cfg *config.Config
+	// started is when the running jobs started, by name
+	started map[string]time.Time
+	// path is the file lines counts the runs of, which is rewritten with
+	// the latest ones once it holds twice as many as are kept
+	path  string
+	lines int
+}
+
+// New creates a recorder for the job history of cfg
+func New(cfg *config.Config) *Recorder {
+	return &Recorder{cfg: cfg, started: make(map[string]time.Time)}
+}
+
+// Reload switches to a new config
+func (r *Recorder) Reload(cfg *config.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cfg = cfg
+}
+
+// Job records the events of a job run, for scheduler.OnJob
+func (r *Recorder) Job(_ context.Context, e scheduler.JobEvent) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch e.Kind {
+	case scheduler.JobStarted:
+		r.started[e.Job] = now
+		return
+	case scheduler.JobSkipped:
+		delete(r.started, e.Job)
+		return
+	}
+
+	run := Run{Job: e.Job, Itinerary: e.Itinerary.ID, Schedule: e.Schedule, Start: now, End: now,
+		Outcome: e.Kind, Failures: e.Failures, FailedPairs: e.FailedPairs}
+	if start, ok := r.started[e.Job]; ok {
+		run.Start = start
+		delete(r.started, e.Job)
+	}
+	if e.Err != nil {
+		run.Error = e.Err.Error()
+	}
+	if err := r.append(run); err != nil {
+		log.Printf("Warning: failed to record run of %s: %v", e.Job, err)
+	}
+}
+
+// append writes a run as one JSON line, trimming the file once it holds
+// twice as many runs as are kept
+func (r *Recorder) append(run Run) error {
+	path := r.cfg.JobHistoryPath()
+	if path == "" {
+		return nil
+	}
+	if path != r.path {
+		runs, err := Load(path)
+		if err != nil {
+			return err
+		}
+		r.path, r.lines = path, len(runs)
+	}
+
+	line, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode job run: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to open job history: %w", err))
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write job history: %w", err))
+	}
+	r.lines++
+
+	if keep := r.cfg.JobRuns(); r.lines > 2*keep {
+		if err := trim(path, keep); err != nil {
+			return err
+		}
+		r.lines = keep
+	}
+	return nil
+}
+
+// trim replaces the job history in path with its latest keep runs once
+// the new file is complete
+func trim(path string, keep int) error {
+	runs, err := Load(path)
+	if err != nil {
+		return err
+	}
+	if len(runs) > keep {
+		runs = runs[len(runs)-keep:]
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, run := range runs {
+		if err := enc.Encode(run); err != nil {
+			return fmt.Errorf("failed to encode job run: %w", err)
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to trim job history: %w", err))
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to trim job history: %w", err))
+	}
+	return nil
+}
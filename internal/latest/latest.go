@@ -0,0 +1,153 @@
+// Package latest keeps the latest sample of each itinerary in Redis, for
+// other services to read the current commute with a single GET:
+//
+//	gommutetime:work          the sample as the JSON message sent to plugins
+//	gommutetime:work:minutes  its duration in minutes, e.g. 31.5
+//
+// Both keys expire after redis.ttl_seconds, so a missing key means the
+// commute is not known anymore. They hold samples of the primary provider of
+// itineraries comparing several, and matrix itineraries have none. Every
+// sample can also be added to a Redis stream, with the itinerary ID and
+// message as fields.
+package latest
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/events"
+	"gommutetime/internal/plugin"
+)
+
+// queueSize is how many samples may wait for a slow server before new ones
+// are dropped
+const queueSize = 1000
+
+// timeout bounds each write, so an unreachable server does not hold up the
+// next samples for long
+const timeout = 5 * time.Second
+
+// Writer writes the samples of the daemon to Redis
+type Writer struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	worker *worker
+}
+
+// New starts writing samples to the Redis server of a config until ctx is
+// done
+func New(ctx context.Context, cfg *config.Config) *Writer {
+	w := &Writer{ctx: ctx}
+	w.Reload(cfg)
+	return w
+}
+
+// Reload writes to the Redis server of a new config. Samples queued for the
+// old one are still written.
+func (w *Writer) Reload(cfg *config.Config) {
+	var next *worker
+	if cfg.Redis.URL != "" {
+		opts, err := redis.ParseURL(cfg.Redis.URL)
+		if err != nil {
+			log.Printf("ERROR: invalid Redis URL, samples are not written to Redis: %v", err)
+		} else {
+			next = &worker{cfg: cfg.Redis, client: redis.NewClient(opts), queue: make(chan sample, queueSize)}
+			go next.run(w.ctx)
+		}
+	}
+
+	w.mu.Lock()
+	old := w.worker
+	w.worker = next
+	w.mu.Unlock()
+	if old != nil {
+		close(old.queue)
+	}
+}
+
+// Record queues a recorded sample, dropping it when the server is too far
+// behind
+func (w *Writer) Record(_ context.Context, e events.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.worker == nil {
+		return
+	}
+
+	data, err := json.Marshal(plugin.NewMessage(e))
+	if err != nil {
+		log.Printf("ERROR encoding sample for Redis: %v", err)
+		return
+	}
+	latest := e.Sample.Origin == "" && e.Sample.FromPrimary(e.Itinerary.PrimaryProvider())
+	select {
+	case w.worker.queue <- sample{itinerary: e.Itinerary.ID, minutes: e.Sample.Duration, data: data, latest: latest}:
+	default:
+		log.Printf("Warning: Redis is behind, dropped a sample of %s", e.Itinerary.ID)
+	}
+}
+
+// sample is an encoded sample of an itinerary, the latest one of the
+// itinerary as a whole unless it is of another provider or a matrix pair
+type sample struct {
+	itinerary string
+	minutes   float64
+	data      []byte
+	latest    bool
+}
+
+// worker writes the queued samples to a server in order
+type worker struct {
+	cfg    config.RedisConfig
+	client *redis.Client
+	queue  chan sample
+}
+
+// run writes queued samples until the queue is closed or ctx is done
+func (w *worker) run(ctx context.Context) {
+	defer w.client.Close()
+	for {
+		select {
+		case s, ok := <-w.queue:
+			if !ok {
+				return
+			}
+			if err := w.write(ctx, s); err != nil {
+				log.Printf("ERROR writing sample of %s to Redis: %v", s.itinerary, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// write sets the keys of a sample's itinerary and adds it to the stream
+func (w *worker) write(ctx context.Context, s sample) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	key := w.cfg.Prefix() + s.itinerary
+	_, err := w.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if s.latest {
+			pipe.Set(ctx, key, s.data, w.cfg.TTL())
+			pipe.Set(ctx, key+":minutes", strconv.FormatFloat(s.minutes, 'f', -1, 64), w.cfg.TTL())
+		}
+		if w.cfg.Stream != "" {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: w.cfg.Stream,
+				MaxLen: w.cfg.MaxLen(),
+				Approx: true,
+				Values: []any{"itinerary", s.itinerary, "message", s.data},
+			})
+		}
+		return nil
+	})
+	return err
+}
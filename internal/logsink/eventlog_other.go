@@ -0,0 +1,13 @@
+//go:build !windows
+
+package logsink
+
+import (
+	"errors"
+	"io"
+)
+
+// OpenEventLog fails: the event log only exists on Windows
+func OpenEventLog(string) (io.WriteCloser, error) {
+	return nil, errors.New("the event log is only available on Windows; use syslog elsewhere")
+}
@@ -0,0 +1,47 @@
+//go:build windows
+
+package logsink
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// OpenEventLog opens the Windows Event Log as source, which should be
+// registered, e.g. by installing the service
+func OpenEventLog(source string) (io.WriteCloser, error) {
+	elog, err := eventlog.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	return eventLogWriter{elog}, nil
+}
+
+// eventLogWriter sends log lines to the Windows event log, as errors or
+// warnings when they say so
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+// Write implements io.Writer
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	var err error
+	switch severity(msg) {
+	case severityError:
+		err = w.elog.Error(1, msg)
+	case severityWarning:
+		err = w.elog.Warning(1, msg)
+	default:
+		err = w.elog.Info(1, msg)
+	}
+	return len(p), err
+}
+
+// Close implements io.Closer
+func (w eventLogWriter) Close() error {
+	return w.elog.Close()
+}
@@ -0,0 +1,64 @@
+// Package logsink sends the log to syslog or the Windows Event Log instead
+// of standard error, for machines whose logs are collected centrally
+package logsink
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"gommutetime/internal/config"
+)
+
+// defaultName is the syslog tag and event log source unless configured
+// otherwise
+const defaultName = "gommutetime"
+
+// Severities of log lines
+const (
+	severityInfo = iota
+	severityWarning
+	severityError
+)
+
+// severity classifies a log line: errors carry ERROR or an error_kind,
+// warnings start with Warning
+func severity(msg string) int {
+	switch {
+	case strings.Contains(msg, "ERROR") || strings.Contains(msg, "error_kind="):
+		return severityError
+	case strings.Contains(msg, "Warning"):
+		return severityWarning
+	}
+	return severityInfo
+}
+
+// Setup redirects the standard logger to the configured output, returning
+// a function closing it. Standard error needs nothing.
+func Setup(cfg config.LoggingConfig) (func() error, error) {
+	var w io.WriteCloser
+	var err error
+	switch cfg.Output {
+	case "", config.LogStderr:
+		return func() error { return nil }, nil
+	case config.LogSyslog:
+		w, err = openSyslog(cfg.Syslog)
+	case config.LogEventLog:
+		source := cfg.EventLogSource
+		if source == "" {
+			source = defaultName
+		}
+		w, err = OpenEventLog(source)
+	default:
+		err = fmt.Errorf("unknown output %s", cfg.Output)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Both add their own timestamps
+	log.SetFlags(0)
+	log.SetOutput(w)
+	return w.Close, nil
+}
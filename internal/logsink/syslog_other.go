@@ -0,0 +1,15 @@
+//go:build windows || plan9
+
+package logsink
+
+import (
+	"errors"
+	"io"
+
+	"gommutetime/internal/config"
+)
+
+// openSyslog fails: Go has no syslog client on this platform
+func openSyslog(config.SyslogConfig) (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not available on this platform; use the event log on Windows")
+}
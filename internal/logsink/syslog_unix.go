@@ -0,0 +1,71 @@
+//go:build !windows && !plan9
+
+package logsink
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"strings"
+
+	"gommutetime/internal/config"
+)
+
+// facilities maps the facility names of the config to syslog priorities
+var facilities = map[string]syslog.Priority{
+	"kern": syslog.LOG_KERN, "user": syslog.LOG_USER, "mail": syslog.LOG_MAIL,
+	"daemon": syslog.LOG_DAEMON, "auth": syslog.LOG_AUTH, "syslog": syslog.LOG_SYSLOG,
+	"lpr": syslog.LOG_LPR, "news": syslog.LOG_NEWS, "uucp": syslog.LOG_UUCP,
+	"cron": syslog.LOG_CRON, "authpriv": syslog.LOG_AUTHPRIV, "ftp": syslog.LOG_FTP,
+	"local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3, "local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+// openSyslog connects to the local syslog daemon, or to a remote one at
+// udp://host:port or tcp://host:port
+func openSyslog(cfg config.SyslogConfig) (io.WriteCloser, error) {
+	facility := syslog.LOG_DAEMON
+	if cfg.Facility != "" {
+		facility = facilities[cfg.Facility]
+	}
+	tag := cfg.Tag
+	if tag == "" {
+		tag = defaultName
+	}
+
+	var network, address string
+	if cfg.Address != "" {
+		network, address, _ = strings.Cut(cfg.Address, "://")
+	}
+	w, err := syslog.Dial(network, address, facility|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return syslogWriter{w}, nil
+}
+
+// syslogWriter sends log lines to syslog at the severity they say
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+// Write implements io.Writer
+func (s syslogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	var err error
+	switch severity(msg) {
+	case severityError:
+		err = s.w.Err(msg)
+	case severityWarning:
+		err = s.w.Warning(msg)
+	default:
+		err = s.w.Info(msg)
+	}
+	return len(p), err
+}
+
+// Close implements io.Closer
+func (s syslogWriter) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// defaultAppriseCommand is the apprise CLI looked up on PATH
+const defaultAppriseCommand = "apprise"
+
+// apprise delivers messages through the apprise CLI, which supports dozens
+// of services through URLs such as tgram://, pover://, ntfy:// or mailto://
+type apprise struct {
+	command string
+	urls    []string
+}
+
+// newApprise creates an Apprise channel
+func newApprise(command string, urls []string) *apprise {
+	if command == "" {
+		command = defaultAppriseCommand
+	}
+	return &apprise{
+		command: command,
+		urls:    urls,
+	}
+}
+
+// Send runs apprise with the message title, body and type
+func (a *apprise) Send(ctx context.Context, msg Message) error {
+	args := []string{
+		"--title", msg.Title,
+		"--body", msg.Body,
+		"--notification-type", appriseType(msg.Severity),
+	}
+	args = append(args, a.urls...)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, a.command, args...)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("apprise failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// appriseType maps a severity to an apprise notification type
+func appriseType(severity string) string {
+	switch severity {
+	case "info":
+		return "info"
+	case "critical":
+		return "failure"
+	default:
+		return "warning"
+	}
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// discord posts messages as embeds to a Discord webhook
+type discord struct {
+	url    string
+	client *http.Client
+}
+
+// discordPayload is the body of a Discord webhook request
+type discordPayload struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+// discordEmbed is a single rich embed in a Discord message
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Color       int    `json:"color"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// newDiscord creates a Discord webhook channel
+func newDiscord(url string) *discord {
+	return &discord{
+		url:    url,
+		client: http.DefaultClient,
+	}
+}
+
+// Send posts the message as an embed colored by severity
+func (d *discord) Send(ctx context.Context, msg Message) error {
+	payload := discordPayload{
+		Embeds: []discordEmbed{{
+			Title:       msg.Title,
+			Description: msg.Body,
+			Color:       severityColor(msg.Severity),
+			Timestamp:   msg.Timestamp.Format(time.RFC3339),
+		}},
+	}
+
+	return postJSON(ctx, d.client, d.url, payload)
+}
+
+// severityColor maps a severity to an embed color
+func severityColor(severity string) int {
+	switch severity {
+	case "info":
+		return 0x3498db // blue
+	case "critical":
+		return 0xe74c3c // red
+	default:
+		return 0xf1c40f // yellow
+	}
+}
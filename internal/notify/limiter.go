@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"sync"
+	"time"
+)
+
+// Summary describes a burst of alerts suppressed during a rate limit window
+type Summary struct {
+	Count    int
+	First    time.Time
+	Min      float64
+	Max      float64
+	Last     Message
+	Channels []string
+}
+
+// Limiter suppresses identical alerts within a window and collapses the
+// suppressed ones into a single summary when the window closes. Windows are
+// measured in message time; in live mode a timer also closes them so the
+// summary is not held back until the next alert.
+type Limiter struct {
+	mu        sync.Mutex
+	window    time.Duration
+	timers    bool
+	entries   map[string]*limitEntry
+	onSummary func(Summary)
+}
+
+// limitEntry tracks an open rate limit window for one alert key
+type limitEntry struct {
+	start   time.Time
+	summary Summary
+	timer   *time.Timer
+}
+
+// NewLimiter creates a limiter that reports bursts through onSummary
+func NewLimiter(onSummary func(Summary)) *Limiter {
+	return &Limiter{
+		timers:    true,
+		entries:   make(map[string]*limitEntry),
+		onSummary: onSummary,
+	}
+}
+
+// SetWindow changes the suppression window for alerts sent from now on
+func (l *Limiter) SetWindow(window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.window = window
+}
+
+// DisableTimers stops closing windows on wall-clock time, for replaying
+// past messages faster than real time. Call Flush once done.
+func (l *Limiter) DisableTimers() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.timers = false
+}
+
+// Allow reports whether msg should be sent now. When it returns false the
+// message has been recorded and will be part of the window's summary.
+func (l *Limiter) Allow(key string, msg Message, channels []string) bool {
+	l.mu.Lock()
+
+	if l.window <= 0 {
+		l.mu.Unlock()
+		return true
+	}
+
+	// Close a window that elapsed before its timer fired
+	var elapsed *Summary
+	entry, ok := l.entries[key]
+	if ok && !msg.Timestamp.Before(entry.start.Add(l.window)) {
+		elapsed = l.closeLocked(key, entry)
+		ok = false
+	}
+
+	allowed := !ok
+	if !ok {
+		// First alert opens a new window
+		entry = &limitEntry{start: msg.Timestamp, summary: Summary{Channels: channels}}
+		if l.timers {
+			entry.timer = time.AfterFunc(l.window, func() { l.close(key, entry) })
+		}
+		l.entries[key] = entry
+	} else {
+		// Record the suppressed alert in the window summary
+		s := &entry.summary
+		if s.Count == 0 {
+			s.First = msg.Timestamp
+			s.Min = msg.Duration
+			s.Max = msg.Duration
+		}
+		s.Count++
+		s.Min = min(s.Min, msg.Duration)
+		s.Max = max(s.Max, msg.Duration)
+		s.Last = msg
+		s.Channels = channels
+	}
+
+	l.mu.Unlock()
+
+	l.emit(elapsed)
+	return allowed
+}
+
+// Flush closes all open windows, emitting their summaries
+func (l *Limiter) Flush() {
+	l.mu.Lock()
+	var pending []*Summary
+	for key, entry := range l.entries {
+		pending = append(pending, l.closeLocked(key, entry))
+	}
+	l.mu.Unlock()
+
+	for _, s := range pending {
+		l.emit(s)
+	}
+}
+
+// close ends a window from its timer
+func (l *Limiter) close(key string, entry *limitEntry) {
+	l.mu.Lock()
+	var summary *Summary
+	if l.entries[key] == entry {
+		summary = l.closeLocked(key, entry)
+	}
+	l.mu.Unlock()
+
+	l.emit(summary)
+}
+
+// closeLocked removes an entry and returns its summary; l.mu must be held
+func (l *Limiter) closeLocked(key string, entry *limitEntry) *Summary {
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+	delete(l.entries, key)
+	return &entry.summary
+}
+
+// emit reports a summary if any alerts were suppressed
+func (l *Limiter) emit(s *Summary) {
+	if s != nil && s.Count > 0 && l.onSummary != nil {
+		l.onSummary(*s)
+	}
+}
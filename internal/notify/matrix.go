@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// matrix sends messages to a Matrix room through the client-server API
+type matrix struct {
+	homeserver  string
+	accessToken string
+	roomID      string
+	client      *http.Client
+	txnCounter  atomic.Uint64
+}
+
+// matrixMessage is an m.room.message event body
+type matrixMessage struct {
+	MsgType string `json:"msgtype"`
+	Body    string `json:"body"`
+}
+
+// newMatrix creates a Matrix channel
+func newMatrix(homeserver, accessToken, roomID string) *matrix {
+	return &matrix{
+		homeserver:  strings.TrimRight(homeserver, "/"),
+		accessToken: accessToken,
+		roomID:      roomID,
+		client:      http.DefaultClient,
+	}
+}
+
+// Send posts the message as a text event in the configured room
+func (m *matrix) Send(ctx context.Context, msg Message) error {
+	// Transaction IDs must be unique per access token to avoid deduplication by the server
+	txnID := fmt.Sprintf("gommutetime-%d-%d", time.Now().UnixNano(), m.txnCounter.Add(1))
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		m.homeserver, url.PathEscape(m.roomID), txnID)
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+m.accessToken)
+
+	payload := matrixMessage{
+		MsgType: "m.text",
+		Body:    fmt.Sprintf("%s\n%s", msg.Title, msg.Body),
+	}
+
+	return sendJSON(ctx, m.client, http.MethodPut, endpoint, header, payload)
+}
@@ -0,0 +1,407 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"gommutetime/internal/annotation"
+	"gommutetime/internal/config"
+	"gommutetime/internal/events"
+	"gommutetime/internal/history"
+	"gommutetime/internal/outbox"
+	"gommutetime/internal/schoolcal"
+)
+
+// Message is a single alert to deliver
+type Message struct {
+	Title       string    `json:"title"`
+	Body        string    `json:"body"`
+	Severity    string    `json:"severity"`
+	ItineraryID string    `json:"itinerary_id"`
+	Rule        string    `json:"rule"`
+	Duration    float64   `json:"duration_minutes"`
+	Timestamp   time.Time `json:"timestamp"`
+
+	// data is used to render per-channel templates; nil for summaries
+	data *TemplateData
+}
+
+// Channel delivers messages to an external service
+type Channel interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Manager evaluates alert rules and dispatches messages to channels
+type Manager struct {
+	mu        sync.RWMutex
+	channels  map[string]Channel
+	profiles  map[string][]string // profile channels by profile name
+	templates *templates
+	dataDir   string
+	limiter   *Limiter
+	dryRun    io.Writer
+	history   historyCache
+	bus       *events.Bus
+	outbox    *outbox.Outbox
+}
+
+// New creates a notification manager from config
+func New(cfg *config.Config) (*Manager, error) {
+	m := &Manager{}
+	m.limiter = NewLimiter(m.sendSummary)
+
+	if err := m.Reload(cfg); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Reload replaces the configured channels and templates, keeping rate limiting state
+func (m *Manager) Reload(cfg *config.Config) error {
+	channels := make(map[string]Channel)
+	for _, chCfg := range cfg.Notifications.Channels {
+		ch, err := newChannel(chCfg)
+		if err != nil {
+			return fmt.Errorf("failed to create channel %s: %w", chCfg.Name, err)
+		}
+		channels[chCfg.Name] = ch
+	}
+
+	profiles := make(map[string][]string)
+	for _, p := range cfg.Profiles {
+		profiles[p.Name] = p.Channels
+	}
+
+	tmpls, err := compileTemplates(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to compile templates: %w", err)
+	}
+
+	m.mu.Lock()
+	m.channels = channels
+	m.profiles = profiles
+	m.templates = tmpls
+	m.dataDir = cfg.DataDir
+	m.mu.Unlock()
+
+	m.limiter.SetWindow(time.Duration(cfg.Notifications.RateLimit.WindowMinutes) * time.Minute)
+
+	return nil
+}
+
+// SetDryRun prints messages to w instead of delivering them
+func (m *Manager) SetDryRun(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dryRun = w
+}
+
+// Limiter returns the manager's rate limiter
+func (m *Manager) Limiter() *Limiter {
+	return m.limiter
+}
+
+// newChannel creates a channel for the configured type
+func newChannel(cfg config.Channel) (Channel, error) {
+	switch cfg.Type {
+	case "webhook":
+		return newWebhook(cfg.URL), nil
+	case "discord":
+		return newDiscord(cfg.URL), nil
+	case "matrix":
+		return newMatrix(cfg.Homeserver, cfg.AccessToken, cfg.RoomID), nil
+	case "apprise":
+		return newApprise(cfg.Command, cfg.URLs), nil
+	default:
+		return nil, fmt.Errorf("unknown channel type: %s", cfg.Type)
+	}
+}
+
+// Check evaluates the itinerary's alert rules against a fetched sample
+func (m *Manager) Check(ctx context.Context, itin config.Itinerary, sample history.Sample) {
+	duration := sample.Duration
+
+	m.mu.RLock()
+	profileChannels := m.profiles[itin.Profile]
+	m.mu.RUnlock()
+
+	var baseline *history.Stats
+	for _, rule := range itin.Alerts {
+		if duration <= rule.AboveMinutes {
+			continue
+		}
+
+		// Baseline is only loaded once a rule fires
+		if baseline == nil {
+			stats := m.Baseline(itin, sample.Timestamp)
+			baseline = &stats
+		}
+
+		msg := Message{
+			Title:       fmt.Sprintf("%s: %s", itin.Name, rule.Name),
+			Severity:    severity(rule),
+			ItineraryID: itin.ID,
+			Rule:        rule.Name,
+			Duration:    duration,
+			Timestamp:   sample.Timestamp,
+			data: &TemplateData{
+				Itinerary: itin,
+				Rule:      rule,
+				Sample:    sample,
+				Baseline:  *baseline,
+			},
+		}
+
+		// Alerts also go to the channels of the itinerary's profile
+		channels := withProfile(rule.Channels, profileChannels)
+
+		if !m.limiter.Allow(alertKey(itin.ID, rule.Name), msg, channels) {
+			log.Printf("Alert %s for %s suppressed by rate limit", rule.Name, itin.ID)
+			continue
+		}
+
+		m.send(ctx, msg, channels)
+		m.fired(ctx, itin, msg, channels)
+	}
+}
+
+// Notify delivers a message about an itinerary that no alert rule raised,
+// e.g. missing samples, to channels and those of the itinerary's profile
+func (m *Manager) Notify(ctx context.Context, itin config.Itinerary, msg Message, channels []string) {
+	m.mu.RLock()
+	profileChannels := m.profiles[itin.Profile]
+	m.mu.RUnlock()
+
+	channels = withProfile(channels, profileChannels)
+	m.send(ctx, msg, channels)
+	m.fired(ctx, itin, msg, channels)
+}
+
+// delivery is a message to a channel waiting in the outbox, rendered for it
+type delivery struct {
+	Channel string  `json:"channel"`
+	Message Message `json:"message"`
+}
+
+// RetryWith keeps the messages that channels failed to deliver from now on
+// in an outbox, which retries them
+func (m *Manager) RetryWith(o *outbox.Outbox) {
+	o.Register("notify", func(ctx context.Context, payload json.RawMessage) error {
+		var d delivery
+		if err := json.Unmarshal(payload, &d); err != nil {
+			return fmt.Errorf("%w: %v", outbox.ErrDrop, err)
+		}
+		m.mu.RLock()
+		ch, ok := m.channels[d.Channel]
+		m.mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("%w: channel %s was removed", outbox.ErrDrop, d.Channel)
+		}
+		return ch.Send(ctx, d.Message)
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outbox = o
+}
+
+// Send sends a message about the daemon itself rather than an itinerary to
+// channels. It is not published as an alert.
+func (m *Manager) Send(ctx context.Context, msg Message, channels []string) {
+	m.send(ctx, msg, channels)
+}
+
+// PublishTo publishes the alerts sent from now on to an event bus
+func (m *Manager) PublishTo(bus *events.Bus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bus = bus
+}
+
+// fired publishes an alert sent to channels
+func (m *Manager) fired(ctx context.Context, itin config.Itinerary, msg Message, channels []string) {
+	m.mu.RLock()
+	bus := m.bus
+	m.mu.RUnlock()
+	bus.Publish(ctx, events.Event{Kind: events.AlertFired, Time: msg.Timestamp, Itinerary: itin, Alert: events.Alert{
+		Rule:     msg.Rule,
+		Severity: msg.Severity,
+		Title:    msg.Title,
+		Body:     msg.Body,
+		Duration: msg.Duration,
+		Channels: channels,
+	}})
+}
+
+// withProfile adds the channels of a profile missing from channels
+func withProfile(channels, profileChannels []string) []string {
+	for _, name := range profileChannels {
+		if !slices.Contains(channels, name) {
+			channels = append(slices.Clip(channels), name)
+		}
+	}
+	return channels
+}
+
+// Baseline computes typical commute stats for the itinerary at this time of
+// week, from its history
+func (m *Manager) Baseline(itin config.Itinerary, at time.Time) history.Stats {
+	m.mu.RLock()
+	dataDir := m.dataDir
+	m.mu.RUnlock()
+
+	// Without stored history there is nothing to compare against
+	if dataDir == "" || itin.OutputFile == "" {
+		return history.Stats{}
+	}
+	path := filepath.Join(dataDir, itin.OutputFile)
+
+	samples, err := m.history.load(path)
+	if err != nil {
+		log.Printf("Warning: could not load baseline for %s: %v", itin.ID, err)
+		return history.Stats{}
+	}
+
+	// Compare with the primary provider of itineraries comparing several
+	samples = history.PrimaryOnly(samples, itin.PrimaryProvider())
+
+	// Days of annotated events, e.g. a bridge closure, are not typical
+	annotations, err := annotation.Load(annotation.Path(dataDir))
+	if err != nil {
+		log.Printf("Warning: could not load annotations for %s: %v", itin.ID, err)
+	}
+	samples = annotation.Exclude(annotations, itin.ID, samples)
+
+	// School terms and vacations are compared with their own kind, by the
+	// calendar rather than recorded tags so that older samples count too
+	if itin.SchoolCalendar != nil {
+		calendar, err := schoolcal.Load(*itin.SchoolCalendar)
+		if err != nil {
+			log.Printf("Warning: could not load school calendar for %s: %v", itin.ID, err)
+		} else {
+			vacation := calendar.Vacation(at)
+			samples = slices.DeleteFunc(slices.Clone(samples), func(s history.Sample) bool {
+				return calendar.Vacation(s.Timestamp) != vacation
+			})
+		}
+	}
+
+	return history.Baseline(samples, at, baselineWindow)
+}
+
+// send delivers a message to each named channel, logging failures
+func (m *Manager) send(ctx context.Context, msg Message, channelNames []string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, name := range channelNames {
+		ch, ok := m.channels[name]
+		if !ok {
+			log.Printf("ERROR: unknown notification channel %s", name)
+			continue
+		}
+
+		// Render the body with the rule or channel template
+		out := msg
+		if msg.data != nil {
+			tmpl := m.templates.lookup(alertKey(msg.ItineraryID, msg.Rule), name)
+			body, err := render(tmpl, *msg.data)
+			if err != nil {
+				log.Printf("ERROR rendering alert for %s: %v", name, err)
+				continue
+			}
+			out.Body = body
+		}
+
+		if m.dryRun != nil {
+			fmt.Fprintf(m.dryRun, "%s [%s] %s -> %s: %s\n",
+				out.Timestamp.Format(time.RFC3339), out.Severity, name, out.Title, out.Body)
+			continue
+		}
+
+		if err := ch.Send(ctx, out); err != nil {
+			log.Printf("ERROR sending alert to %s: %v", name, err)
+			m.outbox.Add("notify", name, delivery{Channel: name, Message: out}, err)
+		} else {
+			log.Printf("Alert %s for %s sent to %s", msg.Rule, msg.ItineraryID, name)
+			m.outbox.Delivered("notify")
+		}
+	}
+}
+
+// sendSummary delivers the collapsed summary of a burst of suppressed alerts
+func (m *Manager) sendSummary(s Summary) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	msg := s.Last
+	msg.Title = fmt.Sprintf("%s (repeated)", msg.Title)
+	msg.Body = fmt.Sprintf("Alert repeated %d more times between %s and %s (%.0f-%.0f min)",
+		s.Count, s.First.Format("15:04"), s.Last.Timestamp.Format("15:04"), s.Min, s.Max)
+	msg.data = nil
+
+	m.send(ctx, msg, s.Channels)
+}
+
+// alertKey identifies identical alerts for deduplication
+func alertKey(itinID, rule string) string {
+	return itinID + "/" + rule
+}
+
+// severity returns the rule severity, defaulting to warning
+func severity(rule config.AlertRule) string {
+	if rule.Severity == "" {
+		return "warning"
+	}
+	return rule.Severity
+}
+
+// historyCache keeps the last loaded history per file, reloading it only
+// when the file changes
+type historyCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedHistory
+}
+
+// cachedHistory is a loaded history file and the state it was loaded at
+type cachedHistory struct {
+	modTime time.Time
+	size    int64
+	samples []history.Sample
+}
+
+// load returns the samples in path, from cache when the file is unchanged
+func (c *historyCache) load(path string) ([]history.Sample, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return history.Load(path)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.entries[path]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.samples, nil
+	}
+
+	samples, err := history.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.entries == nil {
+		c.entries = make(map[string]cachedHistory)
+	}
+	c.entries[path] = cachedHistory{modTime: info.ModTime(), size: info.Size(), samples: samples}
+
+	return samples, nil
+}
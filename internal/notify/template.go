@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/history"
+)
+
+// TemplateData is available to message templates
+type TemplateData struct {
+	Itinerary config.Itinerary
+	Rule      config.AlertRule
+	Sample    history.Sample
+	Baseline  history.Stats
+}
+
+// baselineWindow is how far from the sample's time of day baseline samples may be
+const baselineWindow = 30 * time.Minute
+
+// defaultTemplate is used when neither the rule nor the channel defines one
+//
+//go:embed templates/default.tmpl
+var defaultTemplate string
+
+// parseTemplate compiles a message template, returning nil for an empty one
+func parseTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New(name).Parse(text)
+}
+
+// render executes tmpl with data
+func render(tmpl *template.Template, data TemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// templates holds the compiled channel and rule templates
+type templates struct {
+	fallback *template.Template
+	channels map[string]*template.Template
+	rules    map[string]*template.Template
+}
+
+// compileTemplates parses all templates defined in config
+func compileTemplates(cfg *config.Config) (*templates, error) {
+	t := &templates{
+		fallback: template.Must(template.New("default").Parse(strings.TrimSuffix(defaultTemplate, "\n"))),
+		channels: make(map[string]*template.Template),
+		rules:    make(map[string]*template.Template),
+	}
+
+	for _, ch := range cfg.Notifications.Channels {
+		tmpl, err := parseTemplate(ch.Name, ch.Template)
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+		if tmpl != nil {
+			t.channels[ch.Name] = tmpl
+		}
+	}
+
+	for _, itin := range cfg.Itineraries {
+		for _, rule := range itin.Alerts {
+			tmpl, err := parseTemplate(rule.Name, rule.Template)
+			if err != nil {
+				return nil, fmt.Errorf("itinerary %s, alert %s: %w", itin.ID, rule.Name, err)
+			}
+			if tmpl != nil {
+				t.rules[alertKey(itin.ID, rule.Name)] = tmpl
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// lookup returns the template for a rule and channel, preferring the rule's own
+func (t *templates) lookup(key, channel string) *template.Template {
+	if tmpl, ok := t.rules[key]; ok {
+		return tmpl
+	}
+	if tmpl, ok := t.channels[channel]; ok {
+		return tmpl
+	}
+	return t.fallback
+}
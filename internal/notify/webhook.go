@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// webhook posts messages as JSON to a URL
+type webhook struct {
+	url    string
+	client *http.Client
+}
+
+// newWebhook creates a generic JSON webhook channel
+func newWebhook(url string) *webhook {
+	return &webhook{
+		url:    url,
+		client: http.DefaultClient,
+	}
+}
+
+// Send posts the message as JSON
+func (w *webhook) Send(ctx context.Context, msg Message) error {
+	return postJSON(ctx, w.client, w.url, msg)
+}
+
+// postJSON sends payload as a JSON POST request and checks the response status
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	return sendJSON(ctx, client, http.MethodPost, url, nil, payload)
+}
+
+// sendJSON sends payload as JSON with the given method and extra headers
+func sendJSON(ctx context.Context, client *http.Client, method, url string, header http.Header, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,315 @@
+// Package outbox keeps the deliveries of notifications and stream messages
+// that failed in the data directory, one JSON file each, and retries them
+// until they succeed or grow too old. Deliveries are then made at least
+// once across network outages and restarts, and consumers drop duplicates
+// with the idempotency keys of samples.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+)
+
+// retryInterval is how often due deliveries are retried
+const retryInterval = 30 * time.Second
+
+// Bounds of the delay between the attempts of a delivery, which doubles
+// with each failure
+const (
+	minBackoff = time.Minute
+	maxBackoff = 10 * time.Minute
+)
+
+// ErrDrop is returned by senders for deliveries that can never succeed,
+// e.g. to a channel removed from the config, which are dropped
+var ErrDrop = errors.New("delivery dropped")
+
+// Entry is a delivery waiting in the outbox
+type Entry struct {
+	// ID names the file of the entry, in the order entries were added
+	ID string `json:"id"`
+	// Kind picks the sender of the entry, e.g. notify or kafka, and Target
+	// tells where it goes in logs
+	Kind    string          `json:"kind"`
+	Target  string          `json:"target"`
+	Payload json.RawMessage `json:"payload"`
+	Created time.Time       `json:"created"`
+	// Attempts counts the failed attempts, Next is when the entry is tried
+	// again and Error why the last attempt failed
+	Attempts int       `json:"attempts"`
+	Next     time.Time `json:"next"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Sender delivers the payload of an entry
+type Sender func(ctx context.Context, payload json.RawMessage) error
+
+// Outbox retries failed deliveries with the senders registered for their
+// kind. A nil outbox drops them, as does one without a data directory.
+type Outbox struct {
+	mu      sync.Mutex
+	cfg     *config.Config
+	senders map[string]Sender
+	// now holds the kinds to retry right away, as a delivery of theirs
+	// just succeeded
+	now  map[string]bool
+	wake chan struct{}
+	seq  int
+}
+
+// New creates the outbox of cfg
+func New(cfg *config.Config) *Outbox {
+	return &Outbox{cfg: cfg, senders: make(map[string]Sender), now: make(map[string]bool), wake: make(chan struct{}, 1)}
+}
+
+// Reload switches to a new config. Entries in the outbox of the old one
+// are left there.
+func (o *Outbox) Reload(cfg *config.Config) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.cfg = cfg
+}
+
+// Register retries the entries of a kind with send
+func (o *Outbox) Register(kind string, send Sender) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.senders[kind] = send
+}
+
+// Add keeps a delivery to target that failed with err, for its kind's
+// sender to retry. The payload is encoded as JSON. Callers log the failure
+// themselves, as it is dropped without an outbox.
+func (o *Outbox) Add(kind, target string, payload any, err error) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	dir := o.cfg.OutboxDir()
+	if dir == "" {
+		return
+	}
+
+	data, encodeErr := json.Marshal(payload)
+	if encodeErr != nil {
+		log.Printf("ERROR encoding delivery to %s %s for the outbox: %v", kind, target, encodeErr)
+		return
+	}
+	now := time.Now()
+	o.seq++
+	entry := Entry{
+		ID:       fmt.Sprintf("%d-%06d-%s", now.UnixNano(), o.seq%1000000, kind),
+		Kind:     kind,
+		Target:   target,
+		Payload:  data,
+		Created:  now,
+		Attempts: 1,
+		Next:     now.Add(minBackoff),
+		Error:    err.Error(),
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Printf("ERROR creating the outbox: %v", err)
+		return
+	}
+	if err := write(dir, entry); err != nil {
+		log.Printf("ERROR adding delivery to %s %s to the outbox: %v", kind, target, err)
+		return
+	}
+	log.Printf("Delivery to %s %s kept in the outbox for retries", kind, target)
+	o.trim(dir)
+}
+
+// Delivered tells the outbox that a delivery of a kind just succeeded, so
+// that its entries are retried right away rather than after their backoff
+func (o *Outbox) Delivered(kind string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	o.now[kind] = true
+	o.mu.Unlock()
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run retries due deliveries periodically and whenever a delivery of
+// their kind succeeds, until ctx is cancelled
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		o.retry(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// retry attempts the due entries in the order they were added, dropping
+// those that grew too old
+func (o *Outbox) retry(ctx context.Context, now time.Time) {
+	o.mu.Lock()
+	dir := o.cfg.OutboxDir()
+	maxAge := o.cfg.Outbox.MaxAge()
+	senders := maps.Clone(o.senders)
+	immediate := o.now
+	o.now = make(map[string]bool)
+	o.mu.Unlock()
+	if dir == "" {
+		return
+	}
+
+	entries, err := List(dir)
+	if err != nil {
+		log.Printf("ERROR reading the outbox: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		if now.Sub(entry.Created) > maxAge {
+			log.Printf("Warning: dropped delivery to %s %s after %d attempts: %s", entry.Kind, entry.Target, entry.Attempts, entry.Error)
+			remove(dir, entry)
+			continue
+		}
+		send, ok := senders[entry.Kind]
+		if !ok || (now.Before(entry.Next) && !immediate[entry.Kind]) {
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := send(sendCtx, entry.Payload)
+		cancel()
+		switch {
+		case err == nil:
+			log.Printf("Delivered to %s %s after %d failed attempts", entry.Kind, entry.Target, entry.Attempts)
+			remove(dir, entry)
+		case errors.Is(err, ErrDrop):
+			log.Printf("Warning: dropped delivery to %s %s: %v", entry.Kind, entry.Target, err)
+			remove(dir, entry)
+		default:
+			entry.Attempts++
+			entry.Error = err.Error()
+			entry.Next = now.Add(backoff(entry.Attempts))
+			if err := write(dir, entry); err != nil {
+				log.Printf("ERROR updating the outbox: %v", err)
+			}
+			// Later entries of the kind would most likely fail the same way
+			immediate[entry.Kind] = false
+		}
+	}
+}
+
+// backoff returns the delay before the next of a number of attempts
+func backoff(attempts int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// trim drops the oldest entries beyond outbox.max_entries
+func (o *Outbox) trim(dir string) {
+	names, err := entryFiles(dir)
+	if err != nil {
+		log.Printf("ERROR reading the outbox: %v", err)
+		return
+	}
+	limit := o.cfg.Outbox.Limit()
+	for _, name := range names[:max(len(names)-limit, 0)] {
+		log.Printf("Warning: the outbox is full, dropped %s", strings.TrimSuffix(name, ".json"))
+		os.Remove(filepath.Join(dir, name))
+	}
+}
+
+// List reads the entries of the outbox in dir, oldest first. A missing
+// directory has none.
+func List(dir string) ([]Entry, error) {
+	names, err := entryFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to read outbox entry: %w", err))
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			log.Printf("Warning: skipping invalid outbox entry %s: %v", name, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// entryFiles lists the entry files in dir, oldest first
+func entryFiles(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to read outbox: %w", err))
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".json") {
+			names = append(names, f.Name())
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// write replaces the file of an entry once the new one is complete
+func write(dir string, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, entry.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write outbox entry: %w", err))
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write outbox entry: %w", err))
+	}
+	return nil
+}
+
+// remove deletes the file of a delivered or dropped entry
+func remove(dir string, entry Entry) {
+	if err := os.Remove(filepath.Join(dir, entry.ID+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("ERROR removing outbox entry %s: %v", entry.ID, err)
+	}
+}
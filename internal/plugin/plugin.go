@@ -0,0 +1,341 @@
+// Package plugin runs external output plugins: programs sent the events of
+// the daemon, e.g. to write samples to Redis, Kafka or a proprietary
+// system without changing the project.
+//
+// A plugin is started once and kept running. Each event is written to its
+// standard input as a line of JSON, and the plugin answers each with a line
+// of JSON on its standard output, {"ok":true} or {"error":"..."}:
+//
+//	{"event":"sample.recorded","time":"2026-03-04T08:15:00Z",
+//	 "itinerary":{"id":"work","name":"Home to work","tags":["car"]},
+//	 "sample":{"timestamp":"2026-03-04T08:15:00Z","duration_minutes":31.5,
+//	 "provider":"google","schedule":"morning-rush","elements":1,
+//	 "sequence":1234,"key":"6f1c0e8e-3b5a-5d2e-9a47-0c6f1b8d2e51"}}
+//
+// Its standard error is logged. A plugin that exits, replies with anything
+// else or does not reply in time is restarted for the next event.
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/events"
+)
+
+// queueSize is how many events may wait for a busy plugin before new ones
+// are dropped
+const queueSize = 100
+
+// Message is the JSON line sent to plugins for an event
+type Message struct {
+	Event     string     `json:"event"`
+	Time      time.Time  `json:"time"`
+	Itinerary *Itinerary `json:"itinerary,omitempty"`
+	Sample    *Sample    `json:"sample,omitempty"`
+	Alert     *Alert     `json:"alert,omitempty"`
+	// Error and Failures describe a failed job
+	Error    string `json:"error,omitempty"`
+	Failures int    `json:"failures,omitempty"`
+	// Itineraries counts the itineraries of a reloaded config
+	Itineraries int `json:"itineraries,omitempty"`
+}
+
+// Itinerary identifies the itinerary of an event
+type Itinerary struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Sample is a recorded sample
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Duration  float64   `json:"duration_minutes"`
+	Provider  string    `json:"provider"`
+	// Origin and Destination label the pair of a matrix itinerary
+	Origin      string    `json:"origin,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Schedule    string    `json:"schedule,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Elements    int       `json:"elements"`
+	Cost        float64   `json:"cost,omitempty"`
+	Legs        []float64 `json:"legs,omitempty"`
+	Direct      float64   `json:"direct,omitempty"`
+	// Sequence numbers the samples of the itinerary, so that a gap tells a
+	// sample was missed, and Key is the same whenever the sample is sent
+	// again, so that duplicates can be dropped
+	Sequence uint64 `json:"sequence,omitempty"`
+	Key      string `json:"key"`
+}
+
+// Alert is a fired alert
+type Alert struct {
+	Rule     string   `json:"rule,omitempty"`
+	Severity string   `json:"severity"`
+	Title    string   `json:"title"`
+	Body     string   `json:"body,omitempty"`
+	Duration float64  `json:"duration_minutes"`
+	Channels []string `json:"channels,omitempty"`
+}
+
+// reply is a plugin's answer to a message
+type reply struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// NewMessage converts an event to the message sent to plugins
+func NewMessage(e events.Event) Message {
+	msg := Message{Event: e.Kind, Time: e.Time.UTC()}
+	if e.Itinerary.ID != "" {
+		msg.Itinerary = &Itinerary{ID: e.Itinerary.ID, Name: e.Itinerary.Name, Tags: e.Itinerary.Tags}
+	}
+	switch e.Kind {
+	case events.SampleRecorded:
+		s := e.Sample
+		msg.Sample = &Sample{Timestamp: s.Timestamp.UTC(), Duration: s.Duration, Provider: s.Provider,
+			Origin: s.Origin, Destination: s.Destination, Schedule: s.Schedule, Tags: s.Tags, Elements: s.Elements, Cost: s.Cost, Legs: s.Legs, Direct: s.Direct,
+			Sequence: e.Sequence, Key: e.Key}
+	case events.AlertFired:
+		a := e.Alert
+		msg.Alert = &Alert{Rule: a.Rule, Severity: a.Severity, Title: a.Title, Body: a.Body,
+			Duration: a.Duration, Channels: a.Channels}
+	case events.JobFailed:
+		msg.Failures = e.Failures
+		if e.Err != nil {
+			msg.Error = e.Err.Error()
+		}
+	case events.ConfigReloaded:
+		if e.Config != nil {
+			msg.Itineraries = len(e.Config.Itineraries)
+		}
+	}
+	return msg
+}
+
+// Manager sends the events of the daemon to the configured plugins
+type Manager struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	runners []*runner
+}
+
+// New starts the plugins of a config, which stop with ctx
+func New(ctx context.Context, cfg *config.Config) *Manager {
+	m := &Manager{ctx: ctx}
+	m.Reload(cfg)
+	return m
+}
+
+// Reload restarts the plugins with those of a new config. Events queued for
+// the old ones are still delivered.
+func (m *Manager) Reload(cfg *config.Config) {
+	runners := make([]*runner, len(cfg.Plugins))
+	for i, p := range cfg.Plugins {
+		runners[i] = &runner{cfg: p, queue: make(chan []byte, queueSize)}
+		go runners[i].run(m.ctx)
+	}
+
+	m.mu.Lock()
+	old := m.runners
+	m.runners = runners
+	m.mu.Unlock()
+	for _, r := range old {
+		close(r.queue)
+	}
+}
+
+// Handle queues an event for the plugins receiving its kind, dropping it
+// for those too far behind
+func (m *Manager) Handle(_ context.Context, e events.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var line []byte
+	for _, r := range m.runners {
+		if !r.cfg.Receives(e.Kind) {
+			continue
+		}
+		if line == nil {
+			data, err := json.Marshal(NewMessage(e))
+			if err != nil {
+				log.Printf("ERROR encoding %s for plugins: %v", e.Kind, err)
+				return
+			}
+			line = append(data, '\n')
+		}
+		select {
+		case r.queue <- line:
+		default:
+			log.Printf("Warning: plugin %s is behind, dropped a %s event", r.cfg.Name, e.Kind)
+		}
+	}
+}
+
+// runner delivers the events of a plugin in order, starting its process
+// when needed
+type runner struct {
+	cfg   config.Plugin
+	queue chan []byte
+}
+
+// run delivers queued events until the queue is closed or ctx is done
+func (r *runner) run(ctx context.Context) {
+	var proc *process
+	defer func() {
+		if proc != nil {
+			proc.stop()
+		}
+	}()
+
+	for {
+		var line []byte
+		var ok bool
+		select {
+		case line, ok = <-r.queue:
+			if !ok {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+
+		if proc == nil {
+			var err error
+			if proc, err = start(r.cfg); err != nil {
+				log.Printf("ERROR starting plugin %s: %v", r.cfg.Name, err)
+				continue
+			}
+		}
+		if err := proc.send(line, r.timeout()); err != nil {
+			log.Printf("ERROR in plugin %s: %v", r.cfg.Name, err)
+			var rejected rejectedError
+			if !errors.As(err, &rejected) {
+				proc.stop()
+				proc = nil
+			}
+		}
+	}
+}
+
+// timeout returns how long the plugin may take to reply
+func (r *runner) timeout() time.Duration {
+	if r.cfg.TimeoutSeconds > 0 {
+		return time.Duration(r.cfg.TimeoutSeconds) * time.Second
+	}
+	return config.DefaultPluginTimeoutSeconds * time.Second
+}
+
+// rejectedError is an error a plugin replied with, after which it can
+// carry on
+type rejectedError string
+
+func (e rejectedError) Error() string {
+	return "event rejected: " + string(e)
+}
+
+// process is a running plugin
+type process struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	replies chan []byte
+}
+
+// start runs the program of a plugin, logging its standard error
+func start(cfg config.Plugin) (*process, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	log.Printf("Started plugin %s (pid %d)", cfg.Name, cmd.Process.Pid)
+
+	p := &process{name: cfg.Name, cmd: cmd, stdin: stdin, replies: make(chan []byte)}
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			p.replies <- append([]byte(nil), scanner.Bytes()...)
+		}
+		close(p.replies)
+	}()
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Printf("Plugin %s: %s", cfg.Name, scanner.Text())
+		}
+	}()
+	return p, nil
+}
+
+// send writes an event and waits for the plugin's reply
+func (p *process) send(line []byte, timeout time.Duration) error {
+	if _, err := p.stdin.Write(line); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case data, ok := <-p.replies:
+		if !ok {
+			return errors.New("plugin exited")
+		}
+		var r reply
+		if err := json.Unmarshal(data, &r); err != nil {
+			return fmt.Errorf("invalid reply %q", data)
+		}
+		if r.Error != "" {
+			return rejectedError(r.Error)
+		}
+		if !r.OK {
+			return fmt.Errorf("invalid reply %q", data)
+		}
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("no reply within %s", timeout)
+	}
+}
+
+// stop closes the plugin's standard input for it to exit, killing it if it
+// does not within a few seconds
+func (p *process) stop() {
+	p.stdin.Close()
+	done := make(chan struct{})
+	go func() {
+		// Drain replies so the reader can finish
+		for range p.replies {
+		}
+		p.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		p.cmd.Process.Kill()
+		<-done
+	}
+	log.Printf("Stopped plugin %s", p.name)
+}
@@ -0,0 +1,107 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/history"
+	"gommutetime/internal/notify"
+)
+
+// Options selects what to replay and how fast
+type Options struct {
+	// ItineraryID restricts the replay to one itinerary; empty replays all
+	ItineraryID string
+	// From and To bound the replayed samples; zero values are unbounded
+	From time.Time
+	To   time.Time
+	// Speed is how many times faster than real time samples are replayed;
+	// zero replays as fast as possible
+	Speed float64
+}
+
+// event is a stored sample for a given itinerary
+type event struct {
+	itin   config.Itinerary
+	sample history.Sample
+}
+
+// Run feeds stored history through the alerting pipeline in chronological
+// order and returns the number of replayed samples
+func Run(ctx context.Context, cfg *config.Config, notifier *notify.Manager, opts Options) (int, error) {
+	events, err := loadEvents(cfg, opts)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	// Rate limit windows follow sample time, not wall-clock time
+	notifier.Limiter().DisableTimers()
+	defer notifier.Limiter().Flush()
+
+	log.Printf("Replaying %d samples from %s to %s", len(events),
+		events[0].sample.Timestamp.Format(time.RFC3339), events[len(events)-1].sample.Timestamp.Format(time.RFC3339))
+
+	for i, ev := range events {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+
+		// Wait for the scaled gap since the previous sample
+		if opts.Speed > 0 && i > 0 {
+			gap := ev.sample.Timestamp.Sub(events[i-1].sample.Timestamp)
+			select {
+			case <-time.After(time.Duration(float64(gap) / opts.Speed)):
+			case <-ctx.Done():
+				return i, ctx.Err()
+			}
+		}
+
+		notifier.Check(ctx, ev.itin, ev.sample)
+	}
+
+	return len(events), nil
+}
+
+// loadEvents reads and merges the selected itineraries' history
+func loadEvents(cfg *config.Config, opts Options) ([]event, error) {
+	var events []event
+	found := false
+
+	for _, itin := range cfg.Itineraries {
+		if opts.ItineraryID != "" && itin.ID != opts.ItineraryID {
+			continue
+		}
+		found = true
+
+		if len(itin.Alerts) == 0 || itin.OutputFile == "" {
+			continue
+		}
+
+		samples, err := history.LoadRange(filepath.Join(cfg.DataDir, itin.OutputFile), opts.From, opts.To)
+		if err != nil {
+			return nil, fmt.Errorf("itinerary %s: %w", itin.ID, err)
+		}
+
+		for _, s := range samples {
+			events = append(events, event{itin: itin, sample: s})
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("unknown itinerary: %s", opts.ItineraryID)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].sample.Timestamp.Before(events[j].sample.Timestamp)
+	})
+
+	return events, nil
+}
@@ -0,0 +1,204 @@
+// Package reporting sends panics and repeated job failures to Sentry, or a
+// compatible service such as GlitchTip, and to a webhook, so that they are
+// noticed on a headless machine where the log is rarely read
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/events"
+)
+
+// defaultFailuresInARow is how many fetches of an itinerary must fail in a
+// row to be reported, unless configured otherwise
+const defaultFailuresInARow = 3
+
+// flushTimeout bounds the wait for reports to be sent on shutdown or after
+// a panic
+const flushTimeout = 5 * time.Second
+
+// Report is an error sent to the webhook, as JSON
+type Report struct {
+	Time        time.Time `json:"time"`
+	Level       string    `json:"level"` // fatal for panics, error otherwise
+	Message     string    `json:"message"`
+	Release     string    `json:"release,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	// Tags describe the context, e.g. itinerary.id and error.kind
+	Tags  map[string]string `json:"tags,omitempty"`
+	Stack string            `json:"stack,omitempty"`
+}
+
+var (
+	mu       sync.RWMutex
+	cfg      config.ErrorsConfig
+	release  string
+	sentryOn bool
+	client   = &http.Client{Timeout: 10 * time.Second}
+	// pending tracks webhook requests in flight, waited for by Flush
+	pending sync.WaitGroup
+)
+
+// Setup starts reporting errors as configured, tagged with the release
+// (version) of the binary. Sentry is enabled by a DSN in the config or the
+// SENTRY_DSN environment variable. The returned function sends pending
+// reports.
+func Setup(settings config.ErrorsConfig, version string) (func(), error) {
+	dsn := settings.SentryDSN
+	if dsn == "" {
+		dsn = os.Getenv("SENTRY_DSN")
+	}
+	if dsn != "" {
+		err := sentry.Init(sentry.ClientOptions{
+			Dsn:         dsn,
+			Environment: settings.Environment,
+			Release:     version,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up Sentry: %w", err)
+		}
+	}
+
+	mu.Lock()
+	cfg, release, sentryOn = settings, version, dsn != ""
+	mu.Unlock()
+	return Flush, nil
+}
+
+// Flush waits for pending reports to be sent, for a few seconds at most
+func Flush() {
+	mu.RLock()
+	on := sentryOn
+	mu.RUnlock()
+	if on {
+		sentry.Flush(flushTimeout)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(flushTimeout):
+	}
+}
+
+// Recover reports a panic of the calling goroutine and panics again, so
+// that the process still crashes. Defer it at the top of a goroutine.
+func Recover() {
+	if r := recover(); r != nil {
+		Panic(r, nil)
+		Flush()
+		panic(r)
+	}
+}
+
+// Panic reports a recovered panic, to be called from the deferred function
+// that recovered it so that the stack leads to the panic
+func Panic(value any, tags map[string]string) {
+	mu.RLock()
+	on := sentryOn
+	mu.RUnlock()
+
+	if on {
+		hub := sentry.CurrentHub().Clone()
+		hub.WithScope(func(scope *sentry.Scope) {
+			scope.SetLevel(sentry.LevelFatal)
+			scope.SetTags(tags)
+			hub.Recover(value)
+		})
+	}
+	send(Report{
+		Level:   "fatal",
+		Message: fmt.Sprintf("panic: %v", value),
+		Tags:    tags,
+		Stack:   string(debug.Stack()),
+	})
+}
+
+// JobFailed reports an itinerary whose fetches failed a number of times in
+// a row, once per streak of failures, on job.failed events
+func JobFailed(_ context.Context, e events.Event) {
+	itin, failures, err := e.Itinerary, e.Failures, e.Err
+	mu.RLock()
+	threshold, on := cfg.FailuresInARow, sentryOn
+	mu.RUnlock()
+	if threshold == 0 {
+		threshold = defaultFailuresInARow
+	}
+	if failures != threshold {
+		return
+	}
+
+	tags := map[string]string{
+		"itinerary.id":   itin.ID,
+		"itinerary.name": itin.Name,
+		"error.kind":     apperr.KindOf(err).String(),
+	}
+	if itin.Profile != "" {
+		tags["profile"] = itin.Profile
+	}
+	message := fmt.Sprintf("%d fetches of %s failed in a row: %v", failures, itin.ID, err)
+
+	if on {
+		hub := sentry.CurrentHub().Clone()
+		hub.WithScope(func(scope *sentry.Scope) {
+			scope.SetTags(tags)
+			scope.SetContext("itinerary", sentry.Context{
+				"id":       itin.ID,
+				"name":     itin.Name,
+				"type":     itin.Type,
+				"tags":     itin.Tags,
+				"failures": failures,
+			})
+			// Group the reports of an itinerary and kind of error
+			scope.SetFingerprint([]string{"job-failures", itin.ID, tags["error.kind"]})
+			hub.CaptureException(errors.New(message))
+		})
+	}
+
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		send(Report{Level: "error", Message: message, Tags: tags})
+	}()
+}
+
+// send posts a report to the webhook, if any
+func send(report Report) {
+	mu.RLock()
+	url := cfg.WebhookURL
+	report.Release, report.Environment = release, cfg.Environment
+	mu.RUnlock()
+	if url == "" {
+		return
+	}
+
+	report.Time = time.Now()
+	body, _ := json.Marshal(report)
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Warning: failed to report error: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Warning: failed to report error: webhook responded %s", resp.Status)
+	}
+}
@@ -0,0 +1,85 @@
+// Package rollup replaces old samples with hourly or daily aggregates, so
+// that years of history stay small while their trends remain in statistics
+package rollup
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/history"
+)
+
+// startDelay lets the daemon settle before the first rollup
+const startDelay = time.Minute
+
+// Job rolls up the samples older than rollup.after_days shortly after the
+// daemon starts and after each midnight
+type Job struct {
+	mu  sync.Mutex
+	cfg *config.Config
+}
+
+// NewJob creates the rollup job of a config
+func NewJob(cfg *config.Config) *Job {
+	return &Job{cfg: cfg}
+}
+
+// Reload switches to a new config, used from the next rollup
+func (j *Job) Reload(cfg *config.Config) {
+	j.mu.Lock()
+	j.cfg = cfg
+	j.mu.Unlock()
+}
+
+// Run rolls up old samples until ctx is cancelled
+func (j *Job) Run(ctx context.Context) {
+	wait := startDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		j.mu.Lock()
+		cfg := j.cfg
+		j.mu.Unlock()
+		if cfg.Rollup.Enabled() {
+			All(cfg, time.Now())
+		}
+
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), 0, 5, 0, 0, now.Location()).AddDate(0, 0, 1)
+		wait = time.Until(next)
+	}
+}
+
+// All rolls up the samples of every itinerary but matrices taken before the
+// start of the day rollup.after_days before now, logging failures
+func All(cfg *config.Config, now time.Time) {
+	resolution := cfg.Rollup.Resolution
+	if resolution == "" {
+		resolution = history.ResolutionHour
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	before := today.AddDate(0, 0, -cfg.Rollup.AfterDays)
+
+	for _, itin := range cfg.Itineraries {
+		// Aggregates have no origin or destination to tell matrix pairs apart
+		if itin.IsMatrix() || itin.OutputFile == "" {
+			continue
+		}
+		samples, err := history.Rollup(filepath.Join(cfg.DataDir, itin.OutputFile), before, resolution)
+		if err != nil {
+			log.Printf("ERROR rolling up samples of %s: %v", itin.ID, err)
+			continue
+		}
+		if samples > 0 {
+			log.Printf("Rolled up %d samples of %s taken before %s", samples, itin.ID, before.Format(time.DateOnly))
+		}
+	}
+}
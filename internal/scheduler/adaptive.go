@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gommutetime/internal/adaptive"
+	"gommutetime/internal/annotation"
+	"gommutetime/internal/config"
+	"gommutetime/internal/history"
+)
+
+// plan is the times an adaptive schedule samples on a day
+type plan struct {
+	day     string
+	minutes []int
+}
+
+// planned reports whether an adaptive schedule samples at minute, after
+// midnight, on the day of now. The day's plan is made from the history on
+// the first time slot of the day.
+func (s *Scheduler) planned(itin config.Itinerary, sched config.Schedule, minute int, now time.Time) bool {
+	key := itin.ID + "/" + sched.Name
+	day := now.Format(time.DateOnly)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.plans[key]
+	if !ok || p.day != day {
+		p = plan{day: day, minutes: adaptive.Plan(s.recent(itin, now), sched.Slots(), int(sched.Every()/time.Minute),
+			now.Weekday(), sched.Adaptive.DailyRequests)}
+		if s.plans == nil {
+			s.plans = make(map[string]plan)
+		}
+		s.plans[key] = p
+		log.Printf("Adaptive plan for %s (%s) on %s: %s", itin.ID, sched.Name, day,
+			strings.Join(adaptive.Format(p.minutes), ", "))
+	}
+	return slices.Contains(p.minutes, minute)
+}
+
+// recent returns the samples of an itinerary from its primary provider over
+// the lookback of adaptive plans, leaving out annotated days. It is called
+// with s.mu held.
+func (s *Scheduler) recent(itin config.Itinerary, now time.Time) []history.Sample {
+	if s.config.DataDir == "" || itin.OutputFile == "" {
+		return nil
+	}
+	samples, err := history.LoadRange(filepath.Join(s.config.DataDir, itin.OutputFile), now.Add(-adaptive.Lookback), now)
+	if err != nil {
+		log.Printf("Warning: could not load history to plan %s: %v", itin.ID, err)
+		return nil
+	}
+	samples = history.PrimaryOnly(samples, itin.PrimaryProvider())
+	annotations, err := annotation.Load(annotation.Path(s.config.DataDir))
+	if err != nil {
+		log.Printf("Warning: could not load annotations to plan %s: %v", itin.ID, err)
+	}
+	return annotation.Exclude(annotations, itin.ID, samples)
+}
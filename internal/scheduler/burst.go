@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+
+	"gommutetime/internal/config"
+)
+
+// addBurst creates the job of a schedule sampling at seconds or at intervals
+// cron minutes cannot express. A cron job with seconds starts a duration job
+// at the start of its window on each of its days, which samples every
+// interval until the end of the window and is then removed. A window that is
+// already open starts right away. Like other schedules, it skips the times
+// of the days already in taken and adds the rest.
+func (s *Scheduler) addBurst(itin config.Itinerary, sched config.Schedule, weekdays []time.Weekday, task func(run *jobRun) func() error,
+	taken map[slotDay]bool) (int, error) {
+	times := sched.Times()
+	start := times[0]
+
+	// Leave out the runs on days on which another schedule already samples
+	// their time
+	skip := claimTimes(sched, weekdays, taken)
+	if len(skip) > 0 {
+		log.Printf("Warning: %s (%s) overlaps an earlier schedule, skipping %d duplicate day/time slots",
+			itin.ID, sched.Name, len(skip))
+		sample := task
+		task = func(run *jobRun) func() error {
+			fetch := sample(run)
+			return func() error {
+				if skip[slotAt(sched.Layer(), time.Now())] {
+					return errSkipped
+				}
+				return fetch()
+			}
+		}
+	}
+
+	expr := fmt.Sprintf("%d %d %d * * %s", int(start%time.Minute/time.Second), int(start%time.Hour/time.Minute), int(start/time.Hour),
+		cronDays(weekdays))
+	_, err := s.scheduler.NewJob(
+		gocron.CronJob(expr, true),
+		gocron.NewTask(func() { s.startBurst(itin, sched, task, time.Now(), len(times)) }),
+		gocron.WithName(fmt.Sprintf("%s-%s-start", itin.ID, sched.Name)),
+		gocron.WithTags(itin.Tags...),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create burst job at %s: %w", sched.StartTime, err)
+	}
+
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if slices.Contains(weekdays, now.Weekday()) && now.After(midnight.Add(start)) {
+		for i, t := range times[1:] {
+			if next := midnight.Add(t); next.After(now) {
+				s.startBurst(itin, sched, task, next, len(times)-1-i)
+				break
+			}
+		}
+	}
+
+	log.Printf("Created burst job for %s (%s), sampling every %s from %s to %s", itin.ID, sched.Name, sched.Every(),
+		sched.StartTime, sched.EndTime)
+	return 1, nil
+}
+
+// claimTimes adds the times of a burst schedule on its days to taken,
+// returning those already in it
+func claimTimes(sched config.Schedule, weekdays []time.Weekday, taken map[slotDay]bool) map[slotDay]bool {
+	skip := make(map[slotDay]bool)
+	for _, t := range sched.Times() {
+		slot := timeSlot{hour: int(t / time.Hour), minute: int(t % time.Hour / time.Minute), second: int(t % time.Minute / time.Second)}
+		for _, day := range weekdays {
+			key := slotDay{sched.Layer(), slot, day}
+			if taken[key] {
+				skip[key] = true
+				continue
+			}
+			taken[key] = true
+		}
+	}
+	return skip
+}
+
+// slotAt returns the time slot of a run at t, to the nearest second
+func slotAt(layer string, t time.Time) slotDay {
+	t = t.Round(time.Second)
+	return slotDay{layer, timeSlot{t.Hour(), t.Minute(), t.Second()}, t.Weekday()}
+}
+
+// startBurst samples a burst schedule every interval from first, runs times.
+// Runs that come while the previous one is still fetching are skipped.
+func (s *Scheduler) startBurst(itin config.Itinerary, sched config.Schedule, task func(run *jobRun) func() error, first time.Time, runs int) {
+	start := gocron.WithStartImmediately()
+	if first.After(time.Now()) {
+		start = gocron.WithStartDateTime(first)
+	}
+
+	s.mu.RLock()
+	scheduler := s.scheduler
+	s.mu.RUnlock()
+	run := &jobRun{}
+	_, err := scheduler.NewJob(
+		gocron.DurationJob(sched.Every()),
+		gocron.NewTask(task(run)),
+		gocron.WithName(fmt.Sprintf("%s-%s-%s", itin.ID, sched.Name, first.Format(time.TimeOnly))),
+		gocron.WithTags(itin.Tags...),
+		gocron.WithStartAt(start),
+		gocron.WithLimitedRuns(uint(runs)),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		s.jobListeners(itin, sched.Name, run),
+	)
+	if err != nil {
+		log.Printf("ERROR starting burst of %s (%s): %v", itin.ID, sched.Name, err)
+	}
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"gommutetime/internal/config"
+)
+
+func TestBurstSkipsTakenSlots(t *testing.T) {
+	s, err := New(&config.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer s.scheduler.Shutdown()
+
+	itin := config.Itinerary{ID: "work"}
+	regular := config.Schedule{Name: "morning", Days: []string{"mon", "tue"}, StartTime: "07:00", EndTime: "07:30", IntervalMinutes: 15}
+	burst := config.Schedule{Name: "burst", Days: []string{"mon"}, StartTime: "07:00", EndTime: "07:20", Interval: "90s"}
+
+	taken := make(map[slotDay]bool)
+	if n, err := s.addSchedule(context.Background(), itin, regular, taken); err != nil || n != 3 {
+		t.Fatalf("addSchedule(regular) = %d, %v, want 3 jobs", n, err)
+	}
+	before := maps.Clone(taken)
+
+	// Every 90 seconds from 07:00 meets the regular schedule at 07:00 and 07:15
+	skip := claimTimes(burst, burst.Weekdays(), taken)
+	at := func(hour, minute, second int) slotDay {
+		return slotDay{"", timeSlot{hour, minute, second}, time.Monday}
+	}
+	want := []slotDay{at(7, 0, 0), at(7, 15, 0)}
+	if got := slices.Collect(maps.Keys(skip)); len(got) != len(want) || !skip[want[0]] || !skip[want[1]] {
+		t.Errorf("skipped slots = %v, want %v", got, want)
+	}
+	for _, tm := range burst.Times() {
+		slot := at(int(tm/time.Hour), int(tm%time.Hour/time.Minute), int(tm%time.Minute/time.Second))
+		if !taken[slot] {
+			t.Errorf("slot %v not taken by the burst", slot)
+		}
+		if !before[slot] && skip[slot] {
+			t.Errorf("slot %v skipped though no other schedule samples it", slot)
+		}
+	}
+
+	// Runs are matched to their slot to the nearest second
+	monday := time.Date(2026, 10, 12, 7, 15, 0, 300*int(time.Millisecond), time.Local)
+	if !skip[slotAt("", monday)] {
+		t.Errorf("run at %s not skipped", monday.Format(time.TimeOnly))
+	}
+	if next := monday.Add(90 * time.Second); skip[slotAt("", next)] {
+		t.Errorf("run at %s skipped", next.Format(time.TimeOnly))
+	}
+
+	// The burst is still scheduled alongside the regular jobs
+	taken = make(map[slotDay]bool)
+	s.addSchedule(context.Background(), itin, regular, taken)
+	if n, err := s.addSchedule(context.Background(), itin, burst, taken); err != nil || n != 1 {
+		t.Errorf("addSchedule(burst) = %d, %v, want 1 job", n, err)
+	}
+	var names []string
+	for _, job := range s.scheduler.Jobs() {
+		names = append(names, job.Name())
+	}
+	if !slices.Contains(names, "work-burst-start") {
+		t.Errorf("jobs = %v, want work-burst-start", names)
+	}
+}
@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"gommutetime/internal/config"
+)
+
+// ManualSchedule labels the samples of runs triggered with RunNow
+const ManualSchedule = "manual"
+
+// RunNow fetches an itinerary right away, outside its schedules. Paused
+// itineraries can still be run manually.
+func (s *Scheduler) RunNow(id string) error {
+	itin, err := s.itinerary(id)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Manual run of %s", id)
+	go s.runManually(itin.ID+"-"+ManualSchedule, itin, ManualSchedule, func(run *jobRun) func() error {
+		return s.createTask(itin, ManualSchedule, run)
+	})
+	return nil
+}
+
+// Pause stops the scheduled fetches of an itinerary until Resume is called.
+// Pauses last until the daemon restarts and survive config reloads.
+func (s *Scheduler) Pause(id string) error {
+	if _, err := s.itinerary(id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused == nil {
+		s.paused = make(map[string]bool)
+	}
+	s.paused[id] = true
+	log.Printf("Paused %s", id)
+	return nil
+}
+
+// Resume restarts the scheduled fetches of a paused itinerary
+func (s *Scheduler) Resume(id string) error {
+	if _, err := s.itinerary(id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.paused, id)
+	log.Printf("Resumed %s", id)
+	return nil
+}
+
+// Paused reports whether an itinerary is paused
+func (s *Scheduler) Paused(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.paused[id]
+}
+
+// itinerary finds a configured itinerary by ID
+func (s *Scheduler) itinerary(id string) (config.Itinerary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := slices.IndexFunc(s.config.Itineraries, func(itin config.Itinerary) bool { return itin.ID == id })
+	if index < 0 {
+		return config.Itinerary{}, fmt.Errorf("unknown itinerary: %s", id)
+	}
+	return s.config.Itineraries[index], nil
+}
@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/fetcher"
+	"gommutetime/internal/history"
+	"gommutetime/internal/weather"
+)
+
+// DenseSchedule labels the samples taken while sampling densely
+const DenseSchedule = "dense"
+
+// weatherInterval is the least time between weather checks of an itinerary
+const weatherInterval = 10 * time.Minute
+
+// dense is the dense sampling state of an itinerary
+type dense struct {
+	// until is when dense sampling stops, unless its condition holds again
+	until  time.Time
+	reason string
+	// last is when the itinerary was last sampled, by any schedule
+	last time.Time
+	// checked is when the weather was last checked
+	checked time.Time
+}
+
+// addDense creates the job checking every minute whether an itinerary with
+// dense sampling is due for a sample
+func (s *Scheduler) addDense(itin config.Itinerary) error {
+	run := &jobRun{}
+	_, err := s.scheduler.NewJob(
+		gocron.DurationJob(time.Minute),
+		gocron.NewTask(func() error { return s.denseTick(itin, run) }),
+		gocron.WithName(itin.ID+"-"+DenseSchedule),
+		gocron.WithTags(itin.Tags...),
+		s.jobListeners(itin, DenseSchedule, run),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create dense sampling job: %w", err)
+	}
+	log.Printf("Created dense sampling job for %s", itin.ID)
+	return nil
+}
+
+// denseTick samples an itinerary when dense sampling is on, the last sample
+// is an interval old and a schedule's window is open. The weather is
+// checked first when it can start dense sampling.
+func (s *Scheduler) denseTick(itin config.Itinerary, run *jobRun) error {
+	now := time.Now()
+	if s.Paused(itin.ID) || !itin.InWindow(now) {
+		return errSkipped
+	}
+
+	if len(itin.Dense.Weather) > 0 {
+		s.checkWeather(itin, now)
+	}
+
+	s.mu.RLock()
+	state := s.dense[itin.ID]
+	s.mu.RUnlock()
+	if now.After(state.until) {
+		return errSkipped
+	}
+	// Leave a little slack for samples taken a few seconds into a minute
+	if now.Sub(state.last) < time.Duration(itin.Dense.IntervalMinutes)*time.Minute-10*time.Second {
+		return errSkipped
+	}
+	return s.createTask(itin, DenseSchedule, run)()
+}
+
+// checkWeather starts or extends dense sampling of an itinerary while one
+// of its weather conditions holds at the origin
+func (s *Scheduler) checkWeather(itin config.Itinerary, now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.dense[itin.ID].checked) < weatherInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.setDense(itin.ID, func(d *dense) { d.checked = now })
+	client := s.weather
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	p, ok := s.origin(ctx, itin)
+	if !ok {
+		return
+	}
+	condition, err := client.Current(ctx, p)
+	if err != nil {
+		log.Printf("Warning: %s: weather check failed: %v", itin.ID, err)
+		return
+	}
+	if slices.Contains(itin.Dense.Weather, condition) {
+		s.densify(itin, condition+" at the origin")
+	}
+}
+
+// checkBaseline starts or extends dense sampling of an itinerary when a
+// sample takes much longer than usual
+func (s *Scheduler) checkBaseline(itin config.Itinerary, sample history.Sample) {
+	if itin.Dense == nil || itin.Dense.AboveBaselineMinutes == 0 {
+		return
+	}
+	baseline := s.notifier.Baseline(itin, sample.Timestamp)
+	if baseline.Count > 0 && sample.Duration-baseline.Mean >= itin.Dense.AboveBaselineMinutes {
+		s.densify(itin, fmt.Sprintf("%.1f min over the usual %.1f min", sample.Duration-baseline.Mean, baseline.Mean))
+	}
+}
+
+// densify samples an itinerary densely until its hold time has passed
+func (s *Scheduler) densify(itin config.Itinerary, reason string) {
+	until := time.Now().Add(itin.Dense.Hold())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Now().After(s.dense[itin.ID].until) {
+		log.Printf("Dense sampling of %s every %d min: %s", itin.ID, itin.Dense.IntervalMinutes, reason)
+	}
+	s.setDense(itin.ID, func(d *dense) { d.until, d.reason = until, reason })
+}
+
+// sampled records when an itinerary with dense sampling was last sampled
+func (s *Scheduler) sampled(itin config.Itinerary, at time.Time) {
+	if itin.Dense == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setDense(itin.ID, func(d *dense) { d.last = at })
+}
+
+// setDense updates the dense sampling state of an itinerary; s.mu must be
+// held
+func (s *Scheduler) setDense(id string, update func(*dense)) {
+	if s.dense == nil {
+		s.dense = make(map[string]dense)
+	}
+	state := s.dense[id]
+	update(&state)
+	s.dense[id] = state
+}
+
+// newWeather creates the weather client of a config, going through the
+// proxy and CA bundle of API requests
+func newWeather(cfg *config.Config) *weather.Client {
+	client, err := fetcher.NewHTTPClient(cfg.API)
+	if err != nil {
+		client = http.DefaultClient
+	}
+	return weather.New(client)
+}
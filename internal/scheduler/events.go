@@ -0,0 +1,217 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/events"
+	"gommutetime/internal/history"
+)
+
+// Kinds of job events
+const (
+	JobStarted   = "started"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	// JobSkipped ends the runs that had nothing to do, e.g. for a paused
+	// itinerary or between the samples of dense sampling, whose job runs
+	// every minute
+	JobSkipped = "skipped"
+)
+
+// errSkipped is returned by the tasks of jobs that had nothing to do
+var errSkipped = errors.New("skipped")
+
+// JobEvent is a step in the run of a job, from gocron's job event
+// listeners. Manual runs report the same events.
+type JobEvent struct {
+	Kind string
+	// Job is the name of the job, e.g. work-morning-07:30
+	Job       string
+	Itinerary config.Itinerary
+	Schedule  string
+	// Sample is what a single-route itinerary recorded from its primary
+	// provider when it succeeded, and Latency how long the provider took
+	// to respond
+	Sample  *history.Sample
+	Latency time.Duration
+	// Samples is every sample the run recorded: Sample and those of the
+	// other providers compared, or one per pair of a matrix itinerary that
+	// succeeded
+	Samples []history.Sample
+	// FailedPairs counts the pairs of a matrix fetch that failed while
+	// others succeeded
+	FailedPairs int
+	// Err is why the job failed, and Failures how many fetches of the
+	// itinerary failed in a row, zero when the job panicked
+	Err      error
+	Failures int
+}
+
+// OnJob calls fn with the events of every job run, in the order they were
+// subscribed, after the alerts and metrics of the scheduler. fn runs in the
+// job's goroutine, with the trace of its run.
+func (s *Scheduler) OnJob(fn func(ctx context.Context, e JobEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onJob = append(s.onJob, fn)
+}
+
+// emit calls the subscribers with a job event
+func (s *Scheduler) emit(ctx context.Context, e JobEvent) {
+	s.mu.RLock()
+	subscribers := s.onJob
+	s.mu.RUnlock()
+	for _, fn := range subscribers {
+		fn(ctx, e)
+	}
+}
+
+// jobRun carries what a run of a job did to its event listeners, which
+// gocron calls with the job's name only. Runs of a job do not overlap: its
+// time slot comes at most once a day, dense sampling checks are a minute
+// apart, and burst jobs skip the runs that would.
+type jobRun struct {
+	mu   sync.Mutex
+	last outcome
+}
+
+// outcome is what a run did
+type outcome struct {
+	span        trace.SpanContext
+	sample      *history.Sample
+	latency     time.Duration
+	samples     []history.Sample
+	failedPairs int
+	failures    int
+}
+
+// recordFailure keeps the failures in a row of the itinerary of a failed run
+func (r *jobRun) recordFailure(span trace.SpanContext, failures int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = outcome{span: span, failures: failures}
+}
+
+// recordSample keeps the sample a run recorded, which its provider
+// returned after latency, and the samples of the other providers compared
+func (r *jobRun) recordSample(span trace.SpanContext, sample *history.Sample, latency time.Duration, others []history.Sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = outcome{span: span, sample: sample, latency: latency, samples: append([]history.Sample{*sample}, others...)}
+}
+
+// recordPairs keeps the samples of the pairs of a matrix itinerary a run
+// recorded, failedPairs others having failed
+func (r *jobRun) recordPairs(span trace.SpanContext, samples []history.Sample, failedPairs int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = outcome{span: span, samples: samples, failedPairs: failedPairs}
+}
+
+// take returns and clears the outcome of the last run
+func (r *jobRun) take() outcome {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := r.last
+	r.last = outcome{}
+	return last
+}
+
+// jobListeners reports the runs of a job as events
+func (s *Scheduler) jobListeners(itin config.Itinerary, schedule string, run *jobRun) gocron.JobOption {
+	return gocron.WithEventListeners(
+		gocron.BeforeJobRuns(func(_ uuid.UUID, name string) {
+			s.started(name, itin, schedule)
+		}),
+		gocron.AfterJobRuns(func(_ uuid.UUID, name string) {
+			s.finished(name, itin, schedule, run, nil)
+		}),
+		gocron.AfterJobRunsWithError(func(_ uuid.UUID, name string, err error) {
+			s.finished(name, itin, schedule, run, err)
+		}),
+	)
+}
+
+// started reports the start of a job's run
+func (s *Scheduler) started(name string, itin config.Itinerary, schedule string) {
+	s.emit(context.Background(), JobEvent{Kind: JobStarted, Job: name, Itinerary: itin, Schedule: schedule})
+}
+
+// finished reports the end of a job's run, which returned err
+func (s *Scheduler) finished(name string, itin config.Itinerary, schedule string, run *jobRun, err error) {
+	last := run.take()
+	e := JobEvent{Kind: JobSucceeded, Job: name, Itinerary: itin, Schedule: schedule,
+		Sample: last.sample, Latency: last.latency, Samples: last.samples, FailedPairs: last.failedPairs}
+	switch {
+	case errors.Is(err, errSkipped):
+		e.Kind = JobSkipped
+	case err != nil:
+		e.Kind, e.Err, e.Failures = JobFailed, err, last.failures
+	}
+
+	ctx, cancel := context.WithTimeout(trace.ContextWithSpanContext(context.Background(), last.span), 30*time.Second)
+	defer cancel()
+	s.emit(ctx, e)
+}
+
+// runManually runs a task outside of gocron, reporting the same events
+func (s *Scheduler) runManually(name string, itin config.Itinerary, schedule string, task func(run *jobRun) func() error) {
+	run := &jobRun{}
+	s.started(name, itin, schedule)
+	s.finished(name, itin, schedule, run, task(run)())
+}
+
+// checkSample checks the sample of a successful run against the alert
+// rules and dense sampling thresholds
+func (s *Scheduler) checkSample(ctx context.Context, e JobEvent) {
+	if e.Kind != JobSucceeded || e.Sample == nil {
+		return
+	}
+	s.notifier.Check(ctx, e.Itinerary, *e.Sample)
+	s.checkBaseline(e.Itinerary, *e.Sample)
+}
+
+// countRun records the outcome of a finished run in the job metrics
+func countRun(ctx context.Context, e JobEvent) {
+	attrs := []attribute.KeyValue{attribute.String("itinerary.id", e.Itinerary.ID)}
+	switch {
+	case e.Kind == JobFailed:
+		attrs = append(attrs, attribute.String("outcome", "error"), attribute.String("error.kind", apperr.KindOf(e.Err).String()))
+	case e.Kind == JobSucceeded && e.FailedPairs > 0:
+		attrs = append(attrs, attribute.String("outcome", "partial"))
+	case e.Kind == JobSucceeded:
+		attrs = append(attrs, attribute.String("outcome", "success"))
+	default:
+		return
+	}
+	jobRuns.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
+
+// PublishTo publishes the samples, successes and failures of job runs to
+// an event bus
+func (s *Scheduler) PublishTo(bus *events.Bus) {
+	s.OnJob(func(ctx context.Context, e JobEvent) {
+		switch {
+		case e.Kind == JobSucceeded:
+			for _, sample := range e.Samples {
+				bus.Publish(ctx, events.Event{Kind: events.SampleRecorded, Time: sample.Timestamp,
+					Itinerary: e.Itinerary, Sample: sample})
+			}
+			bus.Publish(ctx, events.Event{Kind: events.JobSucceeded, Itinerary: e.Itinerary})
+		case e.Kind == JobFailed && e.Failures > 0:
+			bus.Publish(ctx, events.Event{Kind: events.JobFailed, Itinerary: e.Itinerary,
+				Err: e.Err, Failures: e.Failures})
+		}
+	})
+}
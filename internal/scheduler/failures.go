@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"sync"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/fetcher"
+)
+
+// failureWatch detects a reloaded config whose jobs keep failing. Network
+// outages and exhausted quotas say nothing about the config and are ignored.
+type failureWatch struct {
+	mu        sync.Mutex
+	threshold int
+	fn        func(failures int)
+	armed     bool // a config was reloaded and no job has succeeded since
+	failures  int
+}
+
+// OnRepeatedFailures calls fn once when threshold jobs in a row fail after
+// a config reload, before any job succeeds with the new config
+func (s *Scheduler) OnRepeatedFailures(threshold int, fn func(failures int)) {
+	s.failures.mu.Lock()
+	defer s.failures.mu.Unlock()
+	s.failures.threshold = threshold
+	s.failures.fn = fn
+}
+
+// rearm starts watching the jobs of a reloaded config
+func (w *failureWatch) rearm() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.armed = true
+	w.failures = 0
+}
+
+// succeeded records a successful job, which clears the new config
+func (w *failureWatch) succeeded() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.armed = false
+}
+
+// failed records a failed job
+func (w *failureWatch) failed(err error) {
+	if fetcher.IsTransportError(err) || apperr.KindOf(err) == apperr.KindQuota {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.armed || w.fn == nil {
+		return
+	}
+
+	w.failures++
+	if w.failures >= w.threshold {
+		w.armed = false
+		// The handler may reload the config, so run it outside the job
+		go w.fn(w.failures)
+	}
+}
+
+// streaks counts the fetches in a row that failed for each itinerary
+type streaks struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// failed records a failed fetch of an itinerary, returning how many failed
+// in a row
+func (st *streaks) failed(id string) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.counts == nil {
+		st.counts = make(map[string]int)
+	}
+	st.counts[id]++
+	return st.counts[id]
+}
+
+// succeeded ends the streak of an itinerary
+func (st *streaks) succeeded(id string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.counts, id)
+}
+
+// failed records a failed fetch, returning how many fetches of the
+// itinerary failed in a row
+func (s *Scheduler) failed(itin config.Itinerary, err error) int {
+	s.failures.failed(err)
+	return s.streaks.failed(itin.ID)
+}
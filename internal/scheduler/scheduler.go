@@ -4,47 +4,118 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"gommutetime/internal/apperr"
 	"gommutetime/internal/config"
 	"gommutetime/internal/fetcher"
+	"gommutetime/internal/history"
+	"gommutetime/internal/notify"
+	"gommutetime/internal/reporting"
+	"gommutetime/internal/weather"
+)
+
+var (
+	tracer = otel.Tracer("gommutetime/internal/scheduler")
+	meter  = otel.Meter("gommutetime/internal/scheduler")
+
+	jobRuns, _ = meter.Int64Counter("gommutetime.job.runs",
+		metric.WithDescription("Scheduled fetch job executions"))
+	commuteDuration, _ = meter.Float64Histogram("gommutetime.commute.duration",
+		metric.WithDescription("Fetched commute duration in traffic"),
+		metric.WithUnit("min"))
 )
 
 // Scheduler manages scheduled commute time fetches
 type Scheduler struct {
+	mu        sync.RWMutex
 	scheduler gocron.Scheduler
 	fetcher   *fetcher.Fetcher
+	notifier  *notify.Manager
 	config    *config.Config
+	// paused holds the IDs of itineraries whose scheduled fetches are skipped
+	paused   map[string]bool
+	failures failureWatch
+	streaks  streaks
+	// onJob are called with the events of every job run
+	onJob []func(ctx context.Context, e JobEvent)
+	// origins caches the geocoded origins of itineraries by address
+	origins map[string]origin
+	// dense holds the dense sampling state of itineraries by ID, which
+	// survives config reloads
+	dense   map[string]dense
+	weather *weather.Client
+	// shifts holds the shifts read from the calendars of itineraries by ID
+	shifts map[string]shifts
+	// plans holds today's plan of adaptive schedules by itinerary ID and
+	// schedule name
+	plans map[string]plan
 }
 
 // New creates a new scheduler instance
-func New(cfg *config.Config, fetch *fetcher.Fetcher) (*Scheduler, error) {
+func New(cfg *config.Config, fetch *fetcher.Fetcher, notifier *notify.Manager) (*Scheduler, error) {
 	s, err := gocron.NewScheduler()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create scheduler: %w", err)
 	}
 
-	return &Scheduler{
+	sched := &Scheduler{
 		scheduler: s,
 		fetcher:   fetch,
+		notifier:  notifier,
 		config:    cfg,
-	}, nil
+	}
+	sched.OnJob(sched.checkSample)
+	sched.OnJob(countRun)
+	return sched, nil
+}
+
+// succeeded records a successful fetch, ending the failure streak of an
+// itinerary
+func (s *Scheduler) succeeded(itin config.Itinerary) {
+	s.failures.succeeded()
+	s.streaks.succeeded(itin.ID)
 }
 
 // Start initializes all jobs from config and starts the scheduler
 func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	s.weather = newWeather(s.config)
+	s.mu.Unlock()
+
 	// Create jobs for each itinerary/schedule combination
 	jobCount := 0
 	for _, itinerary := range s.config.Itineraries {
+		// Overlapping schedules of the same layer share one job per time slot
+		taken := make(map[slotDay]bool)
 		for _, schedule := range itinerary.Schedules {
-			count, err := s.addSchedule(ctx, itinerary, schedule)
+			count, err := s.addSchedule(ctx, itinerary, schedule, taken)
 			if err != nil {
 				return fmt.Errorf("failed to add schedule %s for %s: %w",
 					schedule.Name, itinerary.ID, err)
 			}
 			jobCount += count
 		}
+		if itinerary.Dense != nil {
+			if err := s.addDense(itinerary); err != nil {
+				return fmt.Errorf("failed to add dense sampling for %s: %w", itinerary.ID, err)
+			}
+			jobCount++
+		}
+		if itinerary.Shifts != nil {
+			if err := s.addShifts(itinerary); err != nil {
+				return fmt.Errorf("failed to add shifts for %s: %w", itinerary.ID, err)
+			}
+			jobCount++
+		}
 	}
 
 	// Start the scheduler
@@ -54,9 +125,17 @@ func (s *Scheduler) Start(ctx context.Context) error {
 	return nil
 }
 
-// addSchedule creates jobs for a single schedule configuration
-func (s *Scheduler) addSchedule(ctx context.Context, itin config.Itinerary, sched config.Schedule) (int, error) {
-	// Parse start and end times
+// addSchedule creates jobs for a single schedule configuration, skipping
+// the days of each time slot already in taken and adding the rest to it,
+// except for adaptive schedules. taken must not change once the jobs run.
+func (s *Scheduler) addSchedule(ctx context.Context, itin config.Itinerary, sched config.Schedule, taken map[slotDay]bool) (int, error) {
+	if sched.SuppressOnly() {
+		log.Printf("Schedule %s suppresses the regular schedules of %s on %s",
+			sched.Name, itin.ID, strings.Join(sched.Dates, ", "))
+		return 0, nil
+	}
+
+	// Parse start and end times, to the minute
 	startHour, startMin, err := config.ParseTime(sched.StartTime)
 	if err != nil {
 		return 0, fmt.Errorf("invalid start time: %w", err)
@@ -68,31 +147,89 @@ func (s *Scheduler) addSchedule(ctx context.Context, itin config.Itinerary, sche
 	}
 
 	// Convert day names to weekdays
-	weekdays := []time.Weekday{}
 	for _, dayName := range sched.Days {
-		day, err := config.DayNameToWeekday(dayName)
-		if err != nil {
+		if _, err := config.DayNameToWeekday(dayName); err != nil {
 			return 0, err
 		}
-		weekdays = append(weekdays, day)
+	}
+	weekdays := sched.Weekdays()
+
+	// Create the job task with panic recovery, skipping paused itineraries,
+	// days on which the schedule is replaced by an override or is outside
+	// its override dates, and days off its roster
+	task := func(run *jobRun) func() error {
+		fetch := s.createTask(itin, sched.Name, run)
+		return func() error {
+			if s.Paused(itin.ID) {
+				log.Printf("Skipping %s (%s): paused", itin.ID, sched.Name)
+				return errSkipped
+			}
+			if itin.HasOverrides() && !itin.Active(sched, time.Now()) {
+				log.Printf("Skipping %s (%s): not active today", itin.ID, sched.Name)
+				return errSkipped
+			}
+			if !sched.OnRoster(time.Now()) {
+				log.Printf("Skipping %s (%s): not on the roster today", itin.ID, sched.Name)
+				return errSkipped
+			}
+			return fetch()
+		}
 	}
 
-	// Create the job task with panic recovery
-	task := s.createTask(itin)
+	// Times cron minutes cannot express are sampled by a duration job
+	if sched.Burst() {
+		return s.addBurst(itin, sched, weekdays, task, taken)
+	}
 
 	// Generate time slots within the window
-	slots := generateTimeSlots(startHour, startMin, endHour, endMin, sched.IntervalMinutes)
+	slots := generateTimeSlots(startHour, startMin, endHour, endMin, int(sched.Every()/time.Minute))
 
 	// Create a job for each time slot
-	jobCount := 0
+	jobCount, duplicates := 0, 0
 	for _, slot := range slots {
+		// Leave out days on which another schedule already samples this time.
+		// Adaptive schedules skip most of their slots, so they leave them to
+		// later schedules and skip them when they run.
+		days := make([]time.Weekday, 0, len(weekdays))
+		for _, day := range weekdays {
+			key := slotDay{sched.Layer(), slot, day}
+			if taken[key] {
+				duplicates++
+				continue
+			}
+			if sched.Adaptive == nil {
+				taken[key] = true
+			}
+			days = append(days, day)
+		}
+		if len(days) == 0 {
+			continue
+		}
+
+		// Adaptive schedules only sample the time slots of the day's plan that
+		// no later schedule samples
+		run := &jobRun{}
+		slotTask := task(run)
+		if sched.Adaptive != nil {
+			slot, minute, fetch := slot, slot.hour*60+slot.minute, slotTask
+			slotTask = func() error {
+				now := time.Now()
+				if taken[slotDay{sched.Layer(), slot, now.Weekday()}] || !s.planned(itin, sched, minute, now) {
+					return errSkipped
+				}
+				return fetch()
+			}
+		}
+
 		// Build cron expression for this specific time on specified days
-		cronExpr := buildCronExpression(slot.hour, slot.minute, weekdays)
+		cronExpr := buildCronExpression(slot.hour, slot.minute, days)
 
 		_, err := s.scheduler.NewJob(
 			gocron.CronJob(cronExpr, false),
-			gocron.NewTask(task),
+			gocron.NewTask(slotTask),
 			gocron.WithName(fmt.Sprintf("%s-%s-%02d:%02d", itin.ID, sched.Name, slot.hour, slot.minute)),
+			gocron.WithTags(itin.Tags...),
+			s.jobListeners(itin, sched.Name, run),
 		)
 
 		if err != nil {
@@ -102,35 +239,207 @@ func (s *Scheduler) addSchedule(ctx context.Context, itin config.Itinerary, sche
 	}
 
 	log.Printf("Created %d jobs for %s (%s)", jobCount, itin.ID, sched.Name)
+	if sched.Adaptive != nil {
+		log.Printf("Adaptive schedule %s (%s) samples %d of its times a day", itin.ID, sched.Name, sched.Requests())
+	}
+	if duplicates > 0 {
+		log.Printf("Warning: %s (%s) overlaps an earlier schedule, skipped %d duplicate day/time slots",
+			itin.ID, sched.Name, duplicates)
+	}
 	return jobCount, nil
 }
 
-// createTask creates a task function with panic recovery
-func (s *Scheduler) createTask(itin config.Itinerary) func() {
-	return func() {
+// createTask creates a task function with panic recovery. Samples are
+// labeled with the schedule name and the tags of sampleTags. The outcome
+// is recorded in run for the job's event listeners.
+func (s *Scheduler) createTask(itin config.Itinerary, schedule string, run *jobRun) func() error {
+	return func() (err error) {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("PANIC in job %s: %v", itin.ID, r)
+				reporting.Panic(r, map[string]string{"itinerary.id": itin.ID, "schedule": schedule})
+				err = fmt.Errorf("panic: %v", r)
 			}
 		}()
 
 		jobCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
-		log.Printf("Fetching: %s -> %s (%s)", itin.From, itin.To, itin.Name)
+		itinAttr := attribute.String("itinerary.id", itin.ID)
+		jobCtx, span := tracer.Start(jobCtx, "job.fetch", trace.WithAttributes(itinAttr))
+		defer span.End()
+
+		s.sampled(itin, time.Now())
+		tags := s.sampleTags(jobCtx, itin, time.Now())
+		labels := fetcher.Labels{Schedule: schedule, Tags: tags}
+
+		if itin.IsMatrix() {
+			return s.fetchMatrix(jobCtx, span, itin, labels, run)
+		}
+
+		switch {
+		case itin.IsParkAndRide():
+			log.Printf("Fetching: %s -> %s -> %s (%s)", itin.From, itin.Via, itin.To, itin.Name)
+		case itin.IsCarpool():
+			log.Printf("Fetching: %s -> %d stops -> %s (%s)", itin.From, len(itin.Stops), itin.To, itin.Name)
+		default:
+			log.Printf("Fetching: %s -> %s (%s)", itin.From, itin.To, itin.Name)
+		}
 
-		if err := s.fetcher.FetchAndSave(jobCtx, itin.From, itin.To, itin.OutputFile); err != nil {
-			log.Printf("ERROR fetching %s: %v", itin.ID, err)
+		result, others, err := s.fetchRoute(jobCtx, itin, labels)
+		if err != nil {
+			jobFailed(span, itin, err)
+			run.recordFailure(span.SpanContext(), s.failed(itin, err))
+			return err
+		}
+		s.succeeded(itin)
+		duration := result.Duration
+		if s.fetcher.ReadOnly() {
+			log.Printf("Fetched %s: %.1f min in %s from %s (read-only, not saved)", itin.ID, duration, result.Latency.Round(time.Millisecond), result.Provider)
 		} else {
-			log.Printf("Successfully saved to %s", itin.OutputFile)
+			log.Printf("Successfully saved to %s (%s responded in %s)", itin.OutputFile, result.Provider, result.Latency.Round(time.Millisecond))
+		}
+
+		commuteDuration.Record(jobCtx, duration, metric.WithAttributes(itinAttr))
+
+		now := time.Now()
+		sample := history.Sample{Timestamp: now, Duration: duration,
+			Provider: result.Provider, Schedule: schedule, Tags: tags,
+			Elements: result.Elements, Cost: result.Cost, Legs: result.Legs, Direct: result.Direct}
+		var samples []history.Sample
+		for _, other := range others {
+			samples = append(samples, history.Sample{Timestamp: now, Duration: other.Duration,
+				Provider: other.Provider, Schedule: schedule, Tags: tags, Elements: other.Elements, Cost: other.Cost})
+		}
+		run.recordSample(span.SpanContext(), &sample, result.Latency, samples)
+		return nil
+	}
+}
+
+// fetchRoute fetches and stores a single-route, park-and-ride or carpool
+// itinerary. When it compares providers, the others are fetched alongside
+// the primary one: the result is the primary one's, followed by those of the
+// others that succeeded. Those that failed are only logged.
+func (s *Scheduler) fetchRoute(ctx context.Context, itin config.Itinerary, labels fetcher.Labels) (fetcher.Result, []fetcher.Result, error) {
+	s.mu.RLock()
+	simulate := s.config.Simulate
+	s.mu.RUnlock()
+	if itin.IsParkAndRide() {
+		result, err := s.fetcher.FetchParkAndRideAndSave(ctx, itin.From, itin.Via, itin.To, itin.OutputFile, labels)
+		return result, nil, err
+	}
+	if itin.IsCarpool() {
+		result, err := s.fetcher.FetchCarpoolAndSave(ctx, itin.From, itin.Stops, itin.To, itin.Direct, itin.OutputFile, labels)
+		return result, nil, err
+	}
+	travel := fetcher.Travel{Mode: itin.Mode, Pace: itin.Pace}
+	if len(itin.Providers) == 0 || simulate {
+		result, err := s.fetcher.FetchAndSave(ctx, itin.From, itin.To, travel, itin.OutputFile, labels)
+		return result, nil, err
+	}
+
+	var wg sync.WaitGroup
+	fetched := make([]*fetcher.Result, len(itin.Providers)-1)
+	for i, provider := range itin.Providers[1:] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := s.fetcher.FetchAndSaveFrom(ctx, provider, itin.From, itin.To, travel, itin.OutputFile, labels)
+			if err != nil {
+				log.Printf("ERROR fetching %s from %s: %v error_kind=%s", itin.ID, provider, err, apperr.KindOf(err))
+				return
+			}
+			commuteDuration.Record(ctx, result.Duration, metric.WithAttributes(
+				attribute.String("itinerary.id", itin.ID), attribute.String("provider", provider)))
+			log.Printf("Fetched %s from %s: %.1f min", itin.ID, provider, result.Duration)
+			fetched[i] = &result
+		}()
+	}
+
+	result, err := s.fetcher.FetchAndSaveFrom(ctx, itin.PrimaryProvider(), itin.From, itin.To, travel, itin.OutputFile, labels)
+	wg.Wait()
+	var others []fetcher.Result
+	for _, other := range fetched {
+		if other != nil {
+			others = append(others, *other)
+		}
+	}
+	return result, others, err
+}
+
+// fetchMatrix fetches and stores every origin/destination pair of a matrix
+// itinerary, logging the pairs that fail without discarding the others. It
+// fails when every pair does.
+func (s *Scheduler) fetchMatrix(ctx context.Context, span trace.Span, itin config.Itinerary, labels fetcher.Labels, run *jobRun) error {
+	itinAttr := attribute.String("itinerary.id", itin.ID)
+
+	log.Printf("Fetching: %d origins x %d destinations (%s)", len(itin.Origins), len(itin.Destinations), itin.Name)
+
+	elements, err := s.fetcher.FetchMatrixAndSave(ctx, itin.Origins, itin.Destinations, itin.OutputFile, labels)
+	if err != nil {
+		jobFailed(span, itin, err)
+		run.recordFailure(span.SpanContext(), s.failed(itin, err))
+		return err
+	}
+
+	// Elements are in row-major order: every destination for each origin
+	failed := 0
+	var lastErr error
+	var samples []history.Sample
+	now := time.Now()
+	for i, el := range elements {
+		origin := itin.Origins[i/len(itin.Destinations)].Label
+		destination := itin.Destinations[i%len(itin.Destinations)].Label
+
+		if el.Err != nil {
+			failed++
+			lastErr = el.Err
+			log.Printf("ERROR fetching %s %s -> %s: %v error_kind=%s", itin.ID, origin, destination, el.Err, apperr.KindOf(el.Err))
+			continue
 		}
+
+		commuteDuration.Record(ctx, el.Result.Duration, metric.WithAttributes(itinAttr,
+			attribute.String("origin", origin), attribute.String("destination", destination)))
+		samples = append(samples, history.Sample{Timestamp: now, Duration: el.Result.Duration,
+			Provider: el.Result.Provider, Origin: origin, Destination: destination,
+			Schedule: labels.Schedule, Tags: labels.Tags, Elements: el.Result.Elements, Cost: el.Result.Cost})
+	}
+
+	if failed == len(elements) {
+		span.SetStatus(codes.Error, "all origin/destination pairs failed")
+		run.recordFailure(span.SpanContext(), s.failed(itin, lastErr))
+		return lastErr
+	}
+	s.succeeded(itin)
+	run.recordPairs(span.SpanContext(), samples, failed)
+
+	if s.fetcher.ReadOnly() {
+		log.Printf("Fetched %d of %d pairs for %s (read-only, not saved)", len(elements)-failed, len(elements), itin.ID)
+	} else {
+		log.Printf("Saved %d of %d pairs to %s", len(elements)-failed, len(elements), itin.OutputFile)
 	}
+	return nil
+}
+
+// jobFailed logs a failed fetch and marks its span
+func jobFailed(span trace.Span, itin config.Itinerary, err error) {
+	log.Printf("ERROR fetching %s: %v error_kind=%s", itin.ID, err, apperr.KindOf(err))
+	span.SetStatus(codes.Error, err.Error())
 }
 
 // timeSlot represents a specific hour:minute
 type timeSlot struct {
 	hour   int
 	minute int
+	// second is only set for the times of burst schedules
+	second int
+}
+
+// slotDay is a time slot on a given weekday within a schedule layer
+type slotDay struct {
+	layer string
+	slot  timeSlot
+	day   time.Weekday
 }
 
 // generateTimeSlots creates all time slots within a window at the specified interval
@@ -159,23 +468,46 @@ func generateTimeSlots(startHour, startMin, endHour, endMin, intervalMinutes int
 func buildCronExpression(hour, minute int, weekdays []time.Weekday) string {
 	// Cron format: minute hour day-of-month month day-of-week
 	// Example: "15 6 * * 1-5" = 6:15 AM Monday-Friday
+	return fmt.Sprintf("%d %d * * %s", minute, hour, cronDays(weekdays))
+}
 
-	// Convert weekdays to cron day numbers (0=Sunday, 1=Monday, etc.)
+// cronDays converts weekdays to the day-of-week field of a cron expression,
+// e.g. "1,2,3" (0=Sunday, 1=Monday, etc.)
+func cronDays(weekdays []time.Weekday) string {
 	dayNums := make([]string, len(weekdays))
 	for i, day := range weekdays {
 		dayNums[i] = fmt.Sprintf("%d", int(day))
 	}
+	return strings.Join(dayNums, ",")
+}
 
-	// Join days with commas
-	daysStr := ""
-	for i, dayNum := range dayNums {
-		if i > 0 {
-			daysStr += ","
+// JobInfo describes the state of a scheduled job
+type JobInfo struct {
+	Name    string    `json:"name"`
+	Tags    []string  `json:"tags,omitempty"`
+	NextRun time.Time `json:"next_run"`
+	LastRun time.Time `json:"last_run,omitempty"`
+}
+
+// Jobs returns the currently scheduled jobs
+func (s *Scheduler) Jobs() []JobInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := s.scheduler.Jobs()
+	infos := make([]JobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		info := JobInfo{Name: job.Name(), Tags: job.Tags()}
+		if next, err := job.NextRun(); err == nil {
+			info.NextRun = next
+		}
+		if last, err := job.LastRun(); err == nil {
+			info.LastRun = last
 		}
-		daysStr += dayNum
+		infos = append(infos, info)
 	}
 
-	return fmt.Sprintf("%d %d * * %s", minute, hour, daysStr)
+	return infos
 }
 
 // Stop gracefully stops the scheduler
@@ -187,6 +519,10 @@ func (s *Scheduler) Stop() error {
 func (s *Scheduler) Reload(ctx context.Context, newConfig *config.Config) error {
 	log.Println("Reloading scheduler configuration...")
 
+	if err := s.notifier.Reload(newConfig); err != nil {
+		return fmt.Errorf("failed to reload notifications: %w", err)
+	}
+
 	// Shutdown old scheduler
 	if err := s.scheduler.Shutdown(); err != nil {
 		log.Printf("Warning: error shutting down old scheduler: %v", err)
@@ -198,8 +534,11 @@ func (s *Scheduler) Reload(ctx context.Context, newConfig *config.Config) error
 		return fmt.Errorf("failed to create new scheduler: %w", err)
 	}
 
+	s.mu.Lock()
 	s.scheduler = newScheduler
 	s.config = newConfig
+	s.mu.Unlock()
+	s.failures.rearm()
 
 	return s.Start(ctx)
 }
@@ -0,0 +1,153 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+
+	"gommutetime/internal/caldav"
+	"gommutetime/internal/config"
+	"gommutetime/internal/fetcher"
+)
+
+// ShiftSchedule labels the samples taken ahead of shifts
+const ShiftSchedule = "shift"
+
+// shiftRefresh is how often shift calendars are read again
+const shiftRefresh = 15 * time.Minute
+
+// shiftHorizon is how far ahead shift calendars are read
+const shiftHorizon = 8 * 24 * time.Hour
+
+// shifts is the state of the shift calendar of an itinerary
+type shifts struct {
+	// calendar is the config the starts were read with
+	calendar config.ShiftCalendar
+	starts   []time.Time
+	read     time.Time
+	// last is when the itinerary was last sampled ahead of a shift
+	last time.Time
+}
+
+// addShifts creates the job checking every minute whether an itinerary is
+// due for a sample ahead of one of its shifts
+func (s *Scheduler) addShifts(itin config.Itinerary) error {
+	run := &jobRun{}
+	_, err := s.scheduler.NewJob(
+		gocron.DurationJob(time.Minute),
+		gocron.NewTask(func() error { return s.shiftTick(itin, run) }),
+		gocron.WithName(itin.ID+"-"+ShiftSchedule),
+		gocron.WithTags(itin.Tags...),
+		s.jobListeners(itin, ShiftSchedule, run),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create shift job: %w", err)
+	}
+	log.Printf("Created shift job for %s, sampling %s ahead of its shifts", itin.ID, itin.Shifts.Lead())
+	return nil
+}
+
+// shiftTick samples an itinerary between the lead time of a shift and its
+// start, once the last sample is an interval old
+func (s *Scheduler) shiftTick(itin config.Itinerary, run *jobRun) error {
+	now := time.Now()
+	if s.Paused(itin.ID) {
+		return errSkipped
+	}
+	starts := s.shiftStarts(itin, now)
+
+	due := false
+	for _, start := range starts {
+		if !now.Before(start.Add(-itin.Shifts.Lead())) && now.Before(start) {
+			due = true
+			break
+		}
+	}
+	if !due {
+		return errSkipped
+	}
+
+	s.mu.Lock()
+	state := s.shifts[itin.ID]
+	// Leave a little slack for samples taken a few seconds into a minute
+	if now.Sub(state.last) < itin.Shifts.Interval()-10*time.Second {
+		s.mu.Unlock()
+		return errSkipped
+	}
+	state.last = now
+	s.shifts[itin.ID] = state
+	s.mu.Unlock()
+
+	return s.createTask(itin, ShiftSchedule, run)()
+}
+
+// shiftStarts returns the starts of the upcoming shifts of an itinerary,
+// reading its calendar again when due. Calendars that cannot be read keep
+// the shifts read last.
+func (s *Scheduler) shiftStarts(itin config.Itinerary, now time.Time) []time.Time {
+	s.mu.Lock()
+	if s.shifts == nil {
+		s.shifts = make(map[string]shifts)
+	}
+	state := s.shifts[itin.ID]
+	cfg := s.config
+	s.mu.Unlock()
+	if state.calendar == *itin.Shifts && now.Sub(state.read) < shiftRefresh {
+		return state.starts
+	}
+
+	starts, err := readShifts(cfg, *itin.Shifts, now)
+	if err != nil {
+		log.Printf("Warning: %s: failed to read shifts: %v", itin.ID, err)
+		if state.calendar != *itin.Shifts {
+			state.starts = nil
+		}
+	} else {
+		if state.calendar != *itin.Shifts || len(starts) != len(state.starts) {
+			log.Printf("Read %d upcoming shifts of %s", len(starts), itin.ID)
+		}
+		state.starts = starts
+	}
+	state.calendar, state.read = *itin.Shifts, now
+
+	s.mu.Lock()
+	// Keep the last sample recorded meanwhile
+	state.last = s.shifts[itin.ID].last
+	s.shifts[itin.ID] = state
+	s.mu.Unlock()
+	return state.starts
+}
+
+// readShifts reads the starts of the timed events of a shift calendar from
+// a lead time ago until shiftHorizon ahead, going through the proxy and CA
+// bundle of API requests
+func readShifts(cfg *config.Config, calendar config.ShiftCalendar, now time.Time) ([]time.Time, error) {
+	match, err := calendar.Matcher()
+	if err != nil {
+		return nil, err
+	}
+	client, err := fetcher.NewHTTPClient(cfg.API)
+	if err != nil {
+		client = http.DefaultClient
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	username, password := calendar.Credentials()
+	events, err := caldav.Events(ctx, client, calendar.URL, username, password, now.Add(-calendar.Lead()), now.Add(shiftHorizon))
+	if err != nil {
+		return nil, err
+	}
+	var starts []time.Time
+	for _, event := range events {
+		if event.AllDay || (match != nil && !match.MatchString(event.Summary)) {
+			continue
+		}
+		starts = append(starts, event.Start)
+	}
+	return starts, nil
+}
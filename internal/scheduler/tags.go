@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/geo"
+	"gommutetime/internal/schoolcal"
+)
+
+// origin is the location of an itinerary's origin, once looked up
+type origin struct {
+	point geo.Point
+	ok    bool
+}
+
+// sampleTags returns the tags of a sample of an itinerary taken at t: the
+// itinerary's own, its school season if it has a school calendar, and
+// whether it is daylight or dark at the origin when its location is known
+func (s *Scheduler) sampleTags(ctx context.Context, itin config.Itinerary, t time.Time) []string {
+	tags, err := schoolcal.Tags(itin, t)
+	if err != nil {
+		log.Printf("Warning: %s: %v", itin.ID, err)
+	}
+
+	if p, ok := s.origin(ctx, itin); ok {
+		tag := config.TagDark
+		if geo.Daylight(p, t) {
+			tag = config.TagDaylight
+		}
+		tags = append(slices.Clip(tags), tag)
+	}
+	return tags
+}
+
+// origin returns the location of an itinerary's origin. Coordinates and
+// Plus Codes are decoded, and addresses geocoded once with the provider;
+// ok is false when it cannot geocode them.
+func (s *Scheduler) origin(ctx context.Context, itin config.Itinerary) (geo.Point, bool) {
+	address := itin.FirstOrigin()
+	if p, ok := geo.Locate(address); ok {
+		return p, true
+	}
+
+	s.mu.RLock()
+	cached, found := s.origins[address]
+	s.mu.RUnlock()
+	if found {
+		return cached.point, cached.ok
+	}
+
+	geoCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	p, err := s.fetcher.Geocode(geoCtx, address)
+	if err != nil {
+		log.Printf("Warning: %s: samples are not tagged with daylight, origin not located: %v", itin.ID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.origins == nil {
+		s.origins = make(map[string]origin)
+	}
+	s.origins[address] = origin{point: p, ok: err == nil}
+	return p, err == nil
+}
@@ -0,0 +1,113 @@
+// Package schoolcal tells school term days from vacations with the school
+// calendars of itineraries, to tag samples and compare them with the
+// samples of the same season only
+package schoolcal
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/ical"
+)
+
+// Calendar is a loaded school calendar
+type Calendar struct {
+	// days are the YYYY-MM-DD local days covered by a counted event
+	days  map[string]bool
+	terms bool
+}
+
+// cache keeps loaded calendars until their file changes, since they are
+// read by every fetch and baseline
+var cache = struct {
+	mu      sync.Mutex
+	entries map[config.SchoolCalendar]cached
+}{entries: make(map[config.SchoolCalendar]cached)}
+
+// cached is a calendar and the state of its file when it was loaded
+type cached struct {
+	modTime  time.Time
+	size     int64
+	calendar *Calendar
+}
+
+// Load reads a school calendar, from cache when its file is unchanged
+func Load(s config.SchoolCalendar) (*Calendar, error) {
+	info, err := os.Stat(s.File)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to read school calendar: %w", err))
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if c, ok := cache.entries[s]; ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.calendar, nil
+	}
+
+	calendar, err := read(s)
+	if err != nil {
+		return nil, err
+	}
+	cache.entries[s] = cached{modTime: info.ModTime(), size: info.Size(), calendar: calendar}
+	return calendar, nil
+}
+
+// read parses the file of a school calendar
+func read(s config.SchoolCalendar) (*Calendar, error) {
+	match, err := s.Matcher()
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("invalid school calendar match: %w", err))
+	}
+	file, err := os.Open(s.File)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to read school calendar: %w", err))
+	}
+	defer file.Close()
+	events, err := ical.Parse(file)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("invalid school calendar %s: %w", s.File, err))
+	}
+
+	calendar := &Calendar{days: make(map[string]bool), terms: s.Terms()}
+	for _, event := range events {
+		if match != nil && !match.MatchString(event.Summary) {
+			continue
+		}
+		for _, day := range event.Days() {
+			calendar.days[day.Format(time.DateOnly)] = true
+		}
+	}
+	return calendar, nil
+}
+
+// Vacation reports whether t falls during a school vacation, in local time
+func (c *Calendar) Vacation(t time.Time) bool {
+	return c.days[t.Local().Format(time.DateOnly)] != c.terms
+}
+
+// Season returns the tag of the school season t falls in: term or vacation
+func (c *Calendar) Season(t time.Time) string {
+	if c.Vacation(t) {
+		return config.TagVacation
+	}
+	return config.TagTerm
+}
+
+// Tags returns the tags of an itinerary's sample taken at t: the
+// itinerary's own, and its school season if it has a calendar. Calendars
+// that cannot be read are logged by the caller and leave the season out.
+func Tags(itin config.Itinerary, t time.Time) ([]string, error) {
+	if itin.SchoolCalendar == nil {
+		return itin.Tags, nil
+	}
+	calendar, err := Load(*itin.SchoolCalendar)
+	if err != nil {
+		return itin.Tags, err
+	}
+	tags := append([]string{}, itin.Tags...)
+	return append(tags, calendar.Season(t)), nil
+}
@@ -0,0 +1,140 @@
+// Package sequence numbers the samples of each itinerary for the consumers
+// of the daemon's events, which tell missed deliveries from gaps in the
+// numbers. The last number of each itinerary is kept in a JSON file of the
+// data directory, so numbering carries on across restarts. The file is
+// written once per block of numbers rather than for every sample.
+package sequence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+)
+
+// File is the name of the sequence file in the data directory
+const File = "sequences.json"
+
+// block is how many numbers of an itinerary are reserved in the sequence
+// file at a time, which a crash skips at most
+const block = 100
+
+// Path returns the path of the sequence file of a config, or an empty
+// string when nothing may be written to the data directory
+func Path(cfg *config.Config) string {
+	if cfg.ReadOnly || cfg.DataDir == "" {
+		return ""
+	}
+	return filepath.Join(cfg.DataDir, File)
+}
+
+// Load reads the last sequence number of each itinerary in path. A missing
+// file has none.
+func Load(path string) (map[string]uint64, error) {
+	last := make(map[string]uint64)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return last, nil
+	}
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to read sequences: %w", err))
+	}
+	if err := json.Unmarshal(data, &last); err != nil {
+		return nil, apperr.Wrap(apperr.KindStorage, fmt.Errorf("invalid sequence file %s: %w", path, err))
+	}
+	return last, nil
+}
+
+// Counter hands out the sequence numbers of samples, for
+// events.Bus.NumberWith. In read-only mode numbers are only kept in memory
+// and start again from 1 with the daemon.
+type Counter struct {
+	mu sync.Mutex
+	// path is the sequence file the numbers in last were read from
+	path string
+	last map[string]uint64
+	// reserved is the highest number of each itinerary saved in the
+	// sequence file, which may be handed out without writing it
+	reserved map[string]uint64
+}
+
+// New creates a counter carrying on from the sequence file of cfg
+func New(cfg *config.Config) *Counter {
+	c := &Counter{last: make(map[string]uint64), reserved: make(map[string]uint64)}
+	c.Reload(cfg)
+	return c
+}
+
+// Reload switches to a new config, reading its sequence file when it moved
+func (c *Counter) Reload(cfg *config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := Path(cfg)
+	if path == c.path || path == "" {
+		c.path = path
+		return
+	}
+	last, err := Load(path)
+	if err != nil {
+		// Keep counting from the numbers in memory rather than from 1
+		log.Printf("Warning: %v", err)
+		return
+	}
+	c.path, c.last, c.reserved = path, last, maps.Clone(last)
+}
+
+// Next returns the sequence number of the next sample of an itinerary. The
+// next block of numbers is saved before its first one is returned, so a
+// crash leaves a gap in the numbers rather than repeating one.
+func (c *Counter) Next(itinerary string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last[itinerary]++
+	if c.path != "" && c.last[itinerary] > c.reserved[itinerary] {
+		c.reserved[itinerary] = c.last[itinerary] + block - 1
+		if err := write(c.path, c.reserved); err != nil {
+			log.Printf("Warning: failed to save sequence numbers of %s: %v", itinerary, err)
+		}
+	}
+	return c.last[itinerary]
+}
+
+// Save writes the last numbers handed out in place of the reserved ones,
+// so that numbering carries on without a gap after the daemon stops
+func (c *Counter) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path == "" {
+		return nil
+	}
+	if err := write(c.path, c.last); err != nil {
+		return err
+	}
+	c.reserved = maps.Clone(c.last)
+	return nil
+}
+
+// write replaces the sequence file in path once the new one is complete
+func write(path string, last map[string]uint64) error {
+	data, err := json.MarshalIndent(last, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write sequences: %w", err))
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to write sequences: %w", err))
+	}
+	return nil
+}
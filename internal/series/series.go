@@ -0,0 +1,175 @@
+// Package series keeps hourly and daily aggregates of single-route
+// itineraries up to date as samples arrive, so that charts over months or
+// years read one row per period instead of every sample
+package series
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/events"
+	"gommutetime/internal/history"
+)
+
+// Writer appends the periods of the configured series once they are over.
+// The period in progress is kept in memory and rebuilt from the output file
+// on start.
+type Writer struct {
+	mu  sync.Mutex
+	cfg *config.Config
+	// open holds the period in progress of each series file kept, nil
+	// before the first sample of a period
+	open map[string]*history.Point
+}
+
+// New creates a writer for the series of cfg, catching them up with the
+// samples recorded since their last period
+func New(cfg *config.Config) *Writer {
+	w := &Writer{open: make(map[string]*history.Point)}
+	w.Reload(cfg)
+	return w
+}
+
+// Reload switches to a new config, catching up the series it adds
+func (w *Writer) Reload(cfg *config.Config) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cfg = cfg
+
+	kept := make(map[string]bool)
+	for _, itin := range cfg.Itineraries {
+		if itin.IsMatrix() || itin.OutputFile == "" || cfg.ReadOnly {
+			continue
+		}
+		output := filepath.Join(cfg.DataDir, itin.OutputFile)
+		for _, resolution := range cfg.Series.Resolutions {
+			path := history.SeriesFile(output, resolution)
+			kept[path] = true
+			if _, ok := w.open[path]; ok {
+				continue
+			}
+			open, err := catchUp(output, path, resolution, time.Now())
+			if err != nil {
+				log.Printf("ERROR catching up the %s series of %s: %v", resolution, itin.ID, err)
+				continue
+			}
+			w.open[path] = open
+		}
+	}
+	for path := range w.open {
+		if !kept[path] {
+			delete(w.open, path)
+		}
+	}
+}
+
+// Record adds a recorded sample to the series of its itinerary, writing the
+// previous period once the sample starts a new one
+func (w *Writer) Record(_ context.Context, e events.Event) {
+	itin, sample := e.Itinerary, e.Sample
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if itin.OutputFile == "" || !sample.FromPrimary(itin.PrimaryProvider()) {
+		return
+	}
+
+	output := filepath.Join(w.cfg.DataDir, itin.OutputFile)
+	for _, resolution := range w.cfg.Series.Resolutions {
+		path := history.SeriesFile(output, resolution)
+		open, ok := w.open[path]
+		if !ok {
+			continue
+		}
+
+		period := history.Truncate(sample.Timestamp, resolution)
+		if open != nil && period.After(open.Period) {
+			if err := history.AppendSeries(path, []history.Point{*open}); err != nil {
+				log.Printf("Warning: failed to write the %s series of %s: %v", resolution, itin.ID, err)
+			}
+			open = nil
+		}
+		if open == nil {
+			open = &history.Point{Period: period}
+		}
+		open.Stats = history.Merge(open.Stats, history.Stats{Count: 1, Mean: sample.Duration, Min: sample.Duration, Max: sample.Duration})
+		w.open[path] = open
+	}
+}
+
+// catchUp appends the periods over by now whose samples are in the output
+// file but not in the series, returning the period in progress if any
+func catchUp(output, path, resolution string, now time.Time) (*history.Point, error) {
+	from, err := covered(path, resolution)
+	if err != nil {
+		return nil, err
+	}
+	points, err := history.AggregateRange(output, from, time.Time{}, resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	var open *history.Point
+	if n := len(points); n > 0 && history.PeriodEnd(points[n-1].Period, resolution).After(now) {
+		open = &points[n-1]
+		points = points[:n-1]
+	}
+	if len(points) > 0 {
+		if err := history.AppendSeries(path, points); err != nil {
+			return nil, err
+		}
+	}
+	return open, nil
+}
+
+// covered returns the end of the last period of a series file, zero when
+// it has none
+func covered(path, resolution string) (time.Time, error) {
+	points, err := history.LoadSeries(path, time.Time{}, time.Time{})
+	if err != nil || len(points) == 0 {
+		return time.Time{}, err
+	}
+	last := slices.MaxFunc(points, func(a, b history.Point) int {
+		return a.Period.Compare(b.Period)
+	})
+	return history.PeriodEnd(last.Period, resolution), nil
+}
+
+// Load returns the points of an output file whose period starts from from
+// (inclusive) to to (exclusive), read from its series file when cfg keeps
+// it and computed from the samples otherwise, including the period in
+// progress
+func Load(cfg *config.Config, output, resolution string, from, to time.Time) ([]history.Point, error) {
+	var points []history.Point
+	tail := from
+	if slices.Contains(cfg.Series.Resolutions, resolution) {
+		path := history.SeriesFile(output, resolution)
+		var err error
+		if points, err = history.LoadSeries(path, from, to); err != nil {
+			return nil, err
+		}
+		end, err := covered(path, resolution)
+		if err != nil {
+			return nil, err
+		}
+		if end.After(tail) {
+			tail = end
+		}
+	}
+
+	recent, err := history.AggregateRange(output, tail, to, resolution)
+	if err != nil {
+		return nil, err
+	}
+	// Samples scanned from a time within a period still start at its start
+	for _, p := range recent {
+		if !p.Period.Before(from) {
+			points = append(points, p)
+		}
+	}
+	return points, nil
+}
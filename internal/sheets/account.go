@@ -0,0 +1,150 @@
+package sheets
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gommutetime/internal/apperr"
+)
+
+// sheetsScope grants access to the spreadsheets shared with the account
+const sheetsScope = "https://www.googleapis.com/auth/spreadsheets"
+
+// serviceAccount signs in with a service account key, caching the access
+// token until shortly before it expires
+type serviceAccount struct {
+	email    string
+	tokenURI string
+	key      string // PEM private key, compared to detect key changes
+	signer   *rsa.PrivateKey
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// loadServiceAccount reads a service account JSON key file
+func loadServiceAccount(path string) (*serviceAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account key: %w", err)
+	}
+
+	var file struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid service account key %s: %w", path, err)
+	}
+	if file.Type != "service_account" || file.ClientEmail == "" || file.PrivateKey == "" {
+		return nil, fmt.Errorf("%s is not a service account key", path)
+	}
+	if file.TokenURI == "" {
+		file.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(file.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("invalid private key in %s", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in %s: %w", path, err)
+	}
+	signer, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key in %s is not an RSA key", path)
+	}
+
+	return &serviceAccount{
+		email:    file.ClientEmail,
+		tokenURI: file.TokenURI,
+		key:      file.PrivateKey,
+		signer:   signer,
+	}, nil
+}
+
+// token returns an access token, exchanging a signed assertion for a new
+// one when the cached token is about to expire
+func (a *serviceAccount) token(ctx context.Context, client *http.Client) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.accessToken != "" && time.Until(a.expiry) > time.Minute {
+		return a.accessToken, nil
+	}
+
+	assertion, err := a.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", apperr.Wrap(apperr.KindProvider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Rejected keys need fixing in the config, not retrying
+		return "", apperr.Wrap(apperr.KindConfig, fmt.Errorf("service account sign-in returned %s: %s", resp.Status, apiError(resp.Body)))
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.AccessToken == "" {
+		return "", apperr.Wrap(apperr.KindProvider, fmt.Errorf("invalid token response: %v", err))
+	}
+
+	a.accessToken = result.AccessToken
+	a.expiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	return a.accessToken, nil
+}
+
+// assertion signs the JWT exchanged for an access token
+func (a *serviceAccount) assertion(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   a.email,
+		"scope": sheetsScope,
+		"aud":   a.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token request: %w", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,276 @@
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/events"
+	"gommutetime/internal/fetcher"
+	"gommutetime/internal/history"
+)
+
+// sheetsURL is the base URL of the Sheets API
+var sheetsURL = "https://sheets.googleapis.com/v4/spreadsheets/"
+
+// defaultTab is the first sheet of a new spreadsheet
+const defaultTab = "Sheet1"
+
+// Header rows written to empty tabs
+var (
+	sampleHeader = []any{"Time", "Itinerary", "Minutes", "Schedule", "Provider"}
+	dailyHeader  = []any{"Date", "Itinerary", "Samples", "Average (min)", "Min (min)", "Max (min)"}
+)
+
+// Exporter appends the samples of itineraries with a sheet to Google
+// Sheets, as a row per sample or a daily summary
+type Exporter struct {
+	mu      sync.Mutex
+	cfg     *config.Config
+	client  *http.Client
+	account *serviceAccount
+	// headed holds the tabs known to have a header row
+	headed map[string]bool
+	// appending serializes appends so rows keep their order and an empty
+	// tab gets a single header row
+	appending sync.Mutex
+}
+
+// New creates an exporter for the sheets of cfg, loading the service
+// account key if any itinerary has a sheet
+func New(cfg *config.Config) (*Exporter, error) {
+	e := &Exporter{headed: make(map[string]bool)}
+	if err := e.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload switches to a new config
+func (e *Exporter) Reload(cfg *config.Config) error {
+	client, err := fetcher.NewHTTPClient(cfg.API)
+	if err != nil {
+		return apperr.Wrap(apperr.KindConfig, err)
+	}
+
+	var account *serviceAccount
+	if hasSheets(cfg) {
+		if account, err = loadServiceAccount(cfg.Sheets.Credentials()); err != nil {
+			return apperr.Wrap(apperr.KindConfig, fmt.Errorf("sheets: %w", err))
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cfg = cfg
+	e.client = client
+	// Keep the cached token when the key did not change
+	if e.account == nil || account == nil || e.account.key != account.key {
+		e.account = account
+	}
+	return nil
+}
+
+// hasSheets reports whether any itinerary has a sheet
+func hasSheets(cfg *config.Config) bool {
+	for _, itin := range cfg.Itineraries {
+		if itin.Sheet != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Record appends a recorded sample to the itinerary's sheet in the
+// background, unless it has none or only gets daily summaries
+func (e *Exporter) Record(_ context.Context, ev events.Event) {
+	itin, sample := ev.Itinerary, ev.Sample
+	if itin.Sheet == nil || itin.Sheet.Daily {
+		return
+	}
+
+	name := itin.Name
+	if sample.Origin != "" || sample.Destination != "" {
+		name = fmt.Sprintf("%s (%s to %s)", itin.Name, sample.Origin, sample.Destination)
+	}
+	row := []any{
+		sample.Timestamp.Format(time.DateTime),
+		name,
+		fmt.Sprintf("%.1f", sample.Duration),
+		sample.Schedule,
+		sample.Provider,
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := e.append(ctx, *itin.Sheet, sampleHeader, row); err != nil {
+			log.Printf("Warning: failed to append %s sample to Google Sheets: %v", itin.ID, err)
+		}
+	}()
+}
+
+// Run appends the previous day's summary of every itinerary with a daily
+// sheet shortly after each midnight, until ctx is cancelled
+func (e *Exporter) Run(ctx context.Context) {
+	for {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		next := today.AddDate(0, 0, 1).Add(time.Minute)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		end := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, next.Location())
+		e.summarize(ctx, end.AddDate(0, 0, -1), end)
+	}
+}
+
+// summarize appends a summary of the samples between start and end for
+// every itinerary with a daily sheet
+func (e *Exporter) summarize(ctx context.Context, start, end time.Time) {
+	e.mu.Lock()
+	cfg := e.cfg
+	e.mu.Unlock()
+
+	for _, itin := range cfg.Itineraries {
+		if itin.Sheet == nil || !itin.Sheet.Daily || itin.OutputFile == "" {
+			continue
+		}
+
+		samples, err := history.LoadRange(filepath.Join(cfg.DataDir, itin.OutputFile), start, end)
+		if err != nil {
+			log.Printf("Warning: failed to summarize %s for Google Sheets: %v", itin.ID, err)
+			continue
+		}
+		stats := history.Compute(samples)
+		if stats.Count == 0 {
+			continue
+		}
+
+		row := []any{
+			start.Format(time.DateOnly),
+			itin.Name,
+			stats.Count,
+			fmt.Sprintf("%.1f", stats.Mean),
+			fmt.Sprintf("%.1f", stats.Min),
+			fmt.Sprintf("%.1f", stats.Max),
+		}
+		if err := e.append(ctx, *itin.Sheet, dailyHeader, row); err != nil {
+			log.Printf("Warning: failed to append %s summary to Google Sheets: %v", itin.ID, err)
+		}
+	}
+}
+
+// append adds a row to the end of a sheet's tab, preceded by a header row
+// when the tab is empty
+func (e *Exporter) append(ctx context.Context, sheet config.SheetTarget, header, row []any) error {
+	tab := sheet.Tab
+	if tab == "" {
+		tab = defaultTab
+	}
+	base := sheetsURL + url.PathEscape(sheet.SpreadsheetID) + "/values/"
+	// Tab names are quoted so that names with spaces are valid ranges
+	quoted := "'" + strings.ReplaceAll(tab, "'", "''") + "'"
+
+	e.appending.Lock()
+	defer e.appending.Unlock()
+
+	rows := [][]any{row}
+	tabKey := sheet.SpreadsheetID + "/" + tab
+	if !e.headed[tabKey] {
+		var existing struct {
+			Values [][]any `json:"values"`
+		}
+		if err := e.call(ctx, http.MethodGet, base+url.PathEscape(quoted+"!A1:A1"), nil, &existing); err != nil {
+			return err
+		}
+		if len(existing.Values) == 0 {
+			rows = [][]any{header, row}
+		}
+	}
+
+	body := map[string]any{"values": rows}
+	endpoint := base + url.PathEscape(quoted+"!A1") + ":append?valueInputOption=USER_ENTERED&insertDataOption=INSERT_ROWS"
+	if err := e.call(ctx, http.MethodPost, endpoint, body, nil); err != nil {
+		return err
+	}
+	e.headed[tabKey] = true
+	return nil
+}
+
+// call makes an authenticated Sheets API request, decoding the JSON
+// response into result if not nil
+func (e *Exporter) call(ctx context.Context, method, endpoint string, body, result any) error {
+	e.mu.Lock()
+	client, account := e.client, e.account
+	e.mu.Unlock()
+	if account == nil {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("no service account configured"))
+	}
+
+	token, err := account.token(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return apperr.Wrap(apperr.KindProvider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apperr.Wrap(apperr.KindProvider, fmt.Errorf("sheets API returned %s: %s", resp.Status, apiError(resp.Body)))
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return apperr.Wrap(apperr.KindProvider, fmt.Errorf("failed to decode sheets response: %w", err))
+		}
+	}
+	return nil
+}
+
+// apiError extracts the message of a Google API error response
+func apiError(body io.Reader) string {
+	data, _ := io.ReadAll(io.LimitReader(body, 64<<10))
+	var parsed struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &parsed) == nil && parsed.Error.Message != "" {
+		return parsed.Error.Message
+	}
+	return strings.TrimSpace(string(data))
+}
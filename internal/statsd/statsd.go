@@ -0,0 +1,146 @@
+// Package statsd sends the metrics of each fetch to a StatsD or DogStatsD
+// agent over UDP, as an alternative to OTLP for monitoring that takes pushed
+// metrics, e.g. the Datadog agent. After each job run it sends:
+//
+//	gommutetime.commute.duration  gauge, the minutes of the recorded sample
+//	gommutetime.api.latency       timer, how long the provider took to respond
+//	gommutetime.job.runs          counter, by outcome: success, partial or error
+//	gommutetime.job.errors        counter, by error kind
+//
+// DogStatsD tags them with the itinerary, provider, outcome and error kind,
+// which plain StatsD appends to the names instead, e.g.
+// gommutetime.commute.duration.work.google.
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/scheduler"
+)
+
+// Emitter sends the metrics of job runs to the agent of the config
+type Emitter struct {
+	mu   sync.Mutex
+	cfg  config.StatsDConfig
+	conn net.Conn
+}
+
+// New sends metrics to the StatsD agent of a config, if any
+func New(cfg *config.Config) *Emitter {
+	e := &Emitter{}
+	e.Reload(cfg)
+	return e
+}
+
+// Reload sends metrics to the agent of a new config. An agent whose address
+// cannot be resolved is logged and sent nothing.
+func (e *Emitter) Reload(cfg *config.Config) {
+	var conn net.Conn
+	if cfg.StatsD.Address != "" {
+		var err error
+		if conn, err = net.Dial("udp", cfg.StatsD.Address); err != nil {
+			log.Printf("ERROR: metrics are not sent to StatsD at %s: %v", cfg.StatsD.Address, err)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn != nil {
+		e.conn.Close()
+	}
+	e.cfg, e.conn = cfg.StatsD, conn
+}
+
+// Job sends the metrics of a finished job run
+func (e *Emitter) Job(_ context.Context, ev scheduler.JobEvent) {
+	var metrics []string
+	itin := tag{"itinerary", ev.Itinerary.ID}
+	switch {
+	case ev.Kind == scheduler.JobSucceeded:
+		outcome := "success"
+		if ev.FailedPairs > 0 {
+			outcome = "partial"
+		}
+		metrics = append(metrics, e.format("job.runs", "1", "c", itin, tag{"outcome", outcome}))
+		if s := ev.Sample; s != nil {
+			provider := tag{"provider", s.Provider}
+			metrics = append(metrics, e.format("commute.duration", number(s.Duration), "g", itin, provider))
+			if ev.Latency > 0 {
+				metrics = append(metrics, e.format("api.latency", number(float64(ev.Latency.Microseconds())/1000), "ms", provider))
+			}
+		}
+	case ev.Kind == scheduler.JobFailed:
+		kind := tag{"error_kind", apperr.KindOf(ev.Err).String()}
+		metrics = append(metrics,
+			e.format("job.runs", "1", "c", itin, tag{"outcome", "error"}),
+			e.format("job.errors", "1", "c", itin, kind))
+	default:
+		return
+	}
+	e.send(metrics)
+}
+
+// tag is a dimension of a metric
+type tag struct {
+	name, value string
+}
+
+// format formats a metric line, tagged with DogStatsD and named after its
+// tag values otherwise
+func (e *Emitter) format(name, value, kind string, tags ...tag) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.cfg.DogStatsD {
+		for _, t := range tags {
+			name += "." + sanitize(t.value)
+		}
+		return fmt.Sprintf("%s%s:%s|%s", e.cfg.MetricPrefix(), name, value, kind)
+	}
+	all := append([]string{}, e.cfg.Tags...)
+	for _, t := range tags {
+		all = append(all, t.name+":"+sanitize(t.value))
+	}
+	return fmt.Sprintf("%s%s:%s|%s|#%s", e.cfg.MetricPrefix(), name, value, kind, strings.Join(all, ","))
+}
+
+// send writes metric lines to the agent in one datagram. UDP drops them
+// silently when the agent is down, as StatsD clients do.
+func (e *Emitter) send(metrics []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil || len(metrics) == 0 {
+		return
+	}
+	if _, err := e.conn.Write([]byte(strings.Join(metrics, "\n"))); err != nil {
+		log.Printf("Warning: failed to send metrics to StatsD: %v", err)
+	}
+}
+
+// number formats a metric value
+func number(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// sanitize replaces the characters StatsD uses as separators in a name or
+// tag value
+func sanitize(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '.', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,144 @@
+package statuspage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+)
+
+// defaultRegion is the region of buckets without one
+const defaultRegion = "us-east-1"
+
+// contentTypes are the content types of the status page files
+var contentTypes = map[string]string{
+	HTMLFile: "text/html; charset=utf-8",
+	JSONFile: "application/json",
+}
+
+// upload puts files in an S3 bucket, where browsers should not cache them
+// for long as they are replaced every interval
+func upload(ctx context.Context, target config.S3Target, files map[string][]byte) error {
+	accessKey, secretKey := target.Credentials()
+	if accessKey == "" || secretKey == "" {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("no S3 credentials for bucket %s", target.Bucket))
+	}
+	region := target.Region
+	if region == "" {
+		region = defaultRegion
+	}
+
+	for name, content := range files {
+		key := path.Join(target.Prefix, name)
+		if err := putObject(ctx, target, region, accessKey, secretKey, key, content); err != nil {
+			return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to upload %s to S3 bucket %s: %w", key, target.Bucket, err))
+		}
+	}
+	return nil
+}
+
+// objectURL returns the URL of a key: virtual-hosted on AWS, path-style on
+// other endpoints as S3-compatible stores rarely have wildcard DNS
+func objectURL(target config.S3Target, region, key string) (*url.URL, error) {
+	if target.Endpoint == "" {
+		return &url.URL{Scheme: "https", Host: target.Bucket + ".s3." + region + ".amazonaws.com", Path: "/" + key}, nil
+	}
+	endpoint := target.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", target.Endpoint)
+	}
+	u.Path = "/" + target.Bucket + "/" + key
+	return u, nil
+}
+
+// putObject uploads one object, signed with AWS Signature Version 4
+func putObject(ctx context.Context, target config.S3Target, region, accessKey, secretKey, key string, content []byte) error {
+	u, err := objectURL(target, region, key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypes[path.Base(key)])
+	req.Header.Set("Cache-Control", "no-cache")
+	sign(req, content, region, accessKey, secretKey, time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("S3 returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds the Authorization header of AWS Signature Version 4 to req,
+// covering its host, content and x-amz headers
+func sign(req *http.Request, content []byte, region, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	stamp, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	payload := sha256Hex(content)
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	headers := []string{"cache-control", "content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	var canonical strings.Builder
+	for _, h := range headers {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+		canonical.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signed := strings.Join(headers, ";")
+	request := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonical.String(),
+		signed,
+		payload,
+	}, "\n")
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + sha256Hex([]byte(request))
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signed, signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
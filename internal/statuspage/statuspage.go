@@ -0,0 +1,282 @@
+// Package statuspage periodically renders a compact status page of the
+// current commute times: index.html for people and e-ink displays, and
+// status.json for scripts. Both are plain files, written to a directory any
+// web server can serve or uploaded to an S3 bucket.
+package statuspage
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+	"gommutetime/internal/history"
+)
+
+// Files of the status page
+const (
+	HTMLFile = "index.html"
+	JSONFile = "status.json"
+)
+
+// Trends of commute times, compared with the previous sample
+const (
+	TrendUp     = "up"
+	TrendDown   = "down"
+	TrendSteady = "steady"
+)
+
+// steadyMinutes is the largest change from the previous sample that is
+// still steady
+const steadyMinutes = 1.0
+
+// window is how far back samples are looked for; older ones are not
+// current enough to show
+const window = 24 * time.Hour
+
+//go:embed status.html
+var templates embed.FS
+
+var page = template.Must(template.New("status.html").Funcs(template.FuncMap{
+	"minutes": func(m *float64) string { return fmt.Sprintf("%.0f", *m) },
+	"clock":   func(t time.Time) string { return t.Format("15:04") },
+	"deref":   func(t *time.Time) time.Time { return *t },
+	"arrow": func(trend string) string {
+		switch trend {
+		case TrendUp:
+			return "↑"
+		case TrendDown:
+			return "↓"
+		}
+		return "→"
+	},
+}).ParseFS(templates, "status.html"))
+
+// Status is the content of the status page
+type Status struct {
+	Title       string      `json:"title"`
+	Updated     time.Time   `json:"updated"`
+	Itineraries []Itinerary `json:"itineraries"`
+	// Refresh is how often browsers reload the page, in seconds
+	Refresh int `json:"-"`
+}
+
+// Itinerary is the current commute time of an itinerary. Minutes is nil
+// when no sample was recorded in the last day.
+type Itinerary struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Minutes   *float64   `json:"minutes"`
+	Previous  *float64   `json:"previous_minutes,omitempty"`
+	Trend     string     `json:"trend,omitempty"`
+	SampledAt *time.Time `json:"sampled_at,omitempty"`
+}
+
+// Build reads the latest samples of every single-route itinerary, from
+// their primary provider as of now
+func Build(cfg *config.Config, now time.Time) (Status, error) {
+	status := Status{
+		Title:       cfg.StatusPage.PageTitle(),
+		Updated:     now,
+		Itineraries: []Itinerary{},
+		Refresh:     int(cfg.StatusPage.Interval().Seconds()),
+	}
+	for _, itin := range cfg.Itineraries {
+		if itin.IsMatrix() {
+			continue
+		}
+		entry, err := Current(cfg, itin, now)
+		if err != nil {
+			return Status{}, err
+		}
+		status.Itineraries = append(status.Itineraries, entry)
+	}
+	return status, nil
+}
+
+// Current reads the latest sample of an itinerary from its primary
+// provider as of now, and its trend since the one before
+func Current(cfg *config.Config, itin config.Itinerary, now time.Time) (Itinerary, error) {
+	entry := Itinerary{ID: itin.ID, Name: itin.Name}
+	if cfg.DataDir != "" && itin.OutputFile != "" {
+		samples, err := history.LoadRange(filepath.Join(cfg.DataDir, itin.OutputFile), now.Add(-window), time.Time{})
+		if err != nil {
+			return Itinerary{}, apperr.Wrap(apperr.KindStorage, err)
+		}
+		entry.describe(samples, itin)
+	}
+	return entry, nil
+}
+
+// describe sets the latest commute time from samples and its trend since
+// the one before
+func (e *Itinerary) describe(samples []history.Sample, itin config.Itinerary) {
+	var latest, previous *history.Sample
+	samples = history.PrimaryOnly(samples, itin.PrimaryProvider())
+	for i := range samples {
+		s := &samples[i]
+		switch {
+		case latest == nil || !s.Timestamp.Before(latest.Timestamp):
+			latest, previous = s, latest
+		case previous == nil || !s.Timestamp.Before(previous.Timestamp):
+			previous = s
+		}
+	}
+	if latest == nil {
+		return
+	}
+
+	e.Minutes, e.SampledAt = &latest.Duration, &latest.Timestamp
+	e.Trend = TrendSteady
+	if previous == nil {
+		return
+	}
+	e.Previous = &previous.Duration
+	switch change := latest.Duration - previous.Duration; {
+	case change > steadyMinutes:
+		e.Trend = TrendUp
+	case change < -steadyMinutes:
+		e.Trend = TrendDown
+	}
+}
+
+// Render returns the HTML page and JSON document of a status
+func Render(status Status) (html, data []byte, err error) {
+	var b bytes.Buffer
+	if err := page.Execute(&b, status); err != nil {
+		return nil, nil, fmt.Errorf("failed to render status page: %w", err)
+	}
+	data, _ = json.MarshalIndent(status, "", "  ")
+	return b.Bytes(), append(data, '\n'), nil
+}
+
+// Publish renders the status page of cfg as of now, writing it to its
+// directory and uploading it to its bucket
+func Publish(ctx context.Context, cfg *config.Config, now time.Time) error {
+	status, err := Build(cfg, now)
+	if err != nil {
+		return err
+	}
+	html, data, err := Render(status)
+	if err != nil {
+		return err
+	}
+	files := map[string][]byte{HTMLFile: html, JSONFile: data}
+
+	if dir := cfg.StatusPageDir(); dir != "" {
+		if err := writeFiles(dir, files); err != nil {
+			return apperr.Wrap(apperr.KindStorage, err)
+		}
+	}
+	if target := cfg.StatusPage.S3; target != nil {
+		if err := upload(ctx, *target, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFiles writes files to dir, each replaced only once complete so that
+// web servers never serve half a page
+func writeFiles(dir string, files map[string][]byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create status page directory: %w", err)
+	}
+	for name, content := range files {
+		tmp, err := os.CreateTemp(dir, "."+name+".*")
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		_, err = tmp.Write(content)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			os.Chmod(tmp.Name(), 0644)
+			err = os.Rename(tmp.Name(), filepath.Join(dir, name))
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Job renders the status page every status_page.interval_minutes
+type Job struct {
+	mu     sync.Mutex
+	cfg    *config.Config
+	reload chan struct{}
+}
+
+// NewJob creates the status page job of a config
+func NewJob(cfg *config.Config) *Job {
+	return &Job{cfg: cfg, reload: make(chan struct{}, 1)}
+}
+
+// Reload switches to a new config, rendering the page again right away
+func (j *Job) Reload(cfg *config.Config) {
+	j.mu.Lock()
+	j.cfg = cfg
+	j.mu.Unlock()
+
+	select {
+	case j.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Run renders the status page until ctx is cancelled, waiting for a
+// reload while it is disabled
+func (j *Job) Run(ctx context.Context) {
+	for {
+		j.mu.Lock()
+		cfg := j.cfg
+		j.mu.Unlock()
+
+		var due <-chan time.Time
+		var ticker *time.Ticker
+		if cfg.StatusPage.Enabled() {
+			j.publish(ctx, cfg)
+			ticker = time.NewTicker(cfg.StatusPage.Interval())
+			due = ticker.C
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				if ticker != nil {
+					ticker.Stop()
+				}
+				return
+			case <-j.reload:
+				break wait
+			case <-due:
+				j.publish(ctx, cfg)
+			}
+		}
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}
+}
+
+// publish renders the status page once, logging failures
+func (j *Job) publish(ctx context.Context, cfg *config.Config) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := Publish(ctx, cfg, time.Now()); err != nil {
+		log.Printf("ERROR rendering the status page: %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+// Package stream publishes samples and alerts to Kafka topics and NATS
+// subjects, for data platforms ingesting them as they are recorded. The
+// messages are those sent to plugins, as JSON; Kafka messages are keyed by
+// itinerary ID so each itinerary's stay in order within a partition. The
+// idempotency key of samples is also sent as a header, Nats-Msg-Id for NATS
+// so that JetStream drops duplicates.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/events"
+	"gommutetime/internal/outbox"
+	"gommutetime/internal/plugin"
+)
+
+// queueSize is how many messages may wait for slow brokers before new ones
+// are dropped
+const queueSize = 1000
+
+// timeout bounds each publication, so unreachable brokers do not hold up
+// the messages to the others for long
+const timeout = 10 * time.Second
+
+// Publisher publishes the samples and alerts of the daemon to the
+// configured streams
+type Publisher struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	cfg    *config.Config
+	worker *worker
+	// outbox keeps the messages that failed, for retries
+	outbox atomic.Pointer[outbox.Outbox]
+	// retrier publishes the messages retried by the outbox, from its
+	// goroutine
+	retrier *worker
+}
+
+// New starts publishing to the streams of a config until ctx is done
+func New(ctx context.Context, cfg *config.Config) *Publisher {
+	p := &Publisher{ctx: ctx}
+	p.Reload(cfg)
+	return p
+}
+
+// Reload publishes to the streams of a new config, reconnecting to the
+// brokers. Messages queued for the old ones are still published.
+func (p *Publisher) Reload(cfg *config.Config) {
+	var w *worker
+	if cfg.HasStreams() {
+		w = newWorker(&p.outbox)
+		go w.run(p.ctx)
+	}
+
+	p.mu.Lock()
+	old := p.worker
+	p.cfg, p.worker = cfg, w
+	p.mu.Unlock()
+	if old != nil {
+		close(old.queue)
+	}
+}
+
+// RetryWith keeps the messages that brokers failed to take from now on in
+// an outbox, which retries them
+func (p *Publisher) RetryWith(o *outbox.Outbox) {
+	p.retrier = newWorker(&p.outbox)
+	p.outbox.Store(o)
+
+	o.Register("kafka", func(ctx context.Context, payload json.RawMessage) error {
+		var msg pending
+		if err := json.Unmarshal(payload, &msg); err != nil || msg.Kafka == nil {
+			return fmt.Errorf("%w: invalid Kafka message", outbox.ErrDrop)
+		}
+		return p.retrier.produce(ctx, *msg.Kafka, msg.message())
+	})
+	o.Register("nats", func(ctx context.Context, payload json.RawMessage) error {
+		var msg pending
+		if err := json.Unmarshal(payload, &msg); err != nil || msg.NATS == nil {
+			return fmt.Errorf("%w: invalid NATS message", outbox.ErrDrop)
+		}
+		if err := p.retrier.publish(*msg.NATS, msg.message()); err != nil {
+			return err
+		}
+		// The message is only buffered until flushed
+		return p.retrier.nats[msg.NATS.URL].FlushTimeout(timeout)
+	})
+}
+
+// Handle queues a sample or alert for the streams of its itinerary. When
+// they are too far behind it goes to the outbox, or is dropped without one.
+func (p *Publisher) Handle(_ context.Context, e events.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.worker == nil {
+		return
+	}
+	streams := p.cfg.StreamsFor(e.Itinerary)
+	if streams.Kafka == nil && streams.NATS == nil {
+		return
+	}
+
+	data, err := json.Marshal(plugin.NewMessage(e))
+	if err != nil {
+		log.Printf("ERROR encoding %s for streams: %v", e.Kind, err)
+		return
+	}
+	msg := message{streams: streams, key: e.Itinerary.ID, event: e.Kind, id: e.Key, data: data}
+	select {
+	case p.worker.queue <- msg:
+	default:
+		if retries := p.outbox.Load(); retries != nil {
+			keep(retries, msg, streams, errors.New("streams are behind"))
+			return
+		}
+		log.Printf("Warning: streams are behind, dropped a %s event", e.Kind)
+	}
+}
+
+// message is an encoded event and where to publish it
+type message struct {
+	streams config.StreamsConfig
+	key     string
+	event   string
+	// id is the idempotency key of a sample, empty for other events
+	id   string
+	data []byte
+}
+
+// pending is a message kept in the outbox for a Kafka topic or NATS subject
+type pending struct {
+	Kafka *config.KafkaTarget `json:"kafka,omitempty"`
+	NATS  *config.NATSTarget  `json:"nats,omitempty"`
+	Key   string              `json:"key"`
+	Event string              `json:"event"`
+	ID    string              `json:"id,omitempty"`
+	Data  json.RawMessage     `json:"data"`
+}
+
+// message returns the message to publish again
+func (p pending) message() message {
+	return message{key: p.Key, event: p.Event, id: p.ID, data: p.Data}
+}
+
+// keep adds a message that failed to reach targets to the outbox, once for
+// each of them
+func keep(o *outbox.Outbox, msg message, targets config.StreamsConfig, err error) {
+	kept := pending{Key: msg.key, Event: msg.event, ID: msg.id, Data: msg.data}
+	if k := targets.Kafka; k != nil {
+		kafkaMsg := kept
+		kafkaMsg.Kafka = k
+		o.Add("kafka", k.Topic, kafkaMsg, err)
+	}
+	if n := targets.NATS; n != nil {
+		natsMsg := kept
+		natsMsg.NATS = n
+		o.Add("nats", n.Subject, natsMsg, err)
+	}
+}
+
+// worker publishes queued messages in order, connecting to the brokers
+// when first needed
+type worker struct {
+	queue chan message
+	// kafka are the writers by broker list, nats the connections by URL
+	kafka map[string]*kafka.Writer
+	nats  map[string]*nats.Conn
+	// outbox keeps the messages that failed, for retries
+	outbox *atomic.Pointer[outbox.Outbox]
+}
+
+// newWorker creates a worker without connections, keeping the messages
+// that failed in the outbox of its publisher
+func newWorker(o *atomic.Pointer[outbox.Outbox]) *worker {
+	return &worker{queue: make(chan message, queueSize), kafka: make(map[string]*kafka.Writer), nats: make(map[string]*nats.Conn), outbox: o}
+}
+
+// run publishes queued messages until the queue is closed or ctx is done
+func (w *worker) run(ctx context.Context) {
+	defer w.close()
+	for {
+		select {
+		case msg, ok := <-w.queue:
+			if !ok {
+				return
+			}
+			retries := w.outbox.Load()
+			if k := msg.streams.Kafka; k != nil {
+				if err := w.produce(ctx, *k, msg); err != nil {
+					log.Printf("ERROR publishing %s to Kafka topic %s: %v", msg.event, k.Topic, err)
+					keep(retries, msg, config.StreamsConfig{Kafka: k}, err)
+				} else {
+					retries.Delivered("kafka")
+				}
+			}
+			if n := msg.streams.NATS; n != nil {
+				if err := w.publish(*n, msg); err != nil {
+					log.Printf("ERROR publishing %s to NATS subject %s: %v", msg.event, n.Subject, err)
+					keep(retries, msg, config.StreamsConfig{NATS: n}, err)
+				} else {
+					retries.Delivered("nats")
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// produce writes a message to a Kafka topic
+func (w *worker) produce(ctx context.Context, target config.KafkaTarget, msg message) error {
+	brokers := strings.Join(slices.Sorted(slices.Values(target.Brokers)), ",")
+	writer, ok := w.kafka[brokers]
+	if !ok {
+		writer = &kafka.Writer{
+			Addr:         kafka.TCP(target.Brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			WriteTimeout: timeout,
+			MaxAttempts:  3,
+		}
+		w.kafka[brokers] = writer
+	}
+
+	headers := []kafka.Header{{Key: "event", Value: []byte(msg.event)}}
+	if msg.id != "" {
+		headers = append(headers, kafka.Header{Key: "idempotency-key", Value: []byte(msg.id)})
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return writer.WriteMessages(ctx, kafka.Message{
+		Topic:   target.Topic,
+		Key:     []byte(msg.key),
+		Value:   msg.data,
+		Headers: headers,
+	})
+}
+
+// publish sends a message on a NATS subject
+func (w *worker) publish(target config.NATSTarget, msg message) error {
+	conn, ok := w.nats[target.URL]
+	if !ok {
+		var err error
+		conn, err = nats.Connect(target.URL, nats.Name("gommutetime"), nats.Timeout(timeout), nats.MaxReconnects(-1))
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", target.URL, err)
+		}
+		w.nats[target.URL] = conn
+	}
+	// Publishing only buffers the message, which the connection keeps
+	// through reconnections
+	out := nats.NewMsg(target.Subject)
+	out.Data = msg.data
+	if msg.id != "" {
+		out.Header.Set(nats.MsgIdHdr, msg.id)
+	}
+	return conn.PublishMsg(out)
+}
+
+// close flushes and closes the connections to the brokers
+func (w *worker) close() {
+	for brokers, writer := range w.kafka {
+		if err := writer.Close(); err != nil {
+			log.Printf("ERROR closing Kafka writer for %s: %v", brokers, err)
+		}
+	}
+	for _, conn := range w.nats {
+		if err := conn.FlushTimeout(timeout); err != nil {
+			log.Printf("ERROR flushing NATS messages to %s: %v", conn.ConnectedUrlRedacted(), err)
+		}
+		conn.Close()
+	}
+}
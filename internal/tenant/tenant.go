@@ -0,0 +1,189 @@
+package tenant
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+)
+
+// File lists the tenants served by one daemon
+type File struct {
+	// Telemetry, error reporting and logging are shared by all tenants,
+	// since exporters and the log are process-wide
+	Telemetry config.TelemetryConfig `yaml:"telemetry,omitempty"`
+	Errors    config.ErrorsConfig    `yaml:"errors,omitempty"`
+	Logging   config.LoggingConfig   `yaml:"logging,omitempty"`
+	Tenants   []Tenant               `yaml:"tenants"`
+}
+
+// Tenant is an isolated set of itineraries with its own config file, and so
+// its own API key, data directory and notification channels
+type Tenant struct {
+	Name string `yaml:"name"`
+	// Config is the tenant's config file, relative to the tenants file
+	Config string `yaml:"config"`
+	// DailyRequests caps the route lookups made per day, zero for no limit
+	DailyRequests int `yaml:"daily_requests,omitempty"`
+}
+
+// Load reads and validates a tenants file, resolving config paths relative
+// to it
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to read tenants file: %w", err))
+	}
+
+	var file File
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("failed to parse tenants file: %w", err))
+	}
+
+	if err := file.validate(); err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, err)
+	}
+
+	dir := filepath.Dir(path)
+	for i, t := range file.Tenants {
+		if !filepath.IsAbs(t.Config) {
+			file.Tenants[i].Config = filepath.Join(dir, t.Config)
+		}
+	}
+
+	return &file, nil
+}
+
+// validate checks the tenant list for errors
+func (f *File) validate() error {
+	if len(f.Tenants) == 0 {
+		return fmt.Errorf("at least one tenant is required")
+	}
+	if err := config.ValidateErrors(f.Errors); err != nil {
+		return err
+	}
+	if err := config.ValidateLogging(f.Logging); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	configs := make(map[string]bool)
+	for i, t := range f.Tenants {
+		if t.Name == "" {
+			return fmt.Errorf("tenant %d: name is required", i)
+		}
+		if strings.ContainsAny(t.Name, "/ \t\r\n") {
+			return fmt.Errorf("tenant %s: name cannot contain slashes or whitespace", t.Name)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("duplicate tenant: %s", t.Name)
+		}
+		names[t.Name] = true
+
+		if t.Config == "" {
+			return fmt.Errorf("tenant %s: config is required", t.Name)
+		}
+		if configs[t.Config] {
+			return fmt.Errorf("tenant %s: config %s is used by another tenant", t.Name, t.Config)
+		}
+		configs[t.Config] = true
+
+		if t.DailyRequests < 0 {
+			return fmt.Errorf("tenant %s: daily_requests cannot be negative", t.Name)
+		}
+	}
+
+	return nil
+}
+
+// CheckIsolation makes sure tenants don't share a data directory, or keep
+// theirs inside another's, where they could read or overwrite each other's
+// history. configs are the loaded tenant configs, in the order of the
+// tenants. The returned Isolation keeps them apart as configs are reloaded.
+func (f *File) CheckIsolation(configs []*config.Config) (*Isolation, error) {
+	iso := &Isolation{dirs: make(map[string]string)}
+	for i, cfg := range configs {
+		if err := iso.Claim(f.Tenants[i].Name, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return iso, nil
+}
+
+// Isolation tracks the data directory of each running tenant. A nil
+// Isolation, for a single config, allows any directory.
+type Isolation struct {
+	mu sync.Mutex
+	// dirs are the absolute data directories by tenant name
+	dirs map[string]string
+}
+
+// Check returns an error when the data directory of cfg, a new config of
+// tenant name, is that of another tenant, inside it or contains it
+func (iso *Isolation) Check(name string, cfg *config.Config) error {
+	if iso == nil {
+		return nil
+	}
+	iso.mu.Lock()
+	defer iso.mu.Unlock()
+	_, err := iso.check(name, cfg)
+	return err
+}
+
+// Claim checks the data directory of cfg like Check, then records it as
+// tenant name's
+func (iso *Isolation) Claim(name string, cfg *config.Config) error {
+	if iso == nil {
+		return nil
+	}
+	iso.mu.Lock()
+	defer iso.mu.Unlock()
+	dir, err := iso.check(name, cfg)
+	if err != nil {
+		return err
+	}
+	if dir == "" {
+		delete(iso.dirs, name)
+	} else {
+		iso.dirs[name] = dir
+	}
+	return nil
+}
+
+// check returns the absolute data directory of cfg once checked against
+// those of the other tenants
+func (iso *Isolation) check(name string, cfg *config.Config) (string, error) {
+	if cfg.DataDir == "" {
+		return "", nil
+	}
+	dir, err := filepath.Abs(cfg.DataDir)
+	if err != nil {
+		return "", apperr.Wrap(apperr.KindConfig, fmt.Errorf("tenant %s: %w", name, err))
+	}
+	for owner, other := range iso.dirs {
+		if owner == name {
+			continue
+		}
+		switch {
+		case dir == other:
+			return "", apperr.Wrap(apperr.KindConfig, fmt.Errorf("tenants %s and %s share data_dir %s", owner, name, dir))
+		case within(dir, other):
+			return "", apperr.Wrap(apperr.KindConfig, fmt.Errorf("tenant %s: data_dir %s is inside that of tenant %s", name, dir, owner))
+		case within(other, dir):
+			return "", apperr.Wrap(apperr.KindConfig, fmt.Errorf("tenant %s: data_dir %s contains that of tenant %s", name, dir, owner))
+		}
+	}
+	return dir, nil
+}
+
+// within reports whether dir is inside parent, both absolute and clean
+func within(dir, parent string) bool {
+	rel, err := filepath.Rel(parent, dir)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
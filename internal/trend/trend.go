@@ -0,0 +1,183 @@
+// Package trend finds in the recorded history the days when the commute
+// times of an itinerary shifted for good, e.g. when construction started or
+// a traffic light was added
+package trend
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"gommutetime/internal/history"
+)
+
+// Change detection parameters
+const (
+	// slotMinutes groups samples taken at nearby times of day, whose usual
+	// duration they are compared with
+	slotMinutes = 15
+	// minDays is the fewest days with samples on each side of a change
+	minDays = 7
+	// minShift is the smallest change in minutes worth reporting
+	minShift = 2.0
+	// minScore is the t-statistic of the difference between the days before
+	// and after a change it takes to report it. Days are not independent, so
+	// it is well above the usual thresholds.
+	minScore = 5.0
+)
+
+// Change is a lasting shift in the commute times of an itinerary
+type Change struct {
+	// Date is the first day of the new level, at local midnight
+	Date time.Time
+	// Shift is how many minutes longer commutes took on average since Date,
+	// compared with the same times of day and week before, negative when
+	// they got shorter
+	Shift float64
+	// Before and After are the average durations in minutes of the samples
+	// between the previous change and this one, and since this one until
+	// the next
+	Before float64
+	After  float64
+}
+
+// day is the average deviation of the samples of a day from their usual
+// duration
+type day struct {
+	date      time.Time
+	deviation float64
+	duration  float64 // average of the samples
+}
+
+// Detect returns the changes in a series of samples, oldest first. Samples
+// are compared with the median of those taken at the same time of day and
+// week, so that schedules sampling rush and quiet hours on different days
+// do not read as changes. Changes are then found by binary segmentation of
+// the daily average deviations.
+func Detect(samples []history.Sample) []Change {
+	days := daily(samples)
+	if len(days) < 2*minDays {
+		return nil
+	}
+
+	splits := split(days, 0, len(days))
+	slices.Sort(splits)
+
+	var changes []Change
+	bounds := append(append([]int{0}, splits...), len(days))
+	for i := 1; i < len(bounds)-1; i++ {
+		before, after := days[bounds[i-1]:bounds[i]], days[bounds[i]:bounds[i+1]]
+		changes = append(changes, Change{
+			Date:   days[bounds[i]].date,
+			Shift:  mean(after, deviationOf) - mean(before, deviationOf),
+			Before: mean(before, durationOf),
+			After:  mean(after, durationOf),
+		})
+	}
+	return changes
+}
+
+// daily returns the average deviation of the samples of each day from the
+// median of their slot, in order
+func daily(samples []history.Sample) []day {
+	slotOf := func(t time.Time) int {
+		return int(t.Weekday())*24*60 + (t.Hour()*60+t.Minute())/slotMinutes
+	}
+	bySlot := make(map[int][]float64)
+	for _, s := range samples {
+		slot := slotOf(s.Timestamp.Local())
+		bySlot[slot] = append(bySlot[slot], s.Duration)
+	}
+	medians := make(map[int]float64, len(bySlot))
+	for slot, durations := range bySlot {
+		medians[slot] = median(durations)
+	}
+
+	type sums struct {
+		deviation, duration float64
+		count               int
+	}
+	byDay := make(map[time.Time]*sums)
+	for _, s := range samples {
+		local := s.Timestamp.Local()
+		date := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+		if byDay[date] == nil {
+			byDay[date] = &sums{}
+		}
+		byDay[date].deviation += s.Duration - medians[slotOf(local)]
+		byDay[date].duration += s.Duration
+		byDay[date].count++
+	}
+
+	days := make([]day, 0, len(byDay))
+	for date, sum := range byDay {
+		n := float64(sum.count)
+		days = append(days, day{date: date, deviation: sum.deviation / n, duration: sum.duration / n})
+	}
+	slices.SortFunc(days, func(a, b day) int { return a.date.Compare(b.date) })
+	return days
+}
+
+// split returns the indexes in [lo, hi) where the days shift, found by
+// splitting at the most significant shift and then looking for more on
+// either side
+func split(days []day, lo, hi int) []int {
+	best, bestScore := -1, 0.0
+	for k := lo + minDays; k <= hi-minDays; k++ {
+		before, after := days[lo:k], days[k:hi]
+		shift := mean(after, deviationOf) - mean(before, deviationOf)
+		if math.Abs(shift) < minShift {
+			continue
+		}
+		// Welch's t-statistic of the difference of the means
+		se := math.Sqrt(variance(before)/float64(len(before)) + variance(after)/float64(len(after)))
+		score := math.Inf(1)
+		if se > 0 {
+			score = math.Abs(shift) / se
+		}
+		if score > bestScore {
+			best, bestScore = k, score
+		}
+	}
+	if best < 0 || bestScore < minScore {
+		return nil
+	}
+	return append(append(split(days, lo, best), best), split(days, best, hi)...)
+}
+
+// deviationOf and durationOf select the values of days averaged by mean
+func deviationOf(d day) float64 { return d.deviation }
+func durationOf(d day) float64  { return d.duration }
+
+// mean averages a value over days
+func mean(days []day, value func(day) float64) float64 {
+	sum := 0.0
+	for _, d := range days {
+		sum += value(d)
+	}
+	return sum / float64(len(days))
+}
+
+// variance returns the unbiased variance of the deviations of days
+func variance(days []day) float64 {
+	if len(days) < 2 {
+		return 0
+	}
+	m := mean(days, deviationOf)
+	sum := 0.0
+	for _, d := range days {
+		sum += (d.deviation - m) * (d.deviation - m)
+	}
+	return sum / float64(len(days)-1)
+}
+
+// median returns the median of values
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
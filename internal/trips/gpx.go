@@ -0,0 +1,63 @@
+package trips
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gommutetime/internal/geo"
+)
+
+// gpxFile is the subset of the GPX 1.1 schema needed to extract a trip
+type gpxFile struct {
+	Tracks []struct {
+		Segments []struct {
+			Points []struct {
+				Lat  float64   `xml:"lat,attr"`
+				Lon  float64   `xml:"lon,attr"`
+				Time time.Time `xml:"time"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// LoadGPX reads a GPX file as a single trip from its first to its last
+// timestamped track point
+func LoadGPX(path string) (Trip, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Trip{}, fmt.Errorf("failed to read GPX file: %w", err)
+	}
+
+	var gpx gpxFile
+	if err := xml.Unmarshal(data, &gpx); err != nil {
+		return Trip{}, fmt.Errorf("failed to parse GPX file %s: %w", path, err)
+	}
+
+	trip := Trip{Source: filepath.Base(path)}
+	var last time.Time
+	for _, trk := range gpx.Tracks {
+		for _, seg := range trk.Segments {
+			for _, pt := range seg.Points {
+				if pt.Time.IsZero() {
+					continue
+				}
+				if trip.Start.IsZero() {
+					trip.Start = pt.Time
+					trip.From = geo.Point{Lat: pt.Lat, Lng: pt.Lon}
+				}
+				last = pt.Time
+				trip.To = geo.Point{Lat: pt.Lat, Lng: pt.Lon}
+			}
+		}
+	}
+
+	if trip.Start.IsZero() || !last.After(trip.Start) {
+		return Trip{}, fmt.Errorf("GPX file %s has no timed track", path)
+	}
+	trip.Duration = last.Sub(trip.Start)
+
+	return trip, nil
+}
@@ -0,0 +1,82 @@
+package trips
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gommutetime/internal/geo"
+)
+
+// stravaAPI is the Strava API base URL
+const stravaAPI = "https://www.strava.com/api/v3"
+
+// stravaPageSize is the largest page the activities endpoint returns
+const stravaPageSize = 200
+
+// stravaActivity is the subset of a Strava summary activity needed for a trip
+type stravaActivity struct {
+	ID          int64     `json:"id"`
+	StartDate   time.Time `json:"start_date"`
+	ElapsedTime int       `json:"elapsed_time"`
+	StartLatLng []float64 `json:"start_latlng"`
+	EndLatLng   []float64 `json:"end_latlng"`
+}
+
+// FetchStrava lists the athlete's activities started after since, using an
+// OAuth access token with the activity:read scope. Activities without GPS
+// endpoints are skipped.
+func FetchStrava(ctx context.Context, client *http.Client, token string, since time.Time) ([]Trip, error) {
+	var trips []Trip
+
+	for page := 1; ; page++ {
+		query := url.Values{
+			"after":    {strconv.FormatInt(since.Unix(), 10)},
+			"page":     {strconv.Itoa(page)},
+			"per_page": {strconv.Itoa(stravaPageSize)},
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, stravaAPI+"/athlete/activities?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Strava activities: %w", err)
+		}
+
+		var activities []stravaActivity
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("Strava returned status %d", resp.StatusCode)
+		} else if decodeErr := json.NewDecoder(resp.Body).Decode(&activities); decodeErr != nil {
+			err = fmt.Errorf("failed to decode Strava activities: %w", decodeErr)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range activities {
+			if len(a.StartLatLng) != 2 || len(a.EndLatLng) != 2 {
+				continue
+			}
+			trips = append(trips, Trip{
+				Source:   fmt.Sprintf("strava:%d", a.ID),
+				Start:    a.StartDate,
+				Duration: time.Duration(a.ElapsedTime) * time.Second,
+				From:     geo.Point{Lat: a.StartLatLng[0], Lng: a.StartLatLng[1]},
+				To:       geo.Point{Lat: a.EndLatLng[0], Lng: a.EndLatLng[1]},
+			})
+		}
+
+		if len(activities) < stravaPageSize {
+			return trips, nil
+		}
+	}
+}
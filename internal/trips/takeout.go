@@ -0,0 +1,223 @@
+package trips
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gommutetime/internal/geo"
+	"gommutetime/internal/history"
+)
+
+// TakeoutProvider marks samples imported from location history in output files
+const TakeoutProvider = "takeout"
+
+// DefaultTakeoutActivities are the activity types treated as commutes by car
+var DefaultTakeoutActivities = []string{"IN_PASSENGER_VEHICLE", "IN_VEHICLE", "MOTORCYCLING"}
+
+// takeoutFile covers both location history formats: monthly Semantic Location
+// History files (timelineObjects) and on-device Timeline exports (semanticSegments)
+type takeoutFile struct {
+	TimelineObjects []struct {
+		ActivitySegment *struct {
+			StartLocation takeoutLocation `json:"startLocation"`
+			EndLocation   takeoutLocation `json:"endLocation"`
+			Duration      struct {
+				StartTimestamp time.Time `json:"startTimestamp"`
+				EndTimestamp   time.Time `json:"endTimestamp"`
+			} `json:"duration"`
+			ActivityType string `json:"activityType"`
+		} `json:"activitySegment"`
+	} `json:"timelineObjects"`
+
+	SemanticSegments []struct {
+		StartTime time.Time `json:"startTime"`
+		EndTime   time.Time `json:"endTime"`
+		Activity  *struct {
+			Start struct {
+				LatLng string `json:"latLng"`
+			} `json:"start"`
+			End struct {
+				LatLng string `json:"latLng"`
+			} `json:"end"`
+			TopCandidate struct {
+				Type string `json:"type"`
+			} `json:"topCandidate"`
+		} `json:"activity"`
+	} `json:"semanticSegments"`
+}
+
+// takeoutLocation is a coordinate in degrees × 10^7
+type takeoutLocation struct {
+	LatitudeE7  int64 `json:"latitudeE7"`
+	LongitudeE7 int64 `json:"longitudeE7"`
+}
+
+// point converts the location to degrees
+func (l takeoutLocation) point() geo.Point {
+	return geo.Point{Lat: float64(l.LatitudeE7) / 1e7, Lng: float64(l.LongitudeE7) / 1e7}
+}
+
+// LoadTakeout reads trips of the given activity types from Google Takeout
+// location history. path may be a single JSON file or a directory searched
+// recursively, e.g. the "Semantic Location History" folder.
+func LoadTakeout(path string, activities []string) ([]Trip, error) {
+	wanted := make(map[string]bool)
+	for _, a := range activities {
+		wanted[strings.ToUpper(a)] = true
+	}
+
+	var trips []Trip
+	err := filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(file), ".json") {
+			return nil
+		}
+
+		found, err := loadTakeoutFile(file, wanted)
+		if err != nil {
+			return err
+		}
+		trips = append(trips, found...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trips, nil
+}
+
+// loadTakeoutFile reads trips from one location history file
+func loadTakeoutFile(path string, wanted map[string]bool) ([]Trip, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read location history: %w", err)
+	}
+
+	var history takeoutFile
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to parse location history %s: %w", path, err)
+	}
+
+	var trips []Trip
+	source := filepath.Base(path)
+
+	for _, obj := range history.TimelineObjects {
+		seg := obj.ActivitySegment
+		if seg == nil || !wanted[seg.ActivityType] {
+			continue
+		}
+		trips = appendTrip(trips, source, seg.Duration.StartTimestamp, seg.Duration.EndTimestamp,
+			seg.StartLocation.point(), seg.EndLocation.point())
+	}
+
+	for _, seg := range history.SemanticSegments {
+		if seg.Activity == nil || !wanted[seg.Activity.TopCandidate.Type] {
+			continue
+		}
+		from, err := parseLatLng(seg.Activity.Start.LatLng)
+		if err != nil {
+			continue
+		}
+		to, err := parseLatLng(seg.Activity.End.LatLng)
+		if err != nil {
+			continue
+		}
+		trips = appendTrip(trips, source, seg.StartTime, seg.EndTime, from, to)
+	}
+
+	return trips, nil
+}
+
+// appendTrip adds a trip if its timestamps are usable
+func appendTrip(trips []Trip, source string, start, end time.Time, from, to geo.Point) []Trip {
+	if start.IsZero() || !end.After(start) {
+		return trips
+	}
+	return append(trips, Trip{
+		Source:   source,
+		Start:    start,
+		Duration: end.Sub(start),
+		From:     from,
+		To:       to,
+	})
+}
+
+// parseLatLng parses Timeline coordinates such as "45.5017°, -73.5673°"
+func parseLatLng(value string) (geo.Point, error) {
+	value = strings.TrimPrefix(value, "geo:")
+	value = strings.ReplaceAll(value, "°", "")
+
+	lat, lng, ok := strings.Cut(value, ",")
+	if !ok {
+		return geo.Point{}, fmt.Errorf("invalid coordinates %q", value)
+	}
+
+	var p geo.Point
+	var err error
+	if p.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil {
+		return geo.Point{}, fmt.Errorf("invalid coordinates %q", value)
+	}
+	if p.Lng, err = strconv.ParseFloat(strings.TrimSpace(lng), 64); err != nil {
+		return geo.Point{}, fmt.Errorf("invalid coordinates %q", value)
+	}
+
+	return p, nil
+}
+
+// AppendSamples adds trips to an itinerary output file as historical samples
+// departing at the trip start, skipping departures already recorded
+func AppendSamples(path string, route *Route, trips []Trip) (int, error) {
+	seen := make(map[int64]bool)
+	for _, s := range route.Samples {
+		seen[s.Timestamp.Unix()] = true
+	}
+
+	if err := history.EnsureSchema(path); err != nil {
+		return 0, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer file.Close()
+
+	written := 0
+	for _, trip := range trips {
+		if seen[trip.Start.Unix()] {
+			continue
+		}
+		seen[trip.Start.Unix()] = true
+
+		line := fmt.Sprintf("%s,%f,0,0,OK,%s\n", trip.Start.Local().Format(time.RFC3339), trip.Duration.Minutes(), TakeoutProvider)
+		if _, err := file.WriteString(line); err != nil {
+			return written, fmt.Errorf("failed to write to file: %w", err)
+		}
+		written++
+	}
+
+	return written, nil
+}
+
+// FirstRecorded returns when the earliest sample not imported from location
+// history was recorded, or the zero time if there is none
+func FirstRecorded(route *Route) time.Time {
+	var first time.Time
+	for _, s := range route.Samples {
+		if s.Provider == TakeoutProvider {
+			continue
+		}
+		if first.IsZero() || s.Timestamp.Before(first) {
+			first = s.Timestamp
+		}
+	}
+	return first
+}
@@ -0,0 +1,246 @@
+package trips
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/geo"
+	"gommutetime/internal/history"
+)
+
+// Trip is an actual recorded journey
+type Trip struct {
+	Source   string // e.g. the GPX file name or strava:<activity id>
+	Start    time.Time
+	Duration time.Duration
+	From     geo.Point
+	To       geo.Point
+}
+
+// Route is an itinerary with resolved endpoints to match trips against
+type Route struct {
+	ID         string
+	OutputFile string
+	From       geo.Point
+	To         geo.Point
+	Samples    []history.Sample
+}
+
+// GeocodeFunc resolves an address to coordinates
+type GeocodeFunc func(ctx context.Context, address string) (geo.Point, error)
+
+// LoadRoutes resolves the endpoints of every single-route itinerary and
+// loads its stored samples. Matrix itineraries are not matched.
+func LoadRoutes(ctx context.Context, cfg *config.Config, geocode GeocodeFunc) ([]Route, error) {
+	var routes []Route
+
+	for _, itin := range cfg.Itineraries {
+		if itin.IsMatrix() || itin.OutputFile == "" {
+			continue
+		}
+
+		from, err := resolve(ctx, geocode, itin.From)
+		if err != nil {
+			return nil, fmt.Errorf("itinerary %s: %w", itin.ID, err)
+		}
+		to, err := resolve(ctx, geocode, itin.To)
+		if err != nil {
+			return nil, fmt.Errorf("itinerary %s: %w", itin.ID, err)
+		}
+
+		samples, err := history.Load(filepath.Join(cfg.DataDir, itin.OutputFile))
+		if err != nil {
+			return nil, fmt.Errorf("itinerary %s: %w", itin.ID, err)
+		}
+
+		routes = append(routes, Route{
+			ID:         itin.ID,
+			OutputFile: itin.OutputFile,
+			From:       from,
+			To:         to,
+			Samples:    samples,
+		})
+	}
+
+	return routes, nil
+}
+
+// resolve locates coordinates and full Plus Codes directly, geocoding anything else
+func resolve(ctx context.Context, geocode GeocodeFunc, location string) (geo.Point, error) {
+	if p, ok := geo.Locate(location); ok {
+		return p, nil
+	}
+	return geocode(ctx, location)
+}
+
+// Comparison pairs an actual trip with the prediction recorded closest to
+// its start
+type Comparison struct {
+	Trip       Trip
+	Predicted  history.Sample
+	Route      *Route
+	ActualMins float64
+}
+
+// MatchOptions controls how trips are matched to routes and predictions
+type MatchOptions struct {
+	// Radius is how far in meters a trip may start and end from the
+	// itinerary endpoints
+	Radius float64
+	// Window is how far from the trip start the prediction may be
+	Window time.Duration
+}
+
+// Match pairs trips with the route whose endpoints are closest and the
+// stored sample closest to the trip start. Trips without a matching route or
+// prediction are returned separately.
+func Match(trips []Trip, routes []Route, opts MatchOptions) (matched []Comparison, unmatched []Trip) {
+	for _, trip := range trips {
+		route := ClosestRoute(trip, routes, opts.Radius)
+		if route == nil {
+			unmatched = append(unmatched, trip)
+			continue
+		}
+
+		sample, ok := closestSample(route.Samples, trip.Start, opts.Window)
+		if !ok {
+			unmatched = append(unmatched, trip)
+			continue
+		}
+
+		matched = append(matched, Comparison{
+			Trip:       trip,
+			Predicted:  sample,
+			Route:      route,
+			ActualMins: trip.Duration.Minutes(),
+		})
+	}
+
+	return matched, unmatched
+}
+
+// ClosestRoute returns the route whose endpoints are both within radius of
+// the trip's, preferring the smallest total distance, or nil if none is
+func ClosestRoute(trip Trip, routes []Route, radius float64) *Route {
+	var best *Route
+	bestDist := math.Inf(1)
+
+	for i := range routes {
+		from := geo.Distance(trip.From, routes[i].From)
+		to := geo.Distance(trip.To, routes[i].To)
+		if from > radius || to > radius {
+			continue
+		}
+		if from+to < bestDist {
+			best = &routes[i]
+			bestDist = from + to
+		}
+	}
+
+	return best
+}
+
+// closestSample returns the sample nearest to at within window
+func closestSample(samples []history.Sample, at time.Time, window time.Duration) (history.Sample, bool) {
+	var best history.Sample
+	found := false
+
+	for _, s := range samples {
+		d := s.Timestamp.Sub(at).Abs()
+		if d > window {
+			continue
+		}
+		if !found || d < best.Timestamp.Sub(at).Abs() {
+			best = s
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// ComparisonFile returns the file storing comparisons for an output file,
+// e.g. work.actual.csv for work.csv
+func ComparisonFile(outputFile string) string {
+	return strings.TrimSuffix(outputFile, ".csv") + ".actual.csv"
+}
+
+// Append adds comparisons to the CSV file at path, skipping trips already
+// recorded from the same source, and returns how many were written. Rows are
+// trip_start,actual_minutes,predicted_minutes,prediction_timestamp,source.
+func Append(path string, comparisons []Comparison) (int, error) {
+	seen, err := loadSources(path)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open comparison file: %w", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	written := 0
+	for _, c := range comparisons {
+		if seen[c.Trip.Source] {
+			continue
+		}
+		seen[c.Trip.Source] = true
+
+		w.Write([]string{
+			c.Trip.Start.Format(time.RFC3339),
+			fmt.Sprintf("%f", c.ActualMins),
+			fmt.Sprintf("%f", c.Predicted.Duration),
+			c.Predicted.Timestamp.Format(time.RFC3339),
+			c.Trip.Source,
+		})
+		written++
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return written, fmt.Errorf("failed to write comparison file: %w", err)
+	}
+
+	return written, nil
+}
+
+// loadSources returns the trip sources already recorded in path
+func loadSources(path string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return seen, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open comparison file: %w", err)
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read comparison file: %w", err)
+		}
+		if len(record) >= 5 {
+			seen[record[4]] = true
+		}
+	}
+
+	return seen, nil
+}
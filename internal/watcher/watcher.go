@@ -14,10 +14,18 @@ type Watcher struct {
 	configPath string
 	watcher    *fsnotify.Watcher
 	onReload   func(*config.Config) error
+	onFailure  func(error)
+
+	// realPath is configPath with symlinks resolved. Kubernetes updates a
+	// mounted ConfigMap by pointing a symlink at a new directory, which
+	// changes it without any event for configPath itself.
+	realPath string
 }
 
-// New creates a new config file watcher
-func New(configPath string, onReload func(*config.Config) error) (*Watcher, error) {
+// New creates a new config file watcher. onReload receives each successfully
+// parsed config and is responsible for validating it before applying it.
+// onFailure, if not nil, receives the error of each rejected change.
+func New(configPath string, onReload func(*config.Config) error, onFailure func(error)) (*Watcher, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
@@ -44,10 +52,14 @@ func New(configPath string, onReload func(*config.Config) error) (*Watcher, erro
 		// Continue anyway, directory watch might be sufficient
 	}
 
+	realPath, _ := filepath.EvalSymlinks(absPath)
+
 	return &Watcher{
 		configPath: absPath,
+		realPath:   realPath,
 		watcher:    watcher,
 		onReload:   onReload,
+		onFailure:  onFailure,
 	}, nil
 }
 
@@ -73,10 +85,22 @@ func (w *Watcher) Start(ctx context.Context) error {
 
 			// Reload on Write, Create, or Chmod events for our config file
 			// Chmod is included because some editors change permissions during save
-			if eventPath == w.configPath &&
+			changed := eventPath == w.configPath &&
 				(event.Op&fsnotify.Write == fsnotify.Write ||
 					event.Op&fsnotify.Create == fsnotify.Create ||
-					event.Op&fsnotify.Chmod == fsnotify.Chmod) {
+					event.Op&fsnotify.Chmod == fsnotify.Chmod)
+
+			// Also reload when a symlink swap points the config elsewhere,
+			// and watch the new target since the old one is gone
+			if realPath, err := filepath.EvalSymlinks(w.configPath); err == nil && realPath != w.realPath {
+				w.realPath = realPath
+				changed = true
+				if err := w.watcher.Add(w.configPath); err != nil {
+					log.Printf("Warning: Could not watch file directly: %v", err)
+				}
+			}
+
+			if changed {
 
 				log.Println("Config file changed, reloading...")
 
@@ -84,17 +108,15 @@ func (w *Watcher) Start(ctx context.Context) error {
 				if err != nil {
 					log.Printf("ERROR: Failed to reload config: %v", err)
 					log.Println("Keeping previous configuration")
+					w.failed(err)
 					continue
 				}
 
-				if err := cfg.Validate(); err != nil {
-					log.Printf("ERROR: Invalid new config: %v", err)
-					log.Println("Keeping previous configuration")
-					continue
-				}
-
+				// onReload validates, so callers can adjust the config first
 				if err := w.onReload(cfg); err != nil {
 					log.Printf("ERROR: Failed to apply new config: %v", err)
+					log.Println("Keeping previous configuration")
+					w.failed(err)
 					continue
 				}
 
@@ -109,3 +131,10 @@ func (w *Watcher) Start(ctx context.Context) error {
 		}
 	}
 }
+
+// failed reports a rejected config change
+func (w *Watcher) failed(err error) {
+	if w.onFailure != nil {
+		w.onFailure(err)
+	}
+}
@@ -0,0 +1,98 @@
+// Package weather reports the current weather at a location from
+// Open-Meteo, which needs no API key, as the conditions that slow traffic
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/geo"
+)
+
+// Conditions that slow traffic
+const (
+	Snow         = "snow"
+	FreezingRain = "freezing_rain"
+	HeavyRain    = "heavy_rain"
+	Thunderstorm = "thunderstorm"
+	Fog          = "fog"
+)
+
+// Conditions lists the supported conditions
+var Conditions = []string{Snow, FreezingRain, HeavyRain, Thunderstorm, Fog}
+
+// DefaultURL is the forecast endpoint of Open-Meteo
+const DefaultURL = "https://api.open-meteo.com/v1/forecast"
+
+// Client queries the current weather
+type Client struct {
+	http *http.Client
+	url  string
+}
+
+// New creates a client requesting Open-Meteo through httpClient
+func New(httpClient *http.Client) *Client {
+	return &Client{http: httpClient, url: DefaultURL}
+}
+
+// Current returns the condition at p now, empty when none of Conditions
+// holds
+func (c *Client) Current(ctx context.Context, p geo.Point) (string, error) {
+	query := url.Values{
+		"latitude":  {strconv.FormatFloat(p.Lat, 'f', 4, 64)},
+		"longitude": {strconv.FormatFloat(p.Lng, 'f', 4, 64)},
+		"current":   {"weather_code"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "gommutetime")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", apperr.Wrap(apperr.KindProvider, fmt.Errorf("weather request failed: %w", err))
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", apperr.Wrap(apperr.KindProvider, fmt.Errorf("weather request failed: %w", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", apperr.Wrap(apperr.KindProvider, fmt.Errorf("weather request failed: HTTP %s", resp.Status))
+	}
+
+	var body struct {
+		Current struct {
+			WeatherCode *int `json:"weather_code"`
+		} `json:"current"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil || body.Current.WeatherCode == nil {
+		return "", apperr.Wrap(apperr.KindProvider, fmt.Errorf("invalid weather response"))
+	}
+	return Condition(*body.Current.WeatherCode), nil
+}
+
+// Condition returns the condition of a WMO weather interpretation code, as
+// Open-Meteo reports them, empty for the others
+func Condition(code int) string {
+	switch code {
+	case 45, 48:
+		return Fog
+	case 56, 57, 66, 67:
+		return FreezingRain
+	case 65, 82:
+		return HeavyRain
+	case 71, 73, 75, 77, 85, 86:
+		return Snow
+	case 95, 96, 99:
+		return Thunderstorm
+	}
+	return ""
+}
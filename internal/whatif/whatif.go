@@ -0,0 +1,147 @@
+// Package whatif estimates from the recorded history how much time leaving
+// earlier or later than usual would save, weekday by weekday
+package whatif
+
+import (
+	"math"
+	"time"
+
+	"gommutetime/internal/history"
+)
+
+// window is how far from a departure time samples still count for it, half
+// of the usual 15-minute interval
+const window = 7
+
+// z95 is the standard normal quantile of a 95% confidence interval
+const z95 = 1.96
+
+// minSamples is the fewest samples a departure time is compared with
+const minSamples = 2
+
+// DefaultShifts are the departure shifts compared, in minutes, each both
+// earlier and later
+var DefaultShifts = []int{15, 30}
+
+// weekdays are listed from Monday
+var weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday,
+	time.Saturday, time.Sunday}
+
+// Departure summarizes the samples taken around a departure time
+type Departure struct {
+	Samples  int
+	Mean     float64 // minutes
+	variance float64 // of the samples, unbiased
+}
+
+// Enough reports whether the departure has enough samples to be compared
+func (d Departure) Enough() bool {
+	return d.Samples >= minSamples
+}
+
+// Shift compares leaving at a shifted time with leaving at the usual time
+type Shift struct {
+	Minutes   int // shift of the departure, negative when earlier
+	Departure Departure
+	// Saved is how many minutes shorter the trip is on average when leaving
+	// at the shifted time, negative when it is longer, and Margin the
+	// half-width of its 95% confidence interval. Both are zero unless the
+	// usual and shifted departures have enough samples.
+	Saved  float64
+	Margin float64
+}
+
+// Day compares the shifts of one weekday, or of every weekday together
+type Day struct {
+	Name      string // weekday, or "all"
+	Departure Departure
+	Shifts    []Shift
+}
+
+// Analyze compares leaving at a time of day, in minutes since midnight,
+// with leaving shifted by each of shifts, earlier and later, by weekday and
+// then over every weekday. Samples are placed in their local time of day.
+// Weekdays without samples are left out.
+func Analyze(samples []history.Sample, departure int, shifts []int) []Day {
+	var offsets []int
+	for i := len(shifts) - 1; i >= 0; i-- {
+		offsets = append(offsets, -shifts[i])
+	}
+	offsets = append(offsets, shifts...)
+
+	var days []Day
+	for _, weekday := range weekdays {
+		day := compare(samples, departure, offsets, func(t time.Time) bool { return t.Weekday() == weekday })
+		if day.Departure.Samples == 0 && !hasSamples(day.Shifts) {
+			continue
+		}
+		day.Name = weekday.String()
+		days = append(days, day)
+	}
+	if len(days) > 1 {
+		all := compare(samples, departure, offsets, func(time.Time) bool { return true })
+		all.Name = "all"
+		days = append(days, all)
+	}
+	return days
+}
+
+// compare compares the departure with its shifts over the samples taken on
+// the days matching keep
+func compare(samples []history.Sample, departure int, offsets []int, keep func(time.Time) bool) Day {
+	day := Day{Departure: around(samples, departure, keep)}
+	for _, offset := range offsets {
+		shift := Shift{Minutes: offset, Departure: around(samples, departure+offset, keep)}
+		if day.Departure.Enough() && shift.Departure.Enough() {
+			shift.Saved = day.Departure.Mean - shift.Departure.Mean
+			// Welch's standard error of the difference of the means
+			shift.Margin = z95 * math.Sqrt(day.Departure.variance/float64(day.Departure.Samples)+
+				shift.Departure.variance/float64(shift.Departure.Samples))
+		}
+		day.Shifts = append(day.Shifts, shift)
+	}
+	return day
+}
+
+// around summarizes the samples taken within window of a time of day, in
+// minutes since midnight, on the days matching keep
+func around(samples []history.Sample, minute int, keep func(time.Time) bool) Departure {
+	var durations []float64
+	for _, s := range samples {
+		local := s.Timestamp.Local()
+		if !keep(local) {
+			continue
+		}
+		diff := local.Hour()*60 + local.Minute() - minute
+		if diff < -window || diff > window {
+			continue
+		}
+		durations = append(durations, s.Duration)
+	}
+
+	d := Departure{Samples: len(durations)}
+	if d.Samples == 0 {
+		return d
+	}
+	for _, v := range durations {
+		d.Mean += v
+	}
+	d.Mean /= float64(d.Samples)
+	if d.Samples > 1 {
+		for _, v := range durations {
+			d.variance += (v - d.Mean) * (v - d.Mean)
+		}
+		d.variance /= float64(d.Samples - 1)
+	}
+	return d
+}
+
+// hasSamples reports whether any shift has samples
+func hasSamples(shifts []Shift) bool {
+	for _, s := range shifts {
+		if s.Departure.Samples > 0 {
+			return true
+		}
+	}
+	return false
+}
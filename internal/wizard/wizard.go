@@ -0,0 +1,237 @@
+package wizard
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gommutetime/internal/config"
+	"gommutetime/internal/geo"
+)
+
+// GeocodeFunc resolves an address to coordinates using the given API key
+type GeocodeFunc func(ctx context.Context, apiKey, address string) (geo.Point, error)
+
+// Wizard asks the questions needed to build a starter config
+type Wizard struct {
+	in      *bufio.Scanner
+	out     io.Writer
+	geocode GeocodeFunc
+}
+
+// New creates a wizard reading answers from in and writing prompts to out
+func New(in io.Reader, out io.Writer, geocode GeocodeFunc) *Wizard {
+	return &Wizard{
+		in:      bufio.NewScanner(in),
+		out:     out,
+		geocode: geocode,
+	}
+}
+
+// Run prompts for the API key, home and work addresses and commute windows,
+// and returns a validated config with an itinerary in each direction.
+// envKey is the API key from the environment, used when none is entered.
+func (w *Wizard) Run(ctx context.Context, envKey string) (*config.Config, error) {
+	fmt.Fprintln(w.out, "This will create a starter configuration. Press Enter to accept [defaults].")
+	fmt.Fprintln(w.out)
+
+	// API key, left out of the file when it comes from the environment
+	var key string
+	var err error
+	if envKey != "" {
+		key, err = w.ask("Google Maps API key (leave empty to use GOOGLE_MAPS_API_KEY)", "")
+	} else {
+		key, err = w.askRequired("Google Maps API key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	lookupKey := key
+	if lookupKey == "" {
+		lookupKey = envKey
+	}
+
+	// Addresses, verified by geocoding
+	home, err := w.askAddress(ctx, lookupKey, "Home address")
+	if err != nil {
+		return nil, err
+	}
+	work, err := w.askAddress(ctx, lookupKey, "Work address")
+	if err != nil {
+		return nil, err
+	}
+
+	// Commute windows
+	morning, err := w.askWindow("Morning commute window", "07:00-09:30")
+	if err != nil {
+		return nil, err
+	}
+	evening, err := w.askWindow("Evening commute window", "16:00-18:30")
+	if err != nil {
+		return nil, err
+	}
+	interval, err := w.askInt("Minutes between samples", 15)
+	if err != nil {
+		return nil, err
+	}
+	days, err := w.ask("Commute days", "mon,tue,wed,thu,fri")
+	if err != nil {
+		return nil, err
+	}
+	dataDir, err := w.ask("Data directory", "./data")
+	if err != nil {
+		return nil, err
+	}
+
+	dayList := strings.Split(strings.ReplaceAll(days, " ", ""), ",")
+	cfg := &config.Config{
+		API:     config.APIConfig{Key: key},
+		DataDir: dataDir,
+		Itineraries: []config.Itinerary{
+			{
+				ID:         "to-work",
+				Name:       "Home to work",
+				From:       home,
+				To:         work,
+				OutputFile: "to-work.csv",
+				Schedules:  []config.Schedule{schedule("morning", dayList, morning, interval)},
+			},
+			{
+				ID:         "to-home",
+				Name:       "Work to home",
+				From:       work,
+				To:         home,
+				OutputFile: "to-home.csv",
+				Schedules:  []config.Schedule{schedule("evening", dayList, evening, interval)},
+			},
+		},
+	}
+
+	// Validate as it will be loaded, with the key from the environment if needed
+	check := *cfg
+	check.API.Key = lookupKey
+	if err := check.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// schedule builds a schedule from a [start, end] window
+func schedule(name string, days []string, window [2]string, interval int) config.Schedule {
+	return config.Schedule{
+		Name:            name,
+		Days:            days,
+		StartTime:       window[0],
+		EndTime:         window[1],
+		IntervalMinutes: interval,
+	}
+}
+
+// ask prompts for a value, returning def when the answer is empty
+func (w *Wizard) ask(prompt, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", prompt)
+	}
+
+	if !w.in.Scan() {
+		if err := w.in.Err(); err != nil {
+			return "", err
+		}
+		return "", io.ErrUnexpectedEOF
+	}
+
+	answer := strings.TrimSpace(w.in.Text())
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// askRequired prompts until a non-empty value is given
+func (w *Wizard) askRequired(prompt string) (string, error) {
+	for {
+		answer, err := w.ask(prompt, "")
+		if err != nil || answer != "" {
+			return answer, err
+		}
+		fmt.Fprintln(w.out, "  A value is required.")
+	}
+}
+
+// askAddress prompts until an address is found by geocoding, or the user
+// chooses to keep one that could not be verified. Coordinates and full Plus
+// Codes are accepted without a lookup.
+func (w *Wizard) askAddress(ctx context.Context, key, prompt string) (string, error) {
+	for {
+		address, err := w.askRequired(prompt)
+		if err != nil {
+			return "", err
+		}
+
+		if err := geo.ValidateLocation(address); err != nil {
+			fmt.Fprintf(w.out, "  %v\n", err)
+			continue
+		}
+		if point, ok := geo.Locate(address); ok {
+			fmt.Fprintf(w.out, "  Located at %s\n", point)
+			return address, nil
+		}
+
+		point, err := w.geocode(ctx, key, address)
+		if err == nil {
+			fmt.Fprintf(w.out, "  Found at %s\n", point)
+			return address, nil
+		}
+
+		fmt.Fprintf(w.out, "  Could not verify address: %v\n", err)
+		keep, err := w.ask("  Use it anyway? (y/N)", "")
+		if err != nil {
+			return "", err
+		}
+		if strings.EqualFold(keep, "y") || strings.EqualFold(keep, "yes") {
+			return address, nil
+		}
+	}
+}
+
+// askWindow prompts until a valid HH:MM-HH:MM window is given
+func (w *Wizard) askWindow(prompt, def string) ([2]string, error) {
+	for {
+		answer, err := w.ask(prompt, def)
+		if err != nil {
+			return [2]string{}, err
+		}
+
+		start, end, ok := strings.Cut(strings.ReplaceAll(answer, " ", ""), "-")
+		if ok {
+			startHour, startMin, errStart := config.ParseTime(start)
+			endHour, endMin, errEnd := config.ParseTime(end)
+			if errStart == nil && errEnd == nil && startHour*60+startMin < endHour*60+endMin {
+				return [2]string{start, end}, nil
+			}
+		}
+		fmt.Fprintln(w.out, "  Expected a window like 07:00-09:30.")
+	}
+}
+
+// askInt prompts until a positive integer is given
+func (w *Wizard) askInt(prompt string, def int) (int, error) {
+	for {
+		answer, err := w.ask(prompt, strconv.Itoa(def))
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := strconv.Atoi(answer)
+		if err == nil && n > 0 {
+			return n, nil
+		}
+		fmt.Fprintln(w.out, "  Expected a positive number.")
+	}
+}
@@ -0,0 +1,513 @@
+// Package xlsx writes Excel workbooks of plain values and charts, without
+// formulas or shared strings, which is all exports need
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxRows is the number of rows a sheet can hold
+const MaxRows = 1048576
+
+// Header is a cell value shown in bold
+type Header string
+
+// Cell styles, indexes into cellXfs of styles.xml
+const (
+	styleDefault = iota
+	styleHeader
+	styleTime
+	styleDecimal
+)
+
+// Workbook is a set of sheets written as an .xlsx file
+type Workbook struct {
+	sheets []*Sheet
+}
+
+// Sheet is a worksheet filled row by row
+type Sheet struct {
+	name   string
+	rows   [][]any
+	widths map[int]float64
+	frozen bool
+	charts []Chart
+}
+
+// ChartKind is the type of a chart
+type ChartKind int
+
+// Chart kinds
+const (
+	Column ChartKind = iota
+	Line
+)
+
+// Chart plots series of values against shared categories, placed over the
+// cells from Col, Row to Col+Cols, Row+Rows (0-based)
+type Chart struct {
+	Kind       ChartKind
+	Title      string
+	AxisTitle  string
+	Categories Range
+	Series     []Series
+	Col, Row   int
+	Cols, Rows int
+}
+
+// Series is a line or set of bars of a chart, named by a cell
+type Series struct {
+	Name   Range
+	Values Range
+}
+
+// Range is a block of cells of a sheet, with 1-based columns and rows
+type Range struct {
+	Sheet            string
+	FromCol, FromRow int
+	ToCol, ToRow     int
+}
+
+// Cell returns the range of a single cell
+func Cell(sheet string, col, row int) Range {
+	return Range{Sheet: sheet, FromCol: col, FromRow: row, ToCol: col, ToRow: row}
+}
+
+// String formats the range as an absolute reference, e.g. Summary!$B$2:$B$8
+func (r Range) String() string {
+	ref := quoteSheet(r.Sheet) + "!" + absolute(r.FromCol, r.FromRow)
+	if r.ToCol != r.FromCol || r.ToRow != r.FromRow {
+		ref += ":" + absolute(r.ToCol, r.ToRow)
+	}
+	return ref
+}
+
+// New creates an empty workbook
+func New() *Workbook {
+	return &Workbook{}
+}
+
+// AddSheet appends a sheet, changing its name as needed to make it valid
+// and unique in the workbook
+func (w *Workbook) AddSheet(name string) *Sheet {
+	name = sheetName(name)
+	unique := name
+	for n := 2; w.hasSheet(unique); n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		unique = truncate(name, 31-len(suffix)) + suffix
+	}
+
+	sheet := &Sheet{name: unique, widths: make(map[int]float64)}
+	w.sheets = append(w.sheets, sheet)
+	return sheet
+}
+
+// hasSheet reports whether a sheet name is taken, ignoring case like Excel
+func (w *Workbook) hasSheet(name string) bool {
+	for _, s := range w.sheets {
+		if strings.EqualFold(s.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the name of the sheet, as used in ranges
+func (s *Sheet) Name() string {
+	return s.name
+}
+
+// AddRow appends a row of strings, Headers, numbers, times or nils for
+// empty cells, returning its 1-based number
+func (s *Sheet) AddRow(values ...any) int {
+	s.rows = append(s.rows, values)
+	return len(s.rows)
+}
+
+// Rows returns the number of rows added
+func (s *Sheet) Rows() int {
+	return len(s.rows)
+}
+
+// SetWidth sets the width of a 1-based column, in characters
+func (s *Sheet) SetWidth(col int, width float64) {
+	s.widths[col] = width
+}
+
+// FreezeHeader keeps the first row visible while scrolling
+func (s *Sheet) FreezeHeader() {
+	s.frozen = true
+}
+
+// AddChart places a chart over the sheet
+func (s *Sheet) AddChart(c Chart) {
+	s.charts = append(s.charts, c)
+}
+
+// Write writes the workbook as an .xlsx file
+func (w *Workbook) Write(out io.Writer) error {
+	z := zip.NewWriter(out)
+
+	// Sheets, drawings and charts are numbered across the workbook
+	var parts []string
+	drawings, charts := 0, 0
+	for i, sheet := range w.sheets {
+		if len(sheet.rows) > MaxRows {
+			return fmt.Errorf("sheet %s has %d rows, more than the %d Excel allows", sheet.name, len(sheet.rows), MaxRows)
+		}
+
+		drawing := 0
+		if len(sheet.charts) > 0 {
+			drawings++
+			drawing = drawings
+		}
+		sheetPath := fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		parts = append(parts, part(sheetPath, "spreadsheetml.worksheet"))
+		if err := writeSheet(z, sheetPath, sheet, drawing); err != nil {
+			return err
+		}
+		if drawing == 0 {
+			continue
+		}
+
+		sheetRels := fmt.Sprintf("xl/worksheets/_rels/sheet%d.xml.rels", i+1)
+		if err := writeFile(z, sheetRels, relationships([]string{fmt.Sprintf("../drawings/drawing%d.xml", drawing)}, "drawing")); err != nil {
+			return err
+		}
+
+		var chartTargets []string
+		for _, chart := range sheet.charts {
+			charts++
+			chartPath := fmt.Sprintf("xl/charts/chart%d.xml", charts)
+			parts = append(parts, part(chartPath, "drawingml.chart"))
+			if err := writeFile(z, chartPath, chartXML(chart)); err != nil {
+				return err
+			}
+			chartTargets = append(chartTargets, fmt.Sprintf("../charts/chart%d.xml", charts))
+		}
+
+		drawingPath := fmt.Sprintf("xl/drawings/drawing%d.xml", drawing)
+		parts = append(parts, part(drawingPath, "drawing"))
+		if err := writeFile(z, drawingPath, drawingXML(sheet.charts)); err != nil {
+			return err
+		}
+		drawingRels := fmt.Sprintf("xl/drawings/_rels/drawing%d.xml.rels", drawing)
+		if err := writeFile(z, drawingRels, relationships(chartTargets, "chart")); err != nil {
+			return err
+		}
+	}
+
+	// Package parts referencing the sheets
+	var sheets strings.Builder
+	var targets []string
+	for i, sheet := range w.sheets {
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(sheet.name), i+1, i+1)
+		targets = append(targets, fmt.Sprintf("worksheets/sheet%d.xml", i+1))
+	}
+	workbookRels := relationships(targets, "worksheet")
+	workbookRels = strings.Replace(workbookRels, "</Relationships>",
+		fmt.Sprintf(`<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/></Relationships>`, len(w.sheets)+1, relationshipNS), 1)
+
+	files := []struct{ path, content string }{
+		{"[Content_Types].xml", contentTypes(parts)},
+		{"_rels/.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="` + relationshipNS + `/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", xmlHeader + `<workbook xmlns="` + mainNS + `" xmlns:r="` + relationshipNS + `"><sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+		{"xl/styles.xml", stylesXML},
+	}
+	for _, f := range files {
+		if err := writeFile(z, f.path, f.content); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// XML namespaces
+const (
+	xmlHeader      = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+	mainNS         = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	relationshipNS = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	drawingNS      = "http://schemas.openxmlformats.org/drawingml/2006/main"
+	chartNS        = "http://schemas.openxmlformats.org/drawingml/2006/chart"
+)
+
+// stylesXML defines the cell styles: default, bold header, date and time,
+// and one decimal
+const stylesXML = xmlHeader + `<styleSheet xmlns="` + mainNS + `">` +
+	`<numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm"/><numFmt numFmtId="165" formatCode="0.0"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// writeFile adds a file to the archive
+func writeFile(z *zip.Writer, path, content string) error {
+	f, err := z.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, content)
+	return err
+}
+
+// part returns the content type override of a package part
+func part(path, kind string) string {
+	return fmt.Sprintf(`<Override PartName="/%s" ContentType="application/vnd.openxmlformats-officedocument.%s+xml"/>`, path, kind)
+}
+
+// contentTypes lists the content types of the package parts
+func contentTypes(parts []string) string {
+	return xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		part("xl/workbook.xml", "spreadsheetml.sheet.main") +
+		part("xl/styles.xml", "spreadsheetml.styles") +
+		strings.Join(parts, "") +
+		`</Types>`
+}
+
+// relationships links a part to targets of one type, as rId1, rId2...
+func relationships(targets []string, kind string) string {
+	var b strings.Builder
+	b.WriteString(xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, target := range targets {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/%s" Target="%s"/>`, i+1, relationshipNS, kind, target)
+	}
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// writeSheet streams a worksheet, which may hold many rows
+func writeSheet(z *zip.Writer, path string, sheet *Sheet, drawing int) error {
+	f, err := z.Create(path)
+	if err != nil {
+		return err
+	}
+	b := bufio.NewWriter(f)
+
+	b.WriteString(xmlHeader + `<worksheet xmlns="` + mainNS + `" xmlns:r="` + relationshipNS + `">`)
+	if sheet.frozen {
+		b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	if len(sheet.widths) > 0 {
+		b.WriteString(`<cols>`)
+		for col := 1; col <= maxKey(sheet.widths); col++ {
+			if width, ok := sheet.widths[col]; ok {
+				fmt.Fprintf(b, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, col, col, width)
+			}
+		}
+		b.WriteString(`</cols>`)
+	}
+
+	b.WriteString(`<sheetData>`)
+	for i, row := range sheet.rows {
+		fmt.Fprintf(b, `<row r="%d">`, i+1)
+		for j, value := range row {
+			writeCell(b, columnName(j+1)+strconv.Itoa(i+1), value)
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData>`)
+
+	if drawing > 0 {
+		b.WriteString(`<drawing r:id="rId1"/>`)
+	}
+	b.WriteString(`</worksheet>`)
+	return b.Flush()
+}
+
+// writeCell writes a cell, leaving out empty ones
+func writeCell(b *bufio.Writer, ref string, value any) {
+	switch v := value.(type) {
+	case nil:
+	case string:
+		fmt.Fprintf(b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(v))
+	case Header:
+		fmt.Fprintf(b, `<c r="%s" t="inlineStr" s="%d"><is><t xml:space="preserve">%s</t></is></c>`, ref, styleHeader, escape(string(v)))
+	case int:
+		fmt.Fprintf(b, `<c r="%s"><v>%d</v></c>`, ref, v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return
+		}
+		fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleDecimal, strconv.FormatFloat(v, 'f', -1, 64))
+	case time.Time:
+		fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleTime, strconv.FormatFloat(serial(v), 'f', -1, 64))
+	default:
+		fmt.Fprintf(b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(fmt.Sprint(v)))
+	}
+}
+
+// serial converts a time to an Excel date serial number, keeping the wall
+// clock time since Excel dates have no time zone
+func serial(t time.Time) float64 {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return math.Round(wall.Sub(epoch).Seconds()) / 86400
+}
+
+// drawingXML anchors the charts of a sheet, referencing them as rId1, rId2...
+func drawingXML(charts []Chart) string {
+	var b strings.Builder
+	b.WriteString(xmlHeader + `<xdr:wsDr xmlns:xdr="http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing" xmlns:a="` + drawingNS + `" xmlns:c="` + chartNS + `" xmlns:r="` + relationshipNS + `">`)
+	for i, c := range charts {
+		fmt.Fprintf(&b, `<xdr:twoCellAnchor>`+
+			`<xdr:from><xdr:col>%d</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>%d</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from>`+
+			`<xdr:to><xdr:col>%d</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>%d</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:to>`+
+			`<xdr:graphicFrame macro=""><xdr:nvGraphicFramePr><xdr:cNvPr id="%d" name="Chart %d"/><xdr:cNvGraphicFramePr/></xdr:nvGraphicFramePr>`+
+			`<xdr:xfrm><a:off x="0" y="0"/><a:ext cx="0" cy="0"/></xdr:xfrm>`+
+			`<a:graphic><a:graphicData uri="`+chartNS+`"><c:chart r:id="rId%d"/></a:graphicData></a:graphic>`+
+			`</xdr:graphicFrame><xdr:clientData/></xdr:twoCellAnchor>`,
+			c.Col, c.Row, c.Col+c.Cols, c.Row+c.Rows, i+2, i+1, i+1)
+	}
+	b.WriteString(`</xdr:wsDr>`)
+	return b.String()
+}
+
+// chartXML describes a chart. Values are read from the referenced cells
+// when the workbook is opened.
+func chartXML(c Chart) string {
+	var b strings.Builder
+	b.WriteString(xmlHeader + `<c:chartSpace xmlns:c="` + chartNS + `" xmlns:a="` + drawingNS + `" xmlns:r="` + relationshipNS + `">`)
+	b.WriteString(`<c:roundedCorners val="0"/><c:chart>`)
+	b.WriteString(`<c:title>` + richText(c.Title) + `<c:overlay val="0"/></c:title><c:autoTitleDeleted val="0"/>`)
+	b.WriteString(`<c:plotArea><c:layout/>`)
+
+	if c.Kind == Line {
+		b.WriteString(`<c:lineChart><c:grouping val="standard"/><c:varyColors val="0"/>`)
+	} else {
+		b.WriteString(`<c:barChart><c:barDir val="col"/><c:grouping val="clustered"/><c:varyColors val="0"/>`)
+	}
+	for i, s := range c.Series {
+		fmt.Fprintf(&b, `<c:ser><c:idx val="%d"/><c:order val="%d"/>`, i, i)
+		fmt.Fprintf(&b, `<c:tx><c:strRef><c:f>%s</c:f></c:strRef></c:tx>`, escape(s.Name.String()))
+		if c.Kind == Line {
+			b.WriteString(`<c:marker><c:symbol val="circle"/><c:size val="5"/></c:marker>`)
+		}
+		fmt.Fprintf(&b, `<c:cat><c:strRef><c:f>%s</c:f></c:strRef></c:cat>`, escape(c.Categories.String()))
+		fmt.Fprintf(&b, `<c:val><c:numRef><c:f>%s</c:f></c:numRef></c:val>`, escape(s.Values.String()))
+		if c.Kind == Line {
+			b.WriteString(`<c:smooth val="0"/>`)
+		}
+		b.WriteString(`</c:ser>`)
+	}
+	if c.Kind == Line {
+		b.WriteString(`<c:marker val="1"/><c:axId val="1"/><c:axId val="2"/></c:lineChart>`)
+	} else {
+		b.WriteString(`<c:gapWidth val="150"/><c:axId val="1"/><c:axId val="2"/></c:barChart>`)
+	}
+
+	b.WriteString(`<c:catAx><c:axId val="1"/><c:scaling><c:orientation val="minMax"/></c:scaling><c:delete val="0"/><c:axPos val="b"/>` +
+		`<c:numFmt formatCode="General" sourceLinked="1"/><c:tickLblPos val="nextTo"/><c:crossAx val="2"/><c:crosses val="autoZero"/></c:catAx>`)
+	b.WriteString(`<c:valAx><c:axId val="2"/><c:scaling><c:orientation val="minMax"/></c:scaling><c:delete val="0"/><c:axPos val="l"/><c:majorGridlines/>`)
+	if c.AxisTitle != "" {
+		b.WriteString(`<c:title>` + richText(c.AxisTitle) + `<c:overlay val="0"/></c:title>`)
+	}
+	b.WriteString(`<c:numFmt formatCode="0" sourceLinked="0"/><c:tickLblPos val="nextTo"/><c:crossAx val="1"/><c:crosses val="autoZero"/></c:valAx>`)
+
+	b.WriteString(`</c:plotArea><c:legend><c:legendPos val="b"/><c:overlay val="0"/></c:legend><c:plotVisOnly val="1"/><c:dispBlanksAs val="gap"/>`)
+	b.WriteString(`</c:chart></c:chartSpace>`)
+	return b.String()
+}
+
+// richText formats the text of a chart or axis title
+func richText(text string) string {
+	return `<c:tx><c:rich><a:bodyPr/><a:p><a:r><a:t>` + escape(text) + `</a:t></a:r></a:p></c:rich></c:tx>`
+}
+
+// columnName converts a 1-based column number to its letters, e.g. 28 to AB
+func columnName(col int) string {
+	name := ""
+	for col > 0 {
+		col--
+		name = string(rune('A'+col%26)) + name
+		col /= 26
+	}
+	return name
+}
+
+// absolute formats an absolute cell reference, e.g. $B$2
+func absolute(col, row int) string {
+	return "$" + columnName(col) + "$" + strconv.Itoa(row)
+}
+
+// quoteSheet quotes a sheet name in references unless it is a plain word
+func quoteSheet(name string) string {
+	for _, r := range name {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+			return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+		}
+	}
+	return name
+}
+
+// sheetName makes a valid sheet name: at most 31 characters, none of
+// []:*?/\ and not starting or ending with a quote
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(truncate(name, 31), "'")
+	if name == "" {
+		return "Sheet"
+	}
+	return name
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// escape escapes XML text, dropping characters XML cannot hold
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '"':
+			b.WriteString("&quot;")
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r', r == 0xFFFE, r == 0xFFFF:
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// maxKey returns the largest key of a map
+func maxKey(m map[int]float64) int {
+	n := 0
+	for k := range m {
+		n = max(n, k)
+	}
+	return n
+}
@@ -0,0 +1,272 @@
+//go:build darwin
+
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/config"
+)
+
+// defaultLaunchdLabel is the label the job is registered under
+const defaultLaunchdLabel = "com.gommutetime.scheduler"
+
+// launchdJob describes the launchd job running the scheduler
+type launchdJob struct {
+	label      string
+	args       []string
+	workDir    string
+	logPath    string
+	userName   string // only for system daemons
+	env        map[string]string
+	plistPath  string
+	domain     string // launchctl domain, gui/<uid> or system
+	configPath string
+}
+
+func runInstallLaunchd(args []string) {
+	fs := flag.NewFlagSet("install-launchd", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	label := fs.String("label", defaultLaunchdLabel, "Label of the launchd job")
+	logDir := fs.String("log-dir", "", "Directory of the log file (default: ~/Library/Logs/gommutetime, or /Library/Logs/gommutetime with -system)")
+	envNames := fs.String("env", "", "Comma-separated environment variables to copy into the job, besides the API keys and GOMMUTETIME_*")
+	system := fs.Bool("system", false, "Install a system daemon starting at boot instead of a user agent starting at login (run with sudo)")
+	noLoad := fs.Bool("no-load", false, "Write the plist without loading it")
+	uninstall := fs.Bool("uninstall", false, "Unload the job and remove its plist")
+	fs.Parse(args)
+
+	job, err := newLaunchdJob(*label, *configPath, *logDir, *envNames, *system, fs.Args())
+	if err != nil {
+		fatal("Failed to prepare launchd job", err)
+	}
+
+	if *uninstall {
+		if err := job.uninstall(); err != nil {
+			fatal("Failed to uninstall launchd job", err)
+		}
+		fmt.Printf("Removed %s\n", job.plistPath)
+		return
+	}
+
+	if err := job.write(); err != nil {
+		fatal("Failed to write launchd plist", err)
+	}
+	fmt.Printf("Wrote %s\n", job.plistPath)
+	if *noLoad {
+		fmt.Printf("Load it with: launchctl bootstrap %s %s\n", job.domain, job.plistPath)
+		return
+	}
+
+	if err := job.load(); err != nil {
+		fatal("Failed to load launchd job", err)
+	}
+	fmt.Printf("Loaded %s; logs are written to %s\n", job.label, job.logPath)
+}
+
+// newLaunchdJob resolves the paths and environment of the job
+func newLaunchdJob(label, configPath, logDir, envNames string, system bool, scheduleArgs []string) (*launchdJob, error) {
+	if label == "" || strings.ContainsAny(label, "/ ") {
+		return nil, apperr.Wrap(apperr.KindConfig, fmt.Errorf("invalid label %q", label))
+	}
+	if system && os.Geteuid() != 0 {
+		return nil, apperr.Wrap(apperr.KindConfig, errors.New("-system must be run as root, e.g. with sudo"))
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate executable: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return nil, fmt.Errorf("failed to locate executable: %w", err)
+	}
+	configPath, err = filepath.Abs(configPath)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, err)
+	}
+
+	job := &launchdJob{
+		label:      label,
+		args:       append([]string{exe, "schedule", "-config", configPath}, scheduleArgs...),
+		workDir:    filepath.Dir(configPath),
+		env:        launchdEnv(envNames),
+		configPath: configPath,
+	}
+
+	if system {
+		job.plistPath = filepath.Join("/Library/LaunchDaemons", label+".plist")
+		job.domain = "system"
+		if logDir == "" {
+			logDir = "/Library/Logs/gommutetime"
+		}
+		// Run as the user who invoked sudo rather than as root
+		job.userName = os.Getenv("SUDO_USER")
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate home directory: %w", err)
+		}
+		job.plistPath = filepath.Join(home, "Library", "LaunchAgents", label+".plist")
+		job.domain = fmt.Sprintf("gui/%d", os.Getuid())
+		if logDir == "" {
+			logDir = filepath.Join(home, "Library", "Logs", "gommutetime")
+		}
+	}
+	if logDir, err = filepath.Abs(logDir); err != nil {
+		return nil, apperr.Wrap(apperr.KindConfig, err)
+	}
+	job.logPath = filepath.Join(logDir, "gommutetime.log")
+
+	return job, nil
+}
+
+// launchdEnv collects the environment of the job: PATH so the git command
+// is found, the API key, config overrides and any extra variables named
+func launchdEnv(extra string) map[string]string {
+	env := map[string]string{}
+	names := []string{"PATH", "GOOGLE_MAPS_API_KEY", "AZURE_MAPS_KEY"}
+	for _, name := range strings.Split(extra, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+	for _, kv := range os.Environ() {
+		if name, value, _ := strings.Cut(kv, "="); strings.HasPrefix(name, config.EnvPrefix) {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// write creates the log directory and writes the plist, readable only by
+// its owner since the environment may hold the API key
+func (j *launchdJob) write() error {
+	if _, err := os.Stat(j.configPath); err != nil && !config.HasEnv() {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("config file not found: %w", err))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.logPath), 0755); err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to create log directory: %w", err))
+	}
+	if j.userName != "" {
+		// The daemon runs as the user, who must be able to write its logs
+		if u, err := user.Lookup(j.userName); err == nil {
+			chownTo(filepath.Dir(j.logPath), u)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.plistPath), 0755); err != nil {
+		return apperr.Wrap(apperr.KindStorage, fmt.Errorf("failed to create %s: %w", filepath.Dir(j.plistPath), err))
+	}
+	if err := os.WriteFile(j.plistPath, j.plist(), 0600); err != nil {
+		return apperr.Wrap(apperr.KindStorage, err)
+	}
+	return nil
+}
+
+// load replaces any loaded copy of the job with the plist just written
+func (j *launchdJob) load() error {
+	// Unloading fails when the job is not loaded yet, which is fine
+	exec.Command("launchctl", "bootout", j.domain+"/"+j.label).Run()
+
+	out, err := exec.Command("launchctl", "bootstrap", j.domain, j.plistPath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl bootstrap failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// uninstall unloads the job and removes its plist, keeping the logs
+func (j *launchdJob) uninstall() error {
+	exec.Command("launchctl", "bootout", j.domain+"/"+j.label).Run()
+
+	if err := os.Remove(j.plistPath); err != nil {
+		if os.IsNotExist(err) {
+			return apperr.Wrap(apperr.KindConfig, fmt.Errorf("%s is not installed", j.label))
+		}
+		return apperr.Wrap(apperr.KindStorage, err)
+	}
+	return nil
+}
+
+// plist renders the job as a launchd property list. The job starts at load
+// and is restarted whenever it exits, at most every 30 seconds.
+func (j *launchdJob) plist() []byte {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+
+	plistString(&b, "Label", j.label)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range j.args {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", xmlEscape(arg))
+	}
+	b.WriteString("\t</array>\n")
+	plistString(&b, "WorkingDirectory", j.workDir)
+	if j.userName != "" {
+		plistString(&b, "UserName", j.userName)
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<true/>\n")
+	b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>30</integer>\n")
+	plistString(&b, "ProcessType", "Background")
+	plistString(&b, "StandardOutPath", j.logPath)
+	plistString(&b, "StandardErrorPath", j.logPath)
+
+	if len(j.env) > 0 {
+		b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+		names := make([]string, 0, len(j.env))
+		for name := range j.env {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "\t\t<key>%s</key>\n\t\t<string>%s</string>\n", xmlEscape(name), xmlEscape(j.env[name]))
+		}
+		b.WriteString("\t</dict>\n")
+	}
+
+	b.WriteString("</dict>\n</plist>\n")
+	return []byte(b.String())
+}
+
+// plistString writes a string entry of the top-level dict
+func plistString(b *strings.Builder, key, value string) {
+	fmt.Fprintf(b, "\t<key>%s</key>\n\t<string>%s</string>\n", key, xmlEscape(value))
+}
+
+// xmlEscape escapes text for use in the plist
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// chownTo gives a path to a user, ignoring failures
+func chownTo(path string, u *user.User) {
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return
+	}
+	os.Chown(path, uid, gid)
+}
@@ -0,0 +1,14 @@
+//go:build !darwin
+
+package main
+
+import (
+	"errors"
+
+	"gommutetime/internal/apperr"
+)
+
+func runInstallLaunchd(args []string) {
+	fatal("Unsupported command", apperr.Wrap(apperr.KindConfig,
+		errors.New("install-launchd is only available on macOS; use a systemd unit, the Windows service or Docker elsewhere")))
+}
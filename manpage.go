@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gommutetime/internal/apperr"
+)
+
+func runMan(args []string) {
+	fs := flag.NewFlagSet("man", flag.ExitOnError)
+	dir := fs.String("dir", "", "Write gommutetime.1 to this directory instead")
+	fs.Parse(args)
+
+	if *dir == "" {
+		writeManPage(os.Stdout)
+		return
+	}
+
+	path := filepath.Join(*dir, "gommutetime.1")
+	file, err := os.Create(path)
+	if err != nil {
+		fatal("Failed to create man page", apperr.Wrap(apperr.KindStorage, err))
+	}
+	writeManPage(file)
+	if err := file.Close(); err != nil {
+		fatal("Failed to write man page", apperr.Wrap(apperr.KindStorage, err))
+	}
+	fmt.Printf("Wrote %s\n", path)
+}
+
+// writeManPage writes the gommutetime(1) man page in roff format
+func writeManPage(w io.Writer) {
+	fmt.Fprintf(w, ".TH GOMMUTETIME 1 %q gommutetime \"User Commands\"\n", time.Now().Format("January 2006"))
+
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintln(w, `gommutetime \- Google Maps commute time tracker`)
+
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	for _, c := range commandDocs {
+		fmt.Fprintf(w, ".B gommutetime\n%s\n.br\n", roff(c.usage()))
+	}
+
+	fmt.Fprintln(w, ".SH DESCRIPTION")
+	fmt.Fprintln(w, roff("gommutetime records commute times between configured places on a schedule, "+
+		"alerts when they exceed thresholds, and provides tools to analyze the collected history."))
+
+	fmt.Fprintln(w, ".SH COMMANDS")
+	for _, c := range commandDocs {
+		fmt.Fprintf(w, ".SS %s\n%s\n", roff(c.usage()), roff(c.summary))
+		for _, o := range c.options {
+			fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roff(o.flag()), roff(o.usage))
+		}
+	}
+
+	fmt.Fprintln(w, ".SH ENVIRONMENT")
+	for _, env := range [][2]string{
+		{"GOOGLE_MAPS_API_KEY", "Google Maps API key, overriding the one in the config file"},
+		{"AZURE_MAPS_KEY", "Azure Maps key, overriding api.azure.key in the config file"},
+		{"STRAVA_ACCESS_TOKEN", "Strava access token used by import"},
+		{"HTTPS_PROXY, NO_PROXY", "Proxy settings used when api.proxy is not set"},
+		{"OTEL_EXPORTER_OTLP_ENDPOINT", "OpenTelemetry collector to export traces and metrics to"},
+		{"SENTRY_DSN", "Sentry project to report errors to when errors.sentry_dsn is not set"},
+	} {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roff(env[0]), roff(env[1]))
+	}
+
+	fmt.Fprintln(w, ".SH FILES")
+	fmt.Fprintf(w, ".TP\n.I %s\n%s\n", roff(defaultConfigPath), roff("Default config file"))
+
+	fmt.Fprintln(w, ".SH EXIT STATUS")
+	for _, e := range exitCodes {
+		fmt.Fprintf(w, ".TP\n.B %d\n%s\n", e.code, roff(e.description))
+	}
+}
+
+// roff escapes text for use in a roff document
+func roff(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+
+	"gommutetime/internal/apperr"
+)
+
+func runService(args []string) {
+	fatal("Unsupported command", apperr.Wrap(apperr.KindConfig,
+		errors.New("the service command is only available on Windows; use a systemd unit, launchd or Docker elsewhere")))
+}
@@ -0,0 +1,262 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"gommutetime/internal/apperr"
+	"gommutetime/internal/logsink"
+)
+
+// defaultServiceName is the name the service is registered under
+const defaultServiceName = "gommutetime"
+
+func runService(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Error: usage: gommutetime service install|uninstall|start|stop|run [options]")
+		os.Exit(1)
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("service "+action, flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "Path to config file")
+	name := fs.String("name", defaultServiceName, "Service name")
+	fs.Parse(args[1:])
+
+	var err error
+	switch action {
+	case "install":
+		err = installService(*name, *configPath, fs.Args())
+	case "uninstall":
+		err = uninstallService(*name)
+	case "start":
+		err = startService(*name)
+	case "stop":
+		err = stopService(*name)
+	case "run":
+		err = runAsService(*name, *configPath, fs.Args())
+	default:
+		fmt.Printf("Error: unknown service action %q\n", action)
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(fmt.Sprintf("Failed to %s service", action), err)
+	}
+}
+
+// installService registers the service to start at boot, running the
+// scheduler with the config at configPath and any extra schedule flags
+func installService(name, configPath string, scheduleArgs []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	configPath, err = filepath.Abs(configPath)
+	if err != nil {
+		return apperr.Wrap(apperr.KindConfig, err)
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		return apperr.Wrap(apperr.KindConfig, fmt.Errorf("config file not found: %w", err))
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager (run as administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", name)
+	}
+
+	args := append([]string{"service", "run", "-name", name, "-config", configPath}, scheduleArgs...)
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: "Gommutetime commute tracker",
+		Description: "Records commute times on a schedule",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	// Restart after crashes, backing off a little each time
+	recovery := []mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 10 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Minute},
+	}
+	if err := s.SetRecoveryActions(recovery, uint32((24 * time.Hour).Seconds())); err != nil {
+		log.Printf("Warning: failed to set service recovery actions: %v", err)
+	}
+
+	if err := eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to register event log source: %w", err)
+	}
+
+	fmt.Printf("Installed service %s for %s. Start it with: gommutetime service start\n", name, configPath)
+	return nil
+}
+
+// uninstallService removes the service and its event log source
+func uninstallService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager (run as administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+	if err := eventlog.Remove(name); err != nil {
+		log.Printf("Warning: failed to remove event log source: %v", err)
+	}
+
+	fmt.Printf("Uninstalled service %s\n", name)
+	return nil
+}
+
+// startService asks the service manager to start the service
+func startService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("failed to start service: %w", err)
+	}
+
+	fmt.Printf("Started service %s\n", name)
+	return nil
+}
+
+// stopService asks the service to stop and waits until it has
+func stopService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return fmt.Errorf("failed to stop service: %w", err)
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the service to stop")
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return fmt.Errorf("failed to query service: %w", err)
+		}
+	}
+
+	fmt.Printf("Stopped service %s\n", name)
+	return nil
+}
+
+// runAsService runs the scheduler under the service manager, which starts
+// the process with the arguments given at install time
+func runAsService(name, configPath string, scheduleArgs []string) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return errors.New("service run is started by the service manager; use the schedule command to run interactively")
+	}
+
+	// Relative paths in the config are relative to the config file, since
+	// services start in the system directory
+	if err := os.Chdir(filepath.Dir(configPath)); err != nil {
+		return apperr.Wrap(apperr.KindConfig, err)
+	}
+
+	// Services have no console
+	elog, err := logsink.OpenEventLog(name)
+	if err != nil {
+		return err
+	}
+	defer elog.Close()
+	log.SetFlags(0)
+	log.SetOutput(elog)
+
+	args := append([]string{"-config", configPath}, scheduleArgs...)
+	return svc.Run(name, &serviceHandler{args: args})
+}
+
+// serviceHandler runs the scheduler until the service manager stops it
+type serviceHandler struct {
+	args []string
+}
+
+// Execute implements svc.Handler
+func (h *serviceHandler) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	stop, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		schedule(stop, h.args)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-done:
+			// The scheduler exits on its own only after a fatal error,
+			// which already ended the process
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
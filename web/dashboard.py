@@ -1,17 +1,26 @@
 import streamlit as st
 import pandas as pd
+import altair as alt
+import base64
+import hashlib
+import hmac
+import json
 import os
+import sys
 import yaml
 from pathlib import Path
 
 
 def load_config():
-    """Load configuration from config.yaml"""
+    """Load configuration from config.yaml, or from the path given after --
+    as started by gommutetime dashboard"""
     config_paths = [
         "/app/config.yaml",  # Docker path
         "../config.yaml",    # Relative path for local development
         "config.yaml",       # Current directory
     ]
+    if len(sys.argv) > 1:
+        config_paths = [sys.argv[1]]
 
     for config_path in config_paths:
         if os.path.exists(config_path):
@@ -21,6 +30,85 @@ def load_config():
     return None
 
 
+def b64decode(value):
+    """Decode unpadded base64, as written by gommutetime hash-password"""
+    return base64.b64decode(value + "=" * (-len(value) % 4))
+
+
+# A valid hash matching no password, with the iterations of hash-password
+DUMMY_HASH = "pbkdf2-sha256$600000$" + "A" * 22 + "$" + "A" * 43
+
+
+def verify_password(password_hash, password):
+    """Check a password against a pbkdf2-sha256$<iterations>$<salt>$<key> hash"""
+    try:
+        scheme, iterations, salt, key = password_hash.split("$")
+        if scheme != "pbkdf2-sha256":
+            return False
+        key = b64decode(key)
+        derived = hashlib.pbkdf2_hmac("sha256", password.encode(), b64decode(salt), int(iterations), len(key))
+    except (ValueError, TypeError):
+        return False
+    return hmac.compare_digest(derived, key)
+
+
+def login(config):
+    """Require a dashboard login when users or an OIDC provider are
+    configured, returning the logged in user, or None when the dashboard is
+    open"""
+    users = ((config or {}).get('dashboard') or {}).get('users') or []
+    oidc = (config or {}).get('oidc') or {}
+    if not users and not oidc.get('issuer'):
+        return None
+
+    # Logged in through the OIDC provider set up in .streamlit/secrets.toml
+    if oidc.get('issuer') and st.user.is_logged_in:
+        username = st.user.get(oidc.get('username_claim') or 'preferred_username')
+        with st.sidebar:
+            st.caption(f"Logged in as **{username}**")
+            st.button("Log out", on_click=st.logout)
+        if not users:
+            return {'username': username}
+        user = next((u for u in users if u.get('username') == username), None)
+        if user:
+            return user
+        st.error(f"{username} has no access to this dashboard")
+        st.stop()
+
+    if "user" in st.session_state:
+        user = next((u for u in users if u.get('username') == st.session_state["user"]), None)
+        if user:
+            with st.sidebar:
+                st.caption(f"Logged in as **{user['username']}**")
+                if st.button("Log out"):
+                    del st.session_state["user"]
+                    st.rerun()
+            return user
+
+    if oidc.get('issuer'):
+        st.button("Log in with single sign-on", on_click=st.login)
+
+    # Users without a password can only log in through the provider
+    if not any(u.get('password_hash') for u in users):
+        st.stop()
+
+    with st.form("login"):
+        username = st.text_input("Username")
+        password = st.text_input("Password", type="password")
+        submitted = st.form_submit_button("Log in")
+
+    if submitted:
+        # Unknown users are checked against a dummy hash, so that response
+        # times do not tell which usernames exist
+        user = next((u for u in users if u.get('username') == username and u.get('password_hash')), None)
+        password_hash = user['password_hash'] if user else DUMMY_HASH
+        if verify_password(password_hash, password) and user:
+            st.session_state["user"] = username
+            st.rerun()
+        st.error("Invalid username or password")
+    st.stop()
+
+
 def get_itinerary_metadata():
     """Load itinerary metadata from config.yaml"""
     config = load_config()
@@ -36,17 +124,43 @@ def get_itinerary_metadata():
             'name': itin.get('name', 'Unnamed Itinerary'),
             'from': itin.get('from', 'Unknown'),
             'to': itin.get('to', 'Unknown'),
+            'matrix': itin.get('type') == 'matrix',
+            'tags': itin.get('tags') or [],
+            'profile': itin.get('profile'),
+            'via': itin.get('via'),
         }
+        # Names of the legs recorded for park-and-ride and carpool itineraries
+        if itin.get('type') == 'park_and_ride':
+            metadata[output_file]['legs'] = ["drive", "transit"]
+        elif itin.get('type') == 'carpool':
+            stops = [stop.get('label', '?') for stop in itin.get('stops') or []]
+            metadata[output_file]['legs'] = [f"to {stop}" for stop in stops] + ["to destination"]
+            metadata[output_file]['via'] = " → ".join(stops)
+        if metadata[output_file]['matrix']:
+            metadata[output_file]['from'] = ", ".join(p.get('label', '?') for p in itin.get('origins', []))
+            metadata[output_file]['to'] = ", ".join(p.get('label', '?') for p in itin.get('destinations', []))
 
     return metadata
 
 
+# Output file columns; older rows have fewer and the rest are left empty.
+# origin and destination are only set for matrix itineraries, and legs (leg
+# durations separated by semicolons) for park-and-ride and carpool ones, and
+# direct (the trip without stops) for carpool ones fetching it.
+COLUMNS = ["datetime", "commute_time", "latency_ms", "http_status", "status", "provider",
+           "origin", "destination", "schedule", "tags", "elements", "cost", "legs", "direct"]
+
+
 def load_commute_time(file):
-    df = pd.read_csv(file, names=["datetime", "commute_time"])
+    df = pd.read_csv(file, names=COLUMNS, usecols=["datetime", "commute_time", "provider", "origin", "destination",
+                                                 "schedule", "tags", "legs", "direct"],
+                     dtype={"provider": str, "origin": str, "destination": str, "schedule": str, "tags": str,
+                            "legs": str})
     df_dt = pd.to_datetime(df["datetime"], utc=True)
     df_dt = df_dt.dt.tz_convert("US/Eastern")
 
     df = df[df_dt.dt.minute.isin([0, 30])]
+    df["date"] = df_dt.dt.strftime("%Y-%m-%d")
     df["hour_min"] = df_dt.dt.strftime("%H:%M")
     df_weekday_nbr = df_dt.dt.weekday + 1
     df_weekday_name = df_dt.dt.day_name()
@@ -66,13 +180,177 @@ def get_average_commute_time_daywise(df: pd.DataFrame):
     return avg_time_daywise
 
 
+def load_annotations(itin_id):
+    """Load the annotations affecting an itinerary, recorded with the
+    annotation command or the API"""
+    path = "data/annotations.json"
+    if not os.path.exists(path):
+        return []
+    with open(path) as f:
+        annotations = json.load(f) or []
+    return [a for a in annotations if not a.get('itineraries') or itin_id in a['itineraries']]
+
+
+def annotated(dates, annotations):
+    """Tell which of a series of YYYY-MM-DD dates fall on annotated days"""
+    mask = pd.Series(False, index=dates.index)
+    for a in annotations:
+        covered = dates >= a['from']
+        if a.get('to'):
+            covered &= dates <= a['to']
+        mask |= covered
+    return mask
+
+
+def display_daily_average(df, annotations):
+    """Display the average commute time of each day, shading the days of
+    annotated events"""
+    daily = df.groupby("date")["commute_time"].mean().reset_index()
+    daily["date"] = pd.to_datetime(daily["date"])
+    chart = alt.Chart(daily).mark_line(point=True).encode(
+        x=alt.X("date:T", title="Day"),
+        y=alt.Y("commute_time:Q", title="Average commute time (min)"),
+        tooltip=[alt.Tooltip("date:T"), alt.Tooltip("commute_time:Q", format=".1f")],
+    )
+
+    # Ongoing events are shaded up to the last day with samples
+    first, last = daily["date"].min(), daily["date"].max()
+    spans = pd.DataFrame([{
+        "from": pd.to_datetime(a['from']),
+        "to": pd.to_datetime(a.get('to') or last) + pd.Timedelta(days=1),
+        "label": a['label'],
+    } for a in annotations], columns=["from", "to", "label"])
+    spans = spans[(spans["to"] > first) & (spans["from"] <= last)]
+    if len(spans) > 0:
+        bands = alt.Chart(spans).mark_rect(opacity=0.2).encode(
+            x="from:T",
+            x2="to:T",
+            color=alt.Color("label:N", title="Annotation"),
+            tooltip=["label:N", "from:T", "to:T"],
+        )
+        chart = bands + chart
+    st.altair_chart(chart, use_container_width=True)
+
+
+def load_actual_trips(file):
+    df = pd.read_csv(file, names=["datetime", "actual", "predicted", "prediction_time", "source"])
+    df["datetime"] = pd.to_datetime(df["datetime"], utc=True).dt.tz_convert("US/Eastern")
+    df["difference"] = df["actual"] - df["predicted"]
+    return df
+
+
+def display_actual_trips(csv_file):
+    """Display actual trips compared with predictions, if any were imported"""
+    file_path = f"data/{csv_file.replace('.csv', '')}.actual.csv"
+    if not os.path.exists(file_path):
+        return
+
+    df = load_actual_trips(file_path)
+    if len(df) == 0:
+        return
+
+    st.markdown("#### Actual vs. predicted")
+    col1, col2 = st.columns(2)
+    with col1:
+        st.metric("Trips", len(df))
+    with col2:
+        st.metric("Average difference", f"{df['difference'].mean():+.1f} min",
+                  help="Positive when actual trips take longer than predicted")
+    st.scatter_chart(
+        df,
+        x="predicted",
+        y="actual",
+        x_label="Predicted commute time (min)",
+        y_label="Actual commute time (min)",
+    )
+
+
+# Currencies of the built-in pricing of providers, as in cost-estimate
+BUILTIN_CURRENCIES = {"google": "USD", "azure": "USD"}
+
+
+def load_usage(csv_files):
+    """Load the provider, elements and cost recorded with each sample, one
+    request per distinct time and provider of an itinerary like the rows of a
+    matrix fetch"""
+    frames = []
+    for csv_file in csv_files:
+        path = f"data/{csv_file}"
+        if not os.path.exists(path):
+            continue
+        df = pd.read_csv(path, names=COLUMNS, usecols=["datetime", "provider", "elements", "cost"],
+                         dtype={"datetime": str, "provider": str})
+        df["itinerary"] = csv_file
+        df["request"] = ~df[["datetime", "provider"]].duplicated()
+        frames.append(df)
+    if not frames:
+        return pd.DataFrame(columns=["datetime", "provider", "elements", "cost", "itinerary", "request", "date"])
+
+    df = pd.concat(frames, ignore_index=True)
+    df[["elements", "cost"]] = df[["elements", "cost"]].fillna(0)
+    # Days in the local time samples were recorded in
+    df["date"] = df["datetime"].str[:10]
+    return df
+
+
+@st.fragment(run_every="30s")
+def display_usage(csv_files, metadata, show_budget):
+    """Display the provider requests and estimated cost per day and per
+    itinerary, refreshed as samples are recorded. The budget covers every
+    itinerary, whichever are selected."""
+    config = load_config() or {}
+    df = load_usage(csv_files)
+    if len(df) == 0:
+        st.warning("No samples recorded yet.")
+        return
+
+    providers = df.loc[df["elements"] > 0, "provider"]
+    provider = providers.iloc[-1] if len(providers) else None
+    currency = ((config.get('pricing') or {}).get(provider) or {}).get('currency') \
+        or BUILTIN_CURRENCIES.get(provider, "")
+
+    month = pd.Timestamp.now().strftime("%Y-%m")
+    this_month = df[df["date"].str[:7] == month]
+
+    col1, col2, col3 = st.columns(3)
+    with col1:
+        st.metric("Requests this month", f"{int(this_month['request'].sum()):,}")
+    with col2:
+        st.metric("Elements this month", f"{int(this_month['elements'].sum()):,}")
+    with col3:
+        spent = this_month["cost"].sum()
+        budget = config.get('budget') or 0
+        if show_budget and budget:
+            everything = load_usage(get_all_csv_files())
+            spent = everything.loc[everything["date"].str[:7] == month, "cost"].sum()
+            st.metric("Remaining budget", f"{max(budget - spent, 0):.2f} {currency}",
+                      delta=f"{spent:.2f} {currency} spent", delta_color="inverse")
+        else:
+            st.metric("Cost this month", f"{spent:.2f} {currency}")
+
+    st.markdown("#### Requests per day")
+    daily = df.groupby("date").agg(requests=("request", "sum")).reset_index().tail(60)
+    st.bar_chart(daily, x="date", y="requests", x_label="Day", y_label="Requests")
+
+    st.markdown("#### Cost per itinerary")
+    per_itin = df.groupby("itinerary").agg(
+        requests=("request", "sum"), elements=("elements", "sum"), cost=("cost", "sum")).reset_index()
+    per_itin["itinerary"] = [metadata.get(f, {}).get('name', f.replace('.csv', '')) for f in per_itin["itinerary"]]
+    st.dataframe(per_itin.sort_values("cost", ascending=False), hide_index=True, use_container_width=True)
+    st.caption(f"Cumulative since the first sample, at {currency or 'no'} list prices without free elements. "
+               "Samples recorded before costs were tracked count no elements.")
+
+
 def get_all_csv_files():
     """Get all CSV files from the data directory"""
     data_dir = "data"
     if not os.path.exists(data_dir):
         return []
 
-    csv_files = [f for f in os.listdir(data_dir) if f.endswith('.csv')]
+    # Actual trip comparisons are shown with their itinerary, and rollups
+    # and aggregate series are not samples
+    csv_files = [f for f in os.listdir(data_dir)
+                 if f.endswith('.csv') and not f.endswith(('.actual.csv', '.rollup.csv', '.hourly.csv', '.daily.csv'))]
     return csv_files
 
 
@@ -115,6 +393,8 @@ def display_itinerary(csv_file, metadata):
         st.caption(f"**From:** {file_metadata['from']}")
     with col2:
         st.caption(f"**To:** {file_metadata['to']}")
+    if file_metadata.get('via'):
+        st.caption(f"**Via:** {file_metadata['via']}")
 
     st.divider()
 
@@ -122,6 +402,53 @@ def display_itinerary(csv_file, metadata):
     try:
         df = load_commute_time(file_path)
 
+        # Matrix itineraries show one origin/destination pair at a time
+        if file_metadata.get('matrix', False) and len(df) > 0:
+            pairs = sorted((df["origin"] + " → " + df["destination"]).unique())
+            pair = st.selectbox("Route", pairs, key=f"pair-{csv_file}")
+            df = df[df["origin"] + " → " + df["destination"] == pair]
+
+        # Itineraries fetched from several providers show one at a time
+        providers = df["provider"].dropna().unique()
+        if len(providers) > 1:
+            provider = st.selectbox("Provider", providers, key=f"provider-{csv_file}")
+            df = df[df["provider"] == provider]
+
+        # Samples can be narrowed down to the schedules that took them
+        schedules = sorted(df["schedule"].dropna().unique())
+        if len(schedules) > 1:
+            selected = st.multiselect("Schedules", schedules, default=schedules, key=f"schedules-{csv_file}")
+            df = df[df["schedule"].isin(selected) | df["schedule"].isna()]
+
+        # Itineraries with a school calendar show term time or vacations
+        tags = df["tags"].fillna("").str.split(";")
+        term, vacation = tags.apply(lambda t: "term" in t), tags.apply(lambda t: "vacation" in t)
+        if vacation.any() and term.any():
+            season = st.radio("School calendar", ["All days", "Term time", "Vacations"], horizontal=True,
+                              key=f"season-{csv_file}")
+            if season == "Term time":
+                df = df[term]
+            elif season == "Vacations":
+                df = df[vacation]
+
+        # Samples located at the origin show commutes in daylight or in the dark
+        tags = df["tags"].fillna("").str.split(";")
+        daylight, dark = tags.apply(lambda t: "daylight" in t), tags.apply(lambda t: "dark" in t)
+        if daylight.any() and dark.any():
+            light = st.radio("Daylight", ["All samples", "Daylight", "Dark"], horizontal=True,
+                             key=f"daylight-{csv_file}")
+            if light == "Daylight":
+                df = df[daylight]
+            elif light == "Dark":
+                df = df[dark]
+
+        # Days of annotated events, e.g. a bridge closure, can be left out
+        annotations = load_annotations(file_metadata['id'])
+        if annotations:
+            covered = annotated(df["date"], annotations)
+            if st.checkbox(f"Leave out annotated days ({covered.sum()} samples)", key=f"annotated-{csv_file}"):
+                df = df[~covered]
+
         if len(df) == 0:
             st.warning("No data available for this itinerary yet.")
             return
@@ -148,6 +475,22 @@ def display_itinerary(csv_file, metadata):
         with col3:
             st.metric("Max", f"{df['commute_time'].max():.1f} min")
 
+        # Itineraries with legs also show the average of each leg
+        legs = df["legs"].dropna()
+        names = file_metadata.get('legs') or []
+        if len(legs) > 0 and names:
+            legs = legs.str.split(";", expand=True).astype(float)
+            for column, i, name in zip(st.columns(len(names)), legs.columns, names):
+                with column:
+                    st.metric(f"Average {name}", f"{legs[i].mean():.1f} min")
+
+        # Carpool itineraries fetching the direct trip show what the stops cost
+        direct = df.dropna(subset=["direct"])
+        if len(direct) > 0:
+            detour = direct["commute_time"] - direct["direct"]
+            st.metric("Stops vs. direct trip", f"+{detour.mean():.1f} min",
+                      help=f"Average over {len(direct)} samples of the direct trip: {direct['direct'].mean():.1f} min")
+
         # Day-wise breakdown
         st.markdown("#### Day-wise average commute time")
         adf = get_average_commute_time_daywise(df)
@@ -161,6 +504,12 @@ def display_itinerary(csv_file, metadata):
             color="weekday",
         )
 
+        # Day-by-day averages, with the days of annotated events
+        st.markdown("#### Daily average commute time")
+        display_daily_average(df, annotations)
+
+        display_actual_trips(csv_file)
+
         # Show raw data option
         with st.expander(f"📊 Show raw data ({len(df)} records)"):
             st.dataframe(df, use_container_width=True)
@@ -181,6 +530,9 @@ if __name__ == "__main__":
 
     st.title("🚗 Commute Time Dashboard")
 
+    # Users only see the itineraries of their profiles
+    user = login(load_config())
+
     # Load metadata from config
     metadata = get_itinerary_metadata()
 
@@ -193,6 +545,31 @@ if __name__ == "__main__":
     # Get all CSV files and order them by itinerary ID
     csv_files = get_all_csv_files()
     csv_files = order_csv_files_by_config(csv_files, metadata)
+    if user and user.get('profiles'):
+        csv_files = [f for f in csv_files if metadata.get(f, {}).get('profile') in user['profiles']]
+
+    # Each profile gets its own view, bookmarkable as ?profile=<name>
+    profiles = [p.get('name') for p in (load_config() or {}).get('profiles') or []]
+    if user and user.get('profiles'):
+        profiles = [p for p in profiles if p in user['profiles']]
+    if profiles:
+        options = ["Everyone"] + profiles
+        current = st.query_params.get("profile")
+        profile = st.sidebar.selectbox("Profile", options,
+                                       index=options.index(current) if current in options else 0)
+        if profile == "Everyone":
+            st.query_params.pop("profile", None)
+        else:
+            st.query_params["profile"] = profile
+            csv_files = [f for f in csv_files if metadata.get(f, {}).get('profile') == profile]
+
+    # Narrow the tabs down to itineraries with the selected tags
+    all_tags = sorted({tag for meta in metadata.values() for tag in meta['tags']})
+    if all_tags:
+        selected_tags = st.sidebar.multiselect("Tags", all_tags)
+        if selected_tags:
+            csv_files = [f for f in csv_files
+                         if set(metadata.get(f, {}).get('tags', [])) & set(selected_tags)]
 
     if not csv_files:
         st.error("No data files found in the data directory.")
@@ -205,8 +582,14 @@ if __name__ == "__main__":
         label = file_meta.get('name', csv_file.replace('.csv', ''))
         tab_labels.append(label)
 
+    tab_labels.append("💸 API usage")
+
     tabs = st.tabs(tab_labels)
 
     for i, csv_file in enumerate(csv_files):
         with tabs[i]:
             display_itinerary(csv_file, metadata)
+
+    # The budget covers every itinerary, so only users who see them all get it
+    with tabs[-1]:
+        display_usage(csv_files, metadata, not (user and user.get('profiles')))